@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/EastArctica/racelogic-ref-to-dbc/refdbc"
+)
+
+// batch holds the settings shared by the conversions of every input file.
+type batch struct {
+	opts       refdbc.Options
+	cfg        config
+	configPath string
+	outDir     string
+	reverse    bool
+	preamble   refdbc.RefPreamble
+}
+
+// conversion is the conversion of one input file.
+type conversion struct {
+	input   inputFile
+	output  string // Path the output is written to
+	clashed string // Output path of an earlier input that output was renamed from, if any
+
+	stats  refdbc.FileStats
+	failed bool
+
+	// The log events, -dump-raw text, -dump-trailing bytes and -name-report
+	// rows of a file converted alongside others, written out once it is done.
+	log      *refdbc.Logger
+	dump     bytes.Buffer
+	trailing bytes.Buffer
+	report   bytes.Buffer
+}
+
+// plan works out where each input is written: to single (-o) if it is the only
+// input, to the output its config file section gives, to stdout for stdin, or
+// next to the input or under -outdir with the extension ext. Computed paths
+// another input already uses get a _2, _3... suffix.
+func (b *batch) plan(inputs []inputFile, single, ext string) []*conversion {
+	used := make(map[string]bool)
+	conversions := make([]*conversion, len(inputs))
+	for i, input := range inputs {
+		c := &conversion{input: input}
+		// A broken config section is reported when the file is converted.
+		settings, _ := fileSettings(b.cfg.Files, input.Path)
+		switch {
+		case len(inputs) == 1 && single != "":
+			c.output = single
+		case settings["output"] != "":
+			c.output = settings["output"]
+		case input.Path == refdbc.StdioPath:
+			c.output = refdbc.StdioPath
+		default:
+			c.output = outputPath(input, b.outDir, ext)
+			if unique := uniqueOutputPath(c.output, used); unique != c.output {
+				c.clashed, c.output = c.output, unique
+			}
+		}
+		conversions[i] = c
+	}
+	return conversions
+}
+
+// convertAll converts the inputs, up to jobs at the same time, and calls done
+// with each conversion in input order once it has finished. Once done returns
+// false no more conversions are started, though those already running finish.
+//
+// With more than one job every file logs to a Buffered logger, flushed before
+// done is called, so the events of each file stay together.
+func (b *batch) convertAll(conversions []*conversion, jobs int, done func(*conversion) bool) {
+	if jobs <= 1 {
+		for _, c := range conversions {
+			b.convert(c, b.opts)
+			if !done(c) {
+				return
+			}
+		}
+		return
+	}
+
+	finished := make([]chan struct{}, len(conversions))
+	for i := range finished {
+		finished[i] = make(chan struct{})
+	}
+	var stopped atomic.Bool
+	queue := make(chan int)
+	for w := 0; w < jobs; w++ {
+		go func() {
+			for i := range queue {
+				if !stopped.Load() {
+					b.convertBuffered(conversions[i])
+				}
+				close(finished[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range conversions {
+			queue <- i
+		}
+		close(queue)
+	}()
+
+	// Wait for every conversion, even after stopping, so no output file is
+	// left half-written when the program exits.
+	for i, c := range conversions {
+		<-finished[i]
+		if stopped.Load() {
+			continue
+		}
+		b.flush(c)
+		if !done(c) {
+			stopped.Store(true)
+		}
+	}
+}
+
+// convertBuffered converts c with its own logger and buffers, so it can run
+// alongside other conversions.
+func (b *batch) convertBuffered(c *conversion) {
+	opts := b.opts
+	c.log = opts.Log.Buffered()
+	opts.Log = c.log
+	if opts.DumpRaw != nil {
+		opts.DumpRaw = &c.dump
+	}
+	if opts.DumpTrailing != nil {
+		opts.DumpTrailing = &c.trailing
+	}
+	if opts.NameReport != nil {
+		opts.NameReport = &c.report
+	}
+	b.convert(c, opts)
+}
+
+// flush writes out what convertBuffered held back for c.
+func (b *batch) flush(c *conversion) {
+	if c.log == nil {
+		return
+	}
+	c.log.Flush()
+	if b.opts.DumpRaw != nil {
+		b.opts.DumpRaw.Write(c.dump.Bytes())
+	}
+	if b.opts.DumpTrailing != nil {
+		b.opts.DumpTrailing.Write(c.trailing.Bytes())
+	}
+	if b.opts.NameReport != nil {
+		b.opts.NameReport.Write(c.report.Bytes())
+	}
+}
+
+// convert converts the input of c with opts, after applying the settings of
+// its config file section, and records the outcome in c.
+func (b *batch) convert(c *conversion, opts refdbc.Options) {
+	log := opts.Log
+	log.StartFile(c.input.Path)
+	log.Infof("--- Processing file: %s ---", c.input.Path)
+
+	// Apply the config file's settings for this input, if any.
+	settings, err := fileSettings(b.cfg.Files, c.input.Path)
+	if err == nil && settings != nil {
+		log.Debugf("applying the settings for this file from %s", b.configPath)
+		opts, _, err = applyFileSettings(opts, settings, log)
+	}
+	if err != nil {
+		log.Errorf("config file %s: %v", b.configPath, err)
+		c.failed = true
+		return
+	}
+
+	if c.clashed != "" {
+		log.Warnf("%s is already written by an earlier input; writing %s instead.", c.clashed, c.output)
+	}
+	log.Infof("Output will be written to: %s", c.output)
+	if b.outDir != "" {
+		if err := os.MkdirAll(filepath.Dir(c.output), 0o755); err != nil {
+			log.Errorf("creating output directory for %s: %v", c.input.Path, err)
+			c.failed = true
+			return
+		}
+	}
+
+	if b.reverse {
+		c.stats, err = refdbc.ConvertDBCFile(c.input.Path, c.output, b.preamble, opts)
+	} else {
+		c.stats, err = refdbc.ConvertFile(c.input.Path, c.output, opts)
+	}
+	if err != nil {
+		log.Errorf("processing %s: %v", c.input.Path, err)
+		c.failed = true
+		return
+	}
+	log.Infof("Wrote %d messages and %d signals in %v (%d lines skipped, %d repeated lines, %d warnings).",
+		c.stats.Messages, c.stats.Signals, c.stats.Elapsed.Round(time.Microsecond), c.stats.SkippedLines, c.stats.Duplicates, c.stats.Warnings)
+}
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/EastArctica/racelogic-ref-to-dbc/refdbc"
+)
+
+// configBaseName is the file name (without extension) searched for when no -config flag is given.
+const configBaseName = "racelogic-ref-to-dbc"
+
+// configOnlyFlags are flags that control configuration loading itself, or only
+// print information, and therefore cannot be set from within a configuration file.
+var configOnlyFlags = map[string]bool{
+	"config":       true,
+	"print-config": true,
+	"version":      true,
+}
+
+// flagAliases maps each alias flag to the flag it shares a value with, so a
+// setting given under either name counts as given under both.
+var flagAliases = map[string]string{
+	"q":                   "quiet",
+	"v":                   "verbose",
+	"ci":                  "no-pause",
+	"msg-name-template":   "name-template",
+	"startbit-convention": "bit-convention",
+	"derive-range":        "auto-range",
+}
+
+// canonicalFlag returns the flag an alias stands for, or name if it isn't one.
+func canonicalFlag(name string) string {
+	if canonical, ok := flagAliases[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// explicitFlags returns the canonical names of the flags set so far in fs.
+func explicitFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[canonicalFlag(f.Name)] = true })
+	return set
+}
+
+// configExtensions lists the configuration file types, in the order they are searched for.
+var configExtensions = []string{".toml", ".json", ".yaml", ".yml"}
+
+// fileConfigKeys are the settings a per-file section of the configuration file
+// may change. output is the output path; the others are named after their flags.
+var fileConfigKeys = []string{"name-template", "node", "output", "overrides", "rename", "sig-prefix", "sig-suffix"}
+
+// config is the content of a configuration file.
+type config struct {
+	Values map[string]string            // Flag values, keyed by flag name
+	Files  map[string]map[string]string // Per-file settings, keyed by input path or glob pattern
+}
+
+// findConfigFile returns the configuration file to load. An explicit path is
+// always used as-is; otherwise the current directory and then the directory of
+// the executable are searched for racelogic-ref-to-dbc.toml, .json, .yaml or .yml.
+// An empty path with a nil error means no configuration file was found.
+// The returned path is set even on error so it can be reported to the user.
+func findConfigFile(explicit string) (string, error) {
+	if explicit != "" {
+		if _, err := os.Stat(explicit); err != nil {
+			return explicit, fmt.Errorf("cannot access config file: %w", err)
+		}
+		return explicit, nil
+	}
+
+	dirs := []string{"."}
+	if exe, err := os.Executable(); err == nil {
+		dirs = append(dirs, filepath.Dir(exe))
+	}
+	for _, dir := range dirs {
+		for _, ext := range configExtensions {
+			candidate := filepath.Join(dir, configBaseName+ext)
+			if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+				return candidate, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// loadConfigFile reads a .toml, .json, .yaml or .yml configuration file.
+func loadConfigFile(path string) (config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var cfg config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		cfg, err = parseJSONConfig(data)
+	case ".toml":
+		cfg, err = parseTOMLConfig(bytes.NewReader(data))
+	case ".yaml", ".yml":
+		cfg, err = parseYAMLConfig(data)
+	default:
+		return config{}, fmt.Errorf("unsupported config file type '%s' (expected .toml, .json, .yaml or .yml)", filepath.Ext(path))
+	}
+	if err != nil {
+		return config{}, err
+	}
+	return cfg, validateFileConfig(cfg.Files)
+}
+
+// parseJSONConfig decodes a JSON object whose values are strings, numbers or
+// booleans, except for "files", an object of per-file objects of the same kind.
+func parseJSONConfig(data []byte) (config, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return config{}, fmt.Errorf("invalid JSON config: %w", err)
+	}
+	return configFromMap(raw)
+}
+
+// parseYAMLConfig decodes a YAML mapping with the same structure as a JSON config.
+func parseYAMLConfig(data []byte) (config, error) {
+	raw, err := refdbc.ParseYAML(data)
+	if err != nil {
+		return config{}, fmt.Errorf("invalid YAML config: %w", err)
+	}
+	return configFromMap(raw)
+}
+
+// configFromMap converts a decoded JSON or YAML config document.
+func configFromMap(raw map[string]interface{}) (config, error) {
+	cfg := config{Values: make(map[string]string, len(raw))}
+	for key, value := range raw {
+		if key == "files" {
+			files, ok := value.(map[string]interface{})
+			if !ok {
+				return config{}, fmt.Errorf("config key 'files' must map input files to their settings")
+			}
+			cfg.Files = make(map[string]map[string]string, len(files))
+			for pattern, section := range files {
+				settings, ok := section.(map[string]interface{})
+				if !ok {
+					return config{}, fmt.Errorf("settings for file '%s' must be an object", pattern)
+				}
+				values, err := configValues(settings, fmt.Sprintf("files.%s.", pattern))
+				if err != nil {
+					return config{}, err
+				}
+				cfg.Files[pattern] = values
+			}
+			continue
+		}
+		values, err := configValues(map[string]interface{}{key: value}, "")
+		if err != nil {
+			return config{}, err
+		}
+		cfg.Values[key] = values[key]
+	}
+	return cfg, nil
+}
+
+// configValues converts scalar config values to strings. prefix is added to
+// the key named in errors.
+func configValues(raw map[string]interface{}, prefix string) (map[string]string, error) {
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			values[key] = v
+		case bool:
+			values[key] = strconv.FormatBool(v)
+		case float64:
+			values[key] = strconv.FormatFloat(v, 'g', -1, 64)
+		default:
+			return nil, fmt.Errorf("config key '%s%s' must be a string, number or boolean", prefix, key)
+		}
+	}
+	return values, nil
+}
+
+// parseTOMLConfig decodes the subset of TOML needed for flag values:
+// `key = value` pairs where the value is a quoted string, number or boolean.
+// An unquoted string is an error, as in TOML.
+// Per-file settings go in `[files."<pattern>"]` tables. Blank lines and
+// # comments are ignored; other tables and arrays are not supported.
+func parseTOMLConfig(r io.Reader) (config, error) {
+	cfg := config{Values: make(map[string]string)}
+	values := cfg.Values
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			pattern, err := parseTOMLFileTable(line)
+			if err != nil {
+				return config{}, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			if cfg.Files == nil {
+				cfg.Files = make(map[string]map[string]string)
+			}
+			if _, ok := cfg.Files[pattern]; ok {
+				return config{}, fmt.Errorf("line %d: settings for file '%s' are already defined", lineNum, pattern)
+			}
+			values = make(map[string]string)
+			cfg.Files[pattern] = values
+			continue
+		}
+
+		key, rawValue, found := strings.Cut(line, "=")
+		if !found {
+			return config{}, fmt.Errorf("line %d: expected 'key = value'", lineNum)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		value, err := parseTOMLValue(strings.TrimSpace(rawValue))
+		if err != nil {
+			return config{}, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return config{}, err
+	}
+	return cfg, nil
+}
+
+// parseTOMLFileTable returns the pattern of a `[files."<pattern>"]` table header.
+func parseTOMLFileTable(line string) (string, error) {
+	name, ok := strings.CutSuffix(strings.TrimPrefix(line, "["), "]")
+	if !ok || strings.HasPrefix(name, "[") {
+		return "", fmt.Errorf("only [files.\"<pattern>\"] tables are supported in the config file")
+	}
+	rest, ok := strings.CutPrefix(strings.TrimSpace(name), "files.")
+	if !ok {
+		return "", fmt.Errorf("only [files.\"<pattern>\"] tables are supported in the config file")
+	}
+	rest = strings.TrimSpace(rest)
+	if !strings.HasPrefix(rest, `"`) && !strings.HasPrefix(rest, "'") {
+		return rest, nil
+	}
+	return parseTOMLValue(rest)
+}
+
+// parseTOMLValue converts a single TOML scalar to its string form, dropping any trailing comment.
+func parseTOMLValue(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		// Basic string: find the closing quote, honouring escapes.
+		for i := 1; i < len(raw); i++ {
+			if raw[i] == '\\' {
+				i++
+				continue
+			}
+			if raw[i] == '"' {
+				if rest := strings.TrimSpace(raw[i+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+					return "", fmt.Errorf("unexpected text after string: %s", rest)
+				}
+				return strconv.Unquote(raw[:i+1])
+			}
+		}
+		return "", fmt.Errorf("unterminated string: %s", raw)
+	case strings.HasPrefix(raw, "'"):
+		// Literal string: no escapes.
+		end := strings.Index(raw[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string: %s", raw)
+		}
+		return raw[1 : end+1], nil
+	default:
+		if i := strings.Index(raw, "#"); i >= 0 {
+			raw = strings.TrimSpace(raw[:i])
+		}
+		if raw == "" {
+			return "", fmt.Errorf("missing value")
+		}
+		if !isTOMLBareValue(raw) {
+			return "", fmt.Errorf("string value %s must be quoted, as in \"%s\"", raw, raw)
+		}
+		return raw, nil
+	}
+}
+
+// isTOMLBareValue reports whether raw is a value TOML allows without quotes:
+// a boolean or a number.
+func isTOMLBareValue(raw string) bool {
+	if raw == "true" || raw == "false" {
+		return true
+	}
+	number := strings.ReplaceAll(raw, "_", "")
+	if _, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return true
+	}
+	_, err := strconv.ParseFloat(number, 64)
+	return err == nil
+}
+
+// validateFileConfig checks that per-file sections only use fileConfigKeys.
+func validateFileConfig(files map[string]map[string]string) error {
+	for _, pattern := range sortedPatterns(files) {
+		for key := range files[pattern] {
+			found := false
+			for _, allowed := range fileConfigKeys {
+				found = found || key == allowed
+			}
+			if !found {
+				return fmt.Errorf("unknown key '%s' in the settings for file '%s'; valid options are: %s", key, pattern, strings.Join(fileConfigKeys, ", "))
+			}
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid file pattern '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// fileSettings returns the per-file settings for input, or nil if no section
+// matches it. A section matches when its key is the input path, or a glob
+// pattern matching the path or its base name. More than one matching section
+// is an error, since which one wins would be unclear.
+func fileSettings(files map[string]map[string]string, input string) (map[string]string, error) {
+	var matched []string
+	for _, pattern := range sortedPatterns(files) {
+		if filepath.Clean(pattern) == filepath.Clean(input) {
+			matched = append(matched, pattern)
+			continue
+		}
+		inPath, _ := filepath.Match(pattern, input)
+		inBase, _ := filepath.Match(pattern, filepath.Base(input))
+		if inPath || inBase {
+			matched = append(matched, pattern)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return nil, nil
+	case 1:
+		return files[matched[0]], nil
+	}
+	return nil, fmt.Errorf("%s matches the settings of more than one file in the config file: %s", input, strings.Join(matched, ", "))
+}
+
+// applyFileSettings returns opts with the per-file settings applied, and the
+// output path they give, if any. The entries of a rename or overrides file
+// are merged over the ones given for all files: its rename rules are tried
+// first, and its entry for a message replaces the global one.
+func applyFileSettings(opts refdbc.Options, settings map[string]string, log *refdbc.Logger) (refdbc.Options, string, error) {
+	var output string
+	for _, key := range sortedKeys(settings) {
+		value := settings[key]
+		switch key {
+		case "output":
+			output = value
+		case "node":
+			if !refdbc.IsValidIdentifier(value) {
+				return opts, "", fmt.Errorf("node name '%s' is not a valid DBC identifier", value)
+			}
+			opts.Node = value
+		case "name-template":
+			tmpl, err := refdbc.ParseNameTemplate(value)
+			if err != nil {
+				return opts, "", fmt.Errorf("invalid name-template: %w", err)
+			}
+			opts.NameTemplate = tmpl
+		case "sig-prefix":
+			opts.SigPrefix = value
+		case "sig-suffix":
+			opts.SigSuffix = value
+		case "overrides":
+			overrides, err := refdbc.LoadOverrides(value, log)
+			if err != nil {
+				return opts, "", err
+			}
+			opts.Overrides = mergeOverrides(opts.Overrides, overrides)
+		case "rename":
+			var fileOpts refdbc.Options
+			if err := loadRenameFile(value, &fileOpts, log); err != nil {
+				return opts, "", err
+			}
+			opts.Overrides = mergeOverrides(opts.Overrides, fileOpts.Overrides)
+			opts.Renames = append(fileOpts.Renames, opts.Renames...)
+		}
+	}
+	return opts, output, nil
+}
+
+// mergeOverrides returns the overrides of base with those of file added, an
+// entry in file replacing the one in base for the same message. base itself,
+// which other inputs share, is left unchanged.
+func mergeOverrides(base, file map[uint32]*refdbc.MessageOverride) map[uint32]*refdbc.MessageOverride {
+	if len(file) == 0 {
+		return base
+	}
+	merged := make(map[uint32]*refdbc.MessageOverride, len(base)+len(file))
+	for id, override := range base {
+		merged[id] = override
+	}
+	for id, override := range file {
+		merged[id] = override
+	}
+	return merged
+}
+
+// loadRenameFile loads a -rename file: a YAML mapping sets opts.Overrides, and
+// any other file opts.Renames.
+func loadRenameFile(path string, opts *refdbc.Options, log *refdbc.Logger) error {
+	var err error
+	if refdbc.IsYAMLFile(path) {
+		opts.Overrides, err = refdbc.LoadOverrides(path, log)
+	} else {
+		opts.Renames, err = refdbc.LoadRenameRules(path)
+	}
+	return err
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedPatterns returns the patterns of the per-file sections in ascending order.
+func sortedPatterns(files map[string]map[string]string) []string {
+	patterns := make([]string, 0, len(files))
+	for pattern := range files {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+// applyConfig sets every flag named in values that was not already given on
+// the command line, under its own name or an alias, so command-line flags
+// always take precedence. Unknown keys are reported together with the list of
+// valid options.
+func applyConfig(fs *flag.FlagSet, values map[string]string) error {
+	setOnCommandLine := explicitFlags(fs)
+
+	for _, key := range sortedKeys(values) {
+		if fs.Lookup(key) == nil || configOnlyFlags[key] {
+			return fmt.Errorf("unknown config key '%s'; valid options are: %s", key, strings.Join(configKeys(fs), ", "))
+		}
+		if setOnCommandLine[canonicalFlag(key)] {
+			continue
+		}
+		if err := fs.Set(key, values[key]); err != nil {
+			return fmt.Errorf("invalid value for config key '%s': %w", key, err)
+		}
+	}
+	return nil
+}
+
+// applyCompat sets the flags a -compat profile needs, unless they were given
+// on the command line or in the config file, under their own name or an alias.
+func applyCompat(fs *flag.FlagSet, profile string) error {
+	setExplicitly := explicitFlags(fs)
+
+	settings := refdbc.CompatSettings(profile)
+	for _, key := range sortedKeys(settings) {
+		if setExplicitly[canonicalFlag(key)] {
+			continue
+		}
+		if err := fs.Set(key, settings[key]); err != nil {
+			return fmt.Errorf("-compat %s: %w", profile, err)
+		}
+	}
+	return nil
+}
+
+// configKeys returns the sorted names of all flags that may appear in a config file.
+func configKeys(fs *flag.FlagSet) []string {
+	var keys []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if !configOnlyFlags[f.Name] {
+			keys = append(keys, f.Name)
+		}
+	})
+	return keys
+}
+
+// printConfig writes the effective configuration, followed by the per-file
+// settings, as a TOML document that can itself be used as a config file.
+func printConfig(fs *flag.FlagSet, files map[string]map[string]string, source string, w io.Writer) {
+	if source != "" {
+		fmt.Fprintf(w, "# Effective configuration (config file: %s)\n", source)
+	} else {
+		fmt.Fprintln(w, "# Effective configuration (no config file found)")
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if configOnlyFlags[f.Name] {
+			return
+		}
+		value := f.Value.String()
+		if getter, ok := f.Value.(flag.Getter); ok {
+			switch getter.Get().(type) {
+			case bool, int, int64, uint, uint64, float64:
+				fmt.Fprintf(w, "%s = %s\n", f.Name, value)
+				return
+			}
+		}
+		fmt.Fprintf(w, "%s = %s\n", f.Name, strconv.Quote(value))
+	})
+	for _, pattern := range sortedPatterns(files) {
+		fmt.Fprintf(w, "\n[files.%s]\n", strconv.Quote(pattern))
+		for _, key := range sortedKeys(files[pattern]) {
+			fmt.Fprintf(w, "%s = %s\n", key, strconv.Quote(files[pattern][key]))
+		}
+	}
+}
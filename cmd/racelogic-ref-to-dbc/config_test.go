@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/EastArctica/racelogic-ref-to-dbc/refdbc"
+)
+
+// aliasFlagSet defines flags with aliases the way main does.
+func aliasFlagSet() (*flag.FlagSet, *bool, *string) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	var quiet bool
+	var nameTemplate string
+	fs.BoolVar(&quiet, "quiet", false, "")
+	fs.BoolVar(&quiet, "q", false, "")
+	fs.StringVar(&nameTemplate, "name-template", "CAN_MSG_{{.ID}}", "")
+	fs.StringVar(&nameTemplate, "msg-name-template", "CAN_MSG_{{.ID}}", "")
+	fs.String("line-endings", "lf", "")
+	fs.String("dbc-encoding", "utf-8", "")
+	fs.Int("max-name-length", 0, "")
+	return fs, &quiet, &nameTemplate
+}
+
+func TestApplyConfigAliases(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		values       map[string]string
+		quiet        bool
+		nameTemplate string
+	}{
+		{"alias on the command line", []string{"-q"}, map[string]string{"quiet": "false"}, true, "CAN_MSG_{{.ID}}"},
+		{"alias in the config file", []string{"-quiet"}, map[string]string{"q": "false"}, true, "CAN_MSG_{{.ID}}"},
+		{"alias of a string flag", []string{"-msg-name-template", "A_{{.ID}}"}, map[string]string{"name-template": "B_{{.ID}}"}, false, "A_{{.ID}}"},
+		{"canonical name of a string flag", []string{"-name-template", "A_{{.ID}}"}, map[string]string{"msg-name-template": "B_{{.ID}}"}, false, "A_{{.ID}}"},
+		{"not on the command line", nil, map[string]string{"q": "true", "msg-name-template": "B_{{.ID}}"}, true, "B_{{.ID}}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, quiet, nameTemplate := aliasFlagSet()
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfig(fs, tt.values); err != nil {
+				t.Fatal(err)
+			}
+			if *quiet != tt.quiet || *nameTemplate != tt.nameTemplate {
+				t.Errorf("quiet %t, name template %q; want %t, %q", *quiet, *nameTemplate, tt.quiet, tt.nameTemplate)
+			}
+		})
+	}
+}
+
+func TestApplyCompatKeepsExplicitFlags(t *testing.T) {
+	fs, _, _ := aliasFlagSet()
+	if err := fs.Parse([]string{"-line-endings", "lf"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(fs, map[string]string{"dbc-encoding": "utf-8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyCompat(fs, "candb"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"line-endings": "lf", "dbc-encoding": "utf-8", "max-name-length": "32"} {
+		if got := fs.Lookup(name).Value.String(); got != want {
+			t.Errorf("-%s = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestParseTOMLConfigValues(t *testing.T) {
+	cfg, err := parseTOMLConfig(strings.NewReader("node = \"VBOX\"\nquiet = true\nmin-group-size = 1_000\nfloat-digits = 6 # digits\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"node": "VBOX", "quiet": "true", "min-group-size": "1_000", "float-digits": "6"}
+	for key, value := range want {
+		if cfg.Values[key] != value {
+			t.Errorf("%s = %q, want %q", key, cfg.Values[key], value)
+		}
+	}
+
+	_, err = parseTOMLConfig(strings.NewReader("node = \"VBOX\"\nformat = dbc\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2: string value dbc must be quoted") {
+		t.Errorf("err = %v, want an unquoted string reported on line 2", err)
+	}
+}
+
+func TestApplyFileSettingsMergesRenames(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	globalRules, err := refdbc.LoadRenameRules(write("global.txt", "Speed=GlobalSpeed\nHeading=GlobalHeading\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	globalOverrides, err := refdbc.LoadOverrides(write("global.json", `{"256": {"name": "Global256"}, "512": {"name": "Global512"}}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := refdbc.DefaultOptions()
+	opts.Renames, opts.Overrides = globalRules, globalOverrides
+
+	settings := map[string]string{
+		"rename":    write("file.txt", "Speed=FileSpeed\n"),
+		"overrides": write("file.json", `{"512": {"name": "File512"}}`),
+	}
+	got, _, err := applyFileSettings(opts, settings, opts.Log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rules []string
+	for _, rule := range got.Renames {
+		rules = append(rules, rule.From+"="+rule.To)
+	}
+	if want := "Speed=FileSpeed Speed=GlobalSpeed Heading=GlobalHeading"; strings.Join(rules, " ") != want {
+		t.Errorf("rename rules %v, want %s", rules, want)
+	}
+	if len(got.Overrides) != 2 || *got.Overrides[256].Name != "Global256" || *got.Overrides[512].Name != "File512" {
+		t.Errorf("overrides not merged over the global ones: %v", got.Overrides)
+	}
+	if len(opts.Renames) != 2 || *opts.Overrides[512].Name != "Global512" {
+		t.Error("the settings for one file changed the global rename rules or overrides")
+	}
+}
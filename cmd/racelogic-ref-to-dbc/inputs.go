@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// inputFile is one file to convert, with its path relative to the directory
+// or glob it was found through, so the layout can be mirrored under -outdir.
+type inputFile struct {
+	Path string
+	Rel  string
+}
+
+// expandInputs turns the command-line inputs into the list of files to
+// convert. Files are used as given. Directories contribute the files directly
+// inside them whose extension is ext (ignoring case), or every such file in
+// the tree when recursive is set. Inputs containing *, ? or [ are glob
+// patterns, expanded here so they also work where the shell does not expand
+// them; a ** path element matches any number of directories.
+func expandInputs(args []string, ext string, recursive bool) ([]inputFile, error) {
+	var files []inputFile
+	for _, arg := range args {
+		switch info, err := os.Stat(arg); {
+		case err == nil && info.IsDir():
+			found, err := walkInputDir(arg, ext, recursive)
+			if err != nil {
+				return nil, err
+			}
+			if len(found) == 0 {
+				return nil, fmt.Errorf("no %s files found in directory %s", ext, arg)
+			}
+			files = append(files, found...)
+		case err != nil && strings.ContainsAny(arg, "*?["):
+			found, err := globInputs(arg)
+			if err != nil {
+				return nil, err
+			}
+			if len(found) == 0 {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+			files = append(files, found...)
+		default:
+			files = append(files, inputFile{Path: arg, Rel: filepath.Base(arg)})
+		}
+	}
+	return files, nil
+}
+
+// walkInputDir lists the files with the given extension in dir, descending
+// into subdirectories when recursive is set.
+func walkInputDir(dir, ext string, recursive bool) ([]inputFile, error) {
+	var files []inputFile
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.EqualFold(filepath.Ext(path), ext) {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, inputFile{Path: path, Rel: rel})
+		}
+		return nil
+	})
+	return files, err
+}
+
+// globInputs expands a glob pattern, which may use ** to match any number of
+// directories. Relative paths are taken from the last directory before the
+// first element containing a wildcard.
+func globInputs(pattern string) ([]inputFile, error) {
+	elements := strings.Split(filepath.ToSlash(pattern), "/")
+	fixed := 0
+	for fixed < len(elements) && !strings.ContainsAny(elements[fixed], "*?[") {
+		fixed++
+	}
+	root := "."
+	if fixed > 0 {
+		root = filepath.FromSlash(strings.Join(elements[:fixed], "/"))
+		if root == "" {
+			root = "/"
+		}
+	}
+	rest := elements[fixed:]
+	anyDepth := false
+	for _, element := range rest {
+		if _, err := filepath.Match(element, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+		anyDepth = anyDepth || element == "**"
+	}
+
+	var files []inputFile
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// Without **, the pattern can't match below its own depth.
+			if !anyDepth && rel != "." && strings.Count(filepath.ToSlash(rel), "/")+1 >= len(rest) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if matchPathElements(rest, strings.Split(filepath.ToSlash(rel), "/")) {
+			files = append(files, inputFile{Path: path, Rel: rel})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// matchPathElements reports whether the path elements match the pattern
+// elements, where a ** element matches zero or more path elements.
+func matchPathElements(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchPathElements(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	matched, _ := filepath.Match(pattern[0], path[0])
+	return matched && matchPathElements(pattern[1:], path[1:])
+}
+
+// outputPath returns where the converted form of input is written: next to
+// the input file, or under outDir at the input's relative path.
+func outputPath(input inputFile, outDir, outputExt string) string {
+	dir := filepath.Dir(input.Path)
+	if outDir != "" {
+		dir = filepath.Join(outDir, filepath.Dir(input.Rel))
+	}
+	baseName := strings.TrimSuffix(filepath.Base(input.Path), filepath.Ext(input.Path))
+	return filepath.Join(dir, baseName+outputExt)
+}
+
+// uniqueOutputPath returns path, or if an earlier input of this run already
+// writes there, the first of path_2, path_3... not yet used. Paths are
+// compared ignoring case, so the result is also safe on Windows and macOS.
+func uniqueOutputPath(path string, used map[string]bool) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	candidate := path
+	for n := 2; used[strings.ToLower(filepath.Clean(candidate))]; n++ {
+		candidate = fmt.Sprintf("%s_%d%s", base, n, ext)
+	}
+	used[strings.ToLower(filepath.Clean(candidate))] = true
+	return candidate
+}
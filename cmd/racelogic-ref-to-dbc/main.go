@@ -0,0 +1,792 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/EastArctica/racelogic-ref-to-dbc/refdbc"
+)
+
+// Exit statuses. A run without warnings or errors exits with status 0.
+const (
+	exitWarnings  = 1 // At least one file produced warnings
+	exitDifferent = 1 // -diff found differences between the two files
+	exitError     = 2 // Invalid settings, or at least one file could not be converted
+)
+
+// main is the entry point for the program. It handles command-line arguments,
+// file I/O, and orchestrates the parsing process for multiple files.
+func main() {
+	// Define command-line flags for input and output files.
+	inputFileFlag := flag.String("i", "", "Input file path, or '-' for stdin. Can be used with positional arguments.")
+	outputFileFlag := flag.String("o", "", "Output file path, or '-' for stdout. (Only used when a single input file is provided)")
+	outDirFlag := flag.String("outdir", "", "Write output files under this directory, mirroring the layout of input directories and globs, instead of next to each input.")
+	recursiveFlag := flag.Bool("r", false, "Convert the .ref files in subdirectories of directory inputs too. Glob inputs such as 'logs/**/*.REF' are expanded either way.")
+	formatFlag := flag.String("format", "dbc", "Output format: "+strings.Join(refdbc.Formats(), ", ")+".")
+	csvLayoutFlag := flag.String("csv-layout", "table", "Columns of -format csv: 'table' (message first, rows sorted by start bit) or 'ref' (the field order of the .ref file).")
+	nodeFlag := flag.String("node", refdbc.DefaultNodeName, "Node name used as the transmitter and receiver in the DBC.")
+	allowPartialFlag := flag.Bool("allow-partial", false, "When a file ends early or an entry can't be read, still write the messages read before it, with a DBC comment listing the missing entries.")
+	strictFlag := flag.Bool("strict", false, "Treat invalid signal definitions as errors instead of skipping them, and fail any file that produces a warning without writing its output.")
+	verifyFlag := flag.Bool("verify", false, "Read the written DBC back and fail if any message or signal differs from the parsed data.")
+	var noPause bool
+	flag.BoolVar(&noPause, "no-pause", false, "Never wait for Enter at the end of a run with warnings or errors. Implied when stdin isn't a terminal.")
+	flag.BoolVar(&noPause, "ci", false, "CI mode: alias of -no-pause.")
+	jobsFlag := flag.Int("jobs", 1, "Number of files converted at the same time, or 0 for one per CPU. Log events are still written file by file, in input order.")
+	failFastFlag := flag.Bool("fail-fast", false, "Stop at the first file that fails to convert and exit with status 2.")
+	var quiet bool
+	flag.BoolVar(&quiet, "quiet", false, "Quiet mode: only log warnings and errors, without progress or other info.")
+	flag.BoolVar(&quiet, "q", false, "Shorthand for -quiet.")
+	var verbose bool
+	flag.BoolVar(&verbose, "verbose", false, "Also log debug details (entry sizes, byte offsets, skipped lines).")
+	flag.BoolVar(&verbose, "v", false, "Shorthand for -verbose.")
+	logFormatFlag := flag.String("log-format", "text", "Format of log events on stderr: 'text' or 'json' (one object per line).")
+	configFlag := flag.String("config", "", "Config file (.toml, .json, .yaml or .yml) with default flag values and per-file settings. Defaults to racelogic-ref-to-dbc.toml/.json/.yaml/.yml in the current directory or next to the executable.")
+	noHeaderFlag := flag.Bool("no-header", false, "Write only the BO_/SG_ definitions, without the DBC header (for pasting into an existing DBC).")
+	sortFlag := flag.String("sort", "id", "Order of the messages in DBC output: by 'id', by 'name', or in 'source' order (as they first appear in the .ref file).")
+	indentFlag := flag.String("indent", "space", "Indentation of SG_ lines in DBC output: 'space' or 'tab'.")
+	lineEndingsFlag := flag.String("line-endings", "lf", "Line endings of DBC output: 'lf' or 'crlf'.")
+	inputEncodingFlag := flag.String("input-encoding", "auto", "Character set of the text in .ref files: 'auto' (UTF-8 if valid, otherwise Windows-1252), 'utf-8', 'windows-1252' or 'latin-1'.")
+	dbcEncodingFlag := flag.String("dbc-encoding", "utf-8", "Character set of DBC output: 'utf-8' or 'windows-1252' (for tools that expect the Windows code page).")
+	compatFlag := flag.String("compat", "", "Check DBC output against the quirks of a tool reading it, and adjust the output settings not given explicitly to suit it: 'candb', 'canalyzer', 'matlab' or 'savvycan'.")
+	receiverSeparatorFlag := flag.String("receiver-separator", "comma", "Separator of the receiver lists ending SG_ lines: 'comma' (A,B), 'comma-space' (A, B) or 'space' (A B).")
+	sigPrefixFlag := flag.String("sig-prefix", "", "Prefix added to every signal name.")
+	sigSuffixFlag := flag.String("sig-suffix", "", "Suffix added to every signal name.")
+	renameFlag := flag.String("rename", "", "File of signal rename rules: 'oldName=newName' or 's/pattern/replacement/' per line. A .yaml or .yml file is read as a mapping of message IDs and signal names to friendly names, units and comments, like -overrides.")
+	receiversFlag := flag.String("receivers", "", "Comma-separated list of nodes receiving every signal. Defaults to the -node name.")
+	signalReceiversFlag := flag.String("signal-receivers", "", "Receivers per signal name: 'signal,node[,node...];signal,node...'.")
+	nodeMapFlag := flag.String("node-map", "", "File assigning receivers per message or signal and transmitters per message, e.g. '256 rx = ECU1,ECU2', '256.Speed rx = ECU3' or '256 tx = GPS'.")
+	nodeMappingFlag := flag.String("node-mapping", "", "JSON or YAML file mapping channel groups (GPS, IMU, ADC...) to the node that transmits their messages and the nodes that receive their signals.")
+	txFromGroupFlag := flag.Bool("tx-from-group", false, "Use the channel group of each message (e.g. GPS) as its transmitter node instead of the -node name. Transmitters in -node-map take precedence.")
+	autoPackFlag := flag.Bool("auto-pack", false, "Move signals that overlap an earlier signal into the next free bits of the message (growing DLC if needed).")
+	var nameTemplate string
+	flag.StringVar(&nameTemplate, "name-template", refdbc.DefaultNameTemplate, "Template for message names, using {{.ID}} (decimal), {{.HexID}} (hex), {{.Channel}}, {{.Prefix}} and {{.FirstSignal}}, e.g. '{{.Channel}}_{{.HexID}}'.")
+	flag.StringVar(&nameTemplate, "msg-name-template", refdbc.DefaultNameTemplate, "Alias of -name-template.")
+	autoSuffixFlag := flag.Bool("auto-suffix", false, "Make duplicate message names, and duplicate signal names within a message, unique by appending _2, _3...")
+	dlcPolicyFlag := flag.String("dlc-policy", "max", "How to resolve signals of one message declaring different DLCs: 'max', 'first', 'strict' or 'ask' (prompting on stderr when stdin is a terminal, and acting like 'strict' otherwise).")
+	unitsFlag := flag.String("units", "", "JSON or YAML file mapping units as found in .ref files to the units to write, e.g. kmh: km/h, optionally with a scale and shift to convert the values. Applied before -normalize-units.")
+	normalizeUnitsFlag := flag.Bool("normalize-units", false, "Convert recognized units to canonical SI-style units (e.g. mph to km/h), rescaling factor, offset and range.")
+	fixSignFlag := flag.Bool("fix-sign", false, "Make unsigned signals signed when their declared range clearly requires it.")
+	var autoRange bool
+	flag.BoolVar(&autoRange, "auto-range", false, "Replace missing or [0|0] ranges with the range the signal's length, signedness, factor and offset can represent.")
+	flag.BoolVar(&autoRange, "derive-range", false, "Alias of -auto-range.")
+	groupByPrefixFlag := flag.Bool("group-by-prefix", false, "Group signals by the part of their name before the first underscore when the file has no group column.")
+	minGroupSizeFlag := flag.Int("min-group-size", 2, "Smallest number of signals for a SIG_GROUP_ to be written.")
+	combineSplitFlag := flag.Bool("combine-split", false, "Write a signal split across two messages as one full-width signal in the first message, instead of _MSW/_LSW halves.")
+	overridesFlag := flag.String("overrides", "", "JSON or YAML file of message and signal fields (name, unit, comment, min, max...) to patch onto the parsed data, keyed by message ID and signal name.")
+	attributesFlag := flag.String("attributes", "", "JSON or YAML file of DBC attribute definitions (BA_DEF_) and defaults to write, e.g. GenMsgCycleTime or BusType, keyed by attribute name.")
+	var bitConvention string
+	flag.StringVar(&bitConvention, "bit-convention", "dbc", "Numbering of Motorola start bits in the .ref file: 'dbc' (MSB, as written; also 'msb' or 'raw'), 'lsb' (start bit is the LSB) or 'sequential' (0 is the MSB of byte 0).")
+	flag.StringVar(&bitConvention, "startbit-convention", "dbc", "Alias of -bit-convention.")
+	floatFormatFlag := flag.String("float-format", "shortest", "How factors, offsets and ranges are written: 'shortest' (may use exponents, e.g. 3.0517578125e-05), 'fixed' (never uses exponents) or 'max-digits' (fixed, rounded to -float-digits significant digits).")
+	floatDigitsFlag := flag.Int("float-digits", refdbc.DefaultFloatDigits, "Significant digits kept by -float-format max-digits (1 to 17).")
+	delimiterFlag := flag.String("delimiter", ",", "Field separator of the signal lines: a single character, 'tab', or 'auto' to detect comma, semicolon or tab per file.")
+	minMaxOrderFlag := flag.String("minmax-order", "max-first", "Order of the range columns in signal lines: 'max-first' (as Racelogic exports them) or 'min-first'.")
+	refVersionFlag := flag.String("ref-version", "auto", "Layout of the .ref files: 'auto' to detect it per file, 'standard' (serial string and zlib serial block), 'legacy' (no serial block) or 'legacy-le' (no serial block, little-endian entry count, from older logger firmware).")
+	summaryFormatFlag := flag.String("summary-format", "text", "Format of the final summary line on stdout: 'text' (key=value pairs) or 'json'.")
+	reverseFlag := flag.Bool("reverse", false, "Convert .dbc files back into .ref files that VBOX Tools can load.")
+	refTemplateFlag := flag.String("ref-template", "", "Existing .ref file whose header and serial block are copied into -reverse output.")
+	mergeFlag := flag.String("merge", "", "Write the messages of every input .ref file to this one file, combining messages with the same ID and reporting conflicting definitions.")
+	mergeIntoFlag := flag.String("merge-into", "", "Insert the messages of every input .ref file into this existing DBC file, keeping its other messages, attributes and comments. The result is written to -o, or back to the file.")
+	conflictFlag := flag.String("conflict", "error", "What -merge-into does with a converted message whose ID the DBC already has: stop with an 'error', 'keep' the DBC's message or 'replace' it.")
+	diffFlag := flag.Bool("diff", false, "Compare two files (.ref or .dbc) instead of converting, e.g. a hand-maintained DBC with the .ref it should match. Exits 0 if identical, 1 if different and 2 if a file can't be read.")
+	diffIgnoreFlag := flag.String("diff-ignore", "", "Comma-separated kinds of differences -diff leaves out: "+strings.Join(refdbc.DiffIgnores, ", ")+".")
+	inspectFlag := flag.Bool("inspect", false, "Print a summary of each .ref file (serial string, entries, messages, signal counts, bit usage, warnings) instead of converting. Nothing is written.")
+	layoutFlag := flag.Bool("layout", false, "Print a grid of the payload bits of each message in the input files (.ref or .dbc), showing which signal uses each bit and listing unused and overlapping bits, instead of converting. Nothing is written.")
+	dupFlag := flag.String("dup", "keep", "Signals defined more than once in a message: 'keep' all with a warning, stop with an 'error', 'rename' the later ones, or keep only the 'first' or 'last'.")
+	namePolicyFlag := flag.String("name-policy", "keep", "Signal names that aren't valid DBC identifiers: 'keep' them, 'replace' illegal characters with '_', or treat them as errors ('strict').")
+	nameReportFlag := flag.String("name-report", "", "Write a CSV file mapping every signal renamed by -name-policy replace or shortened by -max-name-length to its new name.")
+	maxNameLengthFlag := flag.Int("max-name-length", 0, "Shorten signal names longer than this many characters, ending them in _ and four hex digits of a hash so they stay unique. 0 for no limit.")
+	reportFlag := flag.String("report", "", "Write a report of the run to this .html or .md file: for each conversion its messages, signals, bit layouts and warnings, and the signals that appear in several messages with different scaling.")
+	dumpRawFlag := flag.String("dump-raw", "", "Write the decompressed text of every entry to this file ('-' for stdout) before parsing, for debugging.")
+	dumpTrailingFlag := flag.String("dump-trailing", "", "Write the unparsed bytes left at the end of each .ref file to this file, to help identify unknown sections. -v also logs them as a hex dump.")
+	commentsFlag := flag.String("comments", "basic", "DBC comments to write: 'none', 'basic' (from the .ref file and overrides) or 'full' (also naming the source file, serial string, entry, line and raw text of each message and signal).")
+	canFDFlag := flag.Bool("canfd", false, "Mark every message as a CAN FD frame, writing the BusType, VFrameFormat and CANFD_BRS attributes Vector tools expect. Messages with a DLC above 8 need it.")
+	metadataFlag := flag.Bool("metadata", false, "Write the header line and serial string of each .ref file, with the serial number, firmware version and channel count found in them, as a DBC comment and in JSON output.")
+	annotateFlag := flag.Bool("annotate", false, "Add DBC comments giving each message's hex ID, signal count and source file, and the converter version.")
+	printConfigFlag := flag.Bool("print-config", false, "Print the effective configuration and exit.")
+	versionFlag := flag.Bool("version", false, "Print the converter version and exit.")
+	// "browse" before the flags explores an input file instead of converting it.
+	browse := len(os.Args) > 1 && os.Args[1] == "browse"
+	if browse {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	flag.Parse()
+
+	if *versionFlag {
+		fmt.Printf("racelogic-ref-to-dbc %s\n", refdbc.Version)
+		return
+	}
+
+	// Load defaults from a config file. Flags given on the command line take precedence.
+	configPath, err := findConfigFile(*configFlag)
+	var cfg config
+	if err == nil && configPath != "" {
+		cfg, err = loadConfigFile(configPath)
+		if err == nil {
+			err = applyConfig(flag.CommandLine, cfg.Values)
+		}
+	}
+
+	// Set up logging before reporting any problem.
+	logLevel := refdbc.LevelInfo
+	switch {
+	case verbose:
+		logLevel = refdbc.LevelDebug
+	case quiet:
+		logLevel = refdbc.LevelWarn
+	}
+	log := refdbc.NewLogger(os.Stderr, *logFormatFlag, logLevel)
+	if err != nil {
+		log.Errorf("config file %s: %v", configPath, err)
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidLogFormat(*logFormatFlag) {
+		log.Errorf("unknown -log-format '%s' (expected %s).", *logFormatFlag, strings.Join(refdbc.LogFormats, ", "))
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidSummaryFormat(*summaryFormatFlag) {
+		log.Errorf("unknown -summary-format '%s' (expected %s).", *summaryFormatFlag, strings.Join(refdbc.SummaryFormats, ", "))
+		os.Exit(exitError)
+	}
+	if *compatFlag != "" {
+		if !refdbc.IsValidCompatProfile(*compatFlag) {
+			log.Errorf("unknown -compat '%s' (expected %s).", *compatFlag, strings.Join(refdbc.CompatProfiles, ", "))
+			os.Exit(exitError)
+		}
+		if err := applyCompat(flag.CommandLine, *compatFlag); err != nil {
+			log.Errorf("%v", err)
+			os.Exit(exitError)
+		}
+	}
+	if *printConfigFlag {
+		printConfig(flag.CommandLine, cfg.Files, configPath, os.Stdout)
+		return
+	}
+
+	// Validate the output format before touching any files.
+	outputExt, ok := refdbc.FormatExtensions[*formatFlag]
+	if !ok {
+		log.Errorf("unknown output format '%s' (expected %s).", *formatFlag, strings.Join(refdbc.Formats(), ", "))
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidCommentMode(*commentsFlag) {
+		log.Errorf("unknown -comments '%s' (expected %s).", *commentsFlag, strings.Join(refdbc.CommentModes, ", "))
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidCSVLayout(*csvLayoutFlag) {
+		log.Errorf("unknown -csv-layout '%s' (expected %s).", *csvLayoutFlag, strings.Join(refdbc.CSVLayouts, ", "))
+		os.Exit(exitError)
+	}
+	if *verifyFlag && (*formatFlag != "dbc" || *reverseFlag) {
+		log.Errorf("-verify only checks DBC output.")
+		os.Exit(exitError)
+	}
+	if *compatFlag != "" && (*formatFlag != "dbc" || *reverseFlag) {
+		log.Errorf("-compat only applies to DBC output.")
+		os.Exit(exitError)
+	}
+	jobs := *jobsFlag
+	if jobs < 0 {
+		log.Errorf("-jobs must be 0 or more, got %d.", jobs)
+		os.Exit(exitError)
+	}
+	if jobs == 0 {
+		jobs = runtime.NumCPU()
+	}
+	if jobs > 1 && *dlcPolicyFlag == "ask" {
+		log.Errorf("-dlc-policy ask can't be combined with -jobs, since it asks on stdin.")
+		os.Exit(exitError)
+	}
+	if *inspectFlag && (*reverseFlag || *diffFlag || *mergeFlag != "" || *mergeIntoFlag != "") {
+		log.Errorf("-inspect can't be combined with -reverse, -diff, -merge or -merge-into.")
+		os.Exit(exitError)
+	}
+	if *layoutFlag && (*inspectFlag || *reverseFlag || *diffFlag || *mergeFlag != "" || *mergeIntoFlag != "") {
+		log.Errorf("-layout can't be combined with -inspect, -reverse, -diff, -merge or -merge-into.")
+		os.Exit(exitError)
+	}
+	if browse && (*inspectFlag || *layoutFlag || *reverseFlag || *diffFlag || *mergeFlag != "" || *mergeIntoFlag != "") {
+		log.Errorf("browse can't be combined with -inspect, -layout, -reverse, -diff, -merge or -merge-into.")
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidIdentifier(*nodeFlag) {
+		log.Errorf("node name '%s' is not a valid DBC identifier.", *nodeFlag)
+		os.Exit(exitError)
+	}
+	opts := refdbc.Options{
+		Format:    *formatFlag,
+		CSVLayout: *csvLayoutFlag,
+
+		Node:   *nodeFlag,
+		Strict: *strictFlag,
+		Verify: *verifyFlag,
+
+		AllowPartial: *allowPartialFlag,
+
+		GroupTransmitters: *txFromGroupFlag,
+
+		Log: log,
+
+		NoHeader: *noHeaderFlag,
+
+		SortOrder:         *sortFlag,
+		Indent:            *indentFlag,
+		LineEnding:        *lineEndingsFlag,
+		ReceiverSeparator: *receiverSeparatorFlag,
+
+		Compat: *compatFlag,
+
+		InputEncoding: *inputEncodingFlag,
+		DBCEncoding:   *dbcEncodingFlag,
+
+		SigPrefix: *sigPrefixFlag,
+		SigSuffix: *sigSuffixFlag,
+
+		AutoPack: *autoPackFlag,
+
+		AutoSuffix:    *autoSuffixFlag,
+		DupStrategy:   *dupFlag,
+		NamePolicy:    *namePolicyFlag,
+		MaxNameLength: *maxNameLengthFlag,
+
+		DLCPolicy:   *dlcPolicyFlag,
+		Interactive: refdbc.IsTerminal(os.Stdin),
+		CANFD:       *canFDFlag,
+
+		MinMaxOrder: *minMaxOrderFlag,
+
+		FormatVersion: *refVersionFlag,
+
+		BitConvention: refdbc.CanonicalBitConvention(bitConvention),
+
+		FloatFormat: *floatFormatFlag,
+		FloatDigits: *floatDigitsFlag,
+
+		NormalizeUnits: *normalizeUnitsFlag,
+		FixSign:        *fixSignFlag,
+		AutoRange:      autoRange,
+
+		Annotate: *annotateFlag,
+		Metadata: *metadataFlag,
+		Comments: *commentsFlag,
+
+		GroupByPrefix: *groupByPrefixFlag,
+		MinGroupSize:  *minGroupSizeFlag,
+
+		CombineSplit: *combineSplitFlag,
+	}
+	if !refdbc.IsValidConflictPolicy(*conflictFlag) {
+		log.Errorf("unknown -conflict '%s' (expected %s).", *conflictFlag, strings.Join(refdbc.ConflictPolicies, ", "))
+		os.Exit(exitError)
+	}
+	opts.ConflictPolicy = *conflictFlag
+	for _, kind := range strings.Split(*diffIgnoreFlag, ",") {
+		if kind = strings.TrimSpace(kind); kind == "" {
+			continue
+		}
+		if !refdbc.IsValidDiffIgnore(kind) {
+			log.Errorf("unknown -diff-ignore '%s' (expected %s).", kind, strings.Join(refdbc.DiffIgnores, ", "))
+			os.Exit(exitError)
+		}
+		opts.DiffIgnore = append(opts.DiffIgnore, kind)
+	}
+	if !refdbc.IsValidDLCPolicy(opts.DLCPolicy) {
+		log.Errorf("unknown -dlc-policy '%s' (expected %s).", opts.DLCPolicy, strings.Join(refdbc.DLCPolicies, ", "))
+		os.Exit(exitError)
+	}
+	switch opts.MinMaxOrder {
+	case "max-first":
+		log.Infof("Reading the 8th column as the maximum and the 9th as the minimum (-minmax-order max-first).")
+	case "min-first":
+		log.Infof("Reading the 8th column as the minimum and the 9th as the maximum (-minmax-order min-first).")
+	default:
+		log.Errorf("unknown -minmax-order '%s' (expected max-first or min-first).", opts.MinMaxOrder)
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidRefVersion(opts.FormatVersion) {
+		log.Errorf("unknown -ref-version '%s' (expected %s).", opts.FormatVersion, strings.Join(refdbc.RefVersions, ", "))
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidBitConvention(opts.BitConvention) {
+		log.Errorf("unknown -bit-convention '%s' (expected %s).", opts.BitConvention, strings.Join(refdbc.BitConventions, ", "))
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidFloatFormat(opts.FloatFormat) {
+		log.Errorf("unknown -float-format '%s' (expected %s).", opts.FloatFormat, strings.Join(refdbc.FloatFormats, ", "))
+		os.Exit(exitError)
+	}
+	if opts.FloatDigits < 1 || opts.FloatDigits > 17 {
+		log.Errorf("-float-digits must be between 1 and 17, got %d.", opts.FloatDigits)
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidSortOrder(opts.SortOrder) {
+		log.Errorf("unknown -sort '%s' (expected %s).", opts.SortOrder, strings.Join(refdbc.SortOrders, ", "))
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidIndent(opts.Indent) {
+		log.Errorf("unknown -indent '%s' (expected %s).", opts.Indent, strings.Join(refdbc.Indents, ", "))
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidLineEnding(opts.LineEnding) {
+		log.Errorf("unknown -line-endings '%s' (expected %s).", opts.LineEnding, strings.Join(refdbc.LineEndings, ", "))
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidReceiverSeparator(opts.ReceiverSeparator) {
+		log.Errorf("unknown -receiver-separator '%s' (expected %s).", opts.ReceiverSeparator, strings.Join(refdbc.ReceiverSeparators, ", "))
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidInputEncoding(opts.InputEncoding) {
+		log.Errorf("unknown -input-encoding '%s' (expected %s).", opts.InputEncoding, strings.Join(refdbc.InputEncodings, ", "))
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidDBCEncoding(opts.DBCEncoding) {
+		log.Errorf("unknown -dbc-encoding '%s' (expected %s).", opts.DBCEncoding, strings.Join(refdbc.DBCEncodings, ", "))
+		os.Exit(exitError)
+	}
+	opts.Delimiter, err = refdbc.ParseDelimiter(*delimiterFlag)
+	if err != nil {
+		log.Errorf("invalid -delimiter: %v", err)
+		os.Exit(exitError)
+	}
+	opts.NameTemplate, err = refdbc.ParseNameTemplate(nameTemplate)
+	if err != nil {
+		log.Errorf("invalid -name-template: %v", err)
+		os.Exit(exitError)
+	}
+	opts.Receivers, err = refdbc.ParseNodeList(*receiversFlag, log)
+	if err != nil {
+		log.Errorf("invalid -receivers: %v", err)
+		os.Exit(exitError)
+	}
+	if *nodeMapFlag != "" {
+		opts.NodeMap, err = refdbc.LoadNodeMap(*nodeMapFlag, log)
+		if err != nil {
+			log.Errorf("%v", err)
+			os.Exit(exitError)
+		}
+	}
+	if *nodeMappingFlag != "" {
+		opts.GroupNodes, err = refdbc.LoadNodeMapping(*nodeMappingFlag, log)
+		if err != nil {
+			log.Errorf("%v", err)
+			os.Exit(exitError)
+		}
+	}
+	if *signalReceiversFlag != "" {
+		receivers, err := refdbc.ParseSignalReceivers(*signalReceiversFlag, log)
+		if err != nil {
+			log.Errorf("invalid -signal-receivers: %v", err)
+			os.Exit(exitError)
+		}
+		if opts.NodeMap == nil {
+			opts.NodeMap = refdbc.NewNodeMap()
+		}
+		// Command-line entries override the node map file.
+		for name, nodes := range receivers {
+			opts.NodeMap.NamedSignalReceivers[name] = nodes
+		}
+	}
+	if !refdbc.IsValidDupStrategy(opts.DupStrategy) {
+		log.Errorf("unknown -dup '%s' (expected %s).", opts.DupStrategy, strings.Join(refdbc.DupStrategies, ", "))
+		os.Exit(exitError)
+	}
+	if !refdbc.IsValidNamePolicy(opts.NamePolicy) {
+		log.Errorf("unknown -name-policy '%s' (expected %s).", opts.NamePolicy, strings.Join(refdbc.NamePolicies, ", "))
+		os.Exit(exitError)
+	}
+	if opts.MaxNameLength != 0 && opts.MaxNameLength < refdbc.MinMaxNameLength {
+		log.Errorf("-max-name-length must be 0 or at least %d, got %d.", refdbc.MinMaxNameLength, opts.MaxNameLength)
+		os.Exit(exitError)
+	}
+	if *nameReportFlag != "" {
+		reportFile, err := os.Create(*nameReportFlag)
+		if err != nil {
+			log.Errorf("failed to create -name-report file: %v", err)
+			os.Exit(exitError)
+		}
+		defer reportFile.Close()
+		fmt.Fprintln(reportFile, strings.Join(refdbc.NameReportHeader, ","))
+		opts.NameReport = reportFile
+	}
+	var reportFormat string
+	if *reportFlag != "" {
+		reportFormat, err = refdbc.ReportFormat(*reportFlag)
+		if err != nil {
+			log.Errorf("invalid -report: %v", err)
+			os.Exit(exitError)
+		}
+		opts.Report = refdbc.NewReport()
+	}
+	if *dumpRawFlag == "-" {
+		opts.DumpRaw = os.Stdout
+	} else if *dumpRawFlag != "" {
+		dumpFile, err := os.Create(*dumpRawFlag)
+		if err != nil {
+			log.Errorf("failed to create -dump-raw file: %v", err)
+			os.Exit(exitError)
+		}
+		defer dumpFile.Close()
+		opts.DumpRaw = dumpFile
+	}
+	if *dumpTrailingFlag != "" {
+		trailingFile, err := os.Create(*dumpTrailingFlag)
+		if err != nil {
+			log.Errorf("failed to create -dump-trailing file: %v", err)
+			os.Exit(exitError)
+		}
+		defer trailingFile.Close()
+		opts.DumpTrailing = trailingFile
+	}
+	if *overridesFlag != "" {
+		opts.Overrides, err = refdbc.LoadOverrides(*overridesFlag, log)
+		if err != nil {
+			log.Errorf("%v", err)
+			os.Exit(exitError)
+		}
+	}
+	if *unitsFlag != "" {
+		opts.Units, err = refdbc.LoadUnits(*unitsFlag)
+		if err != nil {
+			log.Errorf("%v", err)
+			os.Exit(exitError)
+		}
+	}
+	if *attributesFlag != "" {
+		opts.Attributes, err = refdbc.LoadAttributes(*attributesFlag)
+		if err != nil {
+			log.Errorf("%v", err)
+			os.Exit(exitError)
+		}
+	}
+	if *renameFlag != "" {
+		if refdbc.IsYAMLFile(*renameFlag) && *overridesFlag != "" {
+			log.Errorf("-rename with a YAML mapping can't be combined with -overrides; move the overrides into %s.", *renameFlag)
+			os.Exit(exitError)
+		}
+		if err := loadRenameFile(*renameFlag, &opts, log); err != nil {
+			log.Errorf("%v", err)
+			os.Exit(exitError)
+		}
+	}
+
+	// Collect all input files from both the -i flag and positional arguments,
+	// expanding directories and glob patterns.
+	inputArgs := []string{}
+	if *inputFileFlag != "" {
+		inputArgs = append(inputArgs, *inputFileFlag)
+	}
+	inputArgs = append(inputArgs, flag.Args()...)
+	inputExt := ".ref"
+	if *reverseFlag {
+		inputExt = ".dbc"
+	}
+	inputs, err := expandInputs(inputArgs, inputExt, *recursiveFlag)
+	if err != nil {
+		log.Errorf("%v", err)
+		os.Exit(exitError)
+	}
+	inputFiles := make([]string, len(inputs))
+	for i, input := range inputs {
+		inputFiles[i] = input.Path
+	}
+
+	// Input read from stdin is written to stdout unless -o says otherwise.
+	// Output on stdout moves the summary line to stderr, and there is no
+	// pause at the end, since stdin isn't the keyboard.
+	usesStdio := false
+	for _, path := range append([]string{*outputFileFlag}, inputFiles...) {
+		usesStdio = usesStdio || path == refdbc.StdioPath
+	}
+	if usesStdio && *dumpRawFlag == refdbc.StdioPath {
+		log.Errorf("-dump-raw - can't be combined with reading from stdin or writing to stdout.")
+		os.Exit(exitError)
+	}
+	summaryOut := os.Stdout
+	if usesStdio {
+		summaryOut = os.Stderr
+	}
+
+	// If no files are provided, show usage and exit.
+	if len(inputFiles) == 0 {
+		log.Errorf("No input file specified.")
+		fmt.Println("Usage: racelogic-ref-to-dbc [options] <file1> <file2> ...")
+		fmt.Println("       racelogic-ref-to-dbc browse [options] <file>")
+		fmt.Println("Options:")
+		flag.PrintDefaults()
+		os.Exit(exitError)
+	}
+
+	// In diff mode, compare exactly two files and exit with a status scripts can check.
+	if *diffFlag {
+		os.Exit(runDiff(inputFiles, opts))
+	}
+
+	// In inspect mode, summarize each file without writing anything.
+	if *inspectFlag {
+		os.Exit(runInspect(inputFiles, opts))
+	}
+
+	// In layout mode, print the bit layout of each file without writing anything.
+	if *layoutFlag {
+		os.Exit(runLayout(inputFiles, opts))
+	}
+
+	// In browse mode, explore one file interactively without writing anything.
+	if browse {
+		os.Exit(runBrowse(inputFiles, opts))
+	}
+
+	// In reverse mode, .dbc files are converted back into .ref files.
+	var preamble refdbc.RefPreamble
+	if *reverseFlag {
+		outputExt = ".ref"
+		if *refTemplateFlag != "" {
+			preamble, err = refdbc.ReadRefPreamble(*refTemplateFlag)
+		} else {
+			preamble, err = refdbc.DefaultRefPreamble()
+		}
+		if err != nil {
+			log.Errorf("%v", err)
+			os.Exit(exitError)
+		}
+	}
+
+	if *mergeFlag != "" && *reverseFlag {
+		log.Errorf("-merge can't be combined with -reverse.")
+		os.Exit(exitError)
+	}
+	if *mergeIntoFlag != "" && (*mergeFlag != "" || *reverseFlag || *formatFlag != "dbc") {
+		log.Errorf("-merge-into writes DBC files only, and can't be combined with -merge, -reverse or -format.")
+		os.Exit(exitError)
+	}
+	if len(cfg.Files) > 0 && (*mergeFlag != "" || *mergeIntoFlag != "") {
+		log.Warnf("per-file settings in %s are ignored when merging.", configPath)
+	}
+
+	// Warn user if -o is used with multiple files, as it will be ignored.
+	if *mergeFlag != "" && *outputFileFlag != "" {
+		log.Warnf("-o flag is ignored when merging; the output is written to %s.", *mergeFlag)
+	} else if len(inputFiles) > 1 && *outputFileFlag != "" {
+		log.Warnf("-o flag is ignored when more than one input file is provided.")
+	}
+
+	// Warnings about the options themselves, such as unknown keys in the
+	// overrides file, count as issues too.
+	hadAnyIssues := log.HasWarnings()
+	var hadAnyErrors bool
+	summary := refdbc.RunSummary{Files: len(inputFiles)}
+
+	if *mergeFlag != "" || *mergeIntoFlag != "" {
+		// Merge every input into one output file.
+		var stats refdbc.FileStats
+		target := *mergeFlag
+		if *mergeIntoFlag != "" {
+			output := *outputFileFlag
+			if output == "" {
+				output = *mergeIntoFlag
+			}
+			target = *mergeIntoFlag
+			log.StartFile(output)
+			log.Infof("--- Merging %d file(s) into %s, writing: %s ---", len(inputFiles), *mergeIntoFlag, output)
+			stats, err = refdbc.MergeIntoDBC(inputFiles, *mergeIntoFlag, output, opts)
+		} else {
+			log.StartFile(*mergeFlag)
+			log.Infof("--- Merging %d file(s) into: %s ---", len(inputFiles), *mergeFlag)
+			stats, err = refdbc.MergeFiles(inputFiles, *mergeFlag, opts)
+		}
+		summary.Add(stats)
+		if stats.Warnings > 0 {
+			hadAnyIssues = true
+		}
+		if err != nil {
+			log.Errorf("merging into %s: %v", target, err)
+			summary.Failed = len(inputFiles)
+			hadAnyIssues = true
+			hadAnyErrors = true
+		} else {
+			log.Infof("Wrote %d messages and %d signals in %v (%d lines skipped, %d repeated lines, %d warnings).",
+				stats.Messages, stats.Signals, stats.Elapsed.Round(time.Microsecond), stats.SkippedLines, stats.Duplicates, stats.Warnings)
+			summary.Converted = len(inputFiles)
+		}
+	} else {
+		// Convert each file provided, up to -jobs at a time.
+		b := &batch{
+			opts:       opts,
+			cfg:        cfg,
+			configPath: configPath,
+			outDir:     *outDirFlag,
+			reverse:    *reverseFlag,
+			preamble:   preamble,
+		}
+		conversions := b.plan(inputs, *outputFileFlag, outputExt)
+		b.convertAll(conversions, jobs, func(c *conversion) bool {
+			summary.Add(c.stats)
+			if c.stats.Warnings > 0 {
+				hadAnyIssues = true
+			}
+			if !c.failed {
+				summary.Converted++
+				return true
+			}
+			summary.Failed++
+			hadAnyIssues = true
+			hadAnyErrors = true
+			if *failFastFlag {
+				log.Infof("Stopping at the first failure (-fail-fast).")
+				return false
+			}
+			return true
+		})
+	}
+
+	log.StartFile("")
+	if opts.Report != nil {
+		if err := writeReport(opts.Report, *reportFlag, reportFormat); err != nil {
+			log.Errorf("writing -report: %v", err)
+			hadAnyIssues = true
+			hadAnyErrors = true
+		} else {
+			log.Infof("Report written to: %s", *reportFlag)
+		}
+	}
+	log.Infof("--- Finished ---")
+	log.Infof("Successfully processed %d out of %d file(s).", summary.Converted, len(inputFiles))
+
+	// Finish with a single line scripts can parse.
+	summary.ElapsedMS = summary.Elapsed.Milliseconds()
+	switch {
+	case hadAnyErrors:
+		summary.Severity = "error"
+	case hadAnyIssues:
+		summary.Severity = "warn"
+	default:
+		summary.Severity = "ok"
+	}
+	summary.Write(summaryOut, *summaryFormatFlag)
+
+	// If any error or warning occurred during the entire run, pause for the
+	// user to see it, unless nobody is at the keyboard.
+	if hadAnyIssues && !usesStdio && !noPause && refdbc.IsTerminal(os.Stdin) {
+		fmt.Println("\nNOTE: Errors or warnings were issued during processing (see details above).")
+		fmt.Println("Press Enter to exit.")
+		refdbc.Stdin.ReadBytes('\n')
+	}
+
+	// Report the outcome through the exit status, so scripts can branch on it.
+	switch {
+	case hadAnyErrors:
+		os.Exit(exitError)
+	case hadAnyIssues:
+		os.Exit(exitWarnings)
+	}
+}
+
+// runDiff compares two input files and prints the differences.
+// It returns the process exit code: 0 when identical, exitDifferent when
+// different, and exitError when a file can't be read.
+func runDiff(inputFiles []string, opts refdbc.Options) int {
+	if len(inputFiles) != 2 {
+		opts.Log.Errorf("-diff requires exactly two files, got %d.", len(inputFiles))
+		return exitError
+	}
+
+	databases := make([]map[uint32]*refdbc.Message, 2)
+	for i, path := range inputFiles {
+		opts.Log.StartFile(path)
+		messages, err := refdbc.LoadDatabase(path, opts)
+		if err != nil {
+			opts.Log.Errorf("reading %s: %v", path, err)
+			return exitError
+		}
+		databases[i] = messages
+	}
+
+	fmt.Printf("Comparing %s with %s\n", inputFiles[0], inputFiles[1])
+	if refdbc.DiffDatabasesWithOptions(inputFiles[0], inputFiles[1], databases[0], databases[1], os.Stdout, opts) {
+		return exitDifferent
+	}
+	return 0
+}
+
+// runInspect prints a summary of each input file. It returns exitError if a
+// file could not be read, or exitWarnings if any file produced warnings.
+func runInspect(inputFiles []string, opts refdbc.Options) int {
+	status := 0
+	for _, path := range inputFiles {
+		opts.Log.StartFile(path)
+		inspection, err := refdbc.Inspect(path, opts)
+		if err != nil {
+			opts.Log.Errorf("reading %s: %v", path, err)
+			status = exitError
+			continue
+		}
+		inspection.Write(os.Stdout)
+		if len(inspection.Warnings) > 0 && status == 0 {
+			status = exitWarnings
+		}
+	}
+	return status
+}
+
+// runLayout prints the bit layout of the messages of each input file. It
+// returns exitError if a file could not be read, or exitWarnings if any file
+// produced warnings, such as overlapping signals.
+func runLayout(inputFiles []string, opts refdbc.Options) int {
+	status := 0
+	for _, path := range inputFiles {
+		opts.Log.StartFile(path)
+		messages, err := refdbc.LoadDatabase(path, opts)
+		if err != nil {
+			opts.Log.Errorf("reading %s: %v", path, err)
+			status = exitError
+			continue
+		}
+		fmt.Printf("=== %s ===\n\n", path)
+		refdbc.WriteLayout(messages, os.Stdout)
+		if opts.Log.HasWarnings() && status == 0 {
+			status = exitWarnings
+		}
+	}
+	return status
+}
+
+// runBrowse opens the interactive browser over the messages of the one input
+// file: full-screen on a terminal, or reading commands a line at a time from
+// stdin otherwise. It returns exitError if there isn't
+// exactly one file, it is stdin, or it could not be read.
+func runBrowse(inputFiles []string, opts refdbc.Options) int {
+	if len(inputFiles) != 1 || inputFiles[0] == refdbc.StdioPath {
+		opts.Log.Errorf("browse needs exactly one input file, other than stdin, got %d.", len(inputFiles))
+		return exitError
+	}
+	path := inputFiles[0]
+	opts.Log.StartFile(path)
+	messages, err := refdbc.LoadDatabase(path, opts)
+	if err != nil {
+		opts.Log.Errorf("reading %s: %v", path, err)
+		return exitError
+	}
+	if err := refdbc.BrowseTerminal(messages, filepath.Base(path), refdbc.Stdin, os.Stdin, os.Stdout); err != nil {
+		opts.Log.Errorf("%v", err)
+		return exitError
+	}
+	return 0
+}
+
+// writeReport writes report to path as format.
+func writeReport(report *refdbc.Report, path, format string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(file, format); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
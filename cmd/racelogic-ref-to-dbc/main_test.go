@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// runMainEnv, when set, makes the test binary run main instead of the tests,
+// so tests can check the exit status of the command.
+const runMainEnv = "RACELOGIC_REF_TO_DBC_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCommand runs the command with args and returns its exit status.
+func runCommand(t *testing.T, args ...string) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	out, err := cmd.CombinedOutput()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return exit.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("running %v: %v", args, err)
+	}
+	t.Logf("%v:\n%s", args, out)
+	return 0
+}
+
+func TestDiffExitStatus(t *testing.T) {
+	basic := filepath.Join("..", "..", "testdata", "basic.ref")
+	features := filepath.Join("..", "..", "testdata", "features.ref")
+	missing := filepath.Join(t.TempDir(), "missing.ref")
+	tests := []struct {
+		name  string
+		files []string
+		want  int
+	}{
+		{"identical", []string{basic, basic}, 0},
+		{"different", []string{basic, features}, exitDifferent},
+		{"unreadable", []string{basic, missing}, exitError},
+		{"one file", []string{basic}, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-ci", "-diff"}, tt.files...)
+			if got := runCommand(t, args...); got != tt.want {
+				t.Errorf("exit status %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
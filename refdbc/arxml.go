@@ -0,0 +1,520 @@
+package refdbc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// arxmlNamespace is the XML namespace of AUTOSAR 4.x documents.
+const arxmlNamespace = "http://autosar.org/schema/r4.0"
+
+// arxmlDocument is the root element of an ARXML file.
+type arxmlDocument struct {
+	XMLName        xml.Name       `xml:"AUTOSAR"`
+	Xmlns          string         `xml:"xmlns,attr"`
+	XmlnsXSI       string         `xml:"xmlns:xsi,attr"`
+	SchemaLocation string         `xml:"xsi:schemaLocation,attr"`
+	Packages       []arxmlPackage `xml:"AR-PACKAGES>AR-PACKAGE"`
+}
+
+// arxmlPackage is an AR-PACKAGE. Each package holds elements of one kind.
+type arxmlPackage struct {
+	ShortName string        `xml:"SHORT-NAME"`
+	Elements  arxmlElements `xml:"ELEMENTS"`
+}
+
+type arxmlElements struct {
+	Clusters      []arxmlCluster      `xml:"CAN-CLUSTER"`
+	Frames        []arxmlFrame        `xml:"CAN-FRAME"`
+	PDUs          []arxmlPDU          `xml:"I-SIGNAL-I-PDU"`
+	MuxPDUs       []arxmlMuxPDU       `xml:"MULTIPLEXED-I-PDU"`
+	ISignals      []arxmlISignal      `xml:"I-SIGNAL"`
+	SystemSignals []arxmlSystemSignal `xml:"SYSTEM-SIGNAL"`
+	CompuMethods  []arxmlCompuMethod  `xml:"COMPU-METHOD"`
+	DataConstrs   []arxmlDataConstr   `xml:"DATA-CONSTR"`
+	Units         []arxmlUnit         `xml:"UNIT"`
+	BaseTypes     []arxmlBaseType     `xml:"SW-BASE-TYPE"`
+}
+
+// empty reports whether the package holds no elements.
+func (e arxmlElements) empty() bool {
+	return len(e.Clusters)+len(e.Frames)+len(e.PDUs)+len(e.MuxPDUs)+len(e.ISignals)+len(e.SystemSignals)+
+		len(e.CompuMethods)+len(e.DataConstrs)+len(e.Units)+len(e.BaseTypes) == 0
+}
+
+// arxmlRef refers to another element by its path, such as /Frames/Speed.
+type arxmlRef struct {
+	Dest string `xml:"DEST,attr"`
+	Path string `xml:",chardata"`
+}
+
+// arxmlDesc is the English description of an element.
+type arxmlDesc struct {
+	Text arxmlText `xml:"L-2"`
+}
+
+type arxmlText struct {
+	Lang string `xml:"L,attr"`
+	Text string `xml:",chardata"`
+}
+
+// newArxmlDesc returns a description holding comment, or nil when it is empty.
+func newArxmlDesc(comment string) *arxmlDesc {
+	if comment == "" {
+		return nil
+	}
+	return &arxmlDesc{Text: arxmlText{Lang: "EN", Text: comment}}
+}
+
+type arxmlCluster struct {
+	ShortName string              `xml:"SHORT-NAME"`
+	Variants  arxmlClusterVariant `xml:"CAN-CLUSTER-VARIANTS>CAN-CLUSTER-CONDITIONAL"`
+}
+
+type arxmlClusterVariant struct {
+	Channels []arxmlChannel `xml:"PHYSICAL-CHANNELS>CAN-PHYSICAL-CHANNEL"`
+}
+
+type arxmlChannel struct {
+	ShortName          string                  `xml:"SHORT-NAME"`
+	FrameTriggerings   []arxmlFrameTriggering  `xml:"FRAME-TRIGGERINGS>CAN-FRAME-TRIGGERING"`
+	PDUTriggerings     []arxmlPDUTriggering    `xml:"PDU-TRIGGERINGS>PDU-TRIGGERING"`
+	ISignalTriggerings []arxmlSignalTriggering `xml:"I-SIGNAL-TRIGGERINGS>I-SIGNAL-TRIGGERING"`
+}
+
+type arxmlFrameTriggering struct {
+	ShortName      string     `xml:"SHORT-NAME"`
+	FrameRef       arxmlRef   `xml:"FRAME-REF"`
+	PDUTriggerings []arxmlRef `xml:"PDU-TRIGGERINGS>PDU-TRIGGERING-REF-CONDITIONAL>PDU-TRIGGERING-REF"`
+	AddressingMode string     `xml:"CAN-ADDRESSING-MODE"`             // STANDARD or EXTENDED
+	RxBehavior     string     `xml:"CAN-FRAME-RX-BEHAVIOR,omitempty"` // CAN-FD for payloads above 8 bytes
+	TxBehavior     string     `xml:"CAN-FRAME-TX-BEHAVIOR,omitempty"`
+	Identifier     uint32     `xml:"IDENTIFIER"`
+}
+
+type arxmlPDUTriggering struct {
+	ShortName          string     `xml:"SHORT-NAME"`
+	PDURef             arxmlRef   `xml:"I-PDU-REF"`
+	ISignalTriggerings []arxmlRef `xml:"I-SIGNAL-TRIGGERINGS>I-SIGNAL-TRIGGERING-REF-CONDITIONAL>I-SIGNAL-TRIGGERING-REF"`
+}
+
+type arxmlSignalTriggering struct {
+	ShortName  string   `xml:"SHORT-NAME"`
+	ISignalRef arxmlRef `xml:"I-SIGNAL-REF"`
+}
+
+type arxmlFrame struct {
+	ShortName   string              `xml:"SHORT-NAME"`
+	Desc        *arxmlDesc          `xml:"DESC"`
+	FrameLength int                 `xml:"FRAME-LENGTH"`
+	Mappings    []arxmlFrameMapping `xml:"PDU-TO-FRAME-MAPPINGS>PDU-TO-FRAME-MAPPING"`
+}
+
+type arxmlFrameMapping struct {
+	ShortName     string   `xml:"SHORT-NAME"`
+	ByteOrder     string   `xml:"PACKING-BYTE-ORDER"`
+	PDURef        arxmlRef `xml:"PDU-REF"`
+	StartPosition int      `xml:"START-POSITION"`
+}
+
+type arxmlPDU struct {
+	ShortName string            `xml:"SHORT-NAME"`
+	Desc      *arxmlDesc        `xml:"DESC"`
+	Length    int               `xml:"LENGTH"`
+	Timing    *arxmlPDUTiming   `xml:"I-PDU-TIMING-SPECIFICATIONS>I-PDU-TIMING"`
+	Mappings  []arxmlPDUMapping `xml:"I-SIGNAL-TO-PDU-MAPPINGS>I-SIGNAL-TO-I-PDU-MAPPING"`
+}
+
+// arxmlPDUTiming sends the PDU cyclically, with the period in seconds.
+type arxmlPDUTiming struct {
+	Period string `xml:"TRANSMISSION-MODE-DECLARATION>TRANSMISSION-MODE-TRUE-TIMING>CYCLIC-TIMING>TIME-PERIOD>VALUE"`
+}
+
+// arxmlMuxPDU is the payload of a multiplexed message: a static part holding
+// the signals of every frame, and a dynamic part with an alternative for each
+// multiplexor value, chosen by the value of the selector field.
+type arxmlMuxPDU struct {
+	ShortName         string                `xml:"SHORT-NAME"`
+	Length            int                   `xml:"LENGTH"`
+	Segments          []arxmlSegment        `xml:"DYNAMIC-PARTS>DYNAMIC-PART>SEGMENT-POSITIONS>SEGMENT-POSITION"`
+	Alternatives      []arxmlMuxAlternative `xml:"DYNAMIC-PARTS>DYNAMIC-PART>DYNAMIC-PART-ALTERNATIVES>DYNAMIC-PART-ALTERNATIVE"`
+	SelectorByteOrder string                `xml:"SELECTOR-FIELD-BYTE-ORDER"`
+	SelectorLength    int                   `xml:"SELECTOR-FIELD-LENGTH"`
+	SelectorStart     int                   `xml:"SELECTOR-FIELD-START-POSITION"`
+	StaticPart        arxmlRef              `xml:"STATIC-PARTS>STATIC-PART>I-PDU-REF"`
+	TriggerMode       string                `xml:"TRIGGER-MODE"`
+}
+
+type arxmlSegment struct {
+	ByteOrder string `xml:"SEGMENT-BYTE-ORDER"`
+	Length    int    `xml:"SEGMENT-LENGTH"`
+	Position  int    `xml:"SEGMENT-POSITION"`
+}
+
+type arxmlMuxAlternative struct {
+	PDURef  arxmlRef `xml:"I-PDU-REF"`
+	Initial bool     `xml:"INITIAL-DYNAMIC-PART"`
+	Code    int      `xml:"SELECTOR-FIELD-CODE"`
+}
+
+type arxmlPDUMapping struct {
+	ShortName        string   `xml:"SHORT-NAME"`
+	ISignalRef       arxmlRef `xml:"I-SIGNAL-REF"`
+	ByteOrder        string   `xml:"PACKING-BYTE-ORDER"`
+	StartPosition    int      `xml:"START-POSITION"`
+	TransferProperty string   `xml:"TRANSFER-PROPERTY"`
+}
+
+type arxmlISignal struct {
+	ShortName       string       `xml:"SHORT-NAME"`
+	Desc            *arxmlDesc   `xml:"DESC"`
+	DataTypePolicy  string       `xml:"DATA-TYPE-POLICY"`
+	Length          int          `xml:"LENGTH"`
+	Props           arxmlSWProps `xml:"NETWORK-REPRESENTATION-PROPS>SW-DATA-DEF-PROPS-VARIANTS>SW-DATA-DEF-PROPS-CONDITIONAL"`
+	SystemSignalRef arxmlRef     `xml:"SYSTEM-SIGNAL-REF"`
+}
+
+type arxmlSWProps struct {
+	BaseTypeRef    arxmlRef  `xml:"BASE-TYPE-REF"`
+	CompuMethodRef arxmlRef  `xml:"COMPU-METHOD-REF"`
+	DataConstrRef  arxmlRef  `xml:"DATA-CONSTR-REF"`
+	UnitRef        *arxmlRef `xml:"UNIT-REF"`
+}
+
+type arxmlSystemSignal struct {
+	ShortName     string     `xml:"SHORT-NAME"`
+	Desc          *arxmlDesc `xml:"DESC"`
+	DynamicLength bool       `xml:"DYNAMIC-LENGTH"`
+}
+
+type arxmlCompuMethod struct {
+	ShortName string            `xml:"SHORT-NAME"`
+	Category  string            `xml:"CATEGORY"` // LINEAR, or SCALE_LINEAR_AND_TEXTTABLE with a value table
+	UnitRef   *arxmlRef         `xml:"UNIT-REF"`
+	Scales    []arxmlCompuScale `xml:"COMPU-INTERNAL-TO-PHYS>COMPU-SCALES>COMPU-SCALE"`
+}
+
+// arxmlCompuScale is either a text scale, labelling the raw value between its
+// equal limits, or the linear scale phys = (numerator[0] + numerator[1]*raw) / denominator.
+type arxmlCompuScale struct {
+	ShortLabel string             `xml:"SHORT-LABEL,omitempty"`
+	LowerLimit *arxmlLimit        `xml:"LOWER-LIMIT"`
+	UpperLimit *arxmlLimit        `xml:"UPPER-LIMIT"`
+	Rational   *arxmlRationalCoef `xml:"COMPU-RATIONAL-COEFFS"`
+	Const      *arxmlCompuConst   `xml:"COMPU-CONST"`
+}
+
+type arxmlCompuConst struct {
+	Text string `xml:"VT"`
+}
+
+type arxmlLimit struct {
+	IntervalType string `xml:"INTERVAL-TYPE,attr"`
+	Value        string `xml:",chardata"`
+}
+
+type arxmlRationalCoef struct {
+	Numerator   []string `xml:"COMPU-NUMERATOR>V"`
+	Denominator []string `xml:"COMPU-DENOMINATOR>V"`
+}
+
+type arxmlDataConstr struct {
+	ShortName  string     `xml:"SHORT-NAME"`
+	LowerLimit arxmlLimit `xml:"DATA-CONSTR-RULES>DATA-CONSTR-RULE>PHYS-CONSTRS>LOWER-LIMIT"`
+	UpperLimit arxmlLimit `xml:"DATA-CONSTR-RULES>DATA-CONSTR-RULE>PHYS-CONSTRS>UPPER-LIMIT"`
+}
+
+type arxmlUnit struct {
+	ShortName   string `xml:"SHORT-NAME"`
+	DisplayName string `xml:"DISPLAY-NAME"`
+}
+
+type arxmlBaseType struct {
+	ShortName string `xml:"SHORT-NAME"`
+	Category  string `xml:"CATEGORY"`
+	Size      int    `xml:"BASE-TYPE-SIZE"`
+	Encoding  string `xml:"BASE-TYPE-ENCODING"` // NONE, 2C or IEEE754
+}
+
+// arxmlShortName turns s into an AUTOSAR short name, which must start with a
+// letter and may only hold letters, digits and underscores.
+func arxmlShortName(s string) string {
+	name := sanitizeIdentifier(s)
+	if name == "" || !(name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z') {
+		name = "X" + name
+	}
+	return name
+}
+
+// arxmlUniqueName returns the short name for s, made unique among taken.
+func arxmlUniqueName(s string, taken map[string]bool) string {
+	name := arxmlShortName(s)
+	if taken[name] {
+		return uniqueName(name, taken)
+	}
+	taken[name] = true
+	return name
+}
+
+// writeARXML writes the messages as an AUTOSAR 4.x system description: a CAN
+// cluster with one physical channel triggering a CAN-FRAME per message, each
+// carrying an I-SIGNAL-I-PDU of the same name that maps its I-SIGNALs. Every
+// signal gets a SYSTEM-SIGNAL, a COMPU-METHOD for its scaling and value table,
+// a DATA-CONSTR for its range, and references a UNIT and SW-BASE-TYPE shared
+// by the signals using them. Nodes are not written.
+//
+// A multiplexed message carries a MULTIPLEXED-I-PDU instead, whose selector
+// field is the multiplexor. Its static part is an I-SIGNAL-I-PDU named
+// <message>_Static holding the signals of every frame, and its dynamic part
+// has an I-SIGNAL-I-PDU named <message>_m<value> for each multiplexor value.
+// The multiplexor is only written as the selector field, so its scaling and
+// comment are left out. Messages whose multiplexing has no single multiplexor
+// are an error.
+//
+// ARXML gives the start position of a big-endian signal as its least
+// significant bit, in DBC bit numbering, so Motorola start bits are converted
+// as for -bit-convention lsb.
+func writeARXML(messages map[uint32]*Message, w io.Writer, opts Options) error {
+	channel := arxmlChannel{ShortName: "CANChannel"}
+	channelPath := "/Cluster/CAN/" + channel.ShortName
+	var frames, pdus, signals, systemSignals, compuMethods, dataConstrs, units, baseTypes arxmlPackage
+	frames.ShortName, pdus.ShortName, signals.ShortName = "Frames", "PDUs", "ISignals"
+	systemSignals.ShortName, compuMethods.ShortName, dataConstrs.ShortName = "SystemSignals", "CompuMethods", "DataConstrs"
+	units.ShortName, baseTypes.ShortName = "Units", "BaseTypes"
+
+	messageNames := make(map[string]bool)
+	pduNames := make(map[string]bool)
+	signalNames := make(map[string]bool)
+	unitNames := make(map[string]string) // Keyed by unit
+	takenUnits := make(map[string]bool)
+	baseTypeNames := make(map[string]bool)
+
+	// addPDU writes an I-SIGNAL-I-PDU named after name mapping the signals of
+	// msg, with its PDU-TRIGGERING, and returns the paths of both.
+	addPDU := func(name string, msg *Message, sigs []*Signal) (pduPath, triggeringPath string) {
+		name = arxmlUniqueName(name, pduNames)
+		pduTriggering := arxmlPDUTriggering{ShortName: name + "_PduTriggering", PDURef: arxmlRef{Dest: "I-SIGNAL-I-PDU", Path: "/PDUs/" + name}}
+		pdu := arxmlPDU{ShortName: name, Length: msg.DLC}
+		if msg.CycleTime > 0 {
+			pdu.Timing = &arxmlPDUTiming{Period: formatFloat(float64(msg.CycleTime)/1000, opts)}
+		}
+
+		for _, sig := range sigs {
+			sigName := arxmlUniqueName(msg.Name+"_"+sig.Name, signalNames)
+			signalPath := "/ISignals/" + sigName
+			signalTriggering := arxmlSignalTriggering{ShortName: sigName + "_ISignalTriggering", ISignalRef: arxmlRef{Dest: "I-SIGNAL", Path: signalPath}}
+			channel.ISignalTriggerings = append(channel.ISignalTriggerings, signalTriggering)
+			pduTriggering.ISignalTriggerings = append(pduTriggering.ISignalTriggerings, arxmlRef{Dest: "I-SIGNAL-TRIGGERING", Path: channelPath + "/" + signalTriggering.ShortName})
+
+			byteOrder, start := arxmlStartPosition(sig)
+			pdu.Mappings = append(pdu.Mappings, arxmlPDUMapping{
+				ShortName:        sig.Name,
+				ISignalRef:       arxmlRef{Dest: "I-SIGNAL", Path: signalPath},
+				ByteOrder:        byteOrder,
+				StartPosition:    start,
+				TransferProperty: "PENDING",
+			})
+
+			baseType := arxmlSignalBaseType(sig)
+			if !baseTypeNames[baseType.ShortName] {
+				baseTypeNames[baseType.ShortName] = true
+				baseTypes.Elements.BaseTypes = append(baseTypes.Elements.BaseTypes, baseType)
+			}
+			var unitRef *arxmlRef
+			if sig.Unit != "" {
+				unitName, ok := unitNames[sig.Unit]
+				if !ok {
+					unitName = arxmlUniqueName("Unit_"+sig.Unit, takenUnits)
+					unitNames[sig.Unit] = unitName
+					units.Elements.Units = append(units.Elements.Units, arxmlUnit{ShortName: unitName, DisplayName: sig.Unit})
+				}
+				unitRef = &arxmlRef{Dest: "UNIT", Path: "/Units/" + unitName}
+			}
+
+			signals.Elements.ISignals = append(signals.Elements.ISignals, arxmlISignal{
+				ShortName:      sigName,
+				Desc:           newArxmlDesc(sig.Comment),
+				DataTypePolicy: "OVERRIDE",
+				Length:         sig.Length,
+				Props: arxmlSWProps{
+					BaseTypeRef:    arxmlRef{Dest: "SW-BASE-TYPE", Path: "/BaseTypes/" + baseType.ShortName},
+					CompuMethodRef: arxmlRef{Dest: "COMPU-METHOD", Path: "/CompuMethods/" + sigName},
+					DataConstrRef:  arxmlRef{Dest: "DATA-CONSTR", Path: "/DataConstrs/" + sigName},
+					UnitRef:        unitRef,
+				},
+				SystemSignalRef: arxmlRef{Dest: "SYSTEM-SIGNAL", Path: "/SystemSignals/" + sigName},
+			})
+			systemSignals.Elements.SystemSignals = append(systemSignals.Elements.SystemSignals, arxmlSystemSignal{ShortName: sigName, Desc: newArxmlDesc(sig.Comment)})
+			compuMethods.Elements.CompuMethods = append(compuMethods.Elements.CompuMethods, arxmlSignalCompuMethod(sigName, sig, unitRef, opts))
+			dataConstrs.Elements.DataConstrs = append(dataConstrs.Elements.DataConstrs, arxmlDataConstr{
+				ShortName:  sigName,
+				LowerLimit: arxmlLimit{IntervalType: "CLOSED", Value: formatFloat(sig.Min, opts)},
+				UpperLimit: arxmlLimit{IntervalType: "CLOSED", Value: formatFloat(sig.Max, opts)},
+			})
+		}
+
+		pdus.Elements.PDUs = append(pdus.Elements.PDUs, pdu)
+		channel.PDUTriggerings = append(channel.PDUTriggerings, pduTriggering)
+		return pduTriggering.PDURef.Path, channelPath + "/" + pduTriggering.ShortName
+	}
+
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		multiplexor, err := messageMultiplexor(msg)
+		if err != nil {
+			return err
+		}
+		name := arxmlUniqueName(msg.Name, messageNames)
+		framePath := "/Frames/" + name
+		frame := arxmlFrame{
+			ShortName:   name,
+			Desc:        newArxmlDesc(msg.Comment),
+			FrameLength: msg.DLC,
+			Mappings: []arxmlFrameMapping{{
+				ShortName: name,
+				ByteOrder: "MOST-SIGNIFICANT-BYTE-LAST",
+			}},
+		}
+		triggering := arxmlFrameTriggering{
+			ShortName:      name + "_FrameTriggering",
+			FrameRef:       arxmlRef{Dest: "CAN-FRAME", Path: framePath},
+			AddressingMode: "STANDARD",
+			Identifier:     msg.ID,
+		}
+		if msg.IsExtended {
+			triggering.AddressingMode = "EXTENDED"
+		}
+		if msg.DLC > 8 || opts.CANFD {
+			triggering.RxBehavior, triggering.TxBehavior = "CAN-FD", "CAN-FD"
+		}
+
+		if multiplexor == nil {
+			pduPath, pduTriggeringPath := addPDU(name, msg, msg.Signals)
+			frame.Mappings[0].PDURef = arxmlRef{Dest: "I-SIGNAL-I-PDU", Path: pduPath}
+			triggering.PDUTriggerings = []arxmlRef{{Dest: "PDU-TRIGGERING", Path: pduTriggeringPath}}
+		} else {
+			muxName := arxmlUniqueName(name, pduNames)
+			byteOrder, start := arxmlStartPosition(multiplexor)
+			muxPDU := arxmlMuxPDU{
+				ShortName:         muxName,
+				Length:            msg.DLC,
+				Segments:          []arxmlSegment{{ByteOrder: "MOST-SIGNIFICANT-BYTE-LAST", Length: msg.DLC * 8}},
+				SelectorByteOrder: byteOrder,
+				SelectorLength:    multiplexor.Length,
+				SelectorStart:     start,
+				TriggerMode:       "DYNAMIC-PART-TRIGGER",
+			}
+			var static []*Signal
+			for _, sig := range msg.Signals {
+				if sig.MuxRole == muxNone {
+					static = append(static, sig)
+				}
+			}
+			staticPath, _ := addPDU(name+"_Static", msg, static)
+			muxPDU.StaticPart = arxmlRef{Dest: "I-SIGNAL-I-PDU", Path: staticPath}
+			for i, value := range muxValues(msg) {
+				var dynamic []*Signal
+				for _, sig := range msg.Signals {
+					if sig.MuxRole == muxMultiplexed && sig.MuxValue == value {
+						dynamic = append(dynamic, sig)
+					}
+				}
+				path, _ := addPDU(fmt.Sprintf("%s_m%d", name, value), msg, dynamic)
+				muxPDU.Alternatives = append(muxPDU.Alternatives, arxmlMuxAlternative{
+					PDURef:  arxmlRef{Dest: "I-SIGNAL-I-PDU", Path: path},
+					Initial: i == 0,
+					Code:    value,
+				})
+			}
+			pdus.Elements.MuxPDUs = append(pdus.Elements.MuxPDUs, muxPDU)
+
+			muxTriggering := arxmlPDUTriggering{ShortName: muxName + "_PduTriggering", PDURef: arxmlRef{Dest: "MULTIPLEXED-I-PDU", Path: "/PDUs/" + muxName}}
+			channel.PDUTriggerings = append(channel.PDUTriggerings, muxTriggering)
+			frame.Mappings[0].PDURef = muxTriggering.PDURef
+			triggering.PDUTriggerings = []arxmlRef{{Dest: "PDU-TRIGGERING", Path: channelPath + "/" + muxTriggering.ShortName}}
+		}
+
+		frames.Elements.Frames = append(frames.Elements.Frames, frame)
+		channel.FrameTriggerings = append(channel.FrameTriggerings, triggering)
+	}
+
+	cluster := arxmlPackage{ShortName: "Cluster"}
+	cluster.Elements.Clusters = []arxmlCluster{{ShortName: "CAN", Variants: arxmlClusterVariant{Channels: []arxmlChannel{channel}}}}
+	doc := arxmlDocument{
+		Xmlns:          arxmlNamespace,
+		XmlnsXSI:       "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: arxmlNamespace + " AUTOSAR_4-3-0.xsd",
+	}
+	for _, pkg := range []arxmlPackage{cluster, frames, pdus, signals, systemSignals, compuMethods, dataConstrs, units, baseTypes} {
+		if !pkg.Elements.empty() {
+			doc.Packages = append(doc.Packages, pkg)
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "<!-- %s -->\n", annotation(fmt.Sprintf("Generated by racelogic-ref-to-dbc %s", Version), opts.Source)); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// arxmlStartPosition returns the PACKING-BYTE-ORDER and START-POSITION of sig.
+func arxmlStartPosition(sig *Signal) (byteOrder string, start int) {
+	if sig.ByteOrder == 0 {
+		return "MOST-SIGNIFICANT-BYTE-FIRST", refStartBit(sig.StartBit, sig.Length, "lsb")
+	}
+	return "MOST-SIGNIFICANT-BYTE-LAST", sig.StartBit
+}
+
+// arxmlSignalBaseType returns the SW-BASE-TYPE of the raw value of sig, such as
+// UINT16, SINT12 or FLOAT32.
+func arxmlSignalBaseType(sig *Signal) arxmlBaseType {
+	base := arxmlBaseType{Category: "FIXED_LENGTH", Size: sig.Length}
+	switch {
+	case sig.ValueType != 0:
+		base.ShortName, base.Encoding = "FLOAT", "IEEE754"
+	case sig.IsSigned:
+		base.ShortName, base.Encoding = "SINT", "2C"
+	default:
+		base.ShortName, base.Encoding = "UINT", "NONE"
+	}
+	base.ShortName += strconv.Itoa(sig.Length)
+	return base
+}
+
+// arxmlSignalCompuMethod returns the COMPU-METHOD converting the raw value of
+// sig to its physical value: a linear scale, preceded by a text scale for each
+// entry of the value table.
+func arxmlSignalCompuMethod(name string, sig *Signal, unitRef *arxmlRef, opts Options) arxmlCompuMethod {
+	method := arxmlCompuMethod{ShortName: name, Category: "LINEAR", UnitRef: unitRef}
+	if len(sig.ValueTable) > 0 {
+		method.Category = "SCALE_LINEAR_AND_TEXTTABLE"
+		for _, vd := range sig.ValueTable {
+			value := strconv.FormatInt(vd.Value, 10)
+			method.Scales = append(method.Scales, arxmlCompuScale{
+				ShortLabel: arxmlShortName(vd.Label),
+				LowerLimit: &arxmlLimit{IntervalType: "CLOSED", Value: value},
+				UpperLimit: &arxmlLimit{IntervalType: "CLOSED", Value: value},
+				Const:      &arxmlCompuConst{Text: strings.TrimSpace(vd.Label)},
+			})
+		}
+	}
+	method.Scales = append(method.Scales, arxmlCompuScale{
+		Rational: &arxmlRationalCoef{
+			Numerator:   []string{formatFloat(sig.Offset, opts), formatFloat(sig.Factor, opts)},
+			Denominator: []string{"1"},
+		},
+	})
+	return method
+}
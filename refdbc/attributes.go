@@ -0,0 +1,362 @@
+package refdbc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// AttributeDef defines a DBC attribute, written as BA_DEF_ with its default as
+// BA_DEF_DEF_.
+type AttributeDef struct {
+	Name    string
+	Object  string   // network, node, message or signal
+	Type    string   // INT, HEX, FLOAT, STRING or ENUM
+	Min     float64  // Lower bound of INT, HEX and FLOAT attributes
+	Max     float64  // Upper bound of INT, HEX and FLOAT attributes
+	Values  []string // Labels of ENUM attributes
+	Default string   // Written as BA_DEF_DEF_ when set
+	Value   string   // Value of a network attribute, written as BA_ when set
+}
+
+// AttributeObjects maps the object names of an attributes file to their DBC keywords.
+var AttributeObjects = map[string]string{
+	"network": "",
+	"node":    "BU_",
+	"message": "BO_",
+	"signal":  "SG_",
+}
+
+// AttributeTypes lists the value types of DBC attributes.
+var AttributeTypes = []string{"INT", "HEX", "FLOAT", "STRING", "ENUM"}
+
+// Attributes written for messages with a cycle time, unless an attributes file
+// defines them differently.
+const (
+	cycleTimeAttribute = "GenMsgCycleTime"
+	sendTypeAttribute  = "GenMsgSendType"
+	cyclicSendType     = "Cyclic"
+)
+
+// Attributes written with Options.CANFD, unless an attributes file defines
+// them differently.
+const (
+	busTypeAttribute     = "BusType"
+	frameFormatAttribute = "VFrameFormat"
+	canFDBRSAttribute    = "CANFD_BRS"
+)
+
+// defaultCycleAttributes returns the definitions of the cycle time and send
+// type attributes, in the form Vector tools use.
+func defaultCycleAttributes() []AttributeDef {
+	return []AttributeDef{
+		{Name: cycleTimeAttribute, Object: "message", Type: "INT", Min: 0, Max: 65535, Default: "0"},
+		{Name: sendTypeAttribute, Object: "message", Type: "ENUM", Values: []string{cyclicSendType, "NoMsgSendType"}, Default: "NoMsgSendType"},
+	}
+}
+
+// defaultCANFDAttributes returns the definitions of the bus type, frame
+// format and bit rate switch attributes, in the form Vector tools use for
+// CAN FD networks.
+func defaultCANFDAttributes() []AttributeDef {
+	return []AttributeDef{
+		{Name: busTypeAttribute, Object: "network", Type: "STRING", Default: "CAN", Value: "CAN FD"},
+		{Name: frameFormatAttribute, Object: "message", Type: "ENUM", Values: []string{
+			"StandardCAN", "ExtendedCAN", "reserved", "J1939PG", "reserved", "reserved", "reserved", "reserved",
+			"reserved", "reserved", "reserved", "reserved", "reserved", "reserved", "StandardCAN_FD", "ExtendedCAN_FD",
+		}, Default: "StandardCAN"},
+		{Name: canFDBRSAttribute, Object: "message", Type: "ENUM", Values: []string{"0", "1"}, Default: "1"},
+	}
+}
+
+// attributeEntry is one attribute of an attributes file, before validation.
+type attributeEntry struct {
+	Object  string      `json:"object"`
+	Type    string      `json:"type"`
+	Min     float64     `json:"min"`
+	Max     float64     `json:"max"`
+	Values  string      `json:"values"` // Comma-separated ENUM labels
+	Default interface{} `json:"default"`
+	Value   interface{} `json:"value"`
+}
+
+// LoadAttributes reads a JSON file of DBC attribute definitions, keyed by
+// attribute name, to write into DBC output:
+//
+//	{
+//	  "BusType": {"object": "network", "type": "STRING", "value": "CAN"},
+//	  "GenMsgCycleTime": {"object": "message", "type": "INT", "min": 0, "max": 10000, "default": 100}
+//	}
+//
+// Files ending in .yaml or .yml are read as YAML with the same structure. The
+// labels of an ENUM attribute are given as one comma-separated string. Unlike
+// overrides, unknown keys are an error, since a misspelt key would otherwise
+// change the written definition.
+func LoadAttributes(path string) ([]AttributeDef, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open attributes file: %w", err)
+	}
+	if IsYAMLFile(path) {
+		doc, err := ParseYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("attributes file %s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("attributes file %s: %w", path, err)
+		}
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("attributes file %s: %w", path, err)
+	}
+	defs := make([]AttributeDef, 0, len(raw))
+	for _, name := range sortedKeys(raw) {
+		var entry attributeEntry
+		decoder := json.NewDecoder(strings.NewReader(string(raw[name])))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("attributes file %s: attribute %s: %w", path, name, err)
+		}
+		def, err := newAttributeDef(name, entry)
+		if err != nil {
+			return nil, fmt.Errorf("attributes file %s: attribute %s: %w", path, name, err)
+		}
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+// newAttributeDef validates an entry of an attributes file.
+func newAttributeDef(name string, entry attributeEntry) (AttributeDef, error) {
+	def := AttributeDef{
+		Name:   name,
+		Object: strings.ToLower(entry.Object),
+		Type:   strings.ToUpper(entry.Type),
+		Min:    entry.Min,
+		Max:    entry.Max,
+	}
+	if !IsValidIdentifier(name) {
+		return def, fmt.Errorf("name is not a valid DBC identifier")
+	}
+	if _, ok := AttributeObjects[def.Object]; !ok {
+		return def, fmt.Errorf("unknown object '%s' (expected network, node, message or signal)", entry.Object)
+	}
+	if !isValidChoice(def.Type, AttributeTypes) {
+		return def, fmt.Errorf("unknown type '%s' (expected %s)", entry.Type, strings.Join(AttributeTypes, ", "))
+	}
+	if def.Type == "ENUM" {
+		for _, label := range strings.Split(entry.Values, ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				def.Values = append(def.Values, label)
+			}
+		}
+		if len(def.Values) == 0 {
+			return def, fmt.Errorf("ENUM attribute has no values")
+		}
+	} else if entry.Values != "" {
+		return def, fmt.Errorf("values are only allowed for ENUM attributes")
+	}
+	if def.Min > def.Max {
+		return def, fmt.Errorf("min %s is greater than max %s", formatNumber(def.Min), formatNumber(def.Max))
+	}
+
+	var err error
+	if def.Default, err = attributeValue(def, entry.Default); err != nil {
+		return def, fmt.Errorf("default: %w", err)
+	}
+	if def.Value, err = attributeValue(def, entry.Value); err != nil {
+		return def, fmt.Errorf("value: %w", err)
+	}
+	if def.Value != "" && def.Object != "network" {
+		return def, fmt.Errorf("a value can only be given for network attributes")
+	}
+	return def, nil
+}
+
+// attributeValue checks a default or value of an attributes file against the
+// definition and returns it as text; nil gives an empty string.
+func attributeValue(def AttributeDef, value interface{}) (string, error) {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case float64:
+		text = formatNumber(v)
+	case string:
+		text = v
+	default:
+		return "", fmt.Errorf("expected a number or a string")
+	}
+
+	switch def.Type {
+	case "INT", "HEX", "FLOAT":
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return "", fmt.Errorf("'%s' is not a number", text)
+		}
+		if def.Type != "FLOAT" && f != float64(int64(f)) {
+			return "", fmt.Errorf("'%s' is not an integer", text)
+		}
+		if (def.Min != 0 || def.Max != 0) && (f < def.Min || f > def.Max) {
+			return "", fmt.Errorf("%s is outside the range %s to %s", text, formatNumber(def.Min), formatNumber(def.Max))
+		}
+	case "ENUM":
+		if !isValidChoice(text, def.Values) {
+			return "", fmt.Errorf("'%s' is not one of %s", text, strings.Join(def.Values, ", "))
+		}
+	}
+	return text, nil
+}
+
+// formatNumber formats an attribute number in its shortest form, without an exponent.
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// isValidChoice reports whether value is one of choices.
+func isValidChoice(value string, choices []string) bool {
+	for _, choice := range choices {
+		if value == choice {
+			return true
+		}
+	}
+	return false
+}
+
+// findAttribute returns the definition named name, or nil.
+func findAttribute(defs []AttributeDef, name string) *AttributeDef {
+	for i := range defs {
+		if defs[i].Name == name {
+			return &defs[i]
+		}
+	}
+	return nil
+}
+
+// writeAttributes writes the BA_DEF_, BA_DEF_DEF_ and BA_ sections of a DBC
+// file: the definitions of opts.Attributes and, when any message has a cycle
+// time, those of GenMsgCycleTime and GenMsgSendType not already among them.
+// Cyclic messages get a GenMsgCycleTime value, and a GenMsgSendType of Cyclic
+// when the send type attribute has that label. With opts.CANFD the BusType,
+// VFrameFormat and CANFD_BRS definitions are added the same way, and every
+// message gets a VFrameFormat of StandardCAN_FD or ExtendedCAN_FD. The
+// network attributes opts.Compat needs are added last.
+func writeAttributes(messages map[uint32]*Message, w *bufio.Writer, opts Options) {
+	ids := orderedMessageIDs(messages, opts)
+	defs := append([]AttributeDef(nil), opts.Attributes...)
+	cyclic := false
+	for _, id := range ids {
+		if messages[id].CycleTime > 0 {
+			cyclic = true
+			break
+		}
+	}
+	if cyclic {
+		for _, def := range defaultCycleAttributes() {
+			if findAttribute(defs, def.Name) == nil {
+				defs = append(defs, def)
+			}
+		}
+	}
+	if opts.CANFD {
+		for _, def := range defaultCANFDAttributes() {
+			if findAttribute(defs, def.Name) == nil {
+				defs = append(defs, def)
+			}
+		}
+	}
+	for _, def := range compatAttributes(opts) {
+		if findAttribute(defs, def.Name) == nil {
+			defs = append(defs, def)
+		}
+	}
+	if len(defs) == 0 {
+		return
+	}
+
+	for _, def := range defs {
+		var kind string
+		switch def.Type {
+		case "STRING":
+			kind = "STRING "
+		case "ENUM":
+			labels := make([]string, len(def.Values))
+			for i, label := range def.Values {
+				labels[i] = fmt.Sprintf("\"%s\"", escapeDBCString(label))
+			}
+			kind = "ENUM  " + strings.Join(labels, ",")
+		default:
+			kind = fmt.Sprintf("%s %s %s", def.Type, formatNumber(def.Min), formatNumber(def.Max))
+		}
+		fmt.Fprintf(w, "BA_DEF_ %s \"%s\" %s;\n", AttributeObjects[def.Object], def.Name, kind)
+	}
+	for _, def := range defs {
+		if def.Default != "" {
+			fmt.Fprintf(w, "BA_DEF_DEF_  \"%s\" %s;\n", def.Name, quoteAttributeValue(def, def.Default))
+		}
+	}
+	for _, def := range defs {
+		if def.Value == "" {
+			continue
+		}
+		// BA_ gives an ENUM value by the index of its label.
+		value := quoteAttributeValue(def, def.Value)
+		if def.Type == "ENUM" {
+			value = strconv.Itoa(enumIndex(def, def.Value))
+		}
+		fmt.Fprintf(w, "BA_ \"%s\" %s;\n", def.Name, value)
+	}
+
+	cycleTime := findAttribute(defs, cycleTimeAttribute)
+	sendType := -1
+	if def := findAttribute(defs, sendTypeAttribute); def != nil && def.Type == "ENUM" && def.Object == "message" {
+		sendType = enumIndex(*def, cyclicSendType)
+	}
+	if def := findAttribute(defs, frameFormatAttribute); opts.CANFD && def != nil && def.Type == "ENUM" && def.Object == "message" {
+		for _, id := range ids {
+			format := "StandardCAN_FD"
+			if messages[id].IsExtended {
+				format = "ExtendedCAN_FD"
+			}
+			if index := enumIndex(*def, format); index >= 0 {
+				fmt.Fprintf(w, "BA_ \"%s\" BO_ %d %d;\n", frameFormatAttribute, messages[id].dbcID(), index)
+			}
+		}
+	}
+	for _, id := range ids {
+		msg := messages[id]
+		if msg.CycleTime <= 0 {
+			continue
+		}
+		if cycleTime != nil && cycleTime.Object == "message" {
+			fmt.Fprintf(w, "BA_ \"%s\" BO_ %d %d;\n", cycleTimeAttribute, msg.dbcID(), msg.CycleTime)
+		}
+		if sendType >= 0 {
+			fmt.Fprintf(w, "BA_ \"%s\" BO_ %d %d;\n", sendTypeAttribute, msg.dbcID(), sendType)
+		}
+	}
+}
+
+// enumIndex returns the index of label among the values of an ENUM attribute, or -1.
+func enumIndex(def AttributeDef, label string) int {
+	for i, value := range def.Values {
+		if value == label {
+			return i
+		}
+	}
+	return -1
+}
+
+// quoteAttributeValue formats a value of the attribute as written in BA_DEF_DEF_
+// lines: quoted for STRING and ENUM attributes, bare otherwise.
+func quoteAttributeValue(def AttributeDef, value string) string {
+	if def.Type == "STRING" || def.Type == "ENUM" {
+		return fmt.Sprintf("\"%s\"", escapeDBCString(value))
+	}
+	return value
+}
@@ -0,0 +1,184 @@
+package refdbc
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// bitLayout is the payload diagram of a message: for every bit, in DBC bit
+// numbering, the number of the signal using it (counting from 1), 0 if no
+// signal does, or sharedBit or overlapBit if several do.
+type bitLayout struct {
+	bits    []int
+	users   [][]int // Numbers of the signals using each bit
+	signals []*Signal
+}
+
+// Marks of bits used by more than one signal in a bitLayout.
+const (
+	sharedBit  = -1 // Used by multiplexed signals of different frames, which is fine
+	overlapBit = -2 // Used by signals sent in the same frame
+)
+
+// messageLayout returns the payload diagram of msg. Bits past the DLC are
+// left out.
+func messageLayout(msg *Message) bitLayout {
+	layout := bitLayout{
+		bits:    make([]int, msg.DLC*8),
+		users:   make([][]int, msg.DLC*8),
+		signals: msg.Signals,
+	}
+	for i, sig := range msg.Signals {
+		for _, bit := range signalBits(sig.StartBit, sig.Length, sig.ByteOrder) {
+			if bit < 0 || bit >= len(layout.bits) {
+				continue
+			}
+			for _, other := range layout.users[bit] {
+				if sameFrame(msg.Signals[other-1], sig) {
+					layout.bits[bit] = overlapBit
+				} else if layout.bits[bit] != overlapBit {
+					layout.bits[bit] = sharedBit
+				}
+			}
+			if layout.bits[bit] == 0 {
+				layout.bits[bit] = i + 1
+			}
+			layout.users[bit] = append(layout.users[bit], i+1)
+		}
+	}
+	return layout
+}
+
+// sameFrame reports whether a and b can be sent in the same frame, so they
+// must not share bits: unless both are multiplexed signals of different
+// multiplexor values.
+func sameFrame(a, b *Signal) bool {
+	return muxLayer(a) == -1 || muxLayer(b) == -1 || muxLayer(a) == muxLayer(b)
+}
+
+// label returns the text of bit in the diagram.
+func (l bitLayout) label(bit int) string {
+	switch n := l.bits[bit]; n {
+	case 0:
+		return ""
+	case sharedBit:
+		return "*"
+	case overlapBit:
+		return "X"
+	default:
+		return strconv.Itoa(n)
+	}
+}
+
+// WriteLayout prints a grid for every message showing which signal uses each
+// payload bit: a row per byte, with the bits from 7 down to 0 as DBC editors
+// show them. Signals are numbered in a list below the grid, followed by the
+// unused bits, the bits shared by multiplexed or overlapping signals, the
+// signals reaching past the DLC, which are what to look at when a signal
+// decodes wrongly because of its byte order or start bit, and the signals too
+// short to use any bit.
+func WriteLayout(messages map[uint32]*Message, w io.Writer) error {
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		layout := messageLayout(msg)
+		fmt.Fprintf(w, "%s, ID %s, DLC %d\n", msg.Name, reportMessageID(msg), msg.DLC)
+
+		width := len(strconv.Itoa(len(msg.Signals)))
+		if width < 2 {
+			width = 2
+		}
+		if msg.DLC > 0 {
+			fmt.Fprintf(w, "  Byte")
+			for bit := 7; bit >= 0; bit-- {
+				fmt.Fprintf(w, " %*d", width, bit)
+			}
+			fmt.Fprintln(w)
+			for b := 0; b < msg.DLC; b++ {
+				fmt.Fprintf(w, "  %4d", b)
+				for bit := 7; bit >= 0; bit-- {
+					label := layout.label(b*8 + bit)
+					if label == "" {
+						label = "."
+					}
+					fmt.Fprintf(w, " %*s", width, label)
+				}
+				fmt.Fprintln(w)
+			}
+		}
+
+		for i, sig := range msg.Signals {
+			marker := ""
+			if m := muxMarker(sig); m != "" {
+				marker = " " + m
+			}
+			fmt.Fprintf(w, "  %*d %s: %s (%s)%s\n", width, i+1, sig.Name, describeLayout(sig), byteOrderName(sig.ByteOrder), marker)
+		}
+
+		// Shared bits are grouped by the signals sharing them, each group
+		// listed once in order of its first bit.
+		type sharing struct{ kind, names string }
+		var unused []int
+		shared := make(map[sharing][]int)
+		var sharedOrder []sharing
+		for bit, n := range layout.bits {
+			switch n {
+			case 0:
+				unused = append(unused, bit)
+			case sharedBit, overlapBit:
+				names := make([]string, len(layout.users[bit]))
+				for i, user := range layout.users[bit] {
+					names[i] = msg.Signals[user-1].Name
+				}
+				key := sharing{kind: "Multiplexed", names: strings.Join(names, ", ")}
+				if n == overlapBit {
+					key.kind = "Overlap"
+				}
+				if shared[key] == nil {
+					sharedOrder = append(sharedOrder, key)
+				}
+				shared[key] = append(shared[key], bit)
+			}
+		}
+		if len(unused) > 0 {
+			fmt.Fprintf(w, "  Unused: %s %s\n", plural(len(unused), "bit", "bits"), formatBitRanges(unused))
+		}
+		for _, key := range sharedOrder {
+			bits := shared[key]
+			fmt.Fprintf(w, "  %s: %s %s used by %s\n", key.kind, plural(len(bits), "bit", "bits"), formatBitRanges(bits), key.names)
+		}
+		for _, sig := range msg.Signals {
+			bits := signalBits(sig.StartBit, sig.Length, sig.ByteOrder)
+			if len(bits) == 0 {
+				fmt.Fprintf(w, "  Invalid: %s has length %d, so it uses no bits\n", sig.Name, sig.Length)
+				continue
+			}
+			if last := bits[len(bits)-1]; last >= msg.DLC*8 {
+				fmt.Fprintf(w, "  Past the DLC: %s reaches bit %d, but DLC %d ends at bit %d\n", sig.Name, last, msg.DLC, msg.DLC*8-1)
+			}
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatBitRanges writes ascending bit numbers as ranges, e.g. "0-7, 12, 16-23".
+func formatBitRanges(bits []int) string {
+	var ranges []string
+	for i := 0; i < len(bits); {
+		j := i
+		for j+1 < len(bits) && bits[j+1] == bits[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(bits[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", bits[i], bits[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
@@ -0,0 +1,28 @@
+package refdbc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteLayoutZeroLengthSignal(t *testing.T) {
+	messages := map[uint32]*Message{0x100: {
+		ID:   0x100,
+		Name: "Engine",
+		DLC:  2,
+		Signals: []*Signal{
+			{Name: "Speed", StartBit: 0, Length: 8, ByteOrder: 1},
+			{Name: "Empty", StartBit: 8, Length: 0, ByteOrder: 1},
+		},
+	}}
+	var out strings.Builder
+	if err := WriteLayout(messages, &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "Invalid: Empty has length 0, so it uses no bits"; !strings.Contains(out.String(), want) {
+		t.Errorf("layout does not contain %q:\n%s", want, out.String())
+	}
+	if want := "Unused: bits 8-15"; !strings.Contains(out.String(), want) {
+		t.Errorf("layout does not contain %q:\n%s", want, out.String())
+	}
+}
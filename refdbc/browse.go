@@ -0,0 +1,299 @@
+package refdbc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// browseHelp lists the commands of Browse.
+const browseHelp = `Commands:
+  list, l          List the messages
+  <n>              Open message n of the list, or signal n of the open message
+  <n>.<m>          Open signal m of message n
+  id <id>          Open the message with this ID (decimal or 0x hex)
+  /<text>          Find messages and signals whose name contains text
+  layout           Show the payload bits of the open message
+  up, ..           Go back to the message list
+  help, ?          Show this help
+  quit, q          Leave
+`
+
+// browser is the state of an interactive Browse session.
+type browser struct {
+	source   string
+	messages []*Message // In ID order
+	open     int        // Index of the open message, or -1 at the message list
+	out      io.Writer
+}
+
+// Browse lets a user explore messages from the keyboard, without converting
+// them: it lists the messages, shows the signals of a message and the
+// details of a signal, and finds messages and signals by name. Commands are
+// read from in, one per line, until the user quits or in ends; source names
+// the file in the listing.
+func Browse(messages map[uint32]*Message, source string, in *bufio.Reader, out io.Writer) error {
+	b := &browser{source: source, open: -1, out: out}
+	for _, id := range sortedMessageIDs(messages) {
+		b.messages = append(b.messages, messages[id])
+	}
+	b.list()
+	fmt.Fprintf(out, "Type a number to open a message, or ? for help.\n")
+	for {
+		fmt.Fprintf(out, "%s> ", b.prompt())
+		line, err := in.ReadString('\n')
+		if strings.TrimSpace(line) == "" && err != nil {
+			fmt.Fprintln(out)
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if !b.run(strings.TrimSpace(line)) {
+			return nil
+		}
+	}
+}
+
+// prompt names the place the user is at.
+func (b *browser) prompt() string {
+	if b.open < 0 {
+		return b.source
+	}
+	return b.messages[b.open].Name
+}
+
+// run carries out a command, and returns false when the user quits.
+func (b *browser) run(command string) bool {
+	word, arg, _ := strings.Cut(command, " ")
+	arg = strings.TrimSpace(arg)
+	switch {
+	case command == "":
+	case word == "quit" || word == "q":
+		return false
+	case word == "help" || word == "?":
+		fmt.Fprint(b.out, browseHelp)
+	case word == "list" || word == "l" || word == "up" || word == "..":
+		b.open = -1
+		b.list()
+	case word == "id":
+		id, err := strconv.ParseUint(arg, 0, 32)
+		if err != nil {
+			fmt.Fprintf(b.out, "'%s' is not a message ID.\n", arg)
+			break
+		}
+		for i, msg := range b.messages {
+			if msg.ID == uint32(id) {
+				b.openMessage(i)
+				return true
+			}
+		}
+		fmt.Fprintf(b.out, "No message has ID %d (0x%X).\n", id, id)
+	case strings.HasPrefix(command, "/"):
+		b.find(strings.TrimSpace(command[1:]))
+	case word == "layout":
+		if b.open < 0 {
+			fmt.Fprintf(b.out, "Open a message first.\n")
+			break
+		}
+		msg := b.messages[b.open]
+		WriteLayout(map[uint32]*Message{msg.ID: msg}, b.out)
+	default:
+		b.openNumber(command)
+	}
+	return true
+}
+
+// openNumber opens the message or signal a number such as 3 or 3.2 refers to.
+func (b *browser) openNumber(text string) {
+	first, second, dotted := strings.Cut(text, ".")
+	n, err := strconv.Atoi(first)
+	if err != nil {
+		fmt.Fprintf(b.out, "Unknown command '%s'; type ? for help.\n", text)
+		return
+	}
+	if !dotted && b.open >= 0 {
+		b.openSignal(b.open, n)
+		return
+	}
+	if n < 1 || n > len(b.messages) {
+		fmt.Fprintf(b.out, "There is no message %d; the list has %d.\n", n, len(b.messages))
+		return
+	}
+	if !dotted {
+		b.openMessage(n - 1)
+		return
+	}
+	m, err := strconv.Atoi(second)
+	if err != nil {
+		fmt.Fprintf(b.out, "Unknown command '%s'; type ? for help.\n", text)
+		return
+	}
+	b.open = n - 1
+	b.openSignal(n-1, m)
+}
+
+// list prints the messages, numbered for opening.
+func (b *browser) list() {
+	fmt.Fprintf(b.out, "%s: %d %s\n", b.source, len(b.messages), plural(len(b.messages), "message", "messages"))
+	writeMessageTable(b.out, b.messages, allRows(len(b.messages)))
+}
+
+// openMessage makes message i the open one and prints its signals.
+func (b *browser) openMessage(i int) {
+	b.open = i
+	msg := b.messages[i]
+	fmt.Fprintf(b.out, "%s\n", messageHeading(msg))
+	if msg.Comment != "" {
+		fmt.Fprintf(b.out, "%s\n", msg.Comment)
+	}
+	writeSignalTable(b.out, msg, allRows(len(msg.Signals)))
+}
+
+// openSignal prints the details of signal n of message i.
+func (b *browser) openSignal(i, n int) {
+	msg := b.messages[i]
+	if n < 1 || n > len(msg.Signals) {
+		fmt.Fprintf(b.out, "%s has no signal %d; it has %d.\n", msg.Name, n, len(msg.Signals))
+		return
+	}
+	writeSignalDetails(b.out, msg, n-1)
+}
+
+// allRows returns the indices 0 to n-1, the rows of a table listing every item.
+func allRows(n int) []int {
+	rows := make([]int, n)
+	for i := range rows {
+		rows[i] = i
+	}
+	return rows
+}
+
+// writeMessageTable writes a header line and a line for each of messages[i]
+// for i in rows, numbered by its place in messages.
+func writeMessageTable(w io.Writer, messages []*Message, rows []int) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  #\tID\tName\tDLC\tSignals\tCycle\n")
+	for _, i := range rows {
+		msg := messages[i]
+		cycle := "-"
+		if msg.CycleTime > 0 {
+			cycle = fmt.Sprintf("%d ms", msg.CycleTime)
+		}
+		fmt.Fprintf(tw, "  %d\t0x%03X\t%s\t%d\t%d\t%s\n", i+1, msg.ID, msg.Name, msg.DLC, len(msg.Signals), cycle)
+	}
+	tw.Flush()
+}
+
+// messageHeading summarizes msg in one line: its name, ID, DLC, cycle time
+// and sender.
+func messageHeading(msg *Message) string {
+	heading := fmt.Sprintf("%s, ID %s, DLC %d", msg.Name, reportMessageID(msg), msg.DLC)
+	if msg.CycleTime > 0 {
+		heading += fmt.Sprintf(", every %d ms", msg.CycleTime)
+	}
+	if msg.Node != "" {
+		heading += ", sent by " + msg.Node
+	}
+	return heading
+}
+
+// writeSignalTable writes a header line and a line for each of the signals
+// of msg in rows, numbered by their place in the message.
+func writeSignalTable(w io.Writer, msg *Message, rows []int) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  #\tName\tStart\tLength\tOrder\tType\tFactor\tOffset\tRange\tUnit\tMux\n")
+	for _, j := range rows {
+		sig := msg.Signals[j]
+		fmt.Fprintf(tw, "  %d\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			j+1, sig.Name, sig.StartBit, sig.Length, byteOrderName(sig.ByteOrder), signalTypeName(sig),
+			formatNumber(sig.Factor), formatNumber(sig.Offset), browseRange(sig), sig.Unit, muxMarker(sig))
+	}
+	tw.Flush()
+}
+
+// writeSignalDetails writes everything known about signal j of msg.
+func writeSignalDetails(w io.Writer, msg *Message, j int) {
+	sig := msg.Signals[j]
+	bits := append([]int(nil), signalBits(sig.StartBit, sig.Length, sig.ByteOrder)...)
+	sort.Ints(bits)
+
+	fmt.Fprintf(w, "%s, signal %d of %s\n", sig.Name, j+1, msg.Name)
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(tw, "  Layout:\tstart bit %d, %d bits, %s (bits %s)\n", sig.StartBit, sig.Length, byteOrderName(sig.ByteOrder), formatBitRanges(bits))
+	fmt.Fprintf(tw, "  Type:\t%s\n", signalTypeName(sig))
+	fmt.Fprintf(tw, "  Scaling:\traw * %s + %s\n", formatNumber(sig.Factor), formatNumber(sig.Offset))
+	fmt.Fprintf(tw, "  Range:\t%s\n", browseRange(sig))
+	if sig.Unit != "" {
+		fmt.Fprintf(tw, "  Unit:\t%s\n", sig.Unit)
+	}
+	switch sig.MuxRole {
+	case muxMultiplexor:
+		fmt.Fprintf(tw, "  Multiplex:\tmultiplexor\n")
+	case muxMultiplexed:
+		fmt.Fprintf(tw, "  Multiplex:\tpresent when the multiplexor is %d\n", sig.MuxValue)
+	}
+	if len(sig.Receivers) > 0 {
+		fmt.Fprintf(tw, "  Receivers:\t%s\n", strings.Join(sig.Receivers, ", "))
+	}
+	if sig.Group != "" {
+		fmt.Fprintf(tw, "  Group:\t%s\n", sig.Group)
+	}
+	if sig.Part != "" {
+		fmt.Fprintf(tw, "  Part:\t%s\n", sig.Part)
+	}
+	if sig.Comment != "" {
+		fmt.Fprintf(tw, "  Comment:\t%s\n", sig.Comment)
+	}
+	for k, vd := range sig.ValueTable {
+		label := ""
+		if k == 0 {
+			label = "Values:"
+		}
+		fmt.Fprintf(tw, "  %s\t%d = %s\n", label, vd.Value, vd.Label)
+	}
+	if sig.pos != (position{}) {
+		fmt.Fprintf(tw, "  Source:\t%s\n", sig.pos)
+	}
+	tw.Flush()
+}
+
+// find prints the messages and signals whose name contains text, ignoring
+// case, with the numbers that open them.
+func (b *browser) find(text string) {
+	if text == "" {
+		fmt.Fprintf(b.out, "Type the text to find after the /.\n")
+		return
+	}
+	needle := strings.ToLower(text)
+	found := 0
+	tw := tabwriter.NewWriter(b.out, 0, 0, 2, ' ', 0)
+	for i, msg := range b.messages {
+		if strings.Contains(strings.ToLower(msg.Name), needle) {
+			fmt.Fprintf(tw, "  %d\tmessage %s\n", i+1, msg.Name)
+			found++
+		}
+		for j, sig := range msg.Signals {
+			if strings.Contains(strings.ToLower(sig.Name), needle) {
+				fmt.Fprintf(tw, "  %d.%d\tsignal %s in %s\n", i+1, j+1, sig.Name, msg.Name)
+				found++
+			}
+		}
+	}
+	tw.Flush()
+	if found == 0 {
+		fmt.Fprintf(b.out, "No message or signal name contains '%s'.\n", text)
+	}
+}
+
+// browseRange writes the range of sig, or "-" if it has none.
+func browseRange(sig *Signal) string {
+	if sig.Min == 0 && sig.Max == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%s to %s", formatNumber(sig.Min), formatNumber(sig.Max))
+}
@@ -0,0 +1,478 @@
+package refdbc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// screenHelp lists the keys of BrowseTerminal.
+const screenHelp = `Keys:
+  Up, Down, k, j        Move through the list, or scroll
+  PgUp, PgDn, Home, End Move a page, or to the first or last line
+  Enter, Right, l       Open the message or signal under the cursor
+  Esc, Left, h          Go back, or clear the search
+  /                     Search the list by name; Enter keeps the result
+  b                     Show the payload bits of the message
+  ?                     Show this help
+  q, Ctrl-C             Leave
+`
+
+// Views of a screen.
+const (
+	viewMessages = iota // The message list
+	viewSignals         // The signals of the open message
+	viewSignal          // The details of the open signal
+	viewLayout          // The payload bits of the open message
+	viewHelp            // The keys
+)
+
+// screenList is a list of a screen, narrowed by its search.
+type screenList struct {
+	rows   []int  // Indices of the items the search matches
+	cursor int    // Row under the cursor
+	top    int    // First row shown
+	search string // Text the names must contain; empty shows every item
+}
+
+// screen is the state of a full-screen BrowseTerminal session.
+type screen struct {
+	source    string
+	messages  []*Message // In ID order
+	view      int
+	back      int // View to return to from the help
+	msg       int // Index of the open message
+	sig       int // Index of the open signal in the open message
+	lists     [2]screenList
+	scroll    int  // First line shown of the text views
+	searching bool // The search of the list is being typed
+	quit      bool
+	width     int
+	height    int
+}
+
+// BrowseTerminal is Browse as a full-screen terminal UI: a list of the
+// messages, moved through with the arrow keys, that opens into the signals of
+// a message and the details of a signal, and narrows to the names containing
+// a search typed after /. Keys are read from in, which reads from the
+// terminal inFile, put in raw mode for the session; the screen is drawn on
+// out with ANSI escapes. When inFile or out isn't a terminal, or raw mode
+// isn't supported on this system, it runs Browse instead, reading commands
+// a line at a time.
+func BrowseTerminal(messages map[uint32]*Message, source string, in *bufio.Reader, inFile, out *os.File) error {
+	if !IsTerminal(inFile) || !IsTerminal(out) {
+		return Browse(messages, source, in, out)
+	}
+	restore, err := makeRaw(inFile)
+	if err != nil {
+		return Browse(messages, source, in, out)
+	}
+	defer restore()
+	return newScreen(messages, source).run(in, out, func() (int, int) {
+		if width, height, ok := terminalSize(out); ok {
+			return width, height
+		}
+		return 80, 24
+	})
+}
+
+// newScreen returns a screen at the list of messages.
+func newScreen(messages map[uint32]*Message, source string) *screen {
+	s := &screen{source: source}
+	for _, id := range sortedMessageIDs(messages) {
+		s.messages = append(s.messages, messages[id])
+	}
+	s.lists[viewMessages].rows = allRows(len(s.messages))
+	return s
+}
+
+// run draws the screen and handles keys from in until the user quits or in
+// ends. size returns the width and height of the terminal, asked before each
+// frame so the screen follows a resized window. The terminal's alternate
+// screen is used, so its contents are back as they were afterwards.
+func (s *screen) run(in *bufio.Reader, out io.Writer, size func() (int, int)) error {
+	if _, err := io.WriteString(out, "\x1b[?1049h\x1b[?25l"); err != nil {
+		return err
+	}
+	defer io.WriteString(out, "\x1b[?25h\x1b[?1049l")
+	for !s.quit {
+		s.width, s.height = size()
+		if err := s.draw(out); err != nil {
+			return err
+		}
+		key, err := readKey(in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.handle(key)
+	}
+	return nil
+}
+
+// readKey reads a key press: a printable character, or the name of a special
+// key such as up, pgdn, enter or esc. Escape sequences the screen has no use
+// for are returned as an empty string.
+func readKey(in *bufio.Reader) (string, error) {
+	r, _, err := in.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch r {
+	case '\r', '\n':
+		return "enter", nil
+	case 0x7f, '\b':
+		return "backspace", nil
+	case 0x03:
+		return "ctrl-c", nil
+	}
+	if r != 0x1b {
+		return string(r), nil
+	}
+
+	// A lone Esc comes without anything after it, while the keys sending
+	// escape sequences send them at once.
+	if in.Buffered() == 0 {
+		return "esc", nil
+	}
+	if next, _ := in.Peek(1); next[0] != '[' && next[0] != 'O' {
+		return "esc", nil
+	}
+	var seq []byte
+	for {
+		c, err := in.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		seq = append(seq, c)
+		if len(seq) > 1 && c >= 0x40 && c <= 0x7e {
+			break
+		}
+	}
+	switch string(seq) {
+	case "[A", "OA":
+		return "up", nil
+	case "[B", "OB":
+		return "down", nil
+	case "[C", "OC":
+		return "right", nil
+	case "[D", "OD":
+		return "left", nil
+	case "[H", "OH", "[1~", "[7~":
+		return "home", nil
+	case "[F", "OF", "[4~", "[8~":
+		return "end", nil
+	case "[5~":
+		return "pgup", nil
+	case "[6~":
+		return "pgdn", nil
+	}
+	return "", nil
+}
+
+// handle changes the screen for a key press.
+func (s *screen) handle(key string) {
+	if key == "ctrl-c" {
+		s.quit = true
+		return
+	}
+	if s.searching {
+		s.handleSearch(key)
+		return
+	}
+	switch key {
+	case "q":
+		s.quit = true
+		return
+	case "?":
+		if s.view != viewHelp {
+			s.back, s.view, s.scroll = s.view, viewHelp, 0
+		}
+		return
+	}
+	if s.view == viewMessages || s.view == viewSignals {
+		s.handleList(key)
+	} else {
+		s.handleText(key)
+	}
+}
+
+// handleSearch edits the search of the list shown.
+func (s *screen) handleSearch(key string) {
+	list := &s.lists[s.view]
+	switch key {
+	case "enter":
+		s.searching = false
+		return
+	case "esc":
+		s.searching = false
+		list.search = ""
+	case "backspace":
+		if list.search == "" {
+			s.searching = false
+			return
+		}
+		_, size := utf8.DecodeLastRuneInString(list.search)
+		list.search = list.search[:len(list.search)-size]
+	default:
+		if r, _ := utf8.DecodeRuneInString(key); utf8.RuneCountInString(key) != 1 || !unicode.IsPrint(r) {
+			return
+		}
+		list.search += key
+	}
+	s.filter()
+}
+
+// filter narrows the list shown to the names containing its search, ignoring
+// case. In the message list, a message also matches when one of its signals
+// does.
+func (s *screen) filter() {
+	list := &s.lists[s.view]
+	needle := strings.ToLower(list.search)
+	matches := func(name string) bool { return strings.Contains(strings.ToLower(name), needle) }
+	list.rows, list.cursor, list.top = nil, 0, 0
+	if s.view == viewSignals {
+		for j, sig := range s.messages[s.msg].Signals {
+			if matches(sig.Name) {
+				list.rows = append(list.rows, j)
+			}
+		}
+		return
+	}
+	for i, msg := range s.messages {
+		found := matches(msg.Name)
+		for _, sig := range msg.Signals {
+			found = found || matches(sig.Name)
+		}
+		if found {
+			list.rows = append(list.rows, i)
+		}
+	}
+}
+
+// handleList handles a key in the message or signal list.
+func (s *screen) handleList(key string) {
+	list := &s.lists[s.view]
+	switch key {
+	case "up", "k":
+		list.cursor--
+	case "down", "j":
+		list.cursor++
+	case "pgup":
+		list.cursor -= s.pageSize()
+	case "pgdn":
+		list.cursor += s.pageSize()
+	case "home", "g":
+		list.cursor = 0
+	case "end", "G":
+		list.cursor = len(list.rows) - 1
+	case "enter", "right", "l":
+		if len(list.rows) == 0 {
+			break
+		}
+		if s.view == viewMessages {
+			s.msg = list.rows[list.cursor]
+			s.view = viewSignals
+			s.lists[viewSignals] = screenList{rows: allRows(len(s.messages[s.msg].Signals))}
+		} else {
+			s.sig = list.rows[list.cursor]
+			s.view, s.scroll = viewSignal, 0
+		}
+	case "/":
+		s.searching = true
+	case "b":
+		if s.view == viewMessages {
+			if len(list.rows) == 0 {
+				break
+			}
+			s.msg = list.rows[list.cursor]
+			s.lists[viewSignals] = screenList{rows: allRows(len(s.messages[s.msg].Signals))}
+		}
+		s.view, s.scroll = viewLayout, 0
+	case "esc":
+		if list.search != "" {
+			list.search = ""
+			s.filter()
+			break
+		}
+		s.goBack()
+	case "left", "h", "backspace":
+		s.goBack()
+	}
+	if s.view == viewMessages || s.view == viewSignals {
+		list = &s.lists[s.view]
+		list.cursor = max(0, min(list.cursor, len(list.rows)-1))
+	}
+}
+
+// handleText handles a key in the signal details, the payload bits or the
+// help, which scroll as a whole.
+func (s *screen) handleText(key string) {
+	switch key {
+	case "up", "k":
+		s.scroll--
+	case "down", "j":
+		s.scroll++
+	case "pgup":
+		s.scroll -= s.pageSize()
+	case "pgdn":
+		s.scroll += s.pageSize()
+	case "home", "g":
+		s.scroll = 0
+	case "end", "G":
+		s.scroll = len(s.textLines())
+	case "esc", "left", "h", "backspace", "enter":
+		s.goBack()
+		return
+	}
+	s.scroll = max(0, min(s.scroll, len(s.textLines())-s.pageSize()))
+}
+
+// goBack leaves the view shown for the one it was opened from.
+func (s *screen) goBack() {
+	switch s.view {
+	case viewHelp:
+		s.view = s.back
+	case viewSignal, viewLayout:
+		s.view = viewSignals
+	case viewSignals:
+		s.view = viewMessages
+	}
+	s.scroll = 0
+}
+
+// pageSize returns the number of lines in the body of the screen, between the
+// title and the status line.
+func (s *screen) pageSize() int {
+	return max(1, s.height-2)
+}
+
+// textLines returns the lines of the signal details, payload bits or help.
+func (s *screen) textLines() []string {
+	var text bytes.Buffer
+	switch s.view {
+	case viewSignal:
+		writeSignalDetails(&text, s.messages[s.msg], s.sig)
+	case viewLayout:
+		msg := s.messages[s.msg]
+		WriteLayout(map[uint32]*Message{msg.ID: msg}, &text)
+	case viewHelp:
+		text.WriteString(screenHelp)
+	}
+	return splitLines(text.String())
+}
+
+// splitLines splits text into lines, without the empty line after a final
+// line break.
+func splitLines(text string) []string {
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// draw writes the whole screen to out: a title naming where the user is, the
+// body, and a status line with the search or the main keys.
+func (s *screen) draw(out io.Writer) error {
+	var lines []string
+	title := s.source
+	if s.view != viewMessages && len(s.messages) > 0 {
+		title += " > " + messageHeading(s.messages[s.msg])
+	}
+	if s.view == viewSignal {
+		title += " > " + s.messages[s.msg].Signals[s.sig].Name
+	}
+	lines = append(lines, s.inverse(" "+title))
+
+	body := s.pageSize()
+	status := "Up/Down move  Enter open  Esc back  / search  b bits  ? help  q quit"
+	if s.view == viewMessages || s.view == viewSignals {
+		list := &s.lists[s.view]
+		var table bytes.Buffer
+		if s.view == viewMessages {
+			writeMessageTable(&table, s.messages, list.rows)
+		} else {
+			writeSignalTable(&table, s.messages[s.msg], list.rows)
+		}
+		rows := splitLines(table.String())
+		lines = append(lines, rows[0])
+		body--
+
+		// Keep the cursor on the screen, scrolling as little as possible.
+		list.top = max(min(list.top, list.cursor), list.cursor-body+1, 0)
+		for i := list.top; i < len(list.rows) && i < list.top+body; i++ {
+			if i == list.cursor {
+				lines = append(lines, s.inverse(rows[i+1]))
+			} else {
+				lines = append(lines, rows[i+1])
+			}
+		}
+		if len(list.rows) == 0 {
+			lines = append(lines, "  No names contain '"+list.search+"'.")
+		}
+		switch {
+		case s.searching:
+			status = "/" + list.search
+		case list.search != "":
+			total := len(s.messages)
+			if s.view == viewSignals {
+				total = len(s.messages[s.msg].Signals)
+			}
+			status = fmt.Sprintf("%d of %d match '%s'; Esc shows all", len(list.rows), total, list.search)
+		}
+	} else {
+		text := s.textLines()
+		for i := s.scroll; i < len(text) && i < s.scroll+body; i++ {
+			lines = append(lines, text[i])
+		}
+	}
+	for len(lines) < s.height-1 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, status)
+
+	var frame strings.Builder
+	frame.WriteString("\x1b[H")
+	for i, line := range lines {
+		if i > 0 {
+			frame.WriteString("\r\n")
+		}
+		frame.WriteString(clipLine(line, s.width))
+		frame.WriteString("\x1b[K")
+	}
+	_, err := io.WriteString(out, frame.String())
+	return err
+}
+
+// inverse pads line to the width of the screen and shows it in reverse video,
+// as the title and the line under the cursor are.
+func (s *screen) inverse(line string) string {
+	line = clipLine(line, s.width)
+	return "\x1b[7m" + line + strings.Repeat(" ", max(0, s.width-utf8.RuneCountInString(line))) + "\x1b[0m"
+}
+
+// clipLine cuts line to width characters, leaving escape sequences whole.
+func clipLine(line string, width int) string {
+	n := 0
+	for i := 0; i < len(line); {
+		if strings.HasPrefix(line[i:], "\x1b[") {
+			end := strings.IndexFunc(line[i+2:], func(r rune) bool { return r >= 0x40 && r <= 0x7e })
+			if end < 0 {
+				return line[:i]
+			}
+			i += end + 3
+			continue
+		}
+		if n == width {
+			return line[:i] + "\x1b[0m"
+		}
+		_, size := utf8.DecodeRuneInString(line[i:])
+		i += size
+		n++
+	}
+	return line
+}
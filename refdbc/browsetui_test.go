@@ -0,0 +1,147 @@
+package refdbc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// screenMessages returns two messages for the screen tests, Engine with two
+// signals and Brakes with one.
+func screenMessages() map[uint32]*Message {
+	return map[uint32]*Message{
+		0x100: {ID: 0x100, Name: "Engine", DLC: 8, Signals: []*Signal{
+			{Name: "RPM", StartBit: 0, Length: 16, ByteOrder: 1, Factor: 1, Unit: "rpm"},
+			{Name: "Coolant", StartBit: 16, Length: 8, ByteOrder: 1, Factor: 1, Offset: -40, Unit: "degC"},
+		}},
+		0x200: {ID: 0x200, Name: "Brakes", DLC: 8, Signals: []*Signal{
+			{Name: "Pressure", StartBit: 0, Length: 16, ByteOrder: 1, Factor: 0.01, Unit: "bar"},
+		}},
+	}
+}
+
+// lastFrame runs a screen over messages with keys as the input, and returns
+// the lines of the last frame drawn, without escape sequences.
+func lastFrame(t *testing.T, keys string) []string {
+	t.Helper()
+	var out bytes.Buffer
+	s := newScreen(screenMessages(), "test.ref")
+	if err := s.run(bufio.NewReader(strings.NewReader(keys)), &out, func() (int, int) { return 100, 24 }); err != nil {
+		t.Fatal(err)
+	}
+	frames := strings.Split(out.String(), "\x1b[H")
+	frame := frames[len(frames)-1]
+	for _, escape := range []string{"\x1b[K", "\x1b[7m", "\x1b[0m", "\x1b[?25h\x1b[?1049l"} {
+		frame = strings.ReplaceAll(frame, escape, "")
+	}
+	return strings.Split(frame, "\r\n")
+}
+
+// containsLine reports whether one of lines contains text.
+func containsLine(lines []string, text string) bool {
+	for _, line := range lines {
+		if strings.Contains(line, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestScreenNavigation(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    string
+		want    []string
+		notWant []string
+	}{
+		{"message list", "", []string{" test.ref", "0x100", "Engine", "Brakes"}, nil},
+		{"open a message", "\r", []string{"Engine, ID 256 (0x100), DLC 8", "RPM", "Coolant"}, []string{"Brakes"}},
+		{"move down", "j\r", []string{"Brakes", "Pressure"}, []string{"Coolant"}},
+		{"arrow keys", "\x1b[B\x1b[A\x1b[C", []string{"RPM", "Coolant"}, []string{"Pressure"}},
+		{"open a signal", "\rj\r", []string{"Coolant, signal 2 of Engine", "raw * 1 + -40"}, nil},
+		{"go back", "\rj\r\x1bh", []string{"Engine", "Brakes"}, []string{"RPM"}},
+		{"bits", "jb", []string{"Byte", "Pressure: bits 0|16@1+ (Intel)"}, nil},
+		{"help", "?", []string{"Search the list by name"}, nil},
+		{"search signals from the message list", "/press", []string{"Brakes", "/press"}, []string{"Engine"}},
+		{"keep a search", "/rpm\r", []string{"Engine", "1 of 2 match 'rpm'"}, []string{"Brakes"}},
+		{"clear a search", "/rpm\r\x1bx", []string{"Engine", "Brakes"}, nil},
+		{"no match", "/xyz", []string{"No names contain 'xyz'.", "/xyz"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := lastFrame(t, tt.keys)
+			for _, want := range tt.want {
+				if !containsLine(lines, want) {
+					t.Errorf("screen does not show %q:\n%s", want, strings.Join(lines, "\n"))
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if containsLine(lines, notWant) {
+					t.Errorf("screen shows %q:\n%s", notWant, strings.Join(lines, "\n"))
+				}
+			}
+		})
+	}
+}
+
+func TestScreenScrollsToCursor(t *testing.T) {
+	messages := make(map[uint32]*Message)
+	for id := uint32(1); id <= 30; id++ {
+		messages[id] = &Message{ID: id, Name: fmt.Sprintf("Message%d", id), DLC: 8}
+	}
+	var out bytes.Buffer
+	s := newScreen(messages, "test.ref")
+	keys := strings.Repeat("j", 20)
+	if err := s.run(bufio.NewReader(strings.NewReader(keys)), &out, func() (int, int) { return 80, 10 }); err != nil {
+		t.Fatal(err)
+	}
+	// The body is a page less the table header.
+	list, rows := s.lists[viewMessages], s.pageSize()-1
+	if list.cursor != 20 || list.cursor < list.top || list.cursor >= list.top+rows {
+		t.Errorf("cursor on row %d with rows %d to %d shown, want row 20 shown", list.cursor, list.top, list.top+rows-1)
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	in := bufio.NewReader(strings.NewReader("a\r\x1b[A\x1b[6~\x1bOH\x7f\x03\x1b"))
+	var got []string
+	for {
+		key, err := readKey(in)
+		if err != nil {
+			break
+		}
+		got = append(got, key)
+	}
+	if want := "a enter up pgdn home backspace ctrl-c esc"; strings.Join(got, " ") != want {
+		t.Errorf("keys %q, want %s", got, want)
+	}
+}
+
+func TestBrowseTerminalFallsBackToLines(t *testing.T) {
+	inFile, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inFile.Close()
+	out, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	in := bufio.NewReader(strings.NewReader("2\nq\n"))
+	if err := BrowseTerminal(screenMessages(), "test.ref", in, inFile, out); err != nil {
+		t.Fatal(err)
+	}
+	written, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(written, []byte("\x1b[")) || !bytes.Contains(written, []byte("Brakes, ID 512 (0x200)")) {
+		t.Errorf("output is not the line browser's:\n%s", written)
+	}
+}
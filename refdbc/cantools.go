@@ -0,0 +1,154 @@
+package refdbc
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// cantoolsDatabase is the document written by writeCantoolsJSON. Its keys are
+// the keyword arguments of the cantools Database, Node, Message and Signal
+// constructors, so Python code can build a cantools database from it with a
+// few lines and no DBC in between.
+type cantoolsDatabase struct {
+	Version  string            `json:"version"`
+	Nodes    []cantoolsNode    `json:"nodes"`
+	Messages []cantoolsMessage `json:"messages"`
+}
+
+type cantoolsNode struct {
+	Name string `json:"name"`
+}
+
+type cantoolsMessage struct {
+	FrameID    uint32           `json:"frame_id"`
+	Name       string           `json:"name"`
+	Length     int              `json:"length"`
+	IsExtended bool             `json:"is_extended_frame"`
+	IsFD       bool             `json:"is_fd"`
+	CycleTime  *int             `json:"cycle_time"`
+	Comment    *string          `json:"comment"`
+	Senders    []string         `json:"senders"`
+	Signals    []cantoolsSignal `json:"signals"`
+}
+
+type cantoolsSignal struct {
+	Name              string            `json:"name"`
+	Start             int               `json:"start"` // DBC bit numbering, as in cantools
+	Length            int               `json:"length"`
+	ByteOrder         string            `json:"byte_order"` // little_endian or big_endian
+	IsSigned          bool              `json:"is_signed"`
+	IsFloat           bool              `json:"is_float"`
+	Scale             float64           `json:"scale"`
+	Offset            float64           `json:"offset"`
+	Minimum           *float64          `json:"minimum"`
+	Maximum           *float64          `json:"maximum"`
+	Unit              *string           `json:"unit"`
+	Choices           map[string]string `json:"choices"` // Keyed by the raw value
+	Comment           *string           `json:"comment"`
+	Receivers         []string          `json:"receivers"`
+	IsMultiplexer     bool              `json:"is_multiplexer"`
+	MultiplexerIDs    []int             `json:"multiplexer_ids"`
+	MultiplexerSignal *string           `json:"multiplexer_signal"`
+}
+
+// cantoolsByteOrders are the cantools names of the Signal.ByteOrder values.
+var cantoolsByteOrders = [...]string{"big_endian", "little_endian"}
+
+// writeCantoolsJSON writes the messages as a JSON document shaped after the
+// cantools object model, ordered by message ID with signals in source order.
+// Attributes cantools leaves unset (None) are written as null, such as the
+// comment of a message without one, the range of a signal with 0|0 in DBC
+// terms, or the multiplexer fields of plain signals. Like cantools does when
+// loading a DBC, the placeholder node Vector__XXX is left out.
+func writeCantoolsJSON(messages map[uint32]*Message, w io.Writer, opts Options) error {
+	doc := cantoolsDatabase{
+		Nodes:    []cantoolsNode{},
+		Messages: make([]cantoolsMessage, 0, len(messages)),
+	}
+	for _, name := range cantoolsNodes(collectNodes(messages, opts.Node)) {
+		doc.Nodes = append(doc.Nodes, cantoolsNode{Name: name})
+	}
+
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		cm := cantoolsMessage{
+			FrameID:    msg.ID,
+			Name:       msg.Name,
+			Length:     msg.DLC,
+			IsExtended: msg.IsExtended,
+			IsFD:       msg.DLC > 8,
+			Comment:    optionalString(msg.Comment),
+			Senders:    cantoolsNodes([]string{msg.Node}),
+			Signals:    make([]cantoolsSignal, 0, len(msg.Signals)),
+		}
+		if msg.CycleTime > 0 {
+			cycle := msg.CycleTime
+			cm.CycleTime = &cycle
+		}
+
+		var multiplexor *string
+		for _, sig := range msg.Signals {
+			if sig.MuxRole == muxMultiplexor {
+				name := sig.Name
+				multiplexor = &name
+				break
+			}
+		}
+		for _, sig := range msg.Signals {
+			cs := cantoolsSignal{
+				Name:          sig.Name,
+				Start:         sig.StartBit,
+				Length:        sig.Length,
+				ByteOrder:     cantoolsByteOrders[sig.ByteOrder],
+				IsSigned:      sig.IsSigned,
+				IsFloat:       sig.ValueType != 0,
+				Scale:         sig.Factor,
+				Offset:        sig.Offset,
+				Unit:          optionalString(sig.Unit),
+				Comment:       optionalString(sig.Comment),
+				Receivers:     cantoolsNodes(signalReceivers(sig, opts.Node)),
+				IsMultiplexer: sig.MuxRole == muxMultiplexor,
+			}
+			if sig.Min != 0 || sig.Max != 0 {
+				low, high := sig.Min, sig.Max
+				cs.Minimum, cs.Maximum = &low, &high
+			}
+			if len(sig.ValueTable) > 0 {
+				cs.Choices = make(map[string]string, len(sig.ValueTable))
+				for _, vd := range sig.ValueTable {
+					cs.Choices[strconv.FormatInt(vd.Value, 10)] = vd.Label
+				}
+			}
+			if sig.MuxRole == muxMultiplexed {
+				cs.MultiplexerIDs = []int{sig.MuxValue}
+				cs.MultiplexerSignal = multiplexor
+			}
+			cm.Signals = append(cm.Signals, cs)
+		}
+		doc.Messages = append(doc.Messages, cm)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// cantoolsNodes returns names without empty ones and the placeholder node.
+func cantoolsNodes(names []string) []string {
+	nodes := []string{}
+	for _, name := range names {
+		if name != "" && name != DefaultNodeName {
+			nodes = append(nodes, name)
+		}
+	}
+	return nodes
+}
+
+// optionalString returns nil for an empty string, which is written as null.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
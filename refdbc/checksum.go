@@ -0,0 +1,129 @@
+package refdbc
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// checksumTrailerLen is the length of the checksum that may follow the last entry.
+const checksumTrailerLen = 2
+
+// checksumScheme is a candidate algorithm for the trailing checksum of a .ref file.
+type checksumScheme struct {
+	Name   string
+	Init   uint16
+	Update func(sum uint16, b byte) uint16
+}
+
+// checksumSchemes lists the 16-bit checksums the trailing bytes are compared against.
+var checksumSchemes = []checksumScheme{
+	{Name: "CRC-16/XMODEM", Init: 0x0000, Update: crc16CCITTUpdate},
+	{Name: "CRC-16/CCITT-FALSE", Init: 0xFFFF, Update: crc16CCITTUpdate},
+	{Name: "CRC-16/ARC", Init: 0x0000, Update: crc16ARCUpdate},
+	{Name: "CRC-16/MODBUS", Init: 0xFFFF, Update: crc16ARCUpdate},
+	{Name: "16-bit sum", Init: 0x0000, Update: func(sum uint16, b byte) uint16 { return sum + uint16(b) }},
+}
+
+// crc16CCITTUpdate adds one byte to a CRC using the polynomial 0x1021, MSB first.
+func crc16CCITTUpdate(crc uint16, b byte) uint16 {
+	crc ^= uint16(b) << 8
+	for i := 0; i < 8; i++ {
+		if crc&0x8000 != 0 {
+			crc = crc<<1 ^ 0x1021
+		} else {
+			crc <<= 1
+		}
+	}
+	return crc
+}
+
+// crc16ARCUpdate adds one byte to a CRC using the reflected polynomial 0x8005 (0xA001), LSB first.
+func crc16ARCUpdate(crc uint16, b byte) uint16 {
+	crc ^= uint16(b)
+	for i := 0; i < 8; i++ {
+		if crc&1 != 0 {
+			crc = crc>>1 ^ 0xA001
+		} else {
+			crc >>= 1
+		}
+	}
+	return crc
+}
+
+// checksumTracker computes every candidate checksum over the bytes written to it,
+// always holding back the most recent checksumTrailerLen bytes. Once the whole
+// file has passed through, the sums cover everything except a possible trailer.
+type checksumTracker struct {
+	sums []uint16
+	held []byte
+}
+
+func newChecksumTracker() *checksumTracker {
+	t := &checksumTracker{sums: make([]uint16, len(checksumSchemes))}
+	for i, scheme := range checksumSchemes {
+		t.sums[i] = scheme.Init
+	}
+	return t
+}
+
+// Write implements io.Writer so the tracker can be used with io.TeeReader.
+func (t *checksumTracker) Write(p []byte) (int, error) {
+	t.held = append(t.held, p...)
+	if excess := len(t.held) - checksumTrailerLen; excess > 0 {
+		for _, b := range t.held[:excess] {
+			for i, scheme := range checksumSchemes {
+				t.sums[i] = scheme.Update(t.sums[i], b)
+			}
+		}
+		t.held = append(t.held[:0], t.held[excess:]...)
+	}
+	return len(p), nil
+}
+
+// verifyTrailer reports on the data found after the last entry. Two trailing
+// bytes are checked against every known checksum scheme in both byte orders; a
+// mismatch is a warning, or an error when opts.Strict is set. Any other amount
+// of trailing data produces a warning showing the bytes in hex.
+func verifyTrailer(trailing []byte, tracker *checksumTracker, opts Options) error {
+	if len(trailing) != checksumTrailerLen {
+		opts.Log.Warnf("The file was processed, but there are %d bytes of unparsed data remaining at the end of the file: %s", len(trailing), hexPreview(trailing))
+		opts.Log.Debugf("unparsed data at the end of the file:\n%s", strings.TrimSuffix(hex.Dump(trailing), "\n"))
+		if opts.DumpTrailing != nil {
+			if _, err := opts.DumpTrailing.Write(trailing); err != nil {
+				return fmt.Errorf("failed to write -dump-trailing file: %w", err)
+			}
+			opts.Log.Infof("Wrote the %d unparsed bytes to the -dump-trailing file.", len(trailing))
+		}
+		return nil
+	}
+
+	big := binary.BigEndian.Uint16(trailing)
+	little := binary.LittleEndian.Uint16(trailing)
+	for i, scheme := range checksumSchemes {
+		switch tracker.sums[i] {
+		case big:
+			opts.Log.Infof("Checksum OK (%s, big-endian).", scheme.Name)
+			return nil
+		case little:
+			opts.Log.Infof("Checksum OK (%s, little-endian).", scheme.Name)
+			return nil
+		}
+	}
+
+	if opts.Strict {
+		return fmt.Errorf("checksum MISMATCH: trailing bytes %s do not match any known checksum of the file", hexPreview(trailing))
+	}
+	opts.Log.Warnf("checksum MISMATCH: trailing bytes %s do not match any known checksum of the file. Please report them along with the file.", hexPreview(trailing))
+	return nil
+}
+
+// hexPreview formats up to the first 32 bytes of data as hex.
+func hexPreview(data []byte) string {
+	const maxBytes = 32
+	if len(data) > maxBytes {
+		return hex.EncodeToString(data[:maxBytes]) + "..."
+	}
+	return hex.EncodeToString(data)
+}
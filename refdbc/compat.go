@@ -0,0 +1,133 @@
+package refdbc
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// CompatProfiles lists the accepted values of the -compat flag, each named
+// after a tool that reads the DBC output.
+var CompatProfiles = []string{"candb", "canalyzer", "matlab", "savvycan"}
+
+// IsValidCompatProfile reports whether profile is one of CompatProfiles.
+func IsValidCompatProfile(profile string) bool {
+	for _, p := range CompatProfiles {
+		if p == profile {
+			return true
+		}
+	}
+	return false
+}
+
+// compatProfile describes the quirks of a tool reading DBC files.
+type compatProfile struct {
+	tool              string            // Name of the tool in warnings
+	settings          map[string]string // Output settings the tool needs, keyed by flag name
+	maxNameLength     int               // Longest message, signal and node name the tool accepts
+	leadingUnderscore bool              // Whether names may start with an underscore
+	networkAttributes bool              // Whether the tool needs the BusType and DBName attributes
+}
+
+// compatProfiles holds the quirks of each of CompatProfiles. CANdb++ and
+// CANalyzer share Vector's DBC reader, which limits names to 32 characters,
+// reads the file in the Windows code page and uses the BusType attribute to
+// tell which bus a database belongs to. MATLAB turns names into struct
+// fields, so they have to be MATLAB identifiers, which start with a letter
+// and are at most namelengthmax (63) characters long. SavvyCAN parses SG_
+// lines with regular expressions that expect plain numbers, single spaces
+// and comma-separated receivers.
+var compatProfiles = map[string]compatProfile{
+	"candb": {
+		tool:              "CANdb++",
+		settings:          map[string]string{"line-endings": "crlf", "dbc-encoding": "windows-1252", "max-name-length": "32"},
+		maxNameLength:     32,
+		leadingUnderscore: true,
+		networkAttributes: true,
+	},
+	"canalyzer": {
+		tool:              "CANalyzer",
+		settings:          map[string]string{"line-endings": "crlf", "dbc-encoding": "windows-1252", "max-name-length": "32"},
+		maxNameLength:     32,
+		leadingUnderscore: true,
+		networkAttributes: true,
+	},
+	"matlab": {
+		tool:          "MATLAB",
+		settings:      map[string]string{"float-format": "fixed", "max-name-length": "63"},
+		maxNameLength: 63,
+	},
+	"savvycan": {
+		tool:              "SavvyCAN",
+		settings:          map[string]string{"float-format": "fixed", "indent": "space", "receiver-separator": "comma"},
+		leadingUnderscore: true,
+	},
+}
+
+// CompatSettings returns the output settings profile needs, keyed by the name
+// of the flag that controls them, such as "line-endings": "crlf". Settings
+// the user chose explicitly should take precedence.
+func CompatSettings(profile string) map[string]string {
+	return compatProfiles[profile].settings
+}
+
+// checkCompat warns about the names in messages the tool of opts.Compat
+// can't read: names that are too long, or start with an underscore where the
+// tool doesn't allow it. The warnings fail the file when opts.Strict is set.
+func checkCompat(messages map[uint32]*Message, opts Options) {
+	profile, ok := compatProfiles[opts.Compat]
+	if !ok {
+		return
+	}
+	check := func(kind, name string) {
+		switch {
+		case profile.maxNameLength > 0 && len(name) > profile.maxNameLength && kind == "signal":
+			opts.Log.Warnf("%s name %s is %d characters long, but %s reads at most %d (use -max-name-length %d to shorten it).", kind, name, len(name), profile.tool, profile.maxNameLength, profile.maxNameLength)
+		case profile.maxNameLength > 0 && len(name) > profile.maxNameLength:
+			opts.Log.Warnf("%s name %s is %d characters long, but %s reads at most %d.", kind, name, len(name), profile.tool, profile.maxNameLength)
+		case !profile.leadingUnderscore && strings.HasPrefix(name, "_"):
+			opts.Log.Warnf("%s name %s starts with an underscore, which %s doesn't accept.", kind, name, profile.tool)
+		}
+	}
+
+	for _, node := range collectNodes(messages, opts.Node) {
+		check("node", node)
+	}
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		check("message", msg.Name)
+		for _, sig := range msg.Signals {
+			check("signal", sig.Name)
+		}
+	}
+}
+
+// compatAttributes returns the network attributes the tool of opts.Compat
+// needs: BusType, set to CAN, and DBName, naming the database after the
+// source file.
+func compatAttributes(opts Options) []AttributeDef {
+	if !compatProfiles[opts.Compat].networkAttributes {
+		return nil
+	}
+	return []AttributeDef{
+		{Name: busTypeAttribute, Object: "network", Type: "STRING", Default: "CAN", Value: "CAN"},
+		{Name: dbNameAttribute, Object: "network", Type: "STRING", Value: compatDatabaseName(opts.Source, compatProfiles[opts.Compat].maxNameLength)},
+	}
+}
+
+// dbNameAttribute names a database in Vector tools.
+const dbNameAttribute = "DBName"
+
+// compatDatabaseName derives the DBName of a database from the name of its
+// source file, or the first of several merged ones, as an identifier of at
+// most maxLength characters.
+func compatDatabaseName(source string, maxLength int) string {
+	source = strings.SplitN(source, ", ", 2)[0]
+	name := sanitizeIdentifier(strings.TrimSuffix(source, filepath.Ext(source)))
+	if name == "" {
+		name = "VBOX"
+	}
+	if len(name) > maxLength {
+		name = name[:maxLength]
+	}
+	return name
+}
@@ -0,0 +1,664 @@
+package refdbc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CommentModes lists the accepted values of the -comments flag.
+var CommentModes = []string{"none", "basic", "full"}
+
+// IsValidCommentMode reports whether mode is one of CommentModes.
+func IsValidCommentMode(mode string) bool {
+	for _, m := range CommentModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// ConvertFile handles the opening, parsing, and writing of the data for a single file.
+// Warnings are reported through opts.Log; the returned error is for fatal issues.
+// The returned stats describe what was written, and are partial when the file failed.
+func ConvertFile(inputPath, outputPath string, opts Options) (stats FileStats, err error) {
+	start := time.Now()
+	defer func() {
+		stats.Warnings = opts.Log.warnings
+		stats.Elapsed = time.Since(start)
+	}()
+
+	opts.Source = sourceName(inputPath)
+	messages, stats, err := readRefFile(inputPath, opts)
+	if err != nil {
+		return stats, err
+	}
+
+	// Render the output first, so a failed export or -verify leaves no file
+	// behind, nor overwrites one from an earlier run.
+	var out bytes.Buffer
+	if err := writeOutput(stats.database(messages), &out, opts); err != nil {
+		return stats, err
+	}
+	if err := writeOutputFile(outputPath, out.Bytes()); err != nil {
+		return stats, err
+	}
+	stats.countWritten(messages)
+	opts.Report.add(inputPath, opts.Source, messages, opts.Log)
+	return stats, nil
+}
+
+// writeOutput writes db to w in the format selected by opts.Format.
+func writeOutput(db *Database, w io.Writer, opts Options) error {
+	if opts.Format == "" {
+		opts.Format = "dbc"
+	}
+	exporter, err := NewExporter(opts)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(w)
+	if err := exporter.Export(db, writer); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// readRefFile opens and decodes a .ref file into structured Message data.
+// It also returns the counts of lines that were skipped or repeated earlier ones.
+func readRefFile(inputPath string, opts Options) (map[uint32]*Message, FileStats, error) {
+	file, err := openInput(inputPath)
+	if err != nil {
+		return nil, FileStats{}, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer file.Close()
+	return parseRef(file, opts)
+}
+
+// openInput opens path for reading, or returns Stdin for StdioPath.
+func openInput(path string) (io.ReadCloser, error) {
+	if path == StdioPath {
+		return io.NopCloser(Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// nopWriteCloser adds a Close method that does nothing to a writer.
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// createOutput creates path for writing, or returns Stdout for StdioPath.
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == StdioPath {
+		return nopWriteCloser{Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+// writeOutputFile writes data to path, or to Stdout for StdioPath.
+func writeOutputFile(path string, data []byte) error {
+	outFile, err := createOutput(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if _, err := outFile.Write(data); err != nil {
+		outFile.Close()
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	if err := outFile.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
+
+// sourceName returns the name of an input file as shown in output and reports.
+func sourceName(path string) string {
+	if path == StdioPath {
+		return "stdin"
+	}
+	return filepath.Base(path)
+}
+
+// parseRef decodes the contents of a .ref file into structured Message data.
+// Warnings are reported through opts.Log; the returned error is for fatal issues.
+// The returned stats count the lines that were skipped or repeated earlier ones.
+func parseRef(r io.Reader, opts Options) (map[uint32]*Message, FileStats, error) {
+	return parseRefContext(context.Background(), r, opts)
+}
+
+// parseRefContext is like parseRef, but stops between entries and returns
+// ctx.Err() once ctx is cancelled, so a huge or malicious file can't keep a
+// caller busy after it has given up.
+func parseRefContext(ctx context.Context, r io.Reader, opts Options) (map[uint32]*Message, FileStats, error) {
+	log := opts.Log
+	warningsBefore := log.warnings
+
+	// Every byte read also feeds the checksum tracker so the trailer can be
+	// verified, and is counted so debug events can give byte offsets.
+	tracker := newChecksumTracker()
+	counter := &countingReader{r: io.TeeReader(r, tracker)}
+	reader := bufio.NewReaderSize(counter, maxEntrySize)
+
+	// --- PARSING LOGIC BASED ON THE .hexpat STRUCTURE ---
+
+	// 1. Check the file looks like a .ref file, unless opts.FormatVersion
+	// forces a layout, then skip headers
+	variant, err := chooseRefVariant(reader, opts.FormatVersion)
+	if err != nil {
+		return nil, FileStats{}, err
+	}
+	if opts.FormatVersion == "" || opts.FormatVersion == "auto" {
+		log.Debugf("detected %s header", variant)
+	} else {
+		log.Debugf("reading %s header (-ref-version %s)", variant, opts.FormatVersion)
+	}
+
+	// 2. Read the serial string and total entries
+	preamble, totalEntries, err := readRefPreamble(reader, variant)
+	if err != nil {
+		return nil, FileStats{}, err
+	}
+	serial := preamble.Serial
+	log.Infof("Found %d entries to process.", totalEntries)
+
+	// 3. Decompress each entry and parse its lines straight away, so only one
+	// entry's data is held in memory at a time.
+	parser := newSignalParser(opts)
+	progress := newProgressReporter(int(totalEntries), opts)
+	var decoder entryDecoder
+	var missing []int
+	partial := false
+	for i := uint16(0); i < totalEntries; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, FileStats{}, err
+		}
+		progress.update(int(i))
+		entryOffset := counter.n - int64(reader.Buffered())
+		compressedLen, decompressedData, err := decoder.next(reader, i == totalEntries-1)
+		var corrupt corruptEntryError
+		if errors.As(err, &corrupt) {
+			// Log non-critical decompression errors and continue
+			missing = append(missing, int(i)+1)
+			if corrupt.skipped > 0 {
+				log.warnAt(position{Entry: int(i) + 1}, "could not decompress entry: %v; skipped bytes %d to %d to the next entry found",
+					err, entryOffset, entryOffset+int64(corrupt.skipped)-1)
+			} else {
+				log.warnAt(position{Entry: int(i) + 1}, "could not decompress entry: %v", err)
+			}
+			continue
+		}
+		if err != nil && opts.AllowPartial {
+			// Keep what was read so far; the rest of the file can't be found.
+			log.warnAt(position{Entry: int(i) + 1}, "failed to read entry: %v; writing the messages read so far (-allow-partial)", err)
+			for e := int(i) + 1; e <= int(totalEntries); e++ {
+				missing = append(missing, e)
+			}
+			partial = true
+			break
+		}
+		if err != nil {
+			return nil, FileStats{}, fmt.Errorf("failed to read entry #%d: %w", i+1, err)
+		}
+		log.debugAt(position{Entry: int(i) + 1}, "offset %d, %d bytes compressed, %d bytes decompressed",
+			entryOffset, compressedLen, len(decompressedData))
+		if opts.DumpRaw != nil {
+			dumpEntry(opts.DumpRaw, opts.Source, int(i)+1, decompressedData)
+		}
+		// Some exports start with a UTF-8 byte order mark.
+		if i == 0 {
+			decompressedData = bytes.TrimPrefix(decompressedData, utf8BOM)
+		}
+		decompressedData = decodeEntryText(decompressedData, position{Entry: int(i) + 1}, opts)
+		if err := parser.parseEntry(decompressedData, int(i)+1); err != nil {
+			return nil, FileStats{}, fmt.Errorf("failed to parse signal data: %w", err)
+		}
+	}
+	progress.finish()
+
+	// 4. Check any data remaining at the end of the file, which is normally a
+	// checksum. A partial read has reached the end already.
+	var trailing []byte
+	if !partial {
+		trailing, err = io.ReadAll(reader)
+	}
+	if err != nil {
+		return nil, FileStats{}, fmt.Errorf("error while checking for remaining data: %w", err)
+	}
+	if len(trailing) > 0 {
+		if err := verifyTrailer(trailing, tracker, opts); err != nil {
+			return nil, FileStats{}, err
+		}
+	}
+	// If nothing remains, we've read the file perfectly.
+
+	messages := parser.messages
+	if opts.Comments == "full" {
+		for _, msg := range messages {
+			msg.provenance = messageProvenance(opts.Source, serial)
+		}
+	}
+
+	// 5. Pair the halves of split signals, patch on the overrides file, then
+	// apply any requested signal renames before the data is written.
+	pairSplitSignals(messages, opts)
+	applyOverrides(messages, opts)
+	renameSignals(messages, opts)
+
+	// 6. Fill in missing ranges, convert units and work out which node
+	// transmits each message and which nodes receive each signal.
+	fillAutoRanges(messages, opts)
+	normalizeUnits(messages, opts)
+	assignTransmitters(messages, opts)
+	assignReceivers(messages, opts)
+
+	// 7. Report (or, with -auto-pack, resolve) signals sharing the same bits,
+	// ranges that contradict the signedness, multiplexed signals without
+	// a multiplexor and CAN FD payloads when the file isn't CAN FD.
+	if err := checkOverlaps(messages, opts); err != nil {
+		return nil, FileStats{}, err
+	}
+	if err := checkSignRanges(messages, opts); err != nil {
+		return nil, FileStats{}, err
+	}
+	if err := checkMultiplexing(messages, opts); err != nil {
+		return nil, FileStats{}, err
+	}
+	if err := checkFrameFormats(messages, opts); err != nil {
+		return nil, FileStats{}, err
+	}
+
+	// 8. Make sure every name is a valid DBC identifier, every name the DBC
+	// needs to be unique is, no signal name is too long, and the tool of
+	// opts.Compat can read them.
+	if err := sanitizeSignalNames(messages, opts); err != nil {
+		return nil, FileStats{}, err
+	}
+	if err := checkUniqueNames(messages, opts); err != nil {
+		return nil, FileStats{}, err
+	}
+	truncateSignalNames(messages, opts)
+	checkCompat(messages, opts)
+
+	// 9. In strict mode any warning, such as a skipped line, a missing DLC or
+	// an entry that failed to decompress, fails the file so nothing
+	// incomplete is written.
+	if n := log.warnings - warningsBefore; opts.Strict && n > 0 {
+		return nil, FileStats{}, fmt.Errorf("%d %s with -strict, not writing output", n, plural(n, "warning", "warnings"))
+	}
+	stats := FileStats{
+		SkippedLines: parser.skipped,
+		Duplicates:   parser.duplicates,
+		metadata:     parseRefMetadata(preamble),
+		entries:      int(totalEntries),
+		version:      variant.version(),
+	}
+	if partial {
+		stats.missing = missing
+	}
+	return messages, stats, nil
+}
+
+// dbcNewSymbols is the NS_ section listing the DBC keywords used by CANdb++ compatible tools.
+const dbcNewSymbols = "NS_ :\n\tCM_\n\tBA_DEF_\n\tBA_\n\tVAL_\n\tCAT_DEF_\n\tCAT_\n\tFILTER\n\tBA_DEF_DEF_\n\tEV_DATA_\n\tENVVAR_DATA_\n\tSGTYPE_\n\tSGTYPE_VAL_\n\tBA_DEF_SGTYPE_\n\tBA_SGTYPE_\n\tSIG_TYPE_REF_\n\tVAL_TABLE_\n\tSIG_GROUP_\n\tSIG_VALTYPE_\n\tSIGTYPE_VALTYPE_\n\tBO_TX_BU_\n\tBA_DEF_REL_\n\tBA_REL_\n\tBA_DEF_DEF_REL_\n\tBU_SG_REL_\n\tBU_EV_REL_\n\tBU_BO_REL_\n\tSG_MUL_VAL_\n"
+
+// writeDBCHeader writes the VERSION, NS_, BS_ and BU_ sections that precede the message definitions.
+func writeDBCHeader(w *bufio.Writer, nodes []string) {
+	w.WriteString("VERSION \"\"\n\n")
+	w.WriteString(dbcNewSymbols)
+	w.WriteString("\nBS_:\n\n")
+
+	// Write Nodes
+	w.WriteString(fmt.Sprintf("BU_: %s\n\n", strings.Join(nodes, " ")))
+}
+
+// writeDBC formats the messages of db into a valid DBC file, with the line
+// endings of opts.LineEnding and the character set of opts.DBCEncoding.
+func writeDBC(db *Database, w *bufio.Writer, opts Options) error {
+	if opts.LineEnding != "crlf" && opts.DBCEncoding != "windows-1252" {
+		return writeDBCSections(db, w, opts)
+	}
+	var buf bytes.Buffer
+	sections := bufio.NewWriter(&buf)
+	if err := writeDBCSections(db, sections, opts); err != nil {
+		return err
+	}
+	sections.Flush()
+	data := buf.Bytes()
+	if opts.DBCEncoding == "windows-1252" {
+		var lost []rune
+		if data, lost = encodeWindows1252(data); len(lost) > 0 {
+			opts.Log.Warnf("Windows-1252 has no %s, so %s written as '?'.", describeRunes(lost), plural(len(lost), "it is", "they are"))
+		}
+	}
+	if opts.LineEnding == "crlf" {
+		// DBC output has no carriage returns of its own, as line breaks in
+		// strings are escaped.
+		data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// writeDBCSections writes the sections of a DBC file for the messages of db,
+// in the order of opts.SortOrder. Every node referenced by a message or
+// signal is listed on the BU_ line, and signals without receivers are
+// received by opts.Node. With opts.NoHeader only the BO_/SG_ definitions are
+// written.
+func writeDBCSections(db *Database, w *bufio.Writer, opts Options) error {
+	messages := db.Messages
+	if !opts.NoHeader {
+		writeDBCHeader(w, collectNodes(messages, opts.Node))
+	}
+
+	// Get and sort message IDs for consistent output order
+	ids := orderedMessageIDs(messages, opts)
+
+	// Write all Messages (BO_) and their Signals (SG_)
+	for _, id := range ids {
+		msg := messages[id]
+		fmt.Fprintf(w, "BO_ %d %s: %d %s\n", msg.dbcID(), msg.Name, msg.DLC, msg.Node)
+		for _, sig := range msg.Signals {
+			byteOrderChar := '0' // @0 for Motorola
+			if sig.ByteOrder == 1 {
+				byteOrderChar = '1' // @1 for Intel
+			}
+
+			signChar := '+' // unsigned
+			if sig.IsSigned {
+				signChar = '-' // signed
+			}
+
+			name := sig.Name
+			if marker := muxMarker(sig); marker != "" {
+				name += " " + marker
+			}
+
+			fmt.Fprintf(w, "%sSG_ %s : %d|%d@%c%c (%s,%s) [%s|%s] \"%s\" %s\n",
+				signalIndent(opts),
+				name,
+				sig.StartBit,
+				sig.Length,
+				byteOrderChar,
+				signChar,
+				formatFloat(sig.Factor, opts),
+				formatFloat(sig.Offset, opts),
+				formatFloat(sig.Min, opts),
+				formatFloat(sig.Max, opts),
+				sig.Unit,
+				joinReceivers(signalReceivers(sig, opts.Node), opts),
+			)
+		}
+		w.WriteString("\n")
+	}
+
+	// Write message and signal comments. With opts.Annotate a file-level
+	// comment names the converter, and each message comment is extended with
+	// the message's hex ID and signal count.
+	// With opts.Comments set to full, each comment also says where the
+	// message or signal was read from; with none, no comments are written.
+	// With opts.Metadata a file-level comment describes the logger. The
+	// comment marking a partial read is written even with none.
+	if opts.Annotate && opts.Comments != "none" {
+		fmt.Fprintf(w, "CM_ \"%s\";\n", escapeDBCString(annotation(fmt.Sprintf("Generated by racelogic-ref-to-dbc %s", Version), opts.Source)+"."))
+	}
+	if opts.Metadata && db.Metadata != nil && opts.Comments != "none" {
+		fmt.Fprintf(w, "CM_ \"%s\";\n", escapeDBCString(metadataNote(*db.Metadata, opts.Source)))
+	}
+	if len(db.MissingEntries) > 0 {
+		fmt.Fprintf(w, "CM_ \"%s\";\n", escapeDBCString(partialNote(db, opts.Source)))
+	}
+	for _, id := range ids {
+		if opts.Comments == "none" {
+			break
+		}
+		msg := messages[id]
+		var notes []string
+		if opts.Annotate {
+			// The provenance already names the source file.
+			source := opts.Source
+			if opts.Comments == "full" && msg.provenance != "" {
+				source = ""
+			}
+			notes = append(notes, annotation(fmt.Sprintf("ID 0x%X, %d %s", id, len(msg.Signals), plural(len(msg.Signals), "signal", "signals")), source))
+		}
+		if opts.Comments == "full" && msg.provenance != "" {
+			notes = append(notes, msg.provenance)
+		}
+		comment := appendNote(msg.Comment, strings.Join(notes, "; "))
+		if comment != "" {
+			fmt.Fprintf(w, "CM_ BO_ %d \"%s\";\n", msg.dbcID(), escapeDBCString(comment))
+		}
+		for _, sig := range msg.Signals {
+			comment := sig.Comment
+			if opts.Comments == "full" {
+				comment = appendNote(comment, sig.provenance)
+			}
+			if comment != "" {
+				fmt.Fprintf(w, "CM_ SG_ %d %s \"%s\";\n", msg.dbcID(), sig.Name, escapeDBCString(comment))
+			}
+		}
+	}
+
+	// Write attribute definitions and values, then value tables and signal groups.
+	writeAttributes(messages, w, opts)
+	writeValueTables(messages, ids, w)
+	writeSignalGroups(messages, ids, w, opts.MinGroupSize)
+
+	// Write the value types of IEEE float and double signals.
+	for _, id := range ids {
+		for _, sig := range messages[id].Signals {
+			if sig.ValueType != 0 {
+				fmt.Fprintf(w, "SIG_VALTYPE_ %d %s : %d;\n", messages[id].dbcID(), sig.Name, sig.ValueType)
+			}
+		}
+	}
+
+	return nil
+}
+
+// partialNote describes the entries missing from a partial read of source.
+func partialNote(db *Database, source string) string {
+	n := len(db.MissingEntries)
+	return fmt.Sprintf("PARTIAL CONVERSION of %s: %d of %d entries could not be read (%s %s), so their messages are missing.",
+		provenanceName(source), n, db.TotalEntries, plural(n, "entry", "entries"), formatEntryRanges(db.MissingEntries))
+}
+
+// formatEntryRanges lists ascending entry numbers, joining runs of
+// consecutive entries into ranges, e.g. "2, 5-12".
+func formatEntryRanges(entries []int) string {
+	var parts []string
+	for i := 0; i < len(entries); {
+		j := i
+		for j+1 < len(entries) && entries[j+1] == entries[j]+1 {
+			j++
+		}
+		if j == i {
+			parts = append(parts, strconv.Itoa(entries[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", entries[i], entries[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ", ")
+}
+
+// dumpEntry writes the decompressed data of an entry to w after a marker line
+// naming the source file and entry number.
+func dumpEntry(w io.Writer, source string, entry int, data []byte) {
+	fmt.Fprintf(w, "===== %s entry #%d (%d bytes) =====\n", source, entry, len(data))
+	w.Write(data)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		fmt.Fprintln(w)
+	}
+}
+
+// messageProvenance describes the .ref file a message was read from.
+func messageProvenance(source, serial string) string {
+	serial = strings.TrimSpace(serial)
+	if serial == "" {
+		return fmt.Sprintf("from %s", provenanceName(source))
+	}
+	return fmt.Sprintf("from %s, serial %s", provenanceName(source), serial)
+}
+
+// signalProvenance describes where in the .ref file a signal was read, quoting
+// the raw line in brackets.
+func signalProvenance(source string, pos position, line string) string {
+	return fmt.Sprintf("from %s %s [%s]", provenanceName(source), pos, strings.TrimSpace(line))
+}
+
+// provenanceName names the source file in provenance comments, which the
+// library API may not know.
+func provenanceName(source string) string {
+	if source == "" {
+		return "the .ref file"
+	}
+	return source
+}
+
+// appendNote adds a note to a comment in parentheses, or returns the note as a
+// sentence when there is no comment. An empty note leaves the comment unchanged.
+func appendNote(comment, note string) string {
+	switch {
+	case note == "":
+		return comment
+	case comment == "":
+		return strings.ToUpper(note[:1]) + note[1:] + "."
+	}
+	return fmt.Sprintf("%s (%s)", comment, note)
+}
+
+// annotation returns text followed by the name of the source file, if known.
+func annotation(text, source string) string {
+	if source == "" {
+		return text
+	}
+	return fmt.Sprintf("%s, from %s", text, source)
+}
+
+// plural returns singular when n is 1 and pluralForm otherwise.
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return singular
+	}
+	return pluralForm
+}
+
+// escapeDBCString escapes backslashes, quotes and line breaks so s can be
+// written inside a double-quoted DBC string.
+func escapeDBCString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// sortedMessageIDs returns the IDs of all messages in ascending order.
+func sortedMessageIDs(messages map[uint32]*Message) []uint32 {
+	ids := make([]uint32, 0, len(messages))
+	for id := range messages {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// parseSignalType reads the type column of a signal line, or the type of a
+// signal override: signed or unsigned for integers, float (also float32 or
+// single) for IEEE single precision and double (also float64) for double
+// precision. It returns the SIG_VALTYPE_ value and signedness, and false for
+// an unknown type, which is read as unsigned.
+func parseSignalType(text string) (valueType byte, signed bool, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "unsigned":
+		return 0, false, true
+	case "signed":
+		return 0, true, true
+	case "float", "float32", "single":
+		return 1, true, true
+	case "double", "float64":
+		return 2, true, true
+	}
+	return 0, false, false
+}
+
+// ieeeLength returns the bit length required by an IEEE value type, or 0 for integers.
+func ieeeLength(valueType byte) int {
+	switch valueType {
+	case 1:
+		return 32
+	case 2:
+		return 64
+	}
+	return 0
+}
+
+// IsValidIdentifier reports whether s is a legal DBC identifier ([A-Za-z_][A-Za-z0-9_]*).
+func IsValidIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_'
+		isDigit := r >= '0' && r <= '9'
+		if !isLetter && !(isDigit && i > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func readUpToCRLF(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		peekedBytes, err := r.Peek(2)
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				remaining, readErr := io.ReadAll(r)
+				return append(line, remaining...), readErr
+			}
+			return nil, err
+		}
+		if peekedBytes[0] == '\r' && peekedBytes[1] == '\n' {
+			return line, nil
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+	}
+}
+
+func readZlibStr(r io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, fmt.Errorf("could not read zlib string length: %w", err)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("could not read zlib string data (expected %d bytes): %w", length, err)
+	}
+	return data, nil
+}
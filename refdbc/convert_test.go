@@ -0,0 +1,523 @@
+package refdbc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update-golden", false, "rewrite the .ref fixtures and golden files in testdata")
+
+// testdataDir holds the sample .ref files and, in golden, their output.
+const testdataDir = "../testdata"
+
+// refBuilder assembles a .ref file the way a logger writes one.
+type refBuilder struct {
+	Header   string           // Header line; empty means "VBOX REF FILE"
+	Serial   string           // Serial string line, followed by a zlib serial block
+	Legacy   bool             // Leave out the serial string and block, as very old files do
+	Order    binary.ByteOrder // Byte order of the entry count; nil means big-endian
+	Count    int              // Entry count written to the file; 0 means len(Entries)
+	Entries  []string         // Text of each entry, compressed into its own zlib block
+	Checksum bool             // Append a CRC-16/XMODEM of everything before it
+}
+
+// build returns the bytes of the file.
+func (b refBuilder) build(t testing.TB) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	header := b.Header
+	if header == "" {
+		header = "VBOX REF FILE"
+	}
+	out.WriteString(header + "\r\n")
+	if !b.Legacy {
+		out.WriteString(b.Serial + "\r\n")
+		writeTestBlock(t, &out, []byte("serial-data"))
+	}
+	order := b.Order
+	if order == nil {
+		order = binary.BigEndian
+	}
+	count := b.Count
+	if count == 0 {
+		count = len(b.Entries)
+	}
+	binary.Write(&out, order, uint16(count))
+	for _, entry := range b.Entries {
+		writeTestBlock(t, &out, []byte(entry))
+	}
+	if b.Checksum {
+		var crc uint16
+		for _, c := range out.Bytes() {
+			crc = crc16CCITTUpdate(crc, c)
+		}
+		binary.Write(&out, binary.BigEndian, crc)
+	}
+	return out.Bytes()
+}
+
+// writeTestBlock writes data compressed with zlib, after its 16-bit length.
+func writeTestBlock(t testing.TB, out *bytes.Buffer, data []byte) {
+	t.Helper()
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	binary.Write(out, binary.BigEndian, uint16(compressed.Len()))
+	out.Write(compressed.Bytes())
+}
+
+// goldenFixtures are the sample files in testdata, by name.
+var goldenFixtures = map[string]refBuilder{
+	// Intel and Motorola signals, comments, a channel group and an
+	// extended ID, with several signals in most entries.
+	"basic": {
+		Serial:   "SN 123456",
+		Checksum: true,
+		Entries: []string{
+			"Speed,256,km/h,0,16,0,0.01,655.35,0,unsigned,Intel,8,Speed over ground,GPS position and velocity,GPS\r\n" +
+				"Heading,256,deg,16,16,0,0.01,360,0,unsigned,Intel,8,,,GPS\r\n" +
+				"Sats,256,,32,8,0,1,255,0,unsigned,Intel,8,,,GPS\r\n",
+			"LatAcc,512,g,7,16,0,0.001,5,-5,signed,Motorola,8,,,IMU\r\n" +
+				"LongAcc,512,g,23,16,0,0.001,5,-5,signed,Motorola,8,,,IMU\r\n",
+			"Voltage,419365120,V,0,12,-0.5,0.00244140625,9.4,-0.5,unsigned,Intel,4\r\n",
+		},
+	},
+	// Value tables, cycle times, IEEE floats and multiplexing.
+	"features": {
+		Serial:   "SN 123456",
+		Checksum: true,
+		Entries: []string{
+			"Mode,768,,0,8,0,1,3,0,unsigned,Intel,8,Drive mode,,,,0=Off|1=Eco|2=Normal|3=Sport,100\r\n" +
+				"Gear,768,,8,4,0,1,15,0,unsigned,Intel,8\r\n",
+			"Latitude,1281,deg,0,32,0,1,90,-90,float,Intel,8,,,,,,50\r\n" +
+				"Longitude,1281,deg,32,32,0,1,180,-180,float,Intel,8\r\n",
+			"Channel,1536,,0,8,0,1,255,0,unsigned,Intel,8,,,,,,,M\r\n" +
+				"Temp,1536,degC,8,16,0,0.1,150,-40,signed,Intel,8,,,,,,,m0\r\n" +
+				"Pressure,1536,bar,8,16,0,0.01,10,0,unsigned,Intel,8,,,,,,,m1\r\n",
+		},
+	},
+	// Lines the parser has to skip or repair: a column header, a comment,
+	// a missing DLC, too few fields, a bad ID and a bad start bit, with
+	// \n line endings and blank lines in between.
+	"problems": {
+		Serial: "SN 654321",
+		Entries: []string{
+			"Name,ID,Unit,Start,Length,Offset,Factor,Max,Min,Type,Order,DLC\r\n" +
+				"# exported by hand\r\n" +
+				"RPM,1024,rpm,0,16,0,1,16000,0,unsigned,Intel\r\n" +
+				"Throttle,1024,%,16,8,0,0.5\r\n",
+			"Brake,1025,bar,7,16,0,0.01,200,0,unsigned,Motorola,8\n" +
+				"\n" +
+				"Steering,1025,deg,23,16,0,0.1,720,-720,signed,Motorola,8\n" +
+				"Yaw,10x25,deg/s,32,16,0,0.01,300,-300,signed,Intel,8\n" +
+				"Roll,1025,deg,start,16,0,0.01,90,-90,signed,Intel,8\n",
+		},
+	},
+}
+
+// TestGolden converts every fixture to DBC and JSON and compares the output
+// with the golden files. Run with -update-golden to rewrite both the .ref
+// files and the golden files after an intended change.
+func TestGolden(t *testing.T) {
+	var names []string
+	for name := range goldenFixtures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			ref := goldenFixtures[name].build(t)
+			checkGolden(t, filepath.Join(testdataDir, name+".ref"), ref)
+
+			for _, format := range []string{"dbc", "json"} {
+				opts := DefaultOptions()
+				opts.Format = format
+				opts.Source = name + ".ref"
+				messages, stats, err := parseRef(bytes.NewReader(ref), opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var out bytes.Buffer
+				if err := writeOutput(stats.database(messages), &out, opts); err != nil {
+					t.Fatal(err)
+				}
+				checkGolden(t, filepath.Join(testdataDir, "golden", name+"."+format), out.Bytes())
+			}
+		})
+	}
+}
+
+// checkGolden compares got with the file at path, or rewrites the file with
+// -update-golden.
+func checkGolden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update-golden to create it)", err)
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	gotLines := strings.SplitAfter(string(got), "\n")
+	wantLines := strings.SplitAfter(string(want), "\n")
+	for i := 0; i < len(gotLines) || i < len(wantLines); i++ {
+		switch {
+		case i >= len(gotLines):
+			t.Fatalf("%s: output ends at line %d, golden file continues with %q", path, i+1, wantLines[i])
+		case i >= len(wantLines):
+			t.Fatalf("%s: output continues past the golden file at line %d with %q", path, i+1, gotLines[i])
+		case gotLines[i] != wantLines[i]:
+			t.Fatalf("%s: line %d is %q, want %q", path, i+1, gotLines[i], wantLines[i])
+		}
+	}
+	t.Fatalf("%s: output differs from the golden file", path)
+}
+
+// TestParseREFWarnings checks the warnings of each kind of problem line, and
+// that -strict turns them into an error.
+func TestParseREFWarnings(t *testing.T) {
+	ref := goldenFixtures["problems"].build(t)
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.Log = NewLogger(&log, "text", LevelWarn)
+	db, err := ParseREFWithOptions(bytes.NewReader(ref), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"entry #1 line #3: missing DLC field",
+		"entry #1 line #4: skipping malformed line (not enough fields)",
+		"entry #2 line #4: skipping line (invalid message ID)",
+		"entry #2 line #5: skipping line (invalid start bit 'start')",
+	} {
+		if !strings.Contains(log.String(), want) {
+			t.Errorf("no warning %q in:\n%s", want, log.String())
+		}
+	}
+	if n := strings.Count(log.String(), "\n"); n != 4 {
+		t.Errorf("%d warnings, want 4:\n%s", n, log.String())
+	}
+	if got := len(db.Messages[1024].Signals); got != 1 {
+		t.Errorf("message 1024 has %d signals, want 1", got)
+	}
+	if got := len(db.Messages[1025].Signals); got != 2 {
+		t.Errorf("message 1025 has %d signals, want 2", got)
+	}
+
+	opts.Strict = true
+	if _, err := ParseREFWithOptions(bytes.NewReader(ref), opts); err == nil {
+		t.Error("-strict accepted a file with problem lines")
+	}
+}
+
+// TestParseREFEntries checks that the signals of multi-line entries keep
+// their byte order and layout.
+func TestParseREFEntries(t *testing.T) {
+	db, err := ParseREF(bytes.NewReader(goldenFixtures["basic"].build(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id        uint32
+		name      string
+		startBit  int
+		byteOrder byte
+		signed    bool
+	}{
+		{256, "Speed", 0, 1, false},
+		{256, "Sats", 32, 1, false},
+		{512, "LatAcc", 7, 0, true},
+		{512, "LongAcc", 23, 0, true},
+		{419365120, "Voltage", 0, 1, false},
+	}
+	for _, tt := range tests {
+		msg := db.Messages[tt.id]
+		if msg == nil {
+			t.Fatalf("message %d is missing", tt.id)
+		}
+		var sig *Signal
+		for _, s := range msg.Signals {
+			if s.Name == tt.name {
+				sig = s
+			}
+		}
+		if sig == nil {
+			t.Errorf("signal %s is missing from message %d", tt.name, tt.id)
+			continue
+		}
+		if sig.StartBit != tt.startBit || sig.ByteOrder != tt.byteOrder || sig.IsSigned != tt.signed {
+			t.Errorf("%s: start bit %d, byte order %d, signed %t; want %d, %d, %t",
+				tt.name, sig.StartBit, sig.ByteOrder, sig.IsSigned, tt.startBit, tt.byteOrder, tt.signed)
+		}
+	}
+	if !db.Messages[419365120].IsExtended {
+		t.Error("message 419365120 is not extended")
+	}
+}
+
+// cancelWriter cancels a context when it is written to.
+type cancelWriter struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return w.Buffer.Write(p)
+}
+
+func TestParseREFContextCancel(t *testing.T) {
+	ref := goldenFixtures["basic"].build(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// -dump-raw output is written as each entry is read, so the context is
+	// cancelled once the first entry has been parsed.
+	dump := &cancelWriter{cancel: cancel}
+	opts := DefaultOptions()
+	opts.DumpRaw = dump
+	db, err := ParseREFContext(ctx, bytes.NewReader(ref), opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+	if db != nil {
+		t.Error("a cancelled parse returned a database")
+	}
+	if !strings.Contains(dump.String(), "entry #1") {
+		t.Error("the first entry was not read")
+	}
+	if strings.Contains(dump.String(), "entry #2") {
+		t.Error("entries after the first were read")
+	}
+
+	if _, err := ParseREFContext(context.Background(), bytes.NewReader(ref), DefaultOptions()); err != nil {
+		t.Errorf("uncancelled parse failed: %v", err)
+	}
+}
+
+// TestConvertFileFailedExport checks that a failed export neither creates the
+// output file nor overwrites an existing one.
+func TestConvertFileFailedExport(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "basic.ref")
+	if err := os.WriteFile(input, goldenFixtures["basic"].build(t), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.Format = "nope"
+
+	missing := filepath.Join(dir, "missing.dbc")
+	if _, err := ConvertFile(input, missing, opts); err == nil {
+		t.Fatal("ConvertFile accepted an unknown format")
+	}
+	if _, err := os.Stat(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a failed export created %s", missing)
+	}
+
+	existing := filepath.Join(dir, "existing.dbc")
+	if err := os.WriteFile(existing, []byte("previous"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ConvertFile(input, existing, opts); err == nil {
+		t.Fatal("ConvertFile accepted an unknown format")
+	}
+	if got, err := os.ReadFile(existing); err != nil || string(got) != "previous" {
+		t.Errorf("a failed export left %s as %q, %v, want %q", existing, got, err, "previous")
+	}
+}
+
+// largeRef builds a file of 1000 entries, each a message of eight signals.
+func largeRef(b *testing.B) []byte {
+	entries := make([]string, 1000)
+	for i := range entries {
+		var entry strings.Builder
+		for j := 0; j < 8; j++ {
+			fmt.Fprintf(&entry, "Channel_%d_%d,%d,km/h,%d,8,0,0.01,2.55,0,unsigned,Intel,8,Channel %d of message %d,,GPS\r\n",
+				i, j, 0x100+i, j*8, j, i)
+		}
+		entries[i] = entry.String()
+	}
+	return refBuilder{Serial: "SN 123456", Entries: entries, Checksum: true}.build(b)
+}
+
+func BenchmarkParseREF(b *testing.B) {
+	ref := largeRef(b)
+	opts := DefaultOptions()
+	b.SetBytes(int64(len(ref)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := parseRef(bytes.NewReader(ref), opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeEntries compares two ways of decompressing the entries of a
+// file: reading each into a new slice and inflating it with a new zlib
+// reader, as the converter used to, and an entryDecoder, which reuses its
+// flate reader and buffer for every entry.
+func BenchmarkDecodeEntries(b *testing.B) {
+	ref := largeRef(b)
+	b.Run("fresh", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			reader := bufio.NewReader(bytes.NewReader(ref))
+			count := skipPreamble(b, reader)
+			for e := 0; e < count; e++ {
+				compressed, err := readZlibStr(reader)
+				if err != nil {
+					b.Fatal(err)
+				}
+				zr, err := zlib.NewReader(bytes.NewReader(compressed))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.ReadAll(zr); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("reused", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			reader := bufio.NewReader(bytes.NewReader(ref))
+			count := skipPreamble(b, reader)
+			var decoder entryDecoder
+			for e := 0; e < count; e++ {
+				if _, _, err := decoder.next(reader, e == count-1); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+// skipPreamble reads the header, serial string and serial block of a .ref
+// file, and returns its entry count.
+func skipPreamble(b *testing.B, r *bufio.Reader) int {
+	for i := 0; i < 2; i++ {
+		if _, err := readUpToCRLF(r); err != nil {
+			b.Fatal(err)
+		}
+		r.Discard(2)
+	}
+	if _, err := readZlibStr(r); err != nil {
+		b.Fatal(err)
+	}
+	var count uint16
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		b.Fatal(err)
+	}
+	return int(count)
+}
+
+// liveHeap returns the bytes of heap still in use after a collection.
+func liveHeap() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// BenchmarkParseREFEntries compares two ways of turning the entries of a file
+// into messages: parsing each entry as it is decompressed, as parseRef
+// does, and decompressing every entry into lines first, then parsing the
+// lines, as the converter used to. Streaming holds one entry at a time and
+// reuses its buffers, which shows in live-B/op, the heap still in use once
+// every line has been parsed, and in B/op. Its lines are slices of their
+// entry rather than copies, which shows in allocs/op.
+func BenchmarkParseREFEntries(b *testing.B) {
+	ref := largeRef(b)
+	b.Run("streaming", func(b *testing.B) {
+		b.ReportAllocs()
+		var live uint64
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			base := liveHeap()
+			b.StartTimer()
+			reader := bufio.NewReader(bytes.NewReader(ref))
+			count := skipPreamble(b, reader)
+			parser := newSignalParser(DefaultOptions())
+			var decoder entryDecoder
+			for e := 0; e < count; e++ {
+				_, data, err := decoder.next(reader, e == count-1)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := parser.parseEntry(data, e+1); err != nil {
+					b.Fatal(err)
+				}
+			}
+			messages := parser.messages
+			b.StopTimer()
+			live += liveHeap() - base
+			runtime.KeepAlive(messages)
+			b.StartTimer()
+		}
+		b.ReportMetric(float64(live)/float64(b.N), "live-B/op")
+	})
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		var live uint64
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			base := liveHeap()
+			b.StartTimer()
+			reader := bufio.NewReader(bytes.NewReader(ref))
+			count := skipPreamble(b, reader)
+			var lines []string
+			for e := 0; e < count; e++ {
+				compressed, err := readZlibStr(reader)
+				if err != nil {
+					b.Fatal(err)
+				}
+				zr, err := zlib.NewReader(bytes.NewReader(compressed))
+				if err != nil {
+					b.Fatal(err)
+				}
+				data, err := io.ReadAll(zr)
+				if err != nil {
+					b.Fatal(err)
+				}
+				lines = append(lines, strings.Split(strings.TrimSpace(string(data)), "\r\n")...)
+			}
+			messages, err := parseSignalLines(lines, DefaultOptions())
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.StopTimer()
+			live += liveHeap() - base
+			runtime.KeepAlive(lines)
+			runtime.KeepAlive(messages)
+			b.StartTimer()
+		}
+		b.ReportMetric(float64(live)/float64(b.N), "live-B/op")
+	})
+}
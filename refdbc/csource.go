@@ -0,0 +1,432 @@
+package refdbc
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// bitSegment is the part of a signal stored in one payload byte: the bits
+// of mask in byte, holding the raw value bits shifted left by shift (right
+// when negative).
+type bitSegment struct {
+	byte  int
+	mask  uint8
+	shift int
+}
+
+// signalSegments splits the raw value of sig into the payload bytes it is
+// stored in, in the order the bytes appear in the signal's bit list. Within
+// a byte the raw bits of both byte orders are contiguous, so each byte needs
+// a single shift. Bits before the payload are left out.
+func signalSegments(sig *Signal) []bitSegment {
+	var segments []bitSegment
+	for i, bit := range signalBits(sig.StartBit, sig.Length, sig.ByteOrder) {
+		if bit < 0 {
+			continue
+		}
+		// Intel signals list their bits from the least significant up,
+		// Motorola signals from the most significant down.
+		rawBit := i
+		if sig.ByteOrder == 0 {
+			rawBit = sig.Length - 1 - i
+		}
+		byteIndex, bitInByte := bit/8, bit%8
+		if n := len(segments); n > 0 && segments[n-1].byte == byteIndex {
+			segments[n-1].mask |= 1 << bitInByte
+			continue
+		}
+		segments = append(segments, bitSegment{byte: byteIndex, mask: 1 << bitInByte, shift: bitInByte - rawBit})
+	}
+	return segments
+}
+
+// rawBits returns the width of the unsigned integer holding the raw value of
+// a signal of length bits: 8, 16, 32 or 64.
+func rawBits(length int) int {
+	switch {
+	case length <= 8:
+		return 8
+	case length <= 16:
+		return 16
+	case length <= 32:
+		return 32
+	}
+	return 64
+}
+
+// cKeywords lists the C keywords a signal name can't be used as.
+var cKeywords = map[string]bool{
+	"auto": true, "break": true, "case": true, "char": true, "const": true, "continue": true,
+	"default": true, "do": true, "double": true, "else": true, "enum": true, "extern": true,
+	"float": true, "for": true, "goto": true, "if": true, "inline": true, "int": true,
+	"long": true, "register": true, "restrict": true, "return": true, "short": true, "signed": true,
+	"sizeof": true, "static": true, "struct": true, "switch": true, "typedef": true, "union": true,
+	"unsigned": true, "void": true, "volatile": true, "while": true, "bool": true,
+}
+
+// snakeCase turns a name such as VehicleSpeed or GPS_Lat into vehicle_speed
+// or gps_lat, the way cantools names generated C identifiers. Characters
+// that can't be in an identifier become underscores.
+func snakeCase(name string) string {
+	runes := []rune(sanitizeIdentifier(name))
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 && runes[i-1] != '_' {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				sb.WriteByte('_')
+			}
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+	return sb.String()
+}
+
+// cDatabaseName returns the prefix of the identifiers generated for the
+// file named source, such as basic for basic.ref.
+func cDatabaseName(source string) string {
+	name := strings.TrimSuffix(source, filepath.Ext(source))
+	if name == "" {
+		name = "can"
+	}
+	return snakeCase(name)
+}
+
+// cLiteral writes f as a C double literal.
+func cLiteral(f float64) string {
+	text := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(text, ".e") {
+		text += ".0"
+	}
+	return text
+}
+
+// cComment makes text safe to use in a /* */ comment, on one line.
+func cComment(text string) string {
+	text = strings.ReplaceAll(text, "*/", "* /")
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// cSignal holds the names and types generated for a signal.
+type cSignal struct {
+	*Signal
+	field     string // Member of the message struct
+	rawType   string // Unsigned integer type the raw value is packed from
+	fieldType string // Type of the struct member
+}
+
+// cMessage holds the names generated for a message and its signals.
+type cMessage struct {
+	*Message
+	name        string // Snake-case name, the middle of every identifier
+	signals     []cSignal
+	multiplexor *cSignal
+}
+
+// newCMessage works out the C names and types of msg and its signals. Signal
+// names that collide once converted get a _2, _3... suffix.
+func newCMessage(msg *Message) cMessage {
+	m := cMessage{Message: msg, name: snakeCase(msg.Name)}
+	taken := make(map[string]bool)
+	for _, sig := range msg.Signals {
+		field := snakeCase(sig.Name)
+		if cKeywords[field] {
+			field += "_"
+		}
+		if taken[field] {
+			field = uniqueName(field, taken)
+		}
+		taken[field] = true
+
+		bits := rawBits(sig.Length)
+		cs := cSignal{Signal: sig, field: field, rawType: fmt.Sprintf("uint%d_t", bits), fieldType: fmt.Sprintf("uint%d_t", bits)}
+		switch {
+		case sig.ValueType == 1:
+			cs.fieldType = "float"
+		case sig.ValueType == 2:
+			cs.fieldType = "double"
+		case sig.IsSigned:
+			cs.fieldType = fmt.Sprintf("int%d_t", bits)
+		}
+		m.signals = append(m.signals, cs)
+	}
+	for i := range m.signals {
+		if m.signals[i].MuxRole == muxMultiplexor && m.multiplexor == nil {
+			m.multiplexor = &m.signals[i]
+		}
+	}
+	return m
+}
+
+// writeCSource writes the messages as a header-only C library in the style
+// of the cantools C source generator: for every message, macros with its
+// frame ID, length and cycle time, a struct with a member per signal holding
+// its raw value, pack and unpack functions converting the struct to and
+// from the payload bytes, and encode and decode functions converting each
+// signal between its raw and physical value. Everything is static inline, so
+// the header can be included in any number of files without a separate
+// source file.
+//
+// Multiplexed signals are only packed and unpacked when the multiplexor has
+// their value. The code needs only <stdint.h>, <stddef.h> and <string.h>.
+func writeCSource(messages map[uint32]*Message, w io.Writer, opts Options) error {
+	db := cDatabaseName(opts.Source)
+	guard := strings.ToUpper(db) + "_H"
+	source := opts.Source
+	if source == "" {
+		source = "a .ref file"
+	}
+
+	fmt.Fprintf(w, "/* Generated by racelogic-ref-to-dbc %s from %s. Do not edit. */\n\n", Version, cComment(source))
+	fmt.Fprintf(w, "#ifndef %s\n#define %s\n\n", guard, guard)
+	fmt.Fprintf(w, "#include <stddef.h>\n#include <stdint.h>\n#include <string.h>\n\n")
+	fmt.Fprintf(w, "#ifdef __cplusplus\nextern \"C\" {\n#endif\n")
+
+	taken := make(map[string]bool)
+	for _, id := range sortedMessageIDs(messages) {
+		m := newCMessage(messages[id])
+		if taken[m.name] {
+			m.name = uniqueName(m.name, taken)
+		}
+		taken[m.name] = true
+		prefix := db + "_" + m.name
+		macro := strings.ToUpper(prefix)
+
+		fmt.Fprintf(w, "\n/* Message %s. */\n", cComment(m.Name))
+		extended := 0
+		if m.IsExtended {
+			extended = 1
+		}
+		fmt.Fprintf(w, "#define %s_FRAME_ID (0x%Xu)\n", macro, m.ID)
+		fmt.Fprintf(w, "#define %s_LENGTH (%du)\n", macro, m.DLC)
+		fmt.Fprintf(w, "#define %s_IS_EXTENDED (%d)\n", macro, extended)
+		if m.CycleTime > 0 {
+			fmt.Fprintf(w, "#define %s_CYCLE_TIME_MS (%du)\n", macro, m.CycleTime)
+		}
+		for _, s := range m.signals {
+			taken := make(map[string]bool)
+			for _, vd := range s.ValueTable {
+				label := strings.Trim(snakeCase(vd.Label), "_")
+				if label == "" {
+					label = fmt.Sprintf("value_%d", vd.Value)
+				}
+				if taken[label] {
+					label = uniqueName(label, taken)
+				}
+				taken[label] = true
+				fmt.Fprintf(w, "#define %s_%s_%s_CHOICE (%d)\n", macro, strings.ToUpper(s.field), strings.ToUpper(label), vd.Value)
+			}
+		}
+
+		writeCStruct(w, m, prefix)
+		writeCPack(w, m, prefix)
+		writeCUnpack(w, m, prefix)
+		for _, s := range m.signals {
+			writeCScaling(w, s, prefix)
+		}
+	}
+
+	fmt.Fprintf(w, "\n#ifdef __cplusplus\n}\n#endif\n\n#endif /* %s */\n", guard)
+	return nil
+}
+
+// writeCStruct writes the struct holding the raw signal values of m.
+func writeCStruct(w io.Writer, m cMessage, prefix string) {
+	fmt.Fprintf(w, "\n/**\n * Signals in message %s (0x%X).\n", cComment(m.Name), m.ID)
+	if m.Comment != "" {
+		fmt.Fprintf(w, " *\n * %s\n", cComment(m.Comment))
+	}
+	fmt.Fprintf(w, " *\n * All signal values are raw; use the encode and decode functions to\n * convert them from and to physical values.\n */\n")
+	fmt.Fprintf(w, "struct %s_t {\n", prefix)
+	if len(m.signals) == 0 {
+		// An empty struct isn't valid C.
+		fmt.Fprintf(w, "    uint8_t dummy;\n")
+	}
+	for i, s := range m.signals {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "    /**\n")
+		if s.Comment != "" {
+			fmt.Fprintf(w, "     * %s\n     *\n", cComment(s.Comment))
+		}
+		if s.Min != 0 || s.Max != 0 {
+			fmt.Fprintf(w, "     * Range: %s..%s\n", cLiteral(s.Min), cLiteral(s.Max))
+		}
+		fmt.Fprintf(w, "     * Scale: %s\n     * Offset: %s\n", cLiteral(s.Factor), cLiteral(s.Offset))
+		if s.Unit != "" {
+			fmt.Fprintf(w, "     * Unit: %s\n", cComment(s.Unit))
+		}
+		if marker := muxMarker(s.Signal); marker != "" {
+			fmt.Fprintf(w, "     * Multiplex: %s\n", marker)
+		}
+		fmt.Fprintf(w, "     */\n    %s %s;\n", s.fieldType, s.field)
+	}
+	fmt.Fprintf(w, "};\n")
+}
+
+// cMuxCondition returns the condition under which s is present in a frame,
+// reading the multiplexor from the struct pointer src, or an empty string if
+// it always is.
+func cMuxCondition(m cMessage, s cSignal, src string) string {
+	if s.MuxRole != muxMultiplexed || m.multiplexor == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s->%s == %du", src, m.multiplexor.field, s.MuxValue)
+}
+
+// writeCPack writes the function packing the struct of m into its payload.
+func writeCPack(w io.Writer, m cMessage, prefix string) {
+	fmt.Fprintf(w, "\n/**\n * Pack message %s.\n *\n", cComment(m.Name))
+	fmt.Fprintf(w, " * @param[out] dst_p Buffer to pack the message into.\n")
+	fmt.Fprintf(w, " * @param[in] src_p Data to pack.\n")
+	fmt.Fprintf(w, " * @param[in] size Size of dst_p.\n *\n")
+	fmt.Fprintf(w, " * @return Size of packed data, or -1 if dst_p is too small.\n */\n")
+	fmt.Fprintf(w, "static inline int %s_pack(uint8_t *dst_p, const struct %s_t *src_p, size_t size)\n{\n", prefix, prefix)
+	for _, s := range m.signals {
+		fmt.Fprintf(w, "    %s %s;\n", s.rawType, s.field)
+	}
+	if len(m.signals) > 0 {
+		fmt.Fprintln(w)
+	} else {
+		fmt.Fprintf(w, "    (void)src_p;\n\n")
+	}
+	if m.DLC > 0 {
+		fmt.Fprintf(w, "    if (size < %du) {\n        return (-1);\n    }\n\n", m.DLC)
+		fmt.Fprintf(w, "    memset(&dst_p[0], 0, %d);\n", m.DLC)
+	} else {
+		fmt.Fprintf(w, "    (void)dst_p;\n    (void)size;\n")
+	}
+	for _, s := range m.signals {
+		indent := "    "
+		fmt.Fprintln(w)
+		if cond := cMuxCondition(m, s, "src_p"); cond != "" {
+			fmt.Fprintf(w, "    if (%s) {\n", cond)
+			indent = "        "
+		}
+		if s.ValueType != 0 {
+			fmt.Fprintf(w, "%smemcpy(&%s, &src_p->%s, sizeof(%s));\n", indent, s.field, s.field, s.field)
+		} else {
+			fmt.Fprintf(w, "%s%s = (%s)src_p->%s;\n", indent, s.field, s.rawType, s.field)
+		}
+		for _, seg := range signalSegments(s.Signal) {
+			if seg.byte >= m.DLC {
+				continue
+			}
+			shifted := s.field
+			switch {
+			case seg.shift > 0:
+				shifted = fmt.Sprintf("(%s << %d)", s.field, seg.shift)
+			case seg.shift < 0:
+				shifted = fmt.Sprintf("(%s >> %d)", s.field, -seg.shift)
+			}
+			fmt.Fprintf(w, "%sdst_p[%d] |= (uint8_t)(%s & 0x%02xu);\n", indent, seg.byte, shifted, seg.mask)
+		}
+		if indent != "    " {
+			fmt.Fprintf(w, "    }\n")
+		}
+	}
+	fmt.Fprintf(w, "\n    return (%d);\n}\n", m.DLC)
+}
+
+// writeCUnpack writes the function unpacking the payload of m into its struct.
+func writeCUnpack(w io.Writer, m cMessage, prefix string) {
+	fmt.Fprintf(w, "\n/**\n * Unpack message %s.\n *\n", cComment(m.Name))
+	fmt.Fprintf(w, " * @param[out] dst_p Object to unpack the message into.\n")
+	fmt.Fprintf(w, " * @param[in] src_p Message to unpack.\n")
+	fmt.Fprintf(w, " * @param[in] size Size of src_p.\n *\n")
+	fmt.Fprintf(w, " * @return zero(0) or -1 if src_p is too small.\n */\n")
+	fmt.Fprintf(w, "static inline int %s_unpack(struct %s_t *dst_p, const uint8_t *src_p, size_t size)\n{\n", prefix, prefix)
+	for _, s := range m.signals {
+		fmt.Fprintf(w, "    %s %s;\n", s.rawType, s.field)
+	}
+	if len(m.signals) > 0 {
+		fmt.Fprintln(w)
+	} else {
+		fmt.Fprintf(w, "    (void)dst_p;\n    (void)src_p;\n\n")
+	}
+	if m.DLC > 0 {
+		fmt.Fprintf(w, "    if (size < %du) {\n        return (-1);\n    }\n", m.DLC)
+	} else {
+		fmt.Fprintf(w, "    (void)size;\n")
+	}
+
+	// The multiplexor is unpacked first, as the other signals depend on it.
+	signals := m.signals
+	if m.multiplexor != nil {
+		signals = []cSignal{*m.multiplexor}
+		for _, s := range m.signals {
+			if s.Signal != m.multiplexor.Signal {
+				signals = append(signals, s)
+			}
+		}
+	}
+	for _, s := range signals {
+		indent := "    "
+		fmt.Fprintln(w)
+		if cond := cMuxCondition(m, s, "dst_p"); cond != "" {
+			fmt.Fprintf(w, "    if (%s) {\n", cond)
+			indent = "        "
+		}
+		fmt.Fprintf(w, "%s%s = 0u;\n", indent, s.field)
+		for _, seg := range signalSegments(s.Signal) {
+			if seg.byte >= m.DLC {
+				continue
+			}
+			masked := fmt.Sprintf("(%s)(src_p[%d] & 0x%02xu)", s.rawType, seg.byte, seg.mask)
+			switch {
+			case seg.shift > 0:
+				masked = fmt.Sprintf("(%s >> %d)", masked, seg.shift)
+			case seg.shift < 0:
+				masked = fmt.Sprintf("(%s << %d)", masked, -seg.shift)
+			}
+			fmt.Fprintf(w, "%s%s |= %s;\n", indent, s.field, masked)
+		}
+		bits := rawBits(s.Length)
+		switch {
+		case s.ValueType != 0:
+			fmt.Fprintf(w, "%smemcpy(&dst_p->%s, &%s, sizeof(dst_p->%s));\n", indent, s.field, s.field, s.field)
+		case s.IsSigned && s.Length < bits:
+			// Extend the sign of the raw value to the width of the member.
+			fill := ^uint64(0) << s.Length
+			if bits < 64 {
+				fill &= 1<<bits - 1
+			}
+			fmt.Fprintf(w, "%sif ((%s & (1u%s << %d)) != 0u) {\n", indent, s.field, cUnsignedSuffix(bits), s.Length-1)
+			fmt.Fprintf(w, "%s    %s |= 0x%Xu%s;\n%s}\n", indent, s.field, fill, cUnsignedSuffix(bits), indent)
+			fmt.Fprintf(w, "%sdst_p->%s = (%s)%s;\n", indent, s.field, s.fieldType, s.field)
+		default:
+			fmt.Fprintf(w, "%sdst_p->%s = (%s)%s;\n", indent, s.field, s.fieldType, s.field)
+		}
+		if indent != "    " {
+			fmt.Fprintf(w, "    }\n")
+		}
+	}
+	fmt.Fprintf(w, "\n    return (0);\n}\n")
+}
+
+// cUnsignedSuffix returns the suffix making a literal wide enough for an
+// unsigned integer of bits bits.
+func cUnsignedSuffix(bits int) string {
+	if bits == 64 {
+		return "ll"
+	}
+	return ""
+}
+
+// writeCScaling writes the functions converting s between its physical and
+// raw value: raw = (physical - offset) / factor.
+func writeCScaling(w io.Writer, s cSignal, prefix string) {
+	name := prefix + "_" + s.field
+	fmt.Fprintf(w, "\n/**\n * Encode signal %s.\n *\n * @param[in] value Physical value.\n *\n * @return Raw value.\n */\n", cComment(s.Name))
+	fmt.Fprintf(w, "static inline %s %s_encode(double value)\n{\n", s.fieldType, name)
+	fmt.Fprintf(w, "    return (%s)((value - %s) / %s);\n}\n", s.fieldType, cLiteral(s.Offset), cLiteral(s.Factor))
+	fmt.Fprintf(w, "\n/**\n * Decode signal %s.\n *\n * @param[in] value Raw value.\n *\n * @return Physical value.\n */\n", cComment(s.Name))
+	fmt.Fprintf(w, "static inline double %s_decode(%s value)\n{\n", name, s.fieldType)
+	fmt.Fprintf(w, "    return ((double)value * %s) + %s;\n}\n", cLiteral(s.Factor), cLiteral(s.Offset))
+}
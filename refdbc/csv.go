@@ -0,0 +1,125 @@
+package refdbc
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// csvHeader lists the columns written by writeCSV, in order.
+var csvHeader = []string{
+	"Message ID", "Message Name", "Signal Name", "Start Bit", "Length",
+	"Byte Order", "Signedness", "Factor", "Offset", "Min", "Max", "Unit", "DLC",
+}
+
+// csvRefHeader lists the columns written by writeCSV with the "ref" layout,
+// which follow the fields of a .ref signal line.
+var csvRefHeader = []string{
+	"Name", "ID", "Unit", "Start Bit", "Length", "Offset", "Factor", "Max", "Min",
+	"Type", "Order", "DLC", "Comment", "Message Comment", "Group", "Part",
+	"Values", "Cycle Time", "Multiplex",
+}
+
+// CSVLayouts lists the accepted values of the -csv-layout flag.
+var CSVLayouts = []string{"table", "ref"}
+
+// IsValidCSVLayout reports whether layout is one of CSVLayouts.
+func IsValidCSVLayout(layout string) bool {
+	for _, l := range CSVLayouts {
+		if l == layout {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCSV writes the structured message map as a flat CSV table with one row per signal.
+// Rows are ordered by message ID and then by start bit so the output is stable across runs.
+// With opts.CSVLayout "ref" the rows use the field order of the .ref file instead.
+func writeCSV(messages map[uint32]*Message, w io.Writer, opts Options) error {
+	if opts.CSVLayout == "ref" {
+		return writeRefCSV(messages, w, opts)
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+
+		// Sort a copy so the message itself keeps its source order for other writers.
+		signals := make([]*Signal, len(msg.Signals))
+		copy(signals, msg.Signals)
+		sort.SliceStable(signals, func(i, j int) bool { return signals[i].StartBit < signals[j].StartBit })
+
+		for _, sig := range signals {
+			row := []string{
+				strconv.FormatUint(uint64(msg.ID), 10),
+				msg.Name,
+				sig.Name,
+				strconv.Itoa(sig.StartBit),
+				strconv.Itoa(sig.Length),
+				byteOrderName(sig.ByteOrder),
+				signalTypeName(sig),
+				formatFloat(sig.Factor, opts),
+				formatFloat(sig.Offset, opts),
+				formatFloat(sig.Min, opts),
+				formatFloat(sig.Max, opts),
+				sig.Unit,
+				strconv.Itoa(msg.DLC),
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeRefCSV writes one row per signal with the columns of a .ref signal line,
+// keeping the signals of each message in source order. Columns follow
+// opts.MinMaxOrder and opts.BitConvention, as in -reverse output, so the rows
+// can be pasted back into a .ref export.
+func writeRefCSV(messages map[uint32]*Message, w io.Writer, opts Options) error {
+	cw := csv.NewWriter(w)
+	header := csvRefHeader
+	if opts.MinMaxOrder == "min-first" {
+		header = append([]string(nil), csvRefHeader...)
+		header[7], header[8] = header[8], header[7]
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		for i, sig := range msg.Signals {
+			row := refSignalFields(msg, sig, i == 0, opts)
+			for len(row) < len(csvRefHeader) {
+				row = append(row, "")
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// signalTypeName names the type of sig as the type column of .ref files
+// does: unsigned, signed, float or double.
+func signalTypeName(sig *Signal) string {
+	switch {
+	case sig.ValueType == 1:
+		return "float"
+	case sig.ValueType == 2:
+		return "double"
+	case sig.IsSigned:
+		return "signed"
+	}
+	return "unsigned"
+}
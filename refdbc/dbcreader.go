@@ -0,0 +1,379 @@
+package refdbc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// boLineRe matches a message definition: BO_ <id> <name>: <dlc> <transmitter>
+	boLineRe = regexp.MustCompile(`^BO_\s+(\d+)\s+(\w+)\s*:\s*(\d+)\s+(\w+)`)
+	// sgLineRe matches a signal definition:
+	// SG_ <name> [M|m<value>] : <start>|<length>@<order><sign> (<factor>,<offset>) [<min>|<max>] "<unit>" <receiver>[,<receiver>...]
+	// Receivers may also be separated by a comma and a space, or by spaces.
+	sgLineRe = regexp.MustCompile(`^SG_\s+(\w+)\s*(?:(\w+)\s*)?:\s*(\d+)\|(\d+)@([01])([+-])\s*\(([^,]+),([^)]+)\)\s*\[([^|]+)\|([^\]]+)\]\s*"((?:[^"\\]|\\.)*)"\s*(.*)`)
+	// buLineRe matches the node list: BU_: <node> <node>...
+	buLineRe = regexp.MustCompile(`^BU_\s*:(.*)$`)
+	// commentLineRe matches a message or signal comment, which may span lines:
+	// CM_ BO_ <id> "<text>"; or CM_ SG_ <id> <signal> "<text>";
+	commentLineRe = regexp.MustCompile(`^CM_\s+(BO_|SG_)\s+(\d+)\s+(?:(\w+)\s+)?"((?:[^"\\]|\\.)*)"\s*;`)
+	// valTypeLineRe matches a signal value type: SIG_VALTYPE_ <id> <signal> : <type>;
+	valTypeLineRe = regexp.MustCompile(`^SIG_VALTYPE_\s+(\d+)\s+(\w+)\s*:\s*([012])\s*;`)
+	// cycleTimeLineRe matches the cycle time of a message: BA_ "GenMsgCycleTime" BO_ <id> <ms>;
+	cycleTimeLineRe = regexp.MustCompile(`^BA_\s+"GenMsgCycleTime"\s+BO_\s+(\d+)\s+(\d+)\s*;`)
+	// attrDefLineRe matches an attribute definition:
+	// BA_DEF_ [BU_|BO_|SG_|EV_] "<name>" <type> [<min> <max> | "<label>","<label>"...];
+	attrDefLineRe = regexp.MustCompile(`^BA_DEF_\s+(?:(BU_|BO_|SG_|EV_)\s+)?"(\w+)"\s+(INT|HEX|FLOAT|STRING|ENUM)\s*(.*?)\s*;$`)
+	// attrDefaultLineRe matches the default of an attribute: BA_DEF_DEF_ "<name>" <value>;
+	attrDefaultLineRe = regexp.MustCompile(`^BA_DEF_DEF_\s+"(\w+)"\s+(.*?)\s*;$`)
+	// networkAttrLineRe matches the value of a network attribute: BA_ "<name>" <value>;
+	networkAttrLineRe = regexp.MustCompile(`^BA_\s+"(\w+)"\s+("(?:[^"\\]|\\.)*"|[-+\w.]+)\s*;$`)
+	// sigGroupLineRe matches a signal group: SIG_GROUP_ <id> <name> <repetitions> : <signal> <signal>...;
+	sigGroupLineRe = regexp.MustCompile(`^SIG_GROUP_\s+(\d+)\s+(\w+)\s+\d+\s*:\s*(.*?)\s*;$`)
+)
+
+// readDBCFile opens a .dbc file and reads its messages and signals.
+func readDBCFile(path string) (map[uint32]*Message, error) {
+	file, err := openInput(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DBC file: %w", err)
+	}
+	defer file.Close()
+	return readDBC(file)
+}
+
+// readDBC reads the messages and signals of a DBC file.
+func readDBC(r io.Reader) (map[uint32]*Message, error) {
+	db, err := ParseDBC(r)
+	if err != nil {
+		return nil, err
+	}
+	return db.Messages, nil
+}
+
+// ParseDBC decodes a DBC file: its nodes, its messages and signals with their
+// comments, value tables, value types, signal groups and cycle times, and its
+// attribute definitions with their defaults and network values. Comments may
+// span several lines. Other sections, and attributes of individual nodes,
+// messages and signals other than GenMsgCycleTime, are ignored. A signal with
+// a length outside 1-64 or bits outside a 64-byte payload is an error.
+func ParseDBC(r io.Reader) (*Database, error) {
+	db := &Database{Messages: make(map[uint32]*Message)}
+	messages := db.Messages
+	var current *Message
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// A quoted string left open continues on the next line.
+		startLine := lineNum
+		for hasOpenQuote(line) && scanner.Scan() {
+			lineNum++
+			line += "\n" + scanner.Text()
+		}
+		if hasOpenQuote(line) {
+			return nil, fmt.Errorf("line %d: unterminated string", startLine)
+		}
+		// DBC files written by Windows tools are usually Windows-1252. The
+		// whole statement is decoded, as a comment's special characters may
+		// be on any of its lines.
+		if !utf8.ValidString(line) {
+			line = decodeSingleByte([]byte(line), true)
+		}
+
+		switch {
+		case strings.HasPrefix(line, "BU_:") || strings.HasPrefix(line, "BU_ "):
+			if m := buLineRe.FindStringSubmatch(line); m != nil {
+				db.Nodes = strings.Fields(m[1])
+			}
+
+		case strings.HasPrefix(line, "BO_ "):
+			m := boLineRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: malformed message definition: %s", lineNum, line)
+			}
+			id, _ := strconv.ParseUint(m[1], 10, 32)
+			dlc, _ := strconv.Atoi(m[3])
+			current = &Message{
+				ID:   uint32(id) &^ dbcExtendedFlag,
+				Name: m[2],
+				DLC:  dlc,
+				Node: m[4],
+
+				IsExtended: id&dbcExtendedFlag != 0,
+			}
+			messages[current.ID] = current
+
+		case strings.HasPrefix(line, "SG_ "):
+			if current == nil {
+				return nil, fmt.Errorf("line %d: signal defined outside of a message: %s", lineNum, line)
+			}
+			m := sgLineRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: malformed signal definition: %s", lineNum, line)
+			}
+			sig, err := signalFromMatch(m)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			current.Signals = append(current.Signals, sig)
+
+		case strings.HasPrefix(line, "CM_ "):
+			// Comments of the network, nodes and environment variables are ignored.
+			m := commentLineRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			id, _ := strconv.ParseUint(m[2], 10, 32)
+			msg := messages[uint32(id)&^dbcExtendedFlag]
+			text := unescapeDBCString(m[4])
+			if m[1] == "BO_" {
+				if msg != nil {
+					msg.Comment = text
+				}
+			} else if sig := findSignal(msg, m[3]); sig != nil {
+				sig.Comment = text
+			}
+
+		case strings.HasPrefix(line, "VAL_ "):
+			// Value tables of environment variables are ignored.
+			m := valLineRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			id, _ := strconv.ParseUint(m[1], 10, 32)
+			if sig := findSignal(messages[uint32(id)&^dbcExtendedFlag], m[2]); sig != nil {
+				table, err := parseValueDescriptions(m[3])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNum, err)
+				}
+				sig.ValueTable = table
+			}
+
+		case strings.HasPrefix(line, "BA_DEF_ "):
+			// Definitions for environment variables, and ones other tools
+			// wrote in a form this reader doesn't know, are ignored.
+			m := attrDefLineRe.FindStringSubmatch(line)
+			if m == nil || m[1] == "EV_" {
+				continue
+			}
+			def, err := attributeDefFromMatch(m)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			db.Attributes = append(db.Attributes, def)
+
+		case strings.HasPrefix(line, "BA_DEF_DEF_ "):
+			m := attrDefaultLineRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			if def := findAttribute(db.Attributes, m[1]); def != nil {
+				def.Default = attributeText(*def, m[2])
+			}
+
+		case strings.HasPrefix(line, "BA_ "):
+			if m := networkAttrLineRe.FindStringSubmatch(line); m != nil {
+				if def := findAttribute(db.Attributes, m[1]); def != nil && def.Object == "network" {
+					def.Value = attributeText(*def, m[2])
+				}
+				continue
+			}
+			// Other attributes of nodes, messages and signals are ignored.
+			m := cycleTimeLineRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			id, _ := strconv.ParseUint(m[1], 10, 32)
+			if msg := messages[uint32(id)&^dbcExtendedFlag]; msg != nil {
+				msg.CycleTime, _ = strconv.Atoi(m[2])
+			}
+
+		case strings.HasPrefix(line, "SIG_GROUP_ "):
+			m := sigGroupLineRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			id, _ := strconv.ParseUint(m[1], 10, 32)
+			msg := messages[uint32(id)&^dbcExtendedFlag]
+			for _, name := range strings.Fields(m[3]) {
+				if sig := findSignal(msg, name); sig != nil {
+					sig.Group = m[2]
+				}
+			}
+
+		case strings.HasPrefix(line, "SIG_VALTYPE_ "):
+			m := valTypeLineRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: malformed value type definition: %s", lineNum, line)
+			}
+			id, _ := strconv.ParseUint(m[1], 10, 32)
+			if sig := findSignal(messages[uint32(id)&^dbcExtendedFlag], m[2]); sig != nil {
+				sig.ValueType = m[3][0] - '0'
+			}
+
+		case line == "":
+			// A blank line ends the current message's signal list.
+			current = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// hasOpenQuote reports whether s ends inside a double-quoted DBC string.
+func hasOpenQuote(s string) bool {
+	open := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && open:
+			i++ // Skip the escaped character
+		case s[i] == '"':
+			open = !open
+		}
+	}
+	return open
+}
+
+// attributeDefFromMatch builds an AttributeDef from the submatches of attrDefLineRe.
+func attributeDefFromMatch(m []string) (AttributeDef, error) {
+	def := AttributeDef{Name: m[2], Type: m[3]}
+	for object, keyword := range AttributeObjects {
+		if keyword == m[1] {
+			def.Object = object
+		}
+	}
+	switch def.Type {
+	case "ENUM":
+		for _, label := range strings.Split(m[4], ",") {
+			def.Values = append(def.Values, unquoteDBCString(strings.TrimSpace(label)))
+		}
+	case "INT", "HEX", "FLOAT":
+		bounds := strings.Fields(m[4])
+		if len(bounds) != 2 {
+			return def, fmt.Errorf("attribute %s needs a minimum and a maximum", def.Name)
+		}
+		var err error
+		if def.Min, err = strconv.ParseFloat(bounds[0], 64); err != nil {
+			return def, fmt.Errorf("invalid minimum '%s' of attribute %s", bounds[0], def.Name)
+		}
+		if def.Max, err = strconv.ParseFloat(bounds[1], 64); err != nil {
+			return def, fmt.Errorf("invalid maximum '%s' of attribute %s", bounds[1], def.Name)
+		}
+	}
+	return def, nil
+}
+
+// attributeText returns a value of a BA_DEF_DEF_ or BA_ line as the text
+// AttributeDef holds: unquoted, and for ENUM attributes given by index, the label.
+func attributeText(def AttributeDef, raw string) string {
+	text := unquoteDBCString(raw)
+	if def.Type == "ENUM" && text == raw {
+		if i, err := strconv.Atoi(text); err == nil && i >= 0 && i < len(def.Values) {
+			return def.Values[i]
+		}
+	}
+	return text
+}
+
+// unquoteDBCString removes the double quotes around s and reverses
+// escapeDBCString. Text without quotes is returned unchanged.
+func unquoteDBCString(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return unescapeDBCString(s[1 : len(s)-1])
+	}
+	return s
+}
+
+// signalFromMatch builds a Signal from the submatches of sgLineRe.
+func signalFromMatch(m []string) (*Signal, error) {
+	startBit, startBitErr := strconv.Atoi(m[3])
+	length, lengthErr := strconv.Atoi(m[4])
+	var byteOrder byte = 0 // @0 is Motorola
+	if m[5] == "1" {
+		byteOrder = 1 // @1 is Intel
+	}
+
+	// The bit layout is checked against the largest payload, as the parser
+	// does for .ref lines, so that no later step meets a signal with no bits
+	// or bits outside any message.
+	switch {
+	case startBitErr != nil:
+		return nil, fmt.Errorf("invalid start bit '%s' in signal %s", m[3], m[1])
+	case lengthErr != nil:
+		return nil, fmt.Errorf("invalid length '%s' in signal %s", m[4], m[1])
+	case length < 1 || length > 64:
+		return nil, fmt.Errorf("length %d of signal %s is outside the range 1-64", length, m[1])
+	case startBit >= maxDLC*8:
+		return nil, fmt.Errorf("start bit %d of signal %s is outside the %d bits of a %d-byte payload", startBit, m[1], maxDLC*8, maxDLC)
+	}
+	bits := signalBits(startBit, length, byteOrder)
+	if last := bits[len(bits)-1]; last >= maxDLC*8 {
+		return nil, fmt.Errorf("signal %s reaches bit %d, past the %d bits of a %d-byte payload", m[1], last, maxDLC*8, maxDLC)
+	}
+
+	floats := make([]float64, 4)
+	for i, raw := range m[7:11] {
+		f, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' in signal %s", raw, m[1])
+		}
+		floats[i] = f
+	}
+
+	receivers := strings.FieldsFunc(m[12], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+	if len(receivers) == 0 {
+		receivers = nil
+	}
+
+	// Extended multiplexing markers such as m1M aren't supported, so those
+	// signals are read as plain ones.
+	muxRole, muxValue, err := parseMuxMarker(m[2])
+	if err != nil {
+		muxRole, muxValue = muxNone, 0
+	}
+
+	return &Signal{
+		Name:      m[1],
+		StartBit:  startBit,
+		Length:    length,
+		ByteOrder: byteOrder,
+		IsSigned:  m[6] == "-",
+		Factor:    floats[0],
+		Offset:    floats[1],
+		Min:       floats[2],
+		Max:       floats[3],
+		Unit:      unescapeDBCString(m[11]),
+		Receivers: receivers,
+		MuxRole:   muxRole,
+		MuxValue:  muxValue,
+	}, nil
+}
+
+// findSignal returns the signal with the given name in msg, or nil if msg is nil or has no such signal.
+func findSignal(msg *Message, name string) *Signal {
+	if msg == nil {
+		return nil
+	}
+	for _, sig := range msg.Signals {
+		if sig.Name == name {
+			return sig
+		}
+	}
+	return nil
+}
+
+// unescapeDBCString reverses escapeDBCString.
+func unescapeDBCString(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n").Replace(s)
+}
@@ -0,0 +1,113 @@
+package refdbc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// checkRoundTrip writes db as a DBC with opts, reads it back with ParseDBC
+// and compares every message and signal, comments included.
+func checkRoundTrip(t *testing.T, db *Database, opts Options) {
+	t.Helper()
+	var out bytes.Buffer
+	if err := WriteDBCWithOptions(db, &out, opts); err != nil {
+		t.Fatal(err)
+	}
+	back, err := ParseDBC(&out)
+	if err != nil {
+		t.Fatalf("reading back: %v\n%s", err, out.String())
+	}
+	if len(back.Messages) != len(db.Messages) {
+		t.Errorf("%d messages read back, want %d", len(back.Messages), len(db.Messages))
+	}
+	for _, id := range sortedMessageIDs(db.Messages) {
+		msg, got := db.Messages[id], back.Messages[id]
+		if got == nil {
+			t.Errorf("message %d is missing", id)
+			continue
+		}
+		if got.Name != msg.Name || got.DLC != msg.DLC || got.IsExtended != msg.IsExtended || got.CycleTime != msg.CycleTime || got.Comment != msg.Comment {
+			t.Errorf("message %d read back as %s, DLC %d, extended %t, cycle %d, comment %q; want %s, %d, %t, %d, %q",
+				id, got.Name, got.DLC, got.IsExtended, got.CycleTime, got.Comment, msg.Name, msg.DLC, msg.IsExtended, msg.CycleTime, msg.Comment)
+		}
+		if len(got.Signals) != len(msg.Signals) {
+			t.Errorf("message %d has %d signals read back, want %d", id, len(got.Signals), len(msg.Signals))
+			continue
+		}
+		for i, sig := range msg.Signals {
+			if got.Signals[i].Name != sig.Name {
+				t.Errorf("signal %s of message %d read back as %s", sig.Name, id, got.Signals[i].Name)
+			}
+			if changes := diffSignal(sig, got.Signals[i], nil); len(changes) > 0 {
+				t.Errorf("signal %s of message %d changed: %s", sig.Name, id, strings.Join(changes, ", "))
+			}
+		}
+	}
+}
+
+func TestDBCRoundTripFixtures(t *testing.T) {
+	for _, name := range []string{"basic", "features"} {
+		t.Run(name, func(t *testing.T) {
+			db, err := ParseREF(bytes.NewReader(goldenFixtures[name].build(t)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkRoundTrip(t, db, DefaultOptions())
+		})
+	}
+}
+
+func TestDBCRoundTripComments(t *testing.T) {
+	db := &Database{Messages: map[uint32]*Message{
+		0x100: {ID: 0x100, Name: "Temperatures", DLC: 8, Node: DefaultNodeName, Comment: "Engine bay\nsensors, 20 °C nominal", Signals: []*Signal{
+			{Name: "Oil", Length: 16, ByteOrder: 1, IsSigned: true, Factor: 0.1, Min: -40, Max: 150, Unit: "°C",
+				Comment: "Measured at the sump.\nSee the \"wiring\" diagram: Zündung"},
+			{Name: "Water", StartBit: 16, Length: 16, ByteOrder: 1, Factor: 0.1, Max: 120, Unit: "°C", Comment: "Résumé"},
+		}},
+	}}
+	for _, encoding := range DBCEncodings {
+		t.Run(encoding, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.DBCEncoding = encoding
+			checkRoundTrip(t, db, opts)
+		})
+	}
+}
+
+func TestParseDBCWindows1252Comment(t *testing.T) {
+	// The only Windows-1252 byte, the degree sign, is on the second line.
+	data := "BO_ 256 Temperatures: 8 Vector__XXX\n" +
+		" SG_ Oil : 0|16@1- (0.1,0) [-40|150] \"\" Vector__XXX\n" +
+		"\n" +
+		"CM_ SG_ 256 Oil \"Oil temperature\nin \xb0C\";\n"
+	db, err := ParseDBC(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := db.Messages[256].Signals[0].Comment, "Oil temperature\nin °C"; got != want {
+		t.Errorf("comment %q, want %q", got, want)
+	}
+}
+
+func TestParseDBCInvalidSignalLayout(t *testing.T) {
+	tests := []struct {
+		name   string
+		signal string
+		want   string
+	}{
+		{"zero length", `SG_ Empty : 0|0@1+ (1,0) [0|0] "" Vector__XXX`, "line 2: length 0 of signal Empty is outside the range 1-64"},
+		{"too long", `SG_ Wide : 0|65@1+ (1,0) [0|0] "" Vector__XXX`, "line 2: length 65 of signal Wide is outside the range 1-64"},
+		{"start bit", `SG_ Far : 512|8@1+ (1,0) [0|0] "" Vector__XXX`, "line 2: start bit 512 of signal Far is outside the 512 bits of a 64-byte payload"},
+		{"past the payload", `SG_ Tail : 508|8@1+ (1,0) [0|0] "" Vector__XXX`, "line 2: signal Tail reaches bit 515, past the 512 bits of a 64-byte payload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := "BO_ 256 Engine: 8 Vector__XXX\n " + tt.signal + "\n"
+			_, err := ParseDBC(strings.NewReader(data))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
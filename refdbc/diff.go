@@ -0,0 +1,221 @@
+package refdbc
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LoadDatabase reads the messages from either a .dbc file or a Racelogic .ref file,
+// chosen by the file extension.
+func LoadDatabase(path string, opts Options) (map[uint32]*Message, error) {
+	if strings.EqualFold(filepath.Ext(path), ".dbc") {
+		return readDBCFile(path)
+	}
+	messages, _, err := readRefFile(path, opts)
+	return messages, err
+}
+
+// DiffIgnores lists the accepted values of the -diff-ignore flag: the kinds of
+// differences a comparison can leave out, for example to compare a converted
+// file only by bit layout, scaling and units with a hand-maintained DBC that
+// uses its own names and comments.
+var DiffIgnores = []string{"names", "comments", "nodes", "cycle-times", "value-tables"}
+
+// IsValidDiffIgnore reports whether kind is one of DiffIgnores.
+func IsValidDiffIgnore(kind string) bool {
+	for _, k := range DiffIgnores {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// DiffDatabases writes a structured comparison of two message sets to w.
+// It returns true if any difference was found.
+func DiffDatabases(nameA, nameB string, a, b map[uint32]*Message, w io.Writer) bool {
+	return DiffDatabasesWithOptions(nameA, nameB, a, b, w, DefaultOptions())
+}
+
+// DiffDatabasesWithOptions is like DiffDatabases, but leaves out the kinds of
+// differences listed in opts.DiffIgnore. The comparison ends with a line
+// counting the messages only in each set and the messages that changed.
+func DiffDatabasesWithOptions(nameA, nameB string, a, b map[uint32]*Message, w io.Writer, opts Options) bool {
+	ignore := make(map[string]bool)
+	for _, kind := range opts.DiffIgnore {
+		ignore[kind] = true
+	}
+
+	var onlyA, onlyB, common []uint32
+	for id := range a {
+		if _, ok := b[id]; ok {
+			common = append(common, id)
+		} else {
+			onlyA = append(onlyA, id)
+		}
+	}
+	for id := range b {
+		if _, ok := a[id]; !ok {
+			onlyB = append(onlyB, id)
+		}
+	}
+	for _, ids := range [][]uint32{onlyA, onlyB, common} {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+
+	different := false
+	if len(onlyA) > 0 {
+		different = true
+		fmt.Fprintf(w, "Messages only in %s:\n", nameA)
+		for _, id := range onlyA {
+			fmt.Fprintf(w, "  %d (%s)\n", id, a[id].Name)
+		}
+	}
+	if len(onlyB) > 0 {
+		different = true
+		fmt.Fprintf(w, "Messages only in %s:\n", nameB)
+		for _, id := range onlyB {
+			fmt.Fprintf(w, "  %d (%s)\n", id, b[id].Name)
+		}
+	}
+
+	changed := 0
+	for _, id := range common {
+		lines := diffMessage(a[id], b[id], ignore)
+		if len(lines) == 0 {
+			continue
+		}
+		different = true
+		changed++
+		fmt.Fprintf(w, "Message %d (%s) changed:\n", id, a[id].Name)
+		for _, line := range lines {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+
+	if !different {
+		fmt.Fprintln(w, "No differences found.")
+		return false
+	}
+	fmt.Fprintf(w, "%d %s only in %s, %d only in %s, %d changed.\n",
+		len(onlyA), plural(len(onlyA), "message", "messages"), nameA, len(onlyB), nameB, changed)
+	return true
+}
+
+// diffMessage describes every difference between two definitions of the same
+// message, except for the kinds in ignore.
+func diffMessage(a, b *Message, ignore map[string]bool) []string {
+	var lines []string
+	if a.Name != b.Name && !ignore["names"] {
+		lines = append(lines, fmt.Sprintf("name: %s -> %s", a.Name, b.Name))
+	}
+	if a.IsExtended != b.IsExtended {
+		lines = append(lines, fmt.Sprintf("frame: %s -> %s", frameName(a.IsExtended), frameName(b.IsExtended)))
+	}
+	if a.DLC != b.DLC {
+		lines = append(lines, fmt.Sprintf("DLC: %d -> %d", a.DLC, b.DLC))
+	}
+	if a.Node != b.Node && !ignore["nodes"] {
+		lines = append(lines, fmt.Sprintf("node: %s -> %s", a.Node, b.Node))
+	}
+	if a.Comment != b.Comment && !ignore["comments"] {
+		lines = append(lines, fmt.Sprintf("comment: %q -> %q", a.Comment, b.Comment))
+	}
+	if a.CycleTime != b.CycleTime && !ignore["cycle-times"] {
+		lines = append(lines, fmt.Sprintf("cycle time: %d ms -> %d ms", a.CycleTime, b.CycleTime))
+	}
+
+	signalsB := make(map[string]*Signal, len(b.Signals))
+	for _, sig := range b.Signals {
+		signalsB[sig.Name] = sig
+	}
+	signalsA := make(map[string]*Signal, len(a.Signals))
+	for _, sig := range a.Signals {
+		signalsA[sig.Name] = sig
+		other, ok := signalsB[sig.Name]
+		if !ok {
+			lines = append(lines, fmt.Sprintf("signal removed: %s", sig.Name))
+			continue
+		}
+		changes := diffSignal(sig, other, ignore)
+		receiversA := strings.Join(signalReceivers(sig, a.Node), ",")
+		receiversB := strings.Join(signalReceivers(other, b.Node), ",")
+		if receiversA != receiversB && !ignore["nodes"] {
+			changes = append(changes, fmt.Sprintf("receivers %s -> %s", receiversA, receiversB))
+		}
+		if len(changes) > 0 {
+			lines = append(lines, fmt.Sprintf("signal %s changed: %s", sig.Name, strings.Join(changes, ", ")))
+		}
+	}
+	for _, sig := range b.Signals {
+		if _, ok := signalsA[sig.Name]; !ok {
+			lines = append(lines, fmt.Sprintf("signal added: %s", sig.Name))
+		}
+	}
+	return lines
+}
+
+// diffSignal lists the fields that differ between two definitions of the same
+// signal, except for the kinds in ignore, which may be nil.
+func diffSignal(a, b *Signal, ignore map[string]bool) []string {
+	var changes []string
+	if a.StartBit != b.StartBit {
+		changes = append(changes, fmt.Sprintf("start bit %d -> %d", a.StartBit, b.StartBit))
+	}
+	if a.Length != b.Length {
+		changes = append(changes, fmt.Sprintf("length %d -> %d", a.Length, b.Length))
+	}
+	if a.ByteOrder != b.ByteOrder {
+		changes = append(changes, fmt.Sprintf("byte order %s -> %s", byteOrderName(a.ByteOrder), byteOrderName(b.ByteOrder)))
+	}
+	if a.IsSigned != b.IsSigned {
+		changes = append(changes, fmt.Sprintf("signed %t -> %t", a.IsSigned, b.IsSigned))
+	}
+	if a.ValueType != b.ValueType {
+		changes = append(changes, fmt.Sprintf("value type %d -> %d", a.ValueType, b.ValueType))
+	}
+	if muxMarker(a) != muxMarker(b) {
+		changes = append(changes, fmt.Sprintf("multiplexing %q -> %q", muxMarker(a), muxMarker(b)))
+	}
+	if a.Factor != b.Factor {
+		changes = append(changes, fmt.Sprintf("factor %g -> %g", a.Factor, b.Factor))
+	}
+	if a.Offset != b.Offset {
+		changes = append(changes, fmt.Sprintf("offset %g -> %g", a.Offset, b.Offset))
+	}
+	if a.Min != b.Min {
+		changes = append(changes, fmt.Sprintf("min %g -> %g", a.Min, b.Min))
+	}
+	if a.Max != b.Max {
+		changes = append(changes, fmt.Sprintf("max %g -> %g", a.Max, b.Max))
+	}
+	if a.Unit != b.Unit {
+		changes = append(changes, fmt.Sprintf("unit %q -> %q", a.Unit, b.Unit))
+	}
+	if a.Comment != b.Comment && !ignore["comments"] {
+		changes = append(changes, fmt.Sprintf("comment %q -> %q", a.Comment, b.Comment))
+	}
+	if !equalValueTables(a.ValueTable, b.ValueTable) && !ignore["value-tables"] {
+		changes = append(changes, fmt.Sprintf("value table %q -> %q", formatValueTable(a.ValueTable), formatValueTable(b.ValueTable)))
+	}
+	return changes
+}
+
+// frameName describes the identifier length of a message.
+func frameName(extended bool) string {
+	if extended {
+		return "extended"
+	}
+	return "standard"
+}
+
+// byteOrderName returns the Racelogic name of a signal byte order.
+func byteOrderName(order byte) string {
+	if order == 1 {
+		return "Intel"
+	}
+	return "Motorola"
+}
@@ -0,0 +1,109 @@
+package refdbc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DLCPolicies lists the accepted values of the -dlc-policy flag.
+var DLCPolicies = []string{"max", "first", "strict", "ask"}
+
+// IsValidDLCPolicy reports whether policy is one of DLCPolicies.
+func IsValidDLCPolicy(policy string) bool {
+	for _, p := range DLCPolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveDLC handles a signal whose DLC differs from the one already chosen for
+// its message. The mismatch is always reported; opts.DLCPolicy then decides
+// whether the larger DLC wins (max), the existing one is kept (first), parsing
+// stops (strict), or the user is asked (ask, which acts like strict unless
+// opts.Interactive is set). The DLCs declared so far are those of the signals
+// already in msg.
+func (p *signalParser) resolveDLC(msg *Message, dlc int, signalName string, pos position) error {
+	candidates := make(map[int][]string)
+	for _, sig := range msg.Signals {
+		candidates[sig.dlc] = append(candidates[sig.dlc], sig.Name)
+	}
+	candidates[dlc] = append(candidates[dlc], signalName)
+	description := describeDLCs(candidates)
+
+	p.opts.Log.warnAt(pos, "message %d has conflicting DLCs: %s.", msg.ID, description)
+
+	policy := p.opts.DLCPolicy
+	if policy == "ask" && !p.opts.Interactive {
+		policy = "strict"
+	}
+
+	switch policy {
+	case "first":
+		// Keep the DLC of the first signal.
+	case "strict":
+		return fmt.Errorf("%s: message %d has conflicting DLCs: %s", pos, msg.ID, description)
+	case "ask":
+		in, out := p.opts.prompter()
+		msg.DLC = askDLC(in, out, msg.ID, msg.DLC, dlc, description)
+	default:
+		if dlc > msg.DLC {
+			msg.DLC = dlc
+		}
+	}
+	return nil
+}
+
+// describeDLCs formats DLC values with the signals that declared them, e.g. "6 (A), 8 (B, C)".
+func describeDLCs(declared map[int][]string) string {
+	values := make([]int, 0, len(declared))
+	for value := range declared {
+		values = append(values, value)
+	}
+	sort.Ints(values)
+
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = fmt.Sprintf("%d (%s)", value, strings.Join(declared[value], ", "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// prompter returns where the questions of DLCPolicy ask are answered and
+// written: opts.PromptInput and opts.Prompt, or Stdin and stderr.
+func (opts Options) prompter() (*bufio.Reader, io.Writer) {
+	in, out := opts.PromptInput, opts.Prompt
+	if in == nil {
+		in = Stdin
+	}
+	if out == nil {
+		out = os.Stderr
+	}
+	return in, out
+}
+
+// askDLC asks the user at in and out to choose between the current and the new DLC.
+// Anything other than a valid choice repeats the question; end of input keeps the current DLC.
+func askDLC(in *bufio.Reader, out io.Writer, id uint32, current, proposed int, description string) int {
+	for {
+		fmt.Fprintf(out, "Message %d has conflicting DLCs: %s.\n", id, description)
+		fmt.Fprintf(out, "Use [1] DLC %d (current) or [2] DLC %d? ", current, proposed)
+		answer, err := in.ReadString('\n')
+		switch strings.TrimSpace(answer) {
+		case "1", strconv.Itoa(current):
+			return current
+		case "2", strconv.Itoa(proposed):
+			return proposed
+		}
+		if err != nil {
+			fmt.Fprintln(out)
+			return current
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package refdbc
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// conflictingDLCs declares message 256 with DLC 6, then with DLC 8.
+var conflictingDLCs = []string{
+	"Speed,256,km/h,0,16,0,0.01,655.35,0,unsigned,Intel,6",
+	"Heading,256,deg,16,16,0,0.01,360,0,unsigned,Intel,8",
+}
+
+func TestDLCPolicies(t *testing.T) {
+	tests := []struct {
+		policy      string
+		interactive bool
+		answers     string
+		want        int // DLC of the message; 0 when parsing fails
+	}{
+		{"max", false, "", 8},
+		{"first", false, "", 6},
+		{"strict", false, "", 0},
+		{"ask", true, "2\n", 8},
+		{"ask", true, "1\n", 6},
+		{"ask", true, "8\n", 8},
+		{"ask", true, "9\n2\n", 8},
+		{"ask", true, "", 6},
+		{"ask", false, "2\n", 0},
+	}
+	for _, tt := range tests {
+		var prompt bytes.Buffer
+		opts := DefaultOptions()
+		opts.DLCPolicy = tt.policy
+		opts.Interactive = tt.interactive
+		opts.Prompt = &prompt
+		opts.PromptInput = bufio.NewReader(strings.NewReader(tt.answers))
+
+		messages, err := parseSignalLines(conflictingDLCs, opts)
+		switch {
+		case tt.want == 0 && err == nil:
+			t.Errorf("%s (interactive %t): conflicting DLCs accepted", tt.policy, tt.interactive)
+		case tt.want != 0 && err != nil:
+			t.Errorf("%s (interactive %t, answers %q): %v", tt.policy, tt.interactive, tt.answers, err)
+		case tt.want != 0 && messages[256].DLC != tt.want:
+			t.Errorf("%s (interactive %t, answers %q): DLC %d, want %d", tt.policy, tt.interactive, tt.answers, messages[256].DLC, tt.want)
+		}
+
+		asked := strings.Count(prompt.String(), "Use [1] DLC 6 (current) or [2] DLC 8?")
+		wantAsked := 0
+		if tt.policy == "ask" && tt.interactive {
+			wantAsked = max(1, strings.Count(tt.answers, "\n"))
+		}
+		if asked != wantAsked {
+			t.Errorf("%s (interactive %t, answers %q): asked %d times, want %d", tt.policy, tt.interactive, tt.answers, asked, wantAsked)
+		}
+	}
+}
+
+// TestDLCPolicyBeforeLayoutCheck checks that a signal past the DLC of its own
+// line is kept when -dlc-policy settles on a DLC it fits in, and reported
+// when it does not.
+func TestDLCPolicyBeforeLayoutCheck(t *testing.T) {
+	lines := []string{
+		"Heading,256,deg,48,16,0,0.01,360,0,unsigned,Intel,4",
+		"Speed,256,km/h,0,16,0,0.01,655.35,0,unsigned,Intel,8",
+	}
+	for _, tt := range []struct {
+		policy string
+		fits   bool
+	}{
+		{"max", true},
+		{"first", false},
+	} {
+		opts := DefaultOptions()
+		opts.DLCPolicy = tt.policy
+		opts.Strict = true
+		messages, err := parseSignalLines(lines, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.policy, err)
+		}
+		if got := len(messages[256].Signals); got != 2 {
+			t.Errorf("%s: message has %d signals, want 2", tt.policy, got)
+		}
+		err = checkOverlaps(messages, opts)
+		if tt.fits && err != nil {
+			t.Errorf("%s: %v", tt.policy, err)
+		}
+		if !tt.fits && (err == nil || !strings.Contains(err.Error(), "signal Heading (bits 48|16@1+) in message 256 reaches bit 63, past the 32 bits of DLC 4")) {
+			t.Errorf("%s: err = %v, want Heading reported past DLC 4", tt.policy, err)
+		}
+	}
+}
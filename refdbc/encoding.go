@@ -0,0 +1,130 @@
+package refdbc
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// InputEncodings lists the accepted values of the -input-encoding flag.
+var InputEncodings = []string{"auto", "utf-8", "windows-1252", "latin-1"}
+
+// IsValidInputEncoding reports whether encoding is one of InputEncodings.
+func IsValidInputEncoding(encoding string) bool {
+	for _, e := range InputEncodings {
+		if e == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+// DBCEncodings lists the accepted values of the -dbc-encoding flag.
+var DBCEncodings = []string{"utf-8", "windows-1252"}
+
+// IsValidDBCEncoding reports whether encoding is one of DBCEncodings.
+func IsValidDBCEncoding(encoding string) bool {
+	for _, e := range DBCEncodings {
+		if e == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+// windows1252High maps the bytes 0x80 to 0x9F of Windows-1252 to the
+// characters they stand for. The five bytes the code page leaves undefined
+// map to the C1 control characters of the same value, as in Latin-1.
+var windows1252High = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\u008D', 'Ž', '\u008F',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\u009D', 'ž', 'Ÿ',
+}
+
+// decodeEntryText converts the text of an entry to UTF-8 according to
+// opts.InputEncoding. With auto (or an empty encoding), text that is valid
+// UTF-8 is kept and anything else is read as Windows-1252, the code page of
+// the Windows tools that write .ref files. Invalid UTF-8 in text declared as
+// UTF-8 is replaced with U+FFFD, with a warning.
+func decodeEntryText(data []byte, pos position, opts Options) []byte {
+	switch opts.InputEncoding {
+	case "latin-1":
+		return []byte(decodeSingleByte(data, false))
+	case "windows-1252":
+		return []byte(decodeSingleByte(data, true))
+	case "utf-8":
+		if !utf8.Valid(data) {
+			opts.Log.warnAt(pos, "text is not valid UTF-8; replacing the invalid bytes with U+FFFD (use -input-encoding windows-1252 or latin-1 if the file uses another encoding)")
+			return []byte(strings.ToValidUTF8(string(data), "�"))
+		}
+		return data
+	}
+	if utf8.Valid(data) {
+		return data
+	}
+	opts.Log.debugAt(pos, "text is not valid UTF-8; reading it as Windows-1252")
+	return []byte(decodeSingleByte(data, true))
+}
+
+// decodeSingleByte decodes Latin-1 text, or Windows-1252 text when cp1252 is
+// set. Both code pages map every byte to one character.
+func decodeSingleByte(data []byte, cp1252 bool) string {
+	var sb strings.Builder
+	sb.Grow(len(data))
+	for _, b := range data {
+		switch {
+		case b < 0x80:
+			sb.WriteByte(b)
+		case cp1252 && b < 0xA0:
+			sb.WriteRune(windows1252High[b-0x80])
+		default:
+			sb.WriteRune(rune(b))
+		}
+	}
+	return sb.String()
+}
+
+// encodeWindows1252 converts UTF-8 text to Windows-1252. Characters the code
+// page can't represent are written as '?' and returned, each once, in order
+// of first appearance.
+func encodeWindows1252(data []byte) ([]byte, []rune) {
+	out := make([]byte, 0, len(data))
+	var lost []rune
+	seen := make(map[rune]bool)
+	for _, r := range string(data) {
+		b, ok := windows1252Byte(r)
+		if !ok {
+			b = '?'
+			if !seen[r] {
+				seen[r] = true
+				lost = append(lost, r)
+			}
+		}
+		out = append(out, b)
+	}
+	return out, lost
+}
+
+// windows1252Byte returns the Windows-1252 byte of r, if it has one.
+func windows1252Byte(r rune) (byte, bool) {
+	switch {
+	case r < 0x80:
+		return byte(r), true
+	case r >= 0xA0 && r <= 0xFF:
+		return byte(r), true
+	}
+	for i, c := range windows1252High {
+		if c == r {
+			return byte(0x80 + i), true
+		}
+	}
+	return 0, false
+}
+
+// describeRunes lists characters for a warning, e.g. "'Ω' (U+03A9), '→' (U+2192)".
+func describeRunes(runes []rune) string {
+	parts := make([]string, len(runes))
+	for i, r := range runes {
+		parts[i] = fmt.Sprintf("'%c' (%U)", r, r)
+	}
+	return strings.Join(parts, ", ")
+}
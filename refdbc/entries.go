@@ -0,0 +1,172 @@
+package refdbc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"math"
+)
+
+// maxEntrySize is the size of the largest entry: a 16-bit length and that
+// many bytes of compressed data. The reader passed to entryDecoder.next must
+// be able to peek this many bytes.
+const maxEntrySize = 2 + math.MaxUint16
+
+// entryDecoder decompresses the length-prefixed zlib entries of a .ref file.
+// It reuses one flate reader and one output buffer for every entry, and
+// decompresses the bytes straight from the buffer of the file's reader, so
+// decoding an entry doesn't allocate once the output buffer has grown to the
+// largest entry.
+type entryDecoder struct {
+	in      bytes.Reader
+	fr      io.ReadCloser
+	out     bytes.Buffer
+	scratch [4]byte // zlib header and checksum
+}
+
+// corruptEntryError reports an entry that could not be decompressed. The
+// entries after it can still be read.
+type corruptEntryError struct {
+	err     error
+	skipped int // Bytes skipped, from the start of the entry, to reach the next entry that decompresses; 0 if the next entry followed it
+}
+
+func (e corruptEntryError) Error() string { return e.err.Error() }
+func (e corruptEntryError) Unwrap() error { return e.err }
+
+// next reads the next entry from r and returns its compressed length and its
+// decompressed data, which is only valid until the following call. last is
+// set for the last entry the file declares.
+//
+// A corrupt entry is reported as a corruptEntryError. When its length prefix
+// runs past the end of the file, or the data after it doesn't look like an
+// entry, the length is taken to be damaged and next skips ahead to the next
+// entry that decompresses, so the rest of the file isn't lost. Any other
+// error means the entry could not be read and no later entry was found.
+func (d *entryDecoder) next(r *bufio.Reader, last bool) (int, []byte, error) {
+	length, err := d.peek(r)
+	if err == nil {
+		r.Discard(2 + length)
+		return length, d.out.Bytes(), nil
+	}
+	var corrupt corruptEntryError
+	if errors.As(err, &corrupt) && (last || entryFollows(r, 2+length)) {
+		r.Discard(2 + length)
+		return length, nil, err
+	}
+	if skipped, ok := d.resync(r); ok {
+		return length, nil, corruptEntryError{err: err, skipped: skipped}
+	}
+	return length, nil, err
+}
+
+// peek decompresses the entry at the start of r into d.out without consuming
+// it, and returns its compressed length.
+func (d *entryDecoder) peek(r *bufio.Reader) (int, error) {
+	prefix, err := r.Peek(2)
+	if err != nil {
+		if err == io.EOF && len(prefix) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, fmt.Errorf("could not read zlib string length: %w", err)
+	}
+	length := int(binary.BigEndian.Uint16(prefix))
+	data, err := r.Peek(2 + length)
+	if err != nil {
+		if err == io.EOF && len(data) > 2 {
+			err = io.ErrUnexpectedEOF
+		}
+		return length, fmt.Errorf("could not read zlib string data (expected %d bytes): %w", length, err)
+	}
+	d.in.Reset(data[2:])
+	d.out.Reset()
+	if err := d.decompress(); err != nil {
+		return length, corruptEntryError{err: err}
+	}
+	return length, nil
+}
+
+// resync discards bytes from r, starting with the first byte of the entry
+// that failed, until r is at an entry that decompresses. It returns the number
+// of bytes discarded, and false if the data ended without such an entry.
+func (d *entryDecoder) resync(r *bufio.Reader) (int, bool) {
+	skipped := 0
+	for {
+		n, _ := r.Discard(1)
+		skipped += n
+		start, _ := r.Peek(4)
+		if len(start) < 4 {
+			n, _ = r.Discard(len(start))
+			return skipped + n, false
+		}
+		if isEntryStart(start) {
+			if _, err := d.peek(r); err == nil {
+				return skipped, true
+			}
+		}
+	}
+}
+
+// entryFollows reports whether the data n bytes into r looks like the start
+// of an entry, or like the end of the file with at most its checksum left.
+func entryFollows(r *bufio.Reader, n int) bool {
+	data, _ := r.Peek(n + 4)
+	if len(data) < n+4 {
+		return true
+	}
+	return isEntryStart(data[n:])
+}
+
+// isEntryStart reports whether data starts with a plausible length prefix
+// followed by a valid zlib header.
+func isEntryStart(data []byte) bool {
+	return isZlibBlockStart(data) && (uint16(data[2])<<8|uint16(data[3]))%31 == 0
+}
+
+// decompress inflates the current entry into d.out. It reads the zlib header
+// and checksum itself and only reuses a flate reader, because resetting a
+// zlib reader allocates a new checksum for every entry. Failures are
+// reported with the errors of compress/zlib.
+func (d *entryDecoder) decompress() error {
+	scratch := d.scratch[:]
+	if _, err := io.ReadFull(&d.in, scratch[:2]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	// The method is deflate, with a window of at most 32 KiB.
+	if scratch[0]&0x0f != 8 || scratch[0]>>4 > 7 || binary.BigEndian.Uint16(scratch[:2])%31 != 0 {
+		return zlib.ErrHeader
+	}
+	// No entry is compressed with a preset dictionary.
+	if scratch[1]&0x20 != 0 {
+		return zlib.ErrDictionary
+	}
+
+	if d.fr == nil {
+		d.fr = flate.NewReader(&d.in)
+	} else if err := d.fr.(flate.Resetter).Reset(&d.in, nil); err != nil {
+		return err
+	}
+	if _, err := d.out.ReadFrom(d.fr); err != nil {
+		return err
+	}
+
+	if _, err := io.ReadFull(&d.in, scratch); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if binary.BigEndian.Uint32(scratch) != adler32.Checksum(d.out.Bytes()) {
+		return zlib.ErrChecksum
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package refdbc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// TestEntryDecoderErrors checks that a damaged entry fails with the error
+// compress/zlib gives for the same data, and that the decoder reads the entry
+// after it.
+func TestEntryDecoderErrors(t *testing.T) {
+	var block bytes.Buffer
+	writeTestBlock(t, &block, []byte("Speed,256,km/h,0,16,0,0.01,655.35,0,unsigned,Intel,8\r\n"))
+	valid := block.Bytes()[2:]
+
+	damage := func(f func(data []byte) []byte) []byte {
+		return f(append([]byte(nil), valid...))
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"header", damage(func(d []byte) []byte { d[0] = 0x79; return d })},
+		{"dictionary", damage(func(d []byte) []byte { d[1] = 0xBB; return d })},
+		{"checksum", damage(func(d []byte) []byte { d[len(d)-1]++; return d })},
+		{"truncated checksum", damage(func(d []byte) []byte { return d[:len(d)-2] })},
+		{"truncated data", damage(func(d []byte) []byte { return d[:len(d)/2] })},
+		{"corrupt data", damage(func(d []byte) []byte { d[2] = 0xFF; return d })},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want error
+			if zr, err := zlib.NewReader(bytes.NewReader(tt.data)); err != nil {
+				want = err
+			} else {
+				_, want = io.ReadAll(zr)
+			}
+			if want == nil {
+				t.Fatal("compress/zlib accepts the damaged entry")
+			}
+
+			var file bytes.Buffer
+			for _, data := range [][]byte{tt.data, valid} {
+				binary.Write(&file, binary.BigEndian, uint16(len(data)))
+				file.Write(data)
+			}
+			r := bufio.NewReader(&file)
+			var decoder entryDecoder
+			if _, _, err := decoder.next(r, false); err == nil || err.Error() != want.Error() {
+				t.Errorf("err = %v, want %v", err, want)
+			}
+			if _, data, err := decoder.next(r, true); err != nil || !bytes.HasPrefix(data, []byte("Speed,")) {
+				t.Errorf("entry after the damaged one: %q, %v", data, err)
+			}
+		})
+	}
+}
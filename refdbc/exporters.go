@@ -0,0 +1,124 @@
+package refdbc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Exporter writes a Database in one output format.
+type Exporter interface {
+	Export(db *Database, w io.Writer) error
+}
+
+// ExporterFunc adapts a function to the Exporter interface.
+type ExporterFunc func(db *Database, w io.Writer) error
+
+// Export calls f(db, w).
+func (f ExporterFunc) Export(db *Database, w io.Writer) error {
+	return f(db, w)
+}
+
+// ExporterFactory creates the Exporter of a format for the settings of one conversion.
+type ExporterFactory func(opts Options) Exporter
+
+// exporters holds the registered formats, keyed by format name.
+var exporters = map[string]ExporterFactory{}
+
+// FormatExtensions maps each registered output format to its default file extension.
+var FormatExtensions = map[string]string{}
+
+// RegisterExporter makes an output format available as Options.Format and the
+// -format flag, writing files with the extension ext (including the dot).
+// Registering a format again replaces it. Like the registries of the standard
+// library, it is meant to be called from init functions and is not safe for
+// concurrent use.
+func RegisterExporter(format, ext string, factory ExporterFactory) {
+	exporters[format] = factory
+	FormatExtensions[format] = ext
+}
+
+// Formats returns the names of the registered output formats in sorted order.
+func Formats() []string {
+	formats := make([]string, 0, len(exporters))
+	for format := range exporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// NewExporter returns the Exporter of opts.Format, or an error if no such
+// format is registered.
+func NewExporter(opts Options) (Exporter, error) {
+	factory, ok := exporters[opts.Format]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format '%s'", opts.Format)
+	}
+	return factory(opts), nil
+}
+
+func init() {
+	RegisterExporter("dbc", ".dbc", func(opts Options) Exporter { return dbcExporter{opts} })
+	RegisterExporter("csv", ".csv", builtinExporter("CSV", writeCSV))
+	RegisterExporter("json", ".json", databaseExporter("JSON", writeJSON))
+	RegisterExporter("kcd", ".kcd", builtinExporter("KCD", writeKCD))
+	RegisterExporter("sym", ".sym", builtinExporter("SYM", writeSYM))
+	RegisterExporter("arxml", ".arxml", builtinExporter("ARXML", writeARXML))
+	RegisterExporter("c", ".h", builtinExporter("C", writeCSource))
+	RegisterExporter("go", ".go", builtinExporter("Go", writeGoSource))
+	RegisterExporter("cantools-json", ".json", builtinExporter("cantools JSON", writeCantoolsJSON))
+}
+
+// builtinExporter returns the factory of a format written by one of the
+// package's write functions. name is used in error messages.
+func builtinExporter(name string, write func(map[uint32]*Message, io.Writer, Options) error) ExporterFactory {
+	return databaseExporter(name, func(db *Database, w io.Writer, opts Options) error {
+		return write(db.Messages, w, opts)
+	})
+}
+
+// databaseExporter is like builtinExporter, for write functions that use more
+// of the Database than its messages.
+func databaseExporter(name string, write func(*Database, io.Writer, Options) error) ExporterFactory {
+	return func(opts Options) Exporter {
+		return ExporterFunc(func(db *Database, w io.Writer) error {
+			if err := write(db, w, opts); err != nil {
+				return fmt.Errorf("failed to write %s file: %w", name, err)
+			}
+			return nil
+		})
+	}
+}
+
+// dbcExporter writes DBC files. With opts.Verify, the output is read back and
+// checked before any of it is written.
+type dbcExporter struct {
+	opts Options
+}
+
+func (e dbcExporter) Export(db *Database, w io.Writer) error {
+	var written bytes.Buffer
+	out := bufio.NewWriter(w)
+	if e.opts.Verify {
+		out = bufio.NewWriter(&written)
+	}
+	if err := writeDBC(db, out, e.opts); err != nil {
+		return fmt.Errorf("failed to write DBC file: %w", err)
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("failed to write DBC file: %w", err)
+	}
+	if !e.opts.Verify {
+		return nil
+	}
+	if err := verifyDBC(db.Messages, written.Bytes()); err != nil {
+		return err
+	}
+	if _, err := w.Write(written.Bytes()); err != nil {
+		return fmt.Errorf("failed to write DBC file: %w", err)
+	}
+	return nil
+}
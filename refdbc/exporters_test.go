@@ -0,0 +1,161 @@
+package refdbc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// muxTestMessages returns a message multiplexed on Channel, with a plain
+// signal in every frame and two signals sharing bits on different values.
+func muxTestMessages() map[uint32]*Message {
+	return map[uint32]*Message{0x600: {
+		ID:   0x600,
+		Name: "Sensors",
+		DLC:  8,
+		Node: DefaultNodeName,
+		Signals: []*Signal{
+			{Name: "Channel", StartBit: 0, Length: 8, ByteOrder: 1, Factor: 1, MuxRole: muxMultiplexor},
+			{Name: "Counter", StartBit: 56, Length: 8, ByteOrder: 1, Factor: 1},
+			{Name: "Temp", StartBit: 8, Length: 16, ByteOrder: 1, IsSigned: true, Factor: 0.1, MuxRole: muxMultiplexed, MuxValue: 0},
+			{Name: "Pressure", StartBit: 8, Length: 16, ByteOrder: 1, Factor: 0.01, MuxRole: muxMultiplexed, MuxValue: 1},
+		},
+	}}
+}
+
+// noMultiplexorMessages returns a message with a multiplexed signal but no
+// multiplexor, which the formats with a selector field can't describe.
+func noMultiplexorMessages() map[uint32]*Message {
+	return map[uint32]*Message{0x600: {
+		ID:      0x600,
+		Name:    "Sensors",
+		DLC:     8,
+		Signals: []*Signal{{Name: "Temp", StartBit: 8, Length: 16, ByteOrder: 1, Factor: 1, MuxRole: muxMultiplexed}},
+	}}
+}
+
+func TestWriteSYMMultiplexing(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeSYM(muxTestMessages(), &out, DefaultOptions()); err != nil {
+		t.Fatal(err)
+	}
+	want := "\n[Sensors]\nID=600h\nLen=8\nMux=Channel 0,8 0\nVar=Counter unsigned 56,8\nVar=Temp signed 8,16 /f:0.1\n" +
+		"\n[Sensors]\nID=600h\nLen=8\nMux=Channel 0,8 1\nVar=Counter unsigned 56,8\nVar=Pressure unsigned 8,16 /f:0.01\n"
+	if got := out.String(); !strings.HasSuffix(got, want) {
+		t.Errorf("SYM output ends with\n%s\nwant\n%s", got[strings.Index(got, "\n[Sensors]"):], want)
+	}
+
+	if err := writeSYM(noMultiplexorMessages(), &out, DefaultOptions()); err == nil {
+		t.Error("no error for a multiplexed signal without a multiplexor")
+	}
+}
+
+func TestWriteKCDMultiplexing(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeKCD(muxTestMessages(), &out, DefaultOptions()); err != nil {
+		t.Fatal(err)
+	}
+	var network kcdNetwork
+	if err := xml.Unmarshal(out.Bytes(), &network); err != nil {
+		t.Fatal(err)
+	}
+	msg := network.Bus.Messages[0]
+	if len(msg.Signals) != 1 || msg.Signals[0].Name != "Counter" {
+		t.Errorf("signals outside the multiplex = %+v, want only Counter", msg.Signals)
+	}
+	if msg.Multiplex == nil || msg.Multiplex.Name != "Channel" {
+		t.Fatalf("multiplex = %+v, want Channel", msg.Multiplex)
+	}
+	var groups []string
+	for _, group := range msg.Multiplex.Groups {
+		for _, sig := range group.Signals {
+			groups = append(groups, fmt.Sprintf("%s@%d", sig.Name, group.Count))
+		}
+	}
+	if got, want := strings.Join(groups, " "), "Temp@0 Pressure@1"; got != want {
+		t.Errorf("mux groups %s, want %s", got, want)
+	}
+
+	if err := writeKCD(noMultiplexorMessages(), &out, DefaultOptions()); err == nil {
+		t.Error("no error for a multiplexed signal without a multiplexor")
+	}
+}
+
+func TestWriteARXMLMultiplexing(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeARXML(muxTestMessages(), &out, DefaultOptions()); err != nil {
+		t.Fatal(err)
+	}
+	var doc arxmlDocument
+	if err := xml.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	var pdus arxmlElements
+	for _, pkg := range doc.Packages {
+		if pkg.ShortName == "PDUs" {
+			pdus = pkg.Elements
+		}
+	}
+	if len(pdus.MuxPDUs) != 1 {
+		t.Fatalf("%d multiplexed PDUs, want 1", len(pdus.MuxPDUs))
+	}
+	mux := pdus.MuxPDUs[0]
+	if mux.SelectorStart != 0 || mux.SelectorLength != 8 {
+		t.Errorf("selector field at %d, %d bits; want 0, 8", mux.SelectorStart, mux.SelectorLength)
+	}
+	if mux.StaticPart.Path != "/PDUs/Sensors_Static" {
+		t.Errorf("static part %s, want /PDUs/Sensors_Static", mux.StaticPart.Path)
+	}
+	signals := make(map[string]string) // PDU path by mapped signal
+	for _, pdu := range pdus.PDUs {
+		for _, mapping := range pdu.Mappings {
+			signals[mapping.ShortName] = "/PDUs/" + pdu.ShortName
+		}
+	}
+	if signals["Counter"] != mux.StaticPart.Path {
+		t.Errorf("Counter is in %s, want the static part", signals["Counter"])
+	}
+	if _, ok := signals["Channel"]; ok {
+		t.Error("the multiplexor is mapped as a signal as well as the selector field")
+	}
+	for i, want := range []struct {
+		signal string
+		code   int
+	}{{"Temp", 0}, {"Pressure", 1}} {
+		if i >= len(mux.Alternatives) {
+			t.Fatalf("%d dynamic part alternatives, want 2", len(mux.Alternatives))
+		}
+		alt := mux.Alternatives[i]
+		if alt.Code != want.code || signals[want.signal] != alt.PDURef.Path {
+			t.Errorf("alternative %d has code %d and PDU %s; want code %d and the PDU of %s (%s)",
+				i, alt.Code, alt.PDURef.Path, want.code, want.signal, signals[want.signal])
+		}
+	}
+
+	if err := writeARXML(noMultiplexorMessages(), &out, DefaultOptions()); err == nil {
+		t.Error("no error for a multiplexed signal without a multiplexor")
+	}
+}
+
+func TestWriteGoSourceFieldComments(t *testing.T) {
+	messages := map[uint32]*Message{
+		0x100: {ID: 0x100, Name: "Engine", DLC: 8, Signals: []*Signal{
+			{Name: "T", StartBit: 0, Length: 8, ByteOrder: 1, Factor: 1},
+			{Name: "Coolant temp", StartBit: 8, Length: 8, ByteOrder: 1, Factor: 0.5, Offset: -40, Unit: "degC", Comment: "At the radiator."},
+		}},
+	}
+	var out bytes.Buffer
+	if err := writeGoSource(messages, &out, DefaultOptions()); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"// T is signal T, decoded as raw * 1 + 0.\n",
+		"// CoolantTemp is signal Coolant temp in degC, decoded as raw * 0.5 + -40. At the radiator.\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("no field comment %q in:\n%s", want, out.String())
+		}
+	}
+}
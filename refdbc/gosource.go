@@ -0,0 +1,337 @@
+package refdbc
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// goCANPackage is the import path of the can.Frame type the generated
+// decoders accept.
+const goCANPackage = "go.einride.tech/can"
+
+// goMaxFrameLength is the payload size of can.Frame. Messages with a larger
+// DLC (CAN FD) can only be decoded from their payload.
+const goMaxFrameLength = 8
+
+// goReservedFields are the method names of generated message types, which
+// their fields can't share.
+var goReservedFields = map[string]bool{"FrameID": true, "Unmarshal": true, "UnmarshalPayload": true}
+
+// pascalCase turns a name such as CAN_MSG_256 or vehicle speed into the
+// exported Go identifier CANMSG256 or VehicleSpeed: every run of letters and
+// digits starts with an upper-case letter, and everything else is dropped.
+// A name starting with a digit gets an X in front.
+func pascalCase(name string) string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range name {
+		if !(r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))) {
+			upper = true
+			continue
+		}
+		if sb.Len() == 0 && unicode.IsDigit(r) {
+			sb.WriteByte('X')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	if sb.Len() == 0 {
+		return "X"
+	}
+	return sb.String()
+}
+
+// goPackageName returns the name of the package generated for the file
+// named source, such as basic for basic.ref.
+func goPackageName(source string) string {
+	name := strings.ToLower(pascalCase(strings.TrimSuffix(source, filepath.Ext(source))))
+	if name == "x" || token.IsKeyword(name) {
+		name = "can" + name
+	}
+	return name
+}
+
+// goLiteral writes f as a Go float literal.
+func goLiteral(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// goComment writes text on one line for a // comment.
+func goComment(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// goSignal holds the names generated for a signal.
+type goSignal struct {
+	*Signal
+	field string
+}
+
+// goMessage holds the names generated for a message and its signals.
+type goMessage struct {
+	*Message
+	typeName    string
+	signals     []goSignal
+	multiplexor *goSignal
+}
+
+// newGoMessage works out the Go names of msg and its signals. Names that
+// collide once converted get a _2, _3... suffix.
+func newGoMessage(msg *Message, typeName string) goMessage {
+	m := goMessage{Message: msg, typeName: typeName}
+	taken := make(map[string]bool)
+	for name := range goReservedFields {
+		taken[name] = true
+	}
+	for _, sig := range msg.Signals {
+		field := pascalCase(sig.Name)
+		if taken[field] {
+			field = uniqueName(field, taken)
+		}
+		taken[field] = true
+		m.signals = append(m.signals, goSignal{Signal: sig, field: field})
+	}
+	for i := range m.signals {
+		if m.signals[i].MuxRole == muxMultiplexor && m.multiplexor == nil {
+			m.multiplexor = &m.signals[i]
+		}
+	}
+	return m
+}
+
+// writeGoSource writes the messages as a Go package for decoding them: a
+// struct per message with a float64 field per signal holding its physical
+// value, an UnmarshalPayload method decoding the payload bytes, and for
+// classic CAN messages an Unmarshal method decoding a can.Frame of
+// go.einride.tech/can, which checks the frame's ID first. A Decode function
+// picks the message type of a frame by its ID.
+//
+// Multiplexed signals are only decoded when the multiplexor has their value,
+// and are zero otherwise. The doc comment of each field names its signal,
+// unit and scaling. The output is formatted with gofmt.
+func writeGoSource(messages map[uint32]*Message, w io.Writer, opts Options) error {
+	pkg := goPackageName(opts.Source)
+	source := opts.Source
+	if source == "" {
+		source = "a .ref file"
+	}
+
+	var list []goMessage
+	usesMath := false
+	taken := map[string]bool{"Decode": true}
+	for _, id := range sortedMessageIDs(messages) {
+		typeName := pascalCase(messages[id].Name)
+		if taken[typeName] {
+			typeName = uniqueName(typeName, taken)
+		}
+		taken[typeName] = true
+		m := newGoMessage(messages[id], typeName)
+		for _, s := range m.signals {
+			if s.ValueType != 0 {
+				usesMath = true
+			}
+		}
+		list = append(list, m)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by racelogic-ref-to-dbc %s from %s. DO NOT EDIT.\n\n", Version, goComment(source))
+	fmt.Fprintf(&buf, "// Package %s decodes the CAN messages described by %s.\n", pkg, goComment(source))
+	fmt.Fprintf(&buf, "package %s\n\nimport (\n\t\"fmt\"\n", pkg)
+	if usesMath {
+		fmt.Fprintf(&buf, "\t\"math\"\n")
+	}
+	fmt.Fprintf(&buf, "\n\t%q\n)\n", goCANPackage)
+
+	writeGoDecode(&buf, list)
+	for _, m := range list {
+		writeGoMessage(&buf, m)
+	}
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("generated code does not compile: %w", err)
+	}
+	_, err = w.Write(formatted)
+	return err
+}
+
+// goFrameCheck returns the condition a can.Frame named frame meets when it
+// carries m.
+func goFrameCheck(m goMessage, frame string) string {
+	extended := "!" + frame + ".IsExtended"
+	if m.IsExtended {
+		extended = frame + ".IsExtended"
+	}
+	return fmt.Sprintf("%s.ID == 0x%X && %s", frame, m.ID, extended)
+}
+
+// writeGoDecode writes the Decode function, which unmarshals a frame into
+// the message type with its ID.
+func writeGoDecode(w io.Writer, list []goMessage) {
+	fmt.Fprintf(w, "\n// Decode unmarshals frame into the message with its ID and returns a\n")
+	fmt.Fprintf(w, "// pointer to it, such as a *%s. Frames of unknown messages are an error.\n", goExampleType(list))
+	fmt.Fprintf(w, "func Decode(frame can.Frame) (interface{}, error) {\n\tswitch {\n")
+	for _, m := range list {
+		if m.DLC > goMaxFrameLength {
+			continue
+		}
+		fmt.Fprintf(w, "\tcase %s:\n\t\tvar m %s\n\t\treturn &m, m.Unmarshal(frame)\n", goFrameCheck(m, "frame"), m.typeName)
+	}
+	fmt.Fprintf(w, "\t}\n\treturn nil, fmt.Errorf(\"unknown frame ID 0x%%X\", frame.ID)\n}\n")
+}
+
+// goExampleType names a message type for the doc comment of Decode.
+func goExampleType(list []goMessage) string {
+	for _, m := range list {
+		if m.DLC <= goMaxFrameLength {
+			return m.typeName
+		}
+	}
+	return "Message"
+}
+
+// writeGoMessage writes the struct and methods of m.
+func writeGoMessage(w io.Writer, m goMessage) {
+	fmt.Fprintf(w, "\n// %s is message %s (ID 0x%X", m.typeName, goComment(m.Name), m.ID)
+	if m.IsExtended {
+		fmt.Fprintf(w, ", extended")
+	}
+	fmt.Fprintf(w, ", %d bytes", m.DLC)
+	if m.CycleTime > 0 {
+		fmt.Fprintf(w, ", sent every %d ms", m.CycleTime)
+	}
+	fmt.Fprintf(w, ").")
+	if m.Comment != "" {
+		fmt.Fprintf(w, "\n//\n// %s", goComment(m.Comment))
+	}
+	fmt.Fprintf(w, "\ntype %s struct {\n", m.typeName)
+	for _, s := range m.signals {
+		fmt.Fprintf(w, "\t// %s is signal %s", s.field, goComment(s.Name))
+		if s.Unit != "" {
+			fmt.Fprintf(w, " in %s", goComment(s.Unit))
+		}
+		fmt.Fprintf(w, ", decoded as raw * %s + %s.", goLiteral(s.Factor), goLiteral(s.Offset))
+		if s.Comment != "" {
+			fmt.Fprintf(w, " %s.", strings.TrimSuffix(goComment(s.Comment), "."))
+		}
+		if s.MuxRole == muxMultiplexed {
+			fmt.Fprintf(w, " Only present when the multiplexor is %d.", s.MuxValue)
+		}
+		if len(s.ValueTable) > 0 {
+			labels := make([]string, len(s.ValueTable))
+			for i, vd := range s.ValueTable {
+				labels[i] = fmt.Sprintf("%d %s", vd.Value, vd.Label)
+			}
+			fmt.Fprintf(w, "\n\t// Raw values: %s.", goComment(strings.Join(labels, ", ")))
+		}
+		fmt.Fprintf(w, "\n\t%s float64\n", s.field)
+	}
+	fmt.Fprintf(w, "}\n")
+
+	fmt.Fprintf(w, "\n// FrameID returns the CAN ID of %s.\n", m.typeName)
+	fmt.Fprintf(w, "func (*%s) FrameID() uint32 {\n\treturn 0x%X\n}\n", m.typeName, m.ID)
+
+	if m.DLC <= goMaxFrameLength {
+		fmt.Fprintf(w, "\n// Unmarshal decodes frame into m, after checking it carries %s.\n", m.typeName)
+		fmt.Fprintf(w, "func (m *%s) Unmarshal(frame can.Frame) error {\n", m.typeName)
+		fmt.Fprintf(w, "\tif !(%s) {\n", goFrameCheck(m, "frame"))
+		fmt.Fprintf(w, "\t\treturn fmt.Errorf(%s, frame.ID)\n\t}\n", strconv.Quote("frame ID 0x%X is not message "+m.Name))
+		fmt.Fprintf(w, "\tif int(frame.Length) > len(frame.Data) {\n")
+		fmt.Fprintf(w, "\t\treturn fmt.Errorf(\"frame length %%d is over %%d bytes\", frame.Length, len(frame.Data))\n\t}\n")
+		fmt.Fprintf(w, "\treturn m.UnmarshalPayload(frame.Data[:frame.Length])\n}\n")
+	}
+
+	fmt.Fprintf(w, "\n// UnmarshalPayload decodes the payload bytes of a %s frame into m.\n", m.typeName)
+	fmt.Fprintf(w, "func (m *%s) UnmarshalPayload(data []byte) error {\n", m.typeName)
+	fmt.Fprintf(w, "\tif len(data) < %d {\n", m.DLC)
+	fmt.Fprintf(w, "\t\treturn fmt.Errorf(%s, len(data))\n\t}\n", strconv.Quote(fmt.Sprintf("message %s needs %d bytes, got %%d", m.Name, m.DLC)))
+	fmt.Fprintf(w, "\t*m = %s{}\n", m.typeName)
+
+	// The multiplexor is decoded first, as the other signals depend on it.
+	signals := m.signals
+	if m.multiplexor != nil {
+		fmt.Fprintf(w, "\tmux := %s\n", goRawValue(m.multiplexor.Signal, m.DLC))
+		fmt.Fprintf(w, "\tm.%s = %s\n", m.multiplexor.field, goPhysicalValue(m.multiplexor.Signal, "mux"))
+		signals = nil
+		for _, s := range m.signals {
+			if s.Signal != m.multiplexor.Signal {
+				signals = append(signals, s)
+			}
+		}
+	}
+	for _, s := range signals {
+		if s.MuxRole == muxMultiplexed && m.multiplexor != nil {
+			fmt.Fprintf(w, "\tif mux == %d {\n", s.MuxValue)
+			fmt.Fprintf(w, "\t\tm.%s = %s\n\t}\n", s.field, goPhysicalValue(s.Signal, goRawValue(s.Signal, m.DLC)))
+			continue
+		}
+		fmt.Fprintf(w, "\tm.%s = %s\n", s.field, goPhysicalValue(s.Signal, goRawValue(s.Signal, m.DLC)))
+	}
+	fmt.Fprintf(w, "\treturn nil\n}\n")
+}
+
+// goRawValue returns an expression reading the raw value of sig, as a
+// uint64, from the byte slice data of a message with dlc bytes.
+func goRawValue(sig *Signal, dlc int) string {
+	var terms []string
+	for _, seg := range signalSegments(sig) {
+		if seg.byte >= dlc {
+			continue
+		}
+		term := fmt.Sprintf("uint64(data[%d])", seg.byte)
+		if seg.mask != 0xFF {
+			term = fmt.Sprintf("uint64(data[%d]&0x%02X)", seg.byte, seg.mask)
+		}
+		switch {
+		case seg.shift > 0:
+			term += fmt.Sprintf(">>%d", seg.shift)
+		case seg.shift < 0:
+			term += fmt.Sprintf("<<%d", -seg.shift)
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 0 {
+		return "uint64(0)"
+	}
+	return strings.Join(terms, " | ")
+}
+
+// goPhysicalValue returns an expression converting the raw value of sig,
+// read by the expression raw, to its physical value.
+func goPhysicalValue(sig *Signal, raw string) string {
+	var value string
+	switch {
+	case sig.ValueType == 1:
+		value = fmt.Sprintf("float64(math.Float32frombits(uint32(%s)))", raw)
+	case sig.ValueType == 2:
+		value = fmt.Sprintf("math.Float64frombits(%s)", raw)
+	case sig.IsSigned && sig.Length < 64:
+		// Shifting the sign bit to the top and back extends it.
+		value = fmt.Sprintf("float64(int64((%s)<<%d)>>%d)", raw, 64-sig.Length, 64-sig.Length)
+	case sig.IsSigned:
+		value = fmt.Sprintf("float64(int64(%s))", raw)
+	default:
+		value = fmt.Sprintf("float64(%s)", raw)
+	}
+	if sig.Factor != 1 {
+		value += "*" + goLiteral(sig.Factor)
+	}
+	switch {
+	case sig.Offset > 0:
+		value += " + " + goLiteral(sig.Offset)
+	case sig.Offset < 0:
+		value += " - " + goLiteral(-sig.Offset)
+	}
+	return value
+}
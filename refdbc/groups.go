@@ -0,0 +1,63 @@
+package refdbc
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// signalGroup is a named set of signals within one message.
+type signalGroup struct {
+	Name    string
+	Signals []string
+}
+
+// signalGroupName returns the group a signal belongs to: the group column when
+// present, otherwise (with opts.GroupByPrefix) the part of the name before the
+// first underscore. The result is sanitized into a DBC identifier.
+func signalGroupName(column, signalName string, opts Options) string {
+	group := strings.TrimSpace(column)
+	if group == "" && opts.GroupByPrefix {
+		if prefix, _, found := strings.Cut(signalName, "_"); found {
+			group = prefix
+		}
+	}
+	return sanitizeIdentifier(group)
+}
+
+// messageGroups collects the signal groups of a message in order of first
+// appearance, dropping groups with fewer than minSize members.
+func messageGroups(msg *Message, minSize int) []*signalGroup {
+	var groups []*signalGroup
+	byName := make(map[string]*signalGroup)
+	for _, sig := range msg.Signals {
+		if sig.Group == "" {
+			continue
+		}
+		group, ok := byName[sig.Group]
+		if !ok {
+			group = &signalGroup{Name: sig.Group}
+			byName[sig.Group] = group
+			groups = append(groups, group)
+		}
+		group.Signals = append(group.Signals, sig.Name)
+	}
+
+	kept := groups[:0]
+	for _, group := range groups {
+		if len(group.Signals) >= minSize {
+			kept = append(kept, group)
+		}
+	}
+	return kept
+}
+
+// writeSignalGroups writes a SIG_GROUP_ line for every group of every message,
+// taking the messages in the order of ids.
+func writeSignalGroups(messages map[uint32]*Message, ids []uint32, w *bufio.Writer, minSize int) {
+	for _, id := range ids {
+		for _, group := range messageGroups(messages[id], minSize) {
+			fmt.Fprintf(w, "SIG_GROUP_ %d %s 1 : %s;\n", messages[id].dbcID(), group.Name, strings.Join(group.Signals, " "))
+		}
+	}
+}
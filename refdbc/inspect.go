@@ -0,0 +1,102 @@
+package refdbc
+
+import (
+	"fmt"
+	"io"
+)
+
+// Inspection summarizes a parsed .ref file without converting it.
+type Inspection struct {
+	Source        string
+	Serial        string // Serial string of the file header, empty if it has none
+	FormatVersion string // Format version of the file, one of RefVersions
+	Entries       int    // Entries declared by the file header
+	Metadata      RefMetadata
+	Messages      map[uint32]*Message
+	Stats         FileStats
+	Warnings      []string // Warnings logged while parsing, with their position
+}
+
+// Inspect parses the .ref file at path with the settings of opts and returns
+// a summary of its contents. Nothing is written; warnings are still logged
+// through opts.Log.
+func Inspect(path string, opts Options) (*Inspection, error) {
+	opts.Source = sourceName(path)
+	messages, stats, err := readRefFile(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	stats.countWritten(messages)
+	stats.Warnings = opts.Log.warnings
+
+	inspection := &Inspection{
+		Source:        opts.Source,
+		Serial:        stats.metadata.Serial,
+		Metadata:      stats.metadata,
+		FormatVersion: stats.version,
+		Entries:       stats.entries,
+		Messages:      messages,
+		Stats:         stats,
+	}
+	for _, event := range opts.Log.fileWarnings {
+		message := event.Message
+		if pos := (position{Entry: event.Entry, Line: event.Line}); pos != (position{}) {
+			message = pos.String() + ": " + message
+		}
+		inspection.Warnings = append(inspection.Warnings, message)
+	}
+	return inspection, nil
+}
+
+// Write prints the summary to w: the header fields, one line per message with
+// its signal count and the payload bits its signals use, then the warnings.
+func (in *Inspection) Write(w io.Writer) error {
+	serial := in.Serial
+	if serial == "" {
+		serial = "(none)"
+	}
+	fmt.Fprintf(w, "File:     %s\n", in.Source)
+	fmt.Fprintf(w, "Format:   %s\n", in.FormatVersion)
+	fmt.Fprintf(w, "Serial:   %s\n", serial)
+	if summary := in.Metadata.summary(); summary != "" {
+		fmt.Fprintf(w, "Logger:   %s\n", summary)
+	}
+	fmt.Fprintf(w, "Entries:  %d\n", in.Entries)
+	fmt.Fprintf(w, "Messages: %d (%d signals, %d skipped lines, %d duplicates)\n",
+		in.Stats.Messages, in.Stats.Signals, in.Stats.SkippedLines, in.Stats.Duplicates)
+
+	for _, id := range sortedMessageIDs(in.Messages) {
+		msg := in.Messages[id]
+		used, total := messageBitUsage(msg)
+		percent := 0
+		if total > 0 {
+			percent = used * 100 / total
+		}
+		fmt.Fprintf(w, "  0x%03X %-24s DLC %-2d %3d signals %4d/%d bits used (%d%%)\n",
+			msg.ID, msg.Name, msg.DLC, len(msg.Signals), used, total, percent)
+	}
+
+	fmt.Fprintf(w, "Warnings: %d\n", len(in.Warnings))
+	for _, warning := range in.Warnings {
+		fmt.Fprintf(w, "  %s\n", warning)
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// messageBitUsage returns the number of payload bits used by at least one
+// signal of msg, and the number of bits in its payload. Bits shared by
+// overlapping signals are counted once, and bits past the DLC are not counted.
+func messageBitUsage(msg *Message) (used, total int) {
+	total = msg.DLC * 8
+	seen := make(map[int]bool)
+	for _, sig := range msg.Signals {
+		for _, bit := range signalBits(sig.StartBit, sig.Length, sig.ByteOrder) {
+			if bit >= 0 && bit < total && !seen[bit] {
+				seen[bit] = true
+				used++
+			}
+		}
+	}
+	return used, total
+}
@@ -0,0 +1,128 @@
+package refdbc
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonDatabase is the document written by writeJSON.
+type jsonDatabase struct {
+	Source   string        `json:"source,omitempty"`
+	Metadata *RefMetadata  `json:"metadata,omitempty"`
+	Messages []jsonMessage `json:"messages"`
+	Warnings []logEvent    `json:"warnings"`
+}
+
+type jsonMessage struct {
+	ID       uint32       `json:"id"`
+	Name     string       `json:"name"`
+	Extended bool         `json:"extended"`
+	DLC      int          `json:"dlc"`
+	Node     string       `json:"node"`
+	Comment  string       `json:"comment,omitempty"`
+	Cycle    int          `json:"cycle_time,omitempty"` // Milliseconds
+	Signals  []jsonSignal `json:"signals"`
+}
+
+type jsonSignal struct {
+	Name      string      `json:"name"`
+	StartBit  int         `json:"start_bit"`
+	Length    int         `json:"length"`
+	ByteOrder string      `json:"byte_order"` // Intel or Motorola
+	Signed    bool        `json:"signed"`
+	ValueType string      `json:"value_type"`          // integer, float or double
+	Multiplex string      `json:"multiplex,omitempty"` // M for the multiplexor, m<value> for a multiplexed signal
+	Factor    float64     `json:"factor"`
+	Offset    float64     `json:"offset"`
+	Min       float64     `json:"min"`
+	Max       float64     `json:"max"`
+	Unit      string      `json:"unit"`
+	Receivers []string    `json:"receivers"`
+	Comment   string      `json:"comment,omitempty"`
+	Group     string      `json:"group,omitempty"`
+	Part      string      `json:"part,omitempty"`
+	Values    []jsonValue `json:"values,omitempty"`
+	Entry     int         `json:"entry,omitempty"` // Entry of the .ref file the signal was read from
+	Line      int         `json:"line,omitempty"`  // Line within that entry
+}
+
+type jsonValue struct {
+	Value int64  `json:"value"`
+	Label string `json:"label"`
+}
+
+// valueTypeNames names the SIG_VALTYPE_ values in JSON output.
+var valueTypeNames = [...]string{"integer", "float", "double"}
+
+// writeJSON writes the messages as an indented JSON document, ordered by
+// message ID with signals in source order. Each signal carries the entry and
+// line it was read from, and the warnings logged for the file are included so
+// tools can tell how complete the data is. With opts.Metadata the logger
+// metadata of a .ref file is included too.
+func writeJSON(db *Database, w io.Writer, opts Options) error {
+	messages := db.Messages
+	doc := jsonDatabase{
+		Source:   opts.Source,
+		Messages: make([]jsonMessage, 0, len(messages)),
+		Warnings: opts.Log.fileWarnings,
+	}
+	if opts.Metadata {
+		doc.Metadata = db.Metadata
+	}
+	if doc.Warnings == nil {
+		doc.Warnings = []logEvent{}
+	}
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		jm := jsonMessage{
+			ID:       msg.ID,
+			Name:     msg.Name,
+			Extended: msg.IsExtended,
+			DLC:      msg.DLC,
+			Node:     msg.Node,
+			Comment:  msg.Comment,
+			Cycle:    msg.CycleTime,
+			Signals:  make([]jsonSignal, 0, len(msg.Signals)),
+		}
+		for _, sig := range msg.Signals {
+			jm.Signals = append(jm.Signals, jsonSignal{
+				Name:      sig.Name,
+				StartBit:  sig.StartBit,
+				Length:    sig.Length,
+				ByteOrder: byteOrderName(sig.ByteOrder),
+				Signed:    sig.IsSigned,
+				ValueType: valueTypeNames[sig.ValueType],
+				Multiplex: muxMarker(sig),
+				Factor:    sig.Factor,
+				Offset:    sig.Offset,
+				Min:       sig.Min,
+				Max:       sig.Max,
+				Unit:      sig.Unit,
+				Receivers: signalReceivers(sig, opts.Node),
+				Comment:   sig.Comment,
+				Group:     sig.Group,
+				Part:      sig.Part,
+				Values:    jsonValues(sig.ValueTable),
+				Entry:     sig.pos.Entry,
+				Line:      sig.pos.Line,
+			})
+		}
+		doc.Messages = append(doc.Messages, jm)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// jsonValues converts a value table for JSON output, or returns nil if it is empty.
+func jsonValues(table []ValueDescription) []jsonValue {
+	if len(table) == 0 {
+		return nil
+	}
+	values := make([]jsonValue, len(table))
+	for i, vd := range table {
+		values[i] = jsonValue{Value: vd.Value, Label: vd.Label}
+	}
+	return values
+}
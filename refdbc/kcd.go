@@ -0,0 +1,219 @@
+package refdbc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// kcdNamespace is the XML namespace of Kayak KCD network definitions.
+const kcdNamespace = "http://kayak.2codeornot2code.org/1.0"
+
+// kcdNetwork is the root element of a KCD file.
+type kcdNetwork struct {
+	XMLName  xml.Name    `xml:"NetworkDefinition"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document kcdDocument `xml:"Document"`
+	Nodes    []kcdNode   `xml:"Node"`
+	Bus      kcdBus      `xml:"Bus"`
+}
+
+type kcdDocument struct {
+	Name    string `xml:"name,attr,omitempty"`
+	Content string `xml:",chardata"`
+}
+
+type kcdNode struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"name,attr"`
+}
+
+type kcdBus struct {
+	Name     string       `xml:"name,attr"`
+	Messages []kcdMessage `xml:"Message"`
+}
+
+type kcdMessage struct {
+	ID        string        `xml:"id,attr"`
+	Name      string        `xml:"name,attr"`
+	Length    int           `xml:"length,attr"`
+	Format    string        `xml:"format,attr,omitempty"`   // extended for 29-bit IDs
+	Interval  int           `xml:"interval,attr,omitempty"` // Cycle time in milliseconds
+	Notes     string        `xml:"Notes,omitempty"`
+	Producer  *kcdNodeRefs  `xml:"Producer"`
+	Multiplex *kcdMultiplex `xml:"Multiplex"`
+	Signals   []kcdSignal   `xml:"Signal"`
+}
+
+type kcdNodeRefs struct {
+	Refs []kcdNodeRef `xml:"NodeRef"`
+}
+
+type kcdNodeRef struct {
+	ID string `xml:"id,attr"`
+}
+
+type kcdSignal struct {
+	Name       string       `xml:"name,attr"`
+	Offset     int          `xml:"offset,attr"`
+	Length     int          `xml:"length,attr"`
+	Endianness string       `xml:"endianess,attr"` // Spelled as in the KCD schema
+	Notes      string       `xml:"Notes,omitempty"`
+	Consumer   *kcdNodeRefs `xml:"Consumer"`
+	Value      kcdValue     `xml:"Value"`
+	LabelSet   *kcdLabelSet `xml:"LabelSet"`
+}
+
+// kcdMultiplex is the multiplexor of a message, holding a MuxGroup of
+// signals for each of its values.
+type kcdMultiplex struct {
+	kcdSignal
+	Groups []kcdMuxGroup `xml:"MuxGroup"`
+}
+
+type kcdMuxGroup struct {
+	Count   int         `xml:"count,attr"` // Multiplexor value
+	Signals []kcdSignal `xml:"Signal"`
+}
+
+type kcdValue struct {
+	Type      string `xml:"type,attr"`
+	Slope     string `xml:"slope,attr"`
+	Intercept string `xml:"intercept,attr"`
+	Unit      string `xml:"unit,attr,omitempty"`
+	Min       string `xml:"min,attr"`
+	Max       string `xml:"max,attr"`
+}
+
+type kcdLabelSet struct {
+	Labels []kcdLabel `xml:"Label"`
+}
+
+type kcdLabel struct {
+	Value int64  `xml:"value,attr"`
+	Name  string `xml:"name,attr"`
+}
+
+// kcdValueTypes names the SIG_VALTYPE_ values as KCD value types.
+var kcdValueTypes = [...]string{"", "single", "double"}
+
+// frameFormat returns the KCD format attribute of a message: empty for the
+// default standard frame, or extended.
+func frameFormat(msg *Message) string {
+	if msg.IsExtended {
+		return "extended"
+	}
+	return ""
+}
+
+// writeKCD writes the messages as a Kayak KCD network definition with a single
+// bus. Every node referenced by a message or signal becomes a <Node>, and
+// signals without receivers are consumed by opts.Node, as in DBC output.
+//
+// The multiplexor of a message is written as its <Multiplex>, with a
+// <MuxGroup> holding the signals of each multiplexor value. Messages whose
+// multiplexing has no single multiplexor are an error.
+//
+// KCD numbers bits sequentially, so the offset of a Motorola signal is its DBC
+// start bit s (the most significant bit) converted with 8*(s/8) + 7 - s%8.
+func writeKCD(messages map[uint32]*Message, w io.Writer, opts Options) error {
+	network := kcdNetwork{
+		Xmlns:    kcdNamespace,
+		Document: kcdDocument{Name: opts.Source, Content: annotation(fmt.Sprintf("Generated by racelogic-ref-to-dbc %s", Version), opts.Source)},
+		Bus:      kcdBus{Name: "CAN"},
+	}
+	nodeIDs := make(map[string]string)
+	for i, name := range collectNodes(messages, opts.Node) {
+		id := strconv.Itoa(i + 1)
+		nodeIDs[name] = id
+		network.Nodes = append(network.Nodes, kcdNode{ID: id, Name: name})
+	}
+
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		km := kcdMessage{
+			ID:       fmt.Sprintf("0x%X", msg.ID),
+			Name:     msg.Name,
+			Length:   msg.DLC,
+			Format:   frameFormat(msg),
+			Interval: msg.CycleTime,
+			Notes:    msg.Comment,
+			Producer: &kcdNodeRefs{Refs: []kcdNodeRef{{ID: nodeIDs[msg.Node]}}},
+		}
+		multiplexor, err := messageMultiplexor(msg)
+		if err != nil {
+			return err
+		}
+		if multiplexor != nil {
+			km.Multiplex = &kcdMultiplex{kcdSignal: newKCDSignal(multiplexor, nodeIDs, opts)}
+			for _, value := range muxValues(msg) {
+				group := kcdMuxGroup{Count: value}
+				for _, sig := range msg.Signals {
+					if sig.MuxRole == muxMultiplexed && sig.MuxValue == value {
+						group.Signals = append(group.Signals, newKCDSignal(sig, nodeIDs, opts))
+					}
+				}
+				km.Multiplex.Groups = append(km.Multiplex.Groups, group)
+			}
+		}
+		for _, sig := range msg.Signals {
+			if multiplexor == nil || sig.MuxRole == muxNone {
+				km.Signals = append(km.Signals, newKCDSignal(sig, nodeIDs, opts))
+			}
+		}
+		network.Bus.Messages = append(network.Bus.Messages, km)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(network); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// newKCDSignal returns the <Signal> of sig, with nodeIDs giving the id of
+// each receiver.
+func newKCDSignal(sig *Signal, nodeIDs map[string]string, opts Options) kcdSignal {
+	ks := kcdSignal{
+		Name:       sig.Name,
+		Offset:     sig.StartBit,
+		Length:     sig.Length,
+		Endianness: "little",
+		Notes:      sig.Comment,
+		Value: kcdValue{
+			Type:      "unsigned",
+			Slope:     formatFloat(sig.Factor, opts),
+			Intercept: formatFloat(sig.Offset, opts),
+			Unit:      sig.Unit,
+			Min:       formatFloat(sig.Min, opts),
+			Max:       formatFloat(sig.Max, opts),
+		},
+		Consumer: &kcdNodeRefs{},
+	}
+	if sig.ByteOrder == 0 {
+		ks.Endianness = "big"
+		ks.Offset = sequentialToDBC(sig.StartBit)
+	}
+	switch {
+	case sig.ValueType != 0:
+		ks.Value.Type = kcdValueTypes[sig.ValueType]
+	case sig.IsSigned:
+		ks.Value.Type = "signed"
+	}
+	if len(sig.ValueTable) > 0 {
+		ks.LabelSet = &kcdLabelSet{}
+		for _, vd := range sig.ValueTable {
+			ks.LabelSet.Labels = append(ks.LabelSet.Labels, kcdLabel{Value: vd.Value, Name: vd.Label})
+		}
+	}
+	for _, receiver := range signalReceivers(sig, opts.Node) {
+		ks.Consumer.Refs = append(ks.Consumer.Refs, kcdNodeRef{ID: nodeIDs[receiver]})
+	}
+	return ks
+}
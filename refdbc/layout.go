@@ -0,0 +1,273 @@
+package refdbc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDLC is the largest payload, in bytes, a message can grow to (CAN FD).
+const maxDLC = 64
+
+// canFDSizes lists the valid CAN FD payload sizes above the classic 8 bytes.
+var canFDSizes = []int{12, 16, 20, 24, 32, 48, 64}
+
+// signalBits returns the payload bit positions occupied by a signal, using DBC
+// bit numbering (bit n is bit n%8 of byte n/8). Intel signals occupy consecutive
+// bits upwards from the start bit. Motorola signals start at their most
+// significant bit and walk down through each byte, continuing at bit 7 of the
+// next byte (the DBC "sawtooth").
+func signalBits(startBit, length int, byteOrder byte) []int {
+	bits := make([]int, 0, length)
+	bit := startBit
+	for i := 0; i < length; i++ {
+		bits = append(bits, bit)
+		switch {
+		case byteOrder == 1:
+			bit++
+		case bit%8 == 0:
+			bit += 15
+		default:
+			bit--
+		}
+	}
+	return bits
+}
+
+// BitConventions lists the accepted values of the -bit-convention flag, naming
+// how the .ref file numbers the start bit of Motorola signals.
+var BitConventions = []string{"dbc", "lsb", "sequential"}
+
+// IsValidBitConvention reports whether convention is one of BitConventions.
+func IsValidBitConvention(convention string) bool {
+	for _, c := range BitConventions {
+		if c == convention {
+			return true
+		}
+	}
+	return false
+}
+
+// bitConventionAliases maps other accepted names to the BitConventions they
+// stand for. In DBC numbering the start bit is the MSB, used raw as written.
+var bitConventionAliases = map[string]string{
+	"msb": "dbc",
+	"raw": "dbc",
+}
+
+// CanonicalBitConvention resolves an alias such as msb to its name in
+// BitConventions. Other names are returned unchanged.
+func CanonicalBitConvention(convention string) string {
+	if canonical, ok := bitConventionAliases[convention]; ok {
+		return canonical
+	}
+	return convention
+}
+
+// motorolaStartBit converts the start bit of a Motorola signal from the given
+// convention to DBC's, where the start bit is the signal's most significant
+// bit, numbered 8*byte + bit with bit 7 the MSB of its byte. The result is
+// negative when the signal would begin before the first byte.
+//
+//   - dbc: the start bit is already in DBC numbering and is returned unchanged.
+//   - sequential: bits are counted from 0 at the MSB of byte 0 upwards through
+//     each byte, so sequential bit s is DBC bit 8*(s/8) + 7 - s%8.
+//   - lsb: the start bit is the signal's least significant bit in DBC
+//     numbering. Its sequential position is q = 8*(b/8) + 7 - b%8, the MSB is
+//     length-1 bits earlier at m = q - (length-1), and the DBC start bit is
+//     8*(m/8) + 7 - m%8.
+func motorolaStartBit(start, length int, convention string) int {
+	switch convention {
+	case "sequential":
+		return sequentialToDBC(start)
+	case "lsb":
+		msb := sequentialToDBC(start) - (length - 1) // sequentialToDBC is its own inverse
+		if msb < 0 {
+			return -1
+		}
+		return sequentialToDBC(msb)
+	}
+	return start
+}
+
+// refStartBit is the inverse of motorolaStartBit: it converts the DBC start bit
+// of a Motorola signal back to the given convention.
+func refStartBit(start, length int, convention string) int {
+	switch convention {
+	case "sequential":
+		return sequentialToDBC(start)
+	case "lsb":
+		return sequentialToDBC(sequentialToDBC(start) + length - 1)
+	}
+	return start
+}
+
+// sequentialToDBC maps between sequential big-endian bit numbering (0 is the
+// MSB of byte 0) and DBC bit numbering. The mapping is its own inverse.
+func sequentialToDBC(bit int) int {
+	return 8*(bit/8) + 7 - bit%8
+}
+
+// fitsIn reports whether every bit lies inside a payload of the given size and is unused.
+func fitsIn(bits []int, payloadBits int, used map[int]*Signal) bool {
+	for _, b := range bits {
+		if b < 0 || b >= payloadBits || used[b] != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidDLC reports whether a payload of n bytes can be sent on CAN (0 to 8)
+// or CAN FD (one of canFDSizes).
+func isValidDLC(n int) bool {
+	if n >= 0 && n <= 8 {
+		return true
+	}
+	for _, size := range canFDSizes {
+		if size == n {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFrameFormats reports messages whose DLC needs a CAN FD frame when
+// opts.CANFD is not set, since tools read them as classic CAN frames, which
+// can't carry more than 8 bytes. Violations are warnings, or an error when
+// opts.Strict is set.
+func checkFrameFormats(messages map[uint32]*Message, opts Options) error {
+	if opts.CANFD {
+		return nil
+	}
+	var violations []string
+	for _, id := range sortedMessageIDs(messages) {
+		if dlc := messages[id].DLC; dlc > 8 {
+			violations = append(violations, fmt.Sprintf("message %d has DLC %d, which needs a CAN FD frame (use -canfd to mark the messages as CAN FD)", id, dlc))
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	if opts.Strict {
+		return fmt.Errorf("CAN FD payloads in a classic CAN file: %s", strings.Join(violations, "; "))
+	}
+	for _, violation := range violations {
+		opts.Log.Warnf("%s.", violation)
+	}
+	return nil
+}
+
+// grownDLC returns the smallest valid DLC of at least the given number of bytes.
+func grownDLC(bytes int) int {
+	if bytes <= 8 {
+		return bytes
+	}
+	for _, size := range canFDSizes {
+		if size >= bytes {
+			return size
+		}
+	}
+	return maxDLC
+}
+
+// checkOverlaps reports signals whose bits overlap an earlier signal in the
+// same message, and signals that extend past the payload given by the DLC,
+// naming the layout of each signal involved. Multiplexed signals only
+// conflict with signals sent in the same frames. With opts.AutoPack each
+// overlapping signal is instead moved to the first free bits of the message,
+// in source order, growing the DLC up to maxDLC bytes if there is no room.
+// Violations that remain are warnings, or an error when opts.Strict is set.
+func checkOverlaps(messages map[uint32]*Message, opts Options) error {
+	var violations []string
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		layers := make(map[int]map[int]*Signal)
+
+		for _, sig := range msg.Signals {
+			used := occupiedBits(layers, sig)
+			bits := signalBits(sig.StartBit, sig.Length, sig.ByteOrder)
+			var conflict *Signal
+			shared := 0
+			for _, b := range bits {
+				if used[b] != nil {
+					if conflict == nil {
+						conflict = used[b]
+					}
+					shared++
+				}
+			}
+
+			if conflict != nil {
+				if !opts.AutoPack {
+					violations = append(violations, fmt.Sprintf("signals %s (%s) and %s (%s) overlap in message %d, sharing %d %s",
+						conflict.Name, describeLayout(conflict), sig.Name, describeLayout(sig), id, shared, plural(shared, "bit", "bits")))
+				} else if newStart, newDLC, ok := findFreeBits(sig, msg.DLC, used); ok {
+					opts.Log.Warnf("auto-pack moved signal %s in message %d from start bit %d to %d (overlapped %s), DLC %d -> %d.",
+						sig.Name, id, sig.StartBit, newStart, conflict.Name, msg.DLC, newDLC)
+					sig.StartBit = newStart
+					msg.DLC = newDLC
+					bits = signalBits(sig.StartBit, sig.Length, sig.ByteOrder)
+				} else {
+					violations = append(violations, fmt.Sprintf("auto-pack could not find %d free bits for signal %s in message %d, so it still overlaps %s (%s)",
+						sig.Length, sig.Name, id, conflict.Name, describeLayout(conflict)))
+				}
+			}
+
+			layer := layers[muxLayer(sig)]
+			if layer == nil {
+				layer = make(map[int]*Signal)
+				layers[muxLayer(sig)] = layer
+			}
+			for _, b := range bits {
+				if layer[b] == nil {
+					layer[b] = sig
+				}
+			}
+		}
+
+		// Checked after auto-pack, which may have grown the DLC.
+		for _, sig := range msg.Signals {
+			bits := signalBits(sig.StartBit, sig.Length, sig.ByteOrder)
+			if last := bits[len(bits)-1]; last >= msg.DLC*8 {
+				violations = append(violations, fmt.Sprintf("signal %s (%s) in message %d reaches bit %d, past the %d bits of DLC %d",
+					sig.Name, describeLayout(sig), id, last, msg.DLC*8, msg.DLC))
+			}
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	if opts.Strict {
+		return fmt.Errorf("invalid bit layout: %s", strings.Join(violations, "; "))
+	}
+	for _, violation := range violations {
+		opts.Log.Warnf("%s.", violation)
+	}
+	return nil
+}
+
+// findFreeBits finds the first start bit at which sig fits without overlapping
+// any used bit, trying the current DLC first and then growing it byte by byte.
+// It returns the start bit, the DLC needed, and whether a position was found.
+func findFreeBits(sig *Signal, dlc int, used map[int]*Signal) (int, int, bool) {
+	for size := dlc; size <= maxDLC; size++ {
+		candidate := grownDLC(size)
+		payloadBits := candidate * 8
+		for byteIndex := 0; byteIndex < candidate; byteIndex++ {
+			for k := 0; k < 8; k++ {
+				// Intel signals are tried from the lowest bit of each byte,
+				// Motorola signals from the highest, so both pack towards byte 0.
+				start := byteIndex*8 + k
+				if sig.ByteOrder == 0 {
+					start = byteIndex*8 + 7 - k
+				}
+				if fitsIn(signalBits(start, sig.Length, sig.ByteOrder), payloadBits, used) {
+					return start, candidate, true
+				}
+			}
+		}
+	}
+	return 0, dlc, false
+}
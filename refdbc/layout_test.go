@@ -0,0 +1,138 @@
+package refdbc
+
+import "testing"
+
+func TestSequentialToDBC(t *testing.T) {
+	seen := make(map[int]bool)
+	for bit := 0; bit < 64; bit++ {
+		dbc := sequentialToDBC(bit)
+		if want := 8*(bit/8) + 7 - bit%8; dbc != want {
+			t.Errorf("sequentialToDBC(%d) = %d, want %d", bit, dbc, want)
+		}
+		if back := sequentialToDBC(dbc); back != bit {
+			t.Errorf("sequentialToDBC(sequentialToDBC(%d)) = %d", bit, back)
+		}
+		seen[dbc] = true
+	}
+	if len(seen) != 64 {
+		t.Errorf("sequentialToDBC maps 64 bits onto %d", len(seen))
+	}
+}
+
+// TestMotorolaStartBit converts every Motorola signal that fits in 8 bytes,
+// from each start bit with each length, to every convention and back. The
+// expected start bits come from the bits signalBits walks in DBC numbering.
+func TestMotorolaStartBit(t *testing.T) {
+	for start := 0; start < 64; start++ {
+		for length := 1; length <= 64; length++ {
+			bits := signalBits(start, length, 0)
+			if bits[len(bits)-1] >= 64 {
+				continue
+			}
+			msb, lsb := bits[0], bits[len(bits)-1]
+			for convention, ref := range map[string]int{
+				"dbc":        msb,
+				"sequential": sequentialToDBC(msb),
+				"lsb":        lsb,
+			} {
+				if got := refStartBit(start, length, convention); got != ref {
+					t.Errorf("refStartBit(%d, %d, %s) = %d, want %d", start, length, convention, got, ref)
+				}
+				if got := motorolaStartBit(ref, length, convention); got != start {
+					t.Errorf("motorolaStartBit(%d, %d, %s) = %d, want %d", ref, length, convention, got, start)
+				}
+			}
+		}
+	}
+}
+
+func TestMotorolaStartBitBeforeFirstByte(t *testing.T) {
+	// The LSB at bit 6 of byte 0 leaves room for a 2-bit signal, not a 3-bit one.
+	if got := motorolaStartBit(6, 2, "lsb"); got != 7 {
+		t.Errorf("motorolaStartBit(6, 2, lsb) = %d, want 7", got)
+	}
+	for _, length := range []int{3, 8, 64} {
+		if got := motorolaStartBit(6, length, "lsb"); got >= 0 {
+			t.Errorf("motorolaStartBit(6, %d, lsb) = %d, want a negative bit", length, got)
+		}
+	}
+}
+
+func TestCanonicalBitConvention(t *testing.T) {
+	tests := map[string]string{
+		"dbc":        "dbc",
+		"msb":        "dbc",
+		"raw":        "dbc",
+		"lsb":        "lsb",
+		"sequential": "sequential",
+		"other":      "other",
+	}
+	for convention, want := range tests {
+		got := CanonicalBitConvention(convention)
+		if got != want {
+			t.Errorf("CanonicalBitConvention(%s) = %s, want %s", convention, got, want)
+		}
+		if IsValidBitConvention(got) != (want != "other") {
+			t.Errorf("IsValidBitConvention(%s) = %t", got, IsValidBitConvention(got))
+		}
+	}
+}
+
+func TestBitConventionParsing(t *testing.T) {
+	// A 12-bit Motorola signal using DBC bits 3-0 and 15-8 starts at bit 3 in
+	// DBC numbering and at bit 4 in sequential numbering, and its LSB is bit 8.
+	tests := []struct {
+		convention string
+		start      string
+		want       int
+	}{
+		{"dbc", "3", 3},
+		{"sequential", "4", 3},
+		{"lsb", "8", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.convention, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.BitConvention = tt.convention
+			messages, err := parseSignalLines([]string{"Pressure,256,bar," + tt.start + ",12,0,0.1,400,0,unsigned,Motorola,8"}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := messages[256].Signals[0].StartBit; got != tt.want {
+				t.Errorf("start bit %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBitConventionLeavesIntel(t *testing.T) {
+	for _, convention := range BitConventions {
+		opts := DefaultOptions()
+		opts.BitConvention = convention
+		messages, err := parseSignalLines([]string{"Speed,256,km/h,4,12,0,0.1,400,0,unsigned,Intel,8"}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := messages[256].Signals[0].StartBit; got != 4 {
+			t.Errorf("-bit-convention %s moved an Intel start bit to %d", convention, got)
+		}
+	}
+}
+
+func TestBitConventionOutsideMessage(t *testing.T) {
+	// With lsb numbering, an LSB at bit 6 of byte 0 leaves no room for 12 bits.
+	opts := DefaultOptions()
+	opts.BitConvention = "lsb"
+	p := newSignalParser(opts)
+	if err := p.parseLine("Pressure,256,bar,6,12,0,0.1,400,0,unsigned,Motorola,8", position{Line: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if p.skipped != 1 {
+		t.Errorf("%d lines skipped, want 1", p.skipped)
+	}
+
+	opts.Strict = true
+	if err := newSignalParser(opts).parseLine("Pressure,256,bar,6,12,0,0.1,400,0,unsigned,Motorola,8", position{Line: 1}); err == nil {
+		t.Error("-strict accepted a start bit with no DBC equivalent")
+	}
+}
@@ -0,0 +1,189 @@
+package refdbc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// LogLevel is the severity of a log event. Lower values are more severe.
+type LogLevel int
+
+const (
+	LevelError LogLevel = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+)
+
+// logLevelNames are the level names written in JSON events, indexed by LogLevel.
+var logLevelNames = [...]string{"error", "warn", "info", "debug"}
+
+// logLevelPrefixes start each text event, indexed by LogLevel. Info events are
+// written without a prefix.
+var logLevelPrefixes = [...]string{"Error: ", "Warning: ", "", "Debug: "}
+
+// LogFormats lists the accepted values of the -log-format flag.
+var LogFormats = []string{"text", "json"}
+
+// position locates data within a .ref file. Entry is 0 for lines that were not
+// read from a numbered entry, and Line is 0 for an entry as a whole; the zero
+// position refers to nothing in particular.
+type position struct {
+	Entry int
+	Line  int
+}
+
+func (p position) String() string {
+	switch {
+	case p.Entry == 0:
+		return fmt.Sprintf("line #%d", p.Line)
+	case p.Line == 0:
+		return fmt.Sprintf("entry #%d", p.Entry)
+	}
+	return fmt.Sprintf("entry #%d line #%d", p.Entry, p.Line)
+}
+
+// before reports whether p comes earlier in the file than q.
+func (p position) before(q position) bool {
+	if p.Entry != q.Entry {
+		return p.Entry < q.Entry
+	}
+	return p.Line < q.Line
+}
+
+// logEvent is the JSON form of a log event.
+type logEvent struct {
+	Level   string `json:"level"`
+	File    string `json:"file,omitempty"`
+	Entry   int    `json:"entry,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// Logger writes leveled diagnostics, either as text or as one JSON object per
+// line. It counts the warnings logged for the current file, whether or not they
+// are written, so callers can tell if the file converted cleanly.
+type Logger struct {
+	w        io.Writer
+	json     bool
+	level    LogLevel // Least severe level that is written
+	file     string   // Input file the events refer to
+	warnings int      // Warnings logged since the last StartFile
+
+	fileWarnings []logEvent // The warnings counted in warnings, for writers that include them
+
+	parent *Logger       // Logger that Flush writes buffered events to
+	buffer *bytes.Buffer // Events held back by a Buffered logger
+}
+
+// NewLogger creates a Logger writing events up to level to w in the given
+// format, one of LogFormats.
+func NewLogger(w io.Writer, format string, level LogLevel) *Logger {
+	return &Logger{w: w, json: format == "json", level: level}
+}
+
+// Buffered returns a Logger with the format and level of l that holds its
+// events back until Flush writes them to l, so the events of files converted
+// at the same time don't interleave.
+func (l *Logger) Buffered() *Logger {
+	buffer := &bytes.Buffer{}
+	return &Logger{w: buffer, json: l.json, level: l.level, parent: l, buffer: buffer}
+}
+
+// Flush writes the events held back by a Buffered logger to its parent.
+func (l *Logger) Flush() error {
+	if l.parent == nil {
+		return nil
+	}
+	_, err := l.parent.w.Write(l.buffer.Bytes())
+	l.buffer.Reset()
+	return err
+}
+
+// IsValidLogFormat reports whether format is one of LogFormats.
+func IsValidLogFormat(format string) bool {
+	for _, f := range LogFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// StartFile attributes the following events to path and resets the warning count.
+func (l *Logger) StartFile(path string) {
+	l.file = path
+	l.warnings = 0
+	l.fileWarnings = nil
+}
+
+// HasWarnings reports whether any warning was logged since the last StartFile.
+func (l *Logger) HasWarnings() bool {
+	return l.warnings > 0
+}
+
+// enabled reports whether events of the given level are written.
+func (l *Logger) enabled(level LogLevel) bool {
+	return level <= l.level
+}
+
+// logf records an event. In text form, a non-zero pos is written before the
+// message. Warnings are counted and kept for the current file even when they
+// are not written.
+func (l *Logger) logf(level LogLevel, pos position, format string, args ...interface{}) {
+	if level != LevelWarn && !l.enabled(level) {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	event := logEvent{
+		Level:   logLevelNames[level],
+		File:    l.file,
+		Entry:   pos.Entry,
+		Line:    pos.Line,
+		Message: message,
+	}
+	if level == LevelWarn {
+		l.warnings++
+		l.fileWarnings = append(l.fileWarnings, event)
+	}
+	if !l.enabled(level) {
+		return
+	}
+	if l.json {
+		data, _ := json.Marshal(event)
+		l.w.Write(append(data, '\n'))
+		return
+	}
+	if pos != (position{}) {
+		message = pos.String() + ": " + message
+	}
+	fmt.Fprintf(l.w, "%s%s\n", logLevelPrefixes[level], message)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(LevelError, position{}, format, args...)
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(LevelWarn, position{}, format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(LevelInfo, position{}, format, args...)
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(LevelDebug, position{}, format, args...)
+}
+
+// warnAt logs a warning about the line at pos.
+func (l *Logger) warnAt(pos position, format string, args ...interface{}) {
+	l.logf(LevelWarn, pos, format, args...)
+}
+
+// debugAt logs a debug event about the line at pos.
+func (l *Logger) debugAt(pos position, format string, args ...interface{}) {
+	l.logf(LevelDebug, pos, format, args...)
+}
@@ -0,0 +1,156 @@
+package refdbc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MergeFiles parses every input .ref file and writes all of their messages to
+// one output file in the format selected by opts.Format. Messages with the same
+// ID in several files are combined into one holding the union of their signals;
+// see mergeMessages for how conflicting definitions are handled. Warnings are
+// reported through opts.Log against the input they were found in.
+func MergeFiles(inputPaths []string, outputPath string, opts Options) (stats FileStats, err error) {
+	start := time.Now()
+	defer func() {
+		stats.Warnings = opts.Log.warnings
+		stats.Elapsed = time.Since(start)
+	}()
+
+	merged, sources, err := mergeRefFiles(inputPaths, &stats, opts)
+	if err != nil {
+		return stats, err
+	}
+
+	opts.Source = strings.Join(sources, ", ")
+	outFile, err := createOutput(outputPath)
+	if err != nil {
+		return stats, fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+
+	if err := writeOutput(&Database{Messages: merged}, outFile, opts); err != nil {
+		return stats, err
+	}
+	stats.countWritten(merged)
+	opts.Report.add(inputPaths[0], opts.Source, merged, opts.Log)
+	return stats, nil
+}
+
+// mergeRefFiles parses every input .ref file and combines their messages with
+// mergeMessages, adding the skipped lines and duplicates to stats. It returns
+// the combined messages and the source names of the inputs.
+func mergeRefFiles(inputPaths []string, stats *FileStats, opts Options) (map[uint32]*Message, []string, error) {
+	outputFile := opts.Log.file
+	merged := make(map[uint32]*Message)
+	sources := make([]string, 0, len(inputPaths))
+	for _, path := range inputPaths {
+		opts.Log.file = path
+		opts.Source = sourceName(path)
+		messages, fileStats, err := readRefFile(path, opts)
+		stats.SkippedLines += fileStats.SkippedLines
+		stats.Duplicates += fileStats.Duplicates
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := mergeMessages(merged, messages, opts.Source, opts); err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, opts.Source)
+	}
+	opts.Log.file = outputFile
+
+	// Message names are only unique within each file.
+	if err := checkUniqueNames(merged, opts); err != nil {
+		return nil, nil, err
+	}
+	truncateSignalNames(merged, opts)
+	checkCompat(merged, opts)
+	return merged, sources, nil
+}
+
+// mergeMessages adds the messages read from source to merged. A message already
+// in merged keeps its name, and takes the larger DLC and the union of the
+// signals; a signal defined in both keeps its earlier definition. A different
+// DLC or cycle time, a signal defined differently (other than by its comment), or a new
+// signal overlapping an existing one is a conflict: a warning, or an error
+// when opts.Strict is set.
+func mergeMessages(merged, messages map[uint32]*Message, source string, opts Options) error {
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		existing, ok := merged[id]
+		if !ok {
+			merged[id] = msg
+			continue
+		}
+
+		var conflicts []string
+		if msg.DLC != existing.DLC {
+			conflicts = append(conflicts, fmt.Sprintf("DLC %d differs from the earlier DLC %d", msg.DLC, existing.DLC))
+			if msg.DLC > existing.DLC {
+				existing.DLC = msg.DLC
+			}
+		}
+		if msg.Name != existing.Name {
+			opts.Log.Warnf("message %d is named %s in %s but %s earlier; keeping %s.", id, msg.Name, source, existing.Name, existing.Name)
+		}
+		if existing.Comment == "" {
+			existing.Comment = msg.Comment
+		}
+		if existing.CycleTime == 0 {
+			existing.CycleTime = msg.CycleTime
+		} else if msg.CycleTime != 0 && msg.CycleTime != existing.CycleTime {
+			conflicts = append(conflicts, fmt.Sprintf("cycle time %d ms differs from the earlier cycle time %d ms", msg.CycleTime, existing.CycleTime))
+		}
+
+		for _, sig := range msg.Signals {
+			if prev := findSignal(existing, sig.Name); prev != nil {
+				other := *sig
+				other.Comment = prev.Comment
+				if changes := diffSignal(prev, &other, nil); len(changes) > 0 {
+					conflicts = append(conflicts, fmt.Sprintf("signal %s differs from the earlier definition (%s)", sig.Name, strings.Join(changes, ", ")))
+				}
+				if prev.Comment == "" {
+					prev.Comment = sig.Comment
+				}
+				continue
+			}
+
+			bits := signalBits(sig.StartBit, sig.Length, sig.ByteOrder)
+			for _, prev := range existing.Signals {
+				if sharedBits(bits, signalBits(prev.StartBit, prev.Length, prev.ByteOrder)) > 0 {
+					conflicts = append(conflicts, fmt.Sprintf("signal %s (%s) overlaps the earlier signal %s (%s)", sig.Name, describeLayout(sig), prev.Name, describeLayout(prev)))
+					break
+				}
+			}
+			existing.Signals = append(existing.Signals, sig)
+		}
+
+		if len(conflicts) == 0 {
+			continue
+		}
+		if opts.Strict {
+			return fmt.Errorf("conflicting definitions of message %d in %s: %s", id, source, strings.Join(conflicts, "; "))
+		}
+		for _, conflict := range conflicts {
+			opts.Log.Warnf("message %d in %s: %s.", id, source, conflict)
+		}
+	}
+	return nil
+}
+
+// sharedBits counts the bit positions present in both a and b.
+func sharedBits(a, b []int) int {
+	inA := make(map[int]bool, len(a))
+	for _, bit := range a {
+		inA[bit] = true
+	}
+	shared := 0
+	for _, bit := range b {
+		if inA[bit] {
+			shared++
+		}
+	}
+	return shared
+}
@@ -0,0 +1,299 @@
+package refdbc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConflictPolicies lists the accepted values of the -conflict flag: what
+// MergeIntoDBC does with a converted message whose ID the base DBC already
+// uses. error stops the merge, keep leaves the base message as it is, and
+// replace swaps it, with its comments, attributes and value tables, for the
+// converted one.
+var ConflictPolicies = []string{"error", "keep", "replace"}
+
+// IsValidConflictPolicy reports whether policy is one of ConflictPolicies.
+func IsValidConflictPolicy(policy string) bool {
+	for _, p := range ConflictPolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// dbcSectionOrder lists the DBC keywords in the order their sections appear
+// in a file. Converted statements are inserted after the last statement of
+// the same or an earlier section.
+var dbcSectionOrder = []string{
+	"VERSION", "NS_", "BS_", "BU_", "VAL_TABLE_", "BO_", "BO_TX_BU_", "EV_", "ENVVAR_DATA_",
+	"SGTYPE_", "CM_", "BA_DEF_", "BA_DEF_SGTYPE_", "BA_DEF_REL_", "BA_DEF_DEF_", "BA_DEF_DEF_REL_",
+	"BA_", "BA_SGTYPE_", "BA_REL_", "VAL_", "SGTYPE_VAL_", "SIG_GROUP_", "SIG_VALTYPE_", "SG_MUL_VAL_",
+}
+
+var (
+	// messageStatementRe matches the statements that start with the ID of the message they belong to.
+	messageStatementRe = regexp.MustCompile(`^(?:BO_|BO_TX_BU_|VAL_|SIG_GROUP_|SIG_VALTYPE_|SG_MUL_VAL_)\s+(\d+)`)
+	// objectStatementRe matches comments and attribute values of a message or one of its signals.
+	objectStatementRe = regexp.MustCompile(`^(?:CM_|BA_\s+"\w+")\s+(?:BO_|SG_)\s+(\d+)`)
+	// attrNameRe matches the attribute name of an attribute definition or default.
+	attrNameRe = regexp.MustCompile(`^BA_DEF_(?:DEF_)?\s+(?:(?:BU_|BO_|SG_|EV_)\s+)?"(\w+)"`)
+)
+
+// dbcStatement is one statement of a DBC file, kept as written.
+type dbcStatement struct {
+	keyword string // First word, such as BO_ or CM_; empty for blank lines at the start of the file
+	text    string // Lines of the statement, including the SG_ lines of a BO_, without the final line break
+	blanks  int    // Blank lines following the statement
+	id      int64  // ID of the message the statement belongs to, or -1
+}
+
+// splitDBCStatements splits a DBC file into statements. Indented lines, such
+// as the SG_ lines of a message and the keyword list of NS_, and the lines of
+// a multi-line string belong to the statement before them.
+func splitDBCStatements(data []byte) []*dbcStatement {
+	var statements []*dbcStatement
+	var current *dbcStatement
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case current != nil && hasOpenQuote(current.text):
+			current.text += "\n" + line
+		case trimmed == "":
+			if current == nil {
+				current = &dbcStatement{id: -1}
+				statements = append(statements, current)
+			}
+			current.blanks++
+		case current != nil && current.blanks == 0 && current.keyword != "" &&
+			(line[0] == ' ' || line[0] == '\t'):
+			current.text += "\n" + line
+		default:
+			current = newDBCStatement(line)
+			statements = append(statements, current)
+		}
+	}
+	return statements
+}
+
+// newDBCStatement starts a statement with its first line.
+func newDBCStatement(line string) *dbcStatement {
+	keyword := strings.Fields(line)[0]
+	keyword, _, _ = strings.Cut(keyword, ":")
+	statement := &dbcStatement{keyword: keyword, text: line, id: -1}
+	trimmed := strings.TrimSpace(line)
+	m := messageStatementRe.FindStringSubmatch(trimmed)
+	if m == nil {
+		m = objectStatementRe.FindStringSubmatch(trimmed)
+	}
+	if m != nil {
+		id, _ := strconv.ParseUint(m[1], 10, 32)
+		statement.id = int64(uint32(id) &^ dbcExtendedFlag)
+	}
+	return statement
+}
+
+// attributeName returns the attribute a BA_DEF_, BA_DEF_DEF_ or network BA_
+// statement is about, or an empty string for other statements.
+func (s *dbcStatement) attributeName() string {
+	trimmed := strings.TrimSpace(s.text)
+	if m := attrNameRe.FindStringSubmatch(trimmed); m != nil {
+		return m[1]
+	}
+	if m := networkAttrLineRe.FindStringSubmatch(trimmed); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// sectionRank returns the position of keyword in dbcSectionOrder, or -1.
+func sectionRank(keyword string) int {
+	for i, k := range dbcSectionOrder {
+		if k == keyword {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertStatement inserts s after the last statement of statements from the
+// same or an earlier section, or at the start if there is none. If s has no
+// blank lines after it, it takes over those of the statement before it, so
+// a statement added to the end of a section stays in the section.
+func insertStatement(statements []*dbcStatement, s *dbcStatement) []*dbcStatement {
+	rank := sectionRank(s.keyword)
+	at := 0
+	for i, other := range statements {
+		if r := sectionRank(other.keyword); r >= 0 && r <= rank {
+			at = i + 1
+		}
+	}
+	if at > 0 && s.blanks == 0 {
+		s.blanks, statements[at-1].blanks = statements[at-1].blanks, 0
+	}
+	statements = append(statements, nil)
+	copy(statements[at+1:], statements[at:])
+	statements[at] = s
+	return statements
+}
+
+// MergeIntoDBC converts the input .ref files, combined as by MergeFiles, and
+// inserts their messages into the DBC file at basePath, writing the result to
+// outputPath (which may be basePath). Everything else in the base file is
+// kept as written. Converted statements go at the end of their section, new
+// nodes are added to the BU_ line, and attribute definitions the base file
+// already has are not repeated; their definitions are used for the values of
+// the converted messages. A converted message with the ID of a base message
+// is handled according to opts.ConflictPolicy.
+func MergeIntoDBC(inputPaths []string, basePath, outputPath string, opts Options) (stats FileStats, err error) {
+	start := time.Now()
+	defer func() {
+		stats.Warnings = opts.Log.warnings
+		stats.Elapsed = time.Since(start)
+	}()
+
+	merged, sources, err := mergeRefFiles(inputPaths, &stats, opts)
+	if err != nil {
+		return stats, err
+	}
+	data, err := os.ReadFile(basePath)
+	if err != nil {
+		return stats, fmt.Errorf("failed to open base DBC file: %w", err)
+	}
+	base, err := ParseDBC(bytes.NewReader(data))
+	if err != nil {
+		return stats, fmt.Errorf("base DBC file %s: %w", basePath, err)
+	}
+	statements := splitDBCStatements(data)
+
+	// Resolve messages whose ID the base file already uses.
+	var conflicts []uint32
+	for _, id := range sortedMessageIDs(merged) {
+		if _, ok := base.Messages[id]; ok {
+			conflicts = append(conflicts, id)
+		}
+	}
+	if len(conflicts) > 0 {
+		ids := make([]string, len(conflicts))
+		for i, id := range conflicts {
+			ids[i] = strconv.FormatUint(uint64(id), 10)
+		}
+		switch opts.ConflictPolicy {
+		case "keep":
+			opts.Log.Infof("Keeping the definitions in %s of %s %s.", basePath, plural(len(ids), "message", "messages"), strings.Join(ids, ", "))
+			for _, id := range conflicts {
+				delete(merged, id)
+			}
+		case "replace":
+			opts.Log.Infof("Replacing the definitions in %s of %s %s.", basePath, plural(len(ids), "message", "messages"), strings.Join(ids, ", "))
+			replaced := make(map[int64]bool)
+			for _, id := range conflicts {
+				replaced[int64(id)] = true
+			}
+			kept := statements[:0]
+			for _, s := range statements {
+				if !replaced[s.id] {
+					kept = append(kept, s)
+				} else if len(kept) > 0 && s.blanks > kept[len(kept)-1].blanks {
+					// Keep the gap that followed the removed statement.
+					kept[len(kept)-1].blanks = s.blanks
+				}
+			}
+			statements = kept
+		default:
+			return stats, fmt.Errorf("%s %s already in %s (use -conflict keep or replace)", plural(len(ids), "message", "messages"), strings.Join(ids, ", "), basePath)
+		}
+	}
+	// Message names must stay unique in the combined file.
+	for _, baseID := range sortedMessageIDs(base.Messages) {
+		if merged[baseID] != nil {
+			continue // Replaced
+		}
+		for _, id := range sortedMessageIDs(merged) {
+			if merged[id].Name == base.Messages[baseID].Name {
+				opts.Log.Warnf("message %d is named %s like message %d in %s.", id, merged[id].Name, baseID, basePath)
+			}
+		}
+	}
+
+	// Write the converted messages, reusing the base file's attribute
+	// definitions, and drop the definitions it already has.
+	defined := make(map[string]bool)
+	for _, s := range statements {
+		if name := s.attributeName(); name != "" {
+			defined[name] = true
+		}
+	}
+	writeOpts := opts
+	writeOpts.NoHeader = true
+	writeOpts.Source = strings.Join(sources, ", ")
+	writeOpts.Attributes = append([]AttributeDef(nil), base.Attributes...)
+	for _, def := range opts.Attributes {
+		if findAttribute(writeOpts.Attributes, def.Name) == nil {
+			writeOpts.Attributes = append(writeOpts.Attributes, def)
+		}
+	}
+	var converted bytes.Buffer
+	writer := bufio.NewWriter(&converted)
+	if err := writeDBC(&Database{Messages: merged}, writer, writeOpts); err != nil {
+		return stats, fmt.Errorf("failed to write DBC file: %w", err)
+	}
+	writer.Flush()
+	for _, s := range splitDBCStatements(converted.Bytes()) {
+		if s.keyword == "" || defined[s.attributeName()] {
+			continue
+		}
+		statements = insertStatement(statements, s)
+	}
+
+	// List the new nodes on the BU_ line.
+	nodes := append([]string(nil), base.Nodes...)
+	for _, node := range collectNodes(merged, opts.Node) {
+		if !isValidChoice(node, nodes) {
+			nodes = append(nodes, node)
+		}
+	}
+	nodeLine := "BU_: " + strings.Join(nodes, " ")
+	found := false
+	for _, s := range statements {
+		if s.keyword == "BU_" {
+			s.text, found = nodeLine, true
+		}
+	}
+	if !found {
+		statements = insertStatement(statements, &dbcStatement{keyword: "BU_", text: nodeLine, blanks: 1, id: -1})
+	}
+
+	// Keep the line endings of the base file.
+	newline := "\n"
+	if bytes.Contains(data, []byte("\r\n")) {
+		newline = "\r\n"
+	}
+	var out bytes.Buffer
+	for _, s := range statements {
+		if s.keyword != "" {
+			out.WriteString(strings.ReplaceAll(s.text, "\n", newline) + newline)
+		}
+		out.WriteString(strings.Repeat(newline, s.blanks))
+	}
+
+	outFile, err := createOutput(outputPath)
+	if err != nil {
+		return stats, fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+	if _, err := outFile.Write(out.Bytes()); err != nil {
+		return stats, fmt.Errorf("failed to write DBC file: %w", err)
+	}
+	stats.countWritten(merged)
+	opts.Report.add(inputPaths[0], strings.Join(sources, ", "), merged, opts.Log)
+	return stats, nil
+}
@@ -0,0 +1,113 @@
+package refdbc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RefMetadata describes the logger a .ref file was written for, as far as its
+// header line, serial string and serial block tell. The layout of these is
+// not documented, so SerialNumber, Firmware and Channels are only filled in
+// when one of them holds the value in a recognizable form, such as
+// "SN 123456", "FW 2.1.4" or "16 channels".
+type RefMetadata struct {
+	Header string `json:"header"`           // Header line as written
+	Serial string `json:"serial,omitempty"` // Serial string line as written, empty in legacy files
+
+	SerialNumber string `json:"serial_number,omitempty"` // Serial number of the unit
+	Firmware     string `json:"firmware,omitempty"`      // Firmware version of the unit
+	Channels     int    `json:"channels,omitempty"`      // Number of channels the unit logs
+}
+
+var (
+	// serialNumberRe matches a labelled serial number, e.g. "SN 123456" or "Serial No: 0451-22".
+	serialNumberRe = regexp.MustCompile(`(?i)\b(?:serial(?:\s*(?:no|number)\.?)?|s/?n)\s*[:#=]?\s*([a-z0-9]*\d[a-z0-9-]*)`)
+	// bareSerialRe matches a serial string that is only the serial number.
+	bareSerialRe = regexp.MustCompile(`^[A-Za-z0-9-]*\d[A-Za-z0-9-]*$`)
+	// firmwareRe matches a labelled version number, e.g. "FW 2.1.4", "Firmware: v3.02b" or "Ver. 1.5".
+	firmwareRe = regexp.MustCompile(`(?i)\b(?:firmware|fw|version|ver)\.?\s*[:=]?\s*v?(\d+(?:\.\d+)+[a-z0-9]*)`)
+	// channelsRe matches a channel count before or after its label, e.g. "16 channels", "16ch" or "Channels: 16".
+	channelsRe = regexp.MustCompile(`(?i)\b(?:(\d+)\s*(?:ch|chan|channels?)\b|channels?\s*[:=]?\s*(\d+))`)
+)
+
+// parseRefMetadata extracts the metadata of preamble. The serial block is
+// searched as well when it decompresses to text.
+func parseRefMetadata(preamble RefPreamble) RefMetadata {
+	md := RefMetadata{Header: preamble.Header, Serial: preamble.Serial}
+	texts := []string{preamble.Serial}
+	if text, ok := serialBlockText(preamble.SerialBlock); ok {
+		texts = append(texts, text)
+	}
+	texts = append(texts, preamble.Header)
+
+	for _, text := range texts {
+		if m := serialNumberRe.FindStringSubmatch(text); m != nil && md.SerialNumber == "" {
+			md.SerialNumber = m[1]
+		}
+		if m := firmwareRe.FindStringSubmatch(text); m != nil && md.Firmware == "" {
+			md.Firmware = m[1]
+		}
+		if m := channelsRe.FindStringSubmatch(text); m != nil && md.Channels == 0 {
+			md.Channels, _ = strconv.Atoi(m[1] + m[2])
+		}
+	}
+	if serial := strings.TrimSpace(preamble.Serial); md.SerialNumber == "" && bareSerialRe.MatchString(serial) {
+		md.SerialNumber = serial
+	}
+	return md
+}
+
+// serialBlockText decompresses a serial block and returns its contents if they
+// are printable text.
+func serialBlockText(block []byte) (string, bool) {
+	if len(block) == 0 {
+		return "", false
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(block))
+	if err != nil {
+		return "", false
+	}
+	data, err := io.ReadAll(io.LimitReader(zr, 4096))
+	if err != nil || len(data) == 0 {
+		return "", false
+	}
+	for _, b := range data {
+		if (b < 0x20 || b > 0x7E) && b != '\t' && b != '\r' && b != '\n' {
+			return "", false
+		}
+	}
+	return string(data), true
+}
+
+// summary describes the logger in one line, naming only the fields that were
+// recognized, or returns an empty string if none were.
+func (md RefMetadata) summary() string {
+	var parts []string
+	if md.SerialNumber != "" {
+		parts = append(parts, "serial number "+md.SerialNumber)
+	}
+	if md.Firmware != "" {
+		parts = append(parts, "firmware "+md.Firmware)
+	}
+	if md.Channels > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", md.Channels, plural(md.Channels, "channel", "channels")))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// metadataNote is the DBC comment written for md with Options.Metadata.
+func metadataNote(md RefMetadata, source string) string {
+	note := fmt.Sprintf("Logger header '%s'", md.Header)
+	if md.Serial != "" {
+		note += fmt.Sprintf(", serial string '%s'", md.Serial)
+	}
+	if summary := md.summary(); summary != "" {
+		note += " (" + summary + ")"
+	}
+	return annotation(note, source) + "."
+}
@@ -0,0 +1,169 @@
+package refdbc
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Values of Signal.MuxRole.
+const (
+	muxNone        = 0 // Present in every frame of the message
+	muxMultiplexor = 1 // Selects which multiplexed signals a frame carries, M in SG_ lines
+	muxMultiplexed = 2 // Present when the multiplexor equals MuxValue, m<MuxValue> in SG_ lines
+)
+
+// parseMuxMarker reads the multiplex column of a signal line, which uses the
+// markers of DBC files: M for the multiplexor and m<value> for a signal sent
+// when the multiplexor has that value. The value may be decimal or hex
+// (m0x10). An empty column is a plain signal.
+func parseMuxMarker(text string) (role byte, value int, err error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return muxNone, 0, nil
+	case text == "M":
+		return muxMultiplexor, 0, nil
+	case strings.HasPrefix(text, "m"):
+		v, err := strconv.ParseUint(text[1:], 0, 31)
+		if err != nil {
+			return muxNone, 0, fmt.Errorf("invalid multiplexor value '%s'", text[1:])
+		}
+		return muxMultiplexed, int(v), nil
+	}
+	return muxNone, 0, fmt.Errorf("unknown multiplex marker '%s' (expected M or m<value>)", text)
+}
+
+// muxMarker returns the marker written for sig in SG_ lines and the multiplex
+// column, or an empty string for a plain signal.
+func muxMarker(sig *Signal) string {
+	switch sig.MuxRole {
+	case muxMultiplexor:
+		return "M"
+	case muxMultiplexed:
+		return "m" + strconv.Itoa(sig.MuxValue)
+	}
+	return ""
+}
+
+// muxLayer returns the set of frames sig occupies bits in: -1 for plain
+// signals and multiplexors, which are in every frame, or the multiplexor
+// value of a multiplexed signal.
+func muxLayer(sig *Signal) int {
+	if sig.MuxRole == muxMultiplexed {
+		return sig.MuxValue
+	}
+	return -1
+}
+
+// occupiedBits returns the bits sig must not share, from the bits used by
+// each multiplex layer of its message. Plain signals and multiplexors
+// conflict with every layer, multiplexed signals only with their own layer
+// and the signals present in every frame.
+func occupiedBits(layers map[int]map[int]*Signal, sig *Signal) map[int]*Signal {
+	keys := sortedLayerKeys(layers)
+	if layer := muxLayer(sig); layer != -1 {
+		keys = []int{-1, layer}
+	}
+	used := make(map[int]*Signal)
+	for _, l := range keys {
+		for b, s := range layers[l] {
+			if used[b] == nil {
+				used[b] = s
+			}
+		}
+	}
+	return used
+}
+
+// messageMultiplexor returns the multiplexor of msg, or nil when msg has no
+// multiplexed signals. Formats that describe multiplexing as one selector
+// field call it before writing a message, as a message with multiplexed
+// signals but no multiplexor, or with several multiplexors, has no such
+// field.
+func messageMultiplexor(msg *Message) (*Signal, error) {
+	var multiplexors []*Signal
+	multiplexed := false
+	for _, sig := range msg.Signals {
+		switch sig.MuxRole {
+		case muxMultiplexor:
+			multiplexors = append(multiplexors, sig)
+		case muxMultiplexed:
+			multiplexed = true
+		}
+	}
+	switch {
+	case !multiplexed:
+		return nil, nil
+	case len(multiplexors) == 0:
+		return nil, fmt.Errorf("message %d has multiplexed signals but no multiplexor", msg.ID)
+	case len(multiplexors) > 1:
+		return nil, fmt.Errorf("message %d has %d multiplexors; only one can be written", msg.ID, len(multiplexors))
+	}
+	return multiplexors[0], nil
+}
+
+// muxValues returns the multiplexor values of the multiplexed signals of msg,
+// each once, in ascending order.
+func muxValues(msg *Message) []int {
+	seen := make(map[int]bool)
+	var values []int
+	for _, sig := range msg.Signals {
+		if sig.MuxRole == muxMultiplexed && !seen[sig.MuxValue] {
+			seen[sig.MuxValue] = true
+			values = append(values, sig.MuxValue)
+		}
+	}
+	sort.Ints(values)
+	return values
+}
+
+// sortedLayerKeys returns the multiplex layers in ascending order, so the
+// signal named in an overlap is the same on every run.
+func sortedLayerKeys(layers map[int]map[int]*Signal) []int {
+	keys := make([]int, 0, len(layers))
+	for k := range layers {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// checkMultiplexing reports messages with multiplexed signals but no
+// multiplexor, and messages with more than one multiplexor, which DBC files
+// can't describe without extended multiplexing. Violations are warnings, or
+// an error when opts.Strict is set.
+func checkMultiplexing(messages map[uint32]*Message, opts Options) error {
+	var violations []string
+	for _, id := range sortedMessageIDs(messages) {
+		var multiplexors, multiplexed []string
+		for _, sig := range messages[id].Signals {
+			switch sig.MuxRole {
+			case muxMultiplexor:
+				multiplexors = append(multiplexors, sig.Name)
+			case muxMultiplexed:
+				multiplexed = append(multiplexed, sig.Name)
+			}
+		}
+		if len(multiplexed) > 0 && len(multiplexors) == 0 {
+			violations = append(violations, fmt.Sprintf("message %d has multiplexed %s %s but no multiplexor",
+				id, plural(len(multiplexed), "signal", "signals"), strings.Join(multiplexed, ", ")))
+		}
+		if len(multiplexors) > 1 {
+			violations = append(violations, fmt.Sprintf("message %d has %d multiplexors (%s); DBC tools expect one",
+				id, len(multiplexors), strings.Join(multiplexors, ", ")))
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	if opts.Strict {
+		return fmt.Errorf("invalid multiplexing: %s", strings.Join(violations, "; "))
+	}
+	for _, violation := range violations {
+		opts.Log.Warnf("%s.", violation)
+	}
+	return nil
+}
@@ -0,0 +1,352 @@
+package refdbc
+
+import (
+	"encoding/csv"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// DefaultNameTemplate produces the message names used when no template is given.
+const DefaultNameTemplate = "CAN_MSG_{{.ID}}"
+
+// messageNameData is the data available to a message name template. The
+// signal fields describe the first signal read for the message.
+type messageNameData struct {
+	ID          uint32 // Message ID in decimal
+	HexID       string // Message ID in upper-case hexadecimal, without a prefix
+	Channel     string // Channel group of the first signal, or else the prefix of its name
+	Prefix      string // Part of the first signal's name before the first underscore
+	FirstSignal string // Name of the first signal
+}
+
+// newMessageNameData fills in the template data for a message from its ID,
+// and the name and group column of its first signal.
+func newMessageNameData(id uint32, signalName, groupColumn string) messageNameData {
+	prefix, _, _ := strings.Cut(signalName, "_")
+	channel := strings.TrimSpace(groupColumn)
+	if channel == "" {
+		channel = prefix
+	}
+	return messageNameData{
+		ID:          id,
+		HexID:       fmt.Sprintf("%X", id),
+		Channel:     channel,
+		Prefix:      prefix,
+		FirstSignal: signalName,
+	}
+}
+
+// ParseNameTemplate compiles a message name template and renders it once with
+// sample data, so mistakes are reported at startup rather than for every message.
+func ParseNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	name, err := renderMessageName(tmpl, newMessageNameData(0x1A0, "GPS_Speed", "GPS"))
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, fmt.Errorf("template produces an empty name")
+	}
+	return tmpl, nil
+}
+
+// renderMessageName executes the template for a message and sanitizes the result.
+func renderMessageName(tmpl *template.Template, data messageNameData) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sanitizeIdentifier(sb.String()), nil
+}
+
+// messageName returns the generated name of a message, falling back to the
+// default CAN_MSG_<id> format when no template is set or rendering fails.
+func messageName(tmpl *template.Template, data messageNameData) string {
+	if tmpl != nil {
+		if name, err := renderMessageName(tmpl, data); err == nil && name != "" {
+			return name
+		}
+	}
+	return fmt.Sprintf("CAN_MSG_%d", data.ID)
+}
+
+// sanitizeIdentifier turns s into a legal DBC identifier by replacing every
+// disallowed character with an underscore and prefixing names that start with a digit.
+// Names that are legal already, as most are, are returned without a copy.
+func sanitizeIdentifier(s string) string {
+	if s == "" || IsValidIdentifier(s) {
+		return s
+	}
+	var sb strings.Builder
+	sb.Grow(len(s) + 1)
+	for i, r := range s {
+		isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r == '_'
+		isDigit := r >= '0' && r <= '9'
+		switch {
+		case isDigit && i == 0:
+			sb.WriteByte('_')
+			sb.WriteRune(r)
+		case isLetter || isDigit:
+			sb.WriteRune(r)
+		default:
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
+
+// NamePolicies lists the accepted values of the -name-policy flag.
+var NamePolicies = []string{"keep", "replace", "strict"}
+
+// IsValidNamePolicy reports whether policy is one of NamePolicies.
+func IsValidNamePolicy(policy string) bool {
+	for _, p := range NamePolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeSignalNames applies opts.NamePolicy to signal names that are not
+// valid DBC identifiers, such as "Speed (km/h)". With "replace" every illegal
+// character becomes an underscore, and a name that then collides with another
+// signal of the message gets a _2, _3... suffix; each rename is logged and, if
+// opts.NameReport is set, added to the report. With "strict" an illegal name is
+// an error. "keep" writes the names unchanged.
+func sanitizeSignalNames(messages map[uint32]*Message, opts Options) error {
+	if opts.NamePolicy == "" || opts.NamePolicy == "keep" {
+		return nil
+	}
+	var report *csv.Writer
+	if opts.NameReport != nil {
+		report = csv.NewWriter(opts.NameReport)
+		defer report.Flush()
+	}
+
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		taken := make(map[string]bool, len(msg.Signals))
+		for _, sig := range msg.Signals {
+			taken[sig.Name] = true
+		}
+		for _, sig := range msg.Signals {
+			if IsValidIdentifier(sig.Name) {
+				continue
+			}
+			if opts.NamePolicy == "strict" {
+				return fmt.Errorf("signal name '%s' in message %d is not a valid DBC identifier (use -name-policy replace to fix it)", sig.Name, id)
+			}
+			newName := sanitizeIdentifier(sig.Name)
+			if newName == "" {
+				newName = "unnamed"
+			}
+			if taken[newName] {
+				newName = uniqueName(newName, taken)
+			}
+			taken[newName] = true
+			opts.Log.Infof("Renamed signal '%s' in message %d to %s (not a valid DBC identifier).", sig.Name, id, newName)
+			if report != nil {
+				report.Write([]string{opts.Source, strconv.FormatUint(uint64(id), 10), sig.Name, newName})
+			}
+			sig.Name = newName
+		}
+	}
+	return nil
+}
+
+// truncateSignalNames shortens signal names longer than opts.MaxNameLength
+// characters, which many DBC tools can't read, to a prefix of the name
+// followed by _ and four hex digits of its hash, such as
+// Combined_Lateral_Accelerati_99FD for a limit of 32. The hash keeps names that
+// only differ after the cut apart; should two still collide, the later one
+// is hashed again. Each signal keeps its name across files, since the hash
+// only depends on the name. Signals sharing a name in a message are
+// shortened alike, leaving the duplicate to checkUniqueNames. Each rename is
+// logged and, if opts.NameReport is set, added to the report.
+func truncateSignalNames(messages map[uint32]*Message, opts Options) {
+	if opts.MaxNameLength <= 0 {
+		return
+	}
+	var report *csv.Writer
+	if opts.NameReport != nil {
+		report = csv.NewWriter(opts.NameReport)
+		defer report.Flush()
+	}
+
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		taken := make(map[string]bool, len(msg.Signals))
+		for _, sig := range msg.Signals {
+			taken[sig.Name] = true
+		}
+		shortened := make(map[string]string)
+		for _, sig := range msg.Signals {
+			if len(sig.Name) <= opts.MaxNameLength {
+				continue
+			}
+			newName, ok := shortened[sig.Name]
+			if !ok {
+				newName = shortName(sig.Name, opts.MaxNameLength, 0)
+				for attempt := 1; taken[newName]; attempt++ {
+					newName = shortName(sig.Name, opts.MaxNameLength, attempt)
+				}
+				taken[newName] = true
+				shortened[sig.Name] = newName
+			}
+			opts.Log.Infof("Shortened signal '%s' in message %d to %s (longer than %d characters).", sig.Name, id, newName, opts.MaxNameLength)
+			if report != nil {
+				report.Write([]string{opts.Source, strconv.FormatUint(uint64(id), 10), sig.Name, newName})
+			}
+			sig.Name = newName
+		}
+	}
+}
+
+// MinMaxNameLength is the smallest name length limit accepted, which leaves
+// room for at least three characters of the name besides the hash.
+const MinMaxNameLength = 8
+
+// shortName cuts name to maxLength characters, ending in _ and four hex
+// digits of the hash of name. Later attempts hash the attempt number too.
+func shortName(name string, maxLength, attempt int) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	if attempt > 0 {
+		fmt.Fprintf(h, "#%d", attempt)
+	}
+	suffix := fmt.Sprintf("_%04X", h.Sum32()&0xFFFF)
+	prefix := strings.TrimRight(name[:maxLength-len(suffix)], "_")
+	return prefix + suffix
+}
+
+// NameReportHeader is the header row of the -name-report CSV file.
+var NameReportHeader = []string{"File", "Message ID", "Original Name", "New Name"}
+
+// DupStrategies lists the accepted values of the -dup flag.
+var DupStrategies = []string{"keep", "error", "rename", "first", "last"}
+
+// IsValidDupStrategy reports whether strategy is one of DupStrategies.
+func IsValidDupStrategy(strategy string) bool {
+	for _, s := range DupStrategies {
+		if s == strategy {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUniqueNames reports message names used by more than one message and
+// signal names used more than once within a message, both of which DBC tools
+// reject. With opts.AutoSuffix each later duplicate, in ID or source order, is
+// renamed by appending _2, _3 and so on; otherwise collisions are warnings, or
+// an error when opts.Strict is set. Duplicate signals are instead handled as
+// opts.DupStrategy says when it is set to anything but keep: error stops,
+// rename appends a suffix, and first or last keeps only that definition.
+func checkUniqueNames(messages map[uint32]*Message, opts Options) error {
+	var collisions []string
+
+	messageIDs := make(map[string][]uint32)
+	takenMessages := make(map[string]bool)
+	for _, id := range sortedMessageIDs(messages) {
+		name := messages[id].Name
+		messageIDs[name] = append(messageIDs[name], id)
+		takenMessages[name] = true
+	}
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		ids := messageIDs[msg.Name]
+		if len(ids) < 2 || ids[0] == id {
+			continue
+		}
+		if opts.AutoSuffix {
+			newName := uniqueName(msg.Name, takenMessages)
+			opts.Log.Warnf("message name %s is also used by message %d; renamed message %d to %s.", msg.Name, ids[0], id, newName)
+			msg.Name = newName
+			continue
+		}
+		collisions = append(collisions, fmt.Sprintf("message name %s is used by messages %d and %d", msg.Name, ids[0], id))
+	}
+
+	strategy := opts.DupStrategy
+	if (strategy == "" || strategy == "keep") && opts.AutoSuffix {
+		strategy = "rename"
+	}
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		first := make(map[string]*Signal)
+		takenSignals := make(map[string]bool)
+		for _, sig := range msg.Signals {
+			takenSignals[sig.Name] = true
+		}
+		var dropped []*Signal
+		for _, sig := range msg.Signals {
+			earlier := first[sig.Name]
+			if earlier == nil {
+				first[sig.Name] = sig
+				continue
+			}
+			conflict := fmt.Sprintf("signal name %s is used more than once in message %d (%s and %s)",
+				sig.Name, id, describeLayout(earlier), describeLayout(sig))
+			switch strategy {
+			case "error":
+				return fmt.Errorf("%s", conflict)
+			case "rename":
+				newName := uniqueName(sig.Name, takenSignals)
+				opts.Log.Warnf("%s; renamed the later one to %s.", conflict, newName)
+				sig.Name = newName
+			case "first":
+				opts.Log.Warnf("%s; keeping the first definition.", conflict)
+				dropped = append(dropped, sig)
+			case "last":
+				opts.Log.Warnf("%s; keeping the last definition.", conflict)
+				dropped = append(dropped, earlier)
+				first[sig.Name] = sig
+			default:
+				collisions = append(collisions, conflict)
+			}
+		}
+		for _, sig := range dropped {
+			removeSignal(msg, sig)
+		}
+	}
+
+	if len(collisions) == 0 {
+		return nil
+	}
+	if opts.Strict {
+		return fmt.Errorf("duplicate names: %s", strings.Join(collisions, "; "))
+	}
+	for _, collision := range collisions {
+		opts.Log.Warnf("%s; some DBC tools will reject the file (use -auto-suffix to rename).", collision)
+	}
+	return nil
+}
+
+// describeLayout summarizes the bit layout of a signal for conflict reports,
+// e.g. "bits 0|16@1+".
+func describeLayout(sig *Signal) string {
+	sign := '+'
+	if sig.IsSigned {
+		sign = '-'
+	}
+	return fmt.Sprintf("bits %d|%d@%d%c", sig.StartBit, sig.Length, sig.ByteOrder, sign)
+}
+
+// uniqueName returns name with the smallest suffix _2, _3... not in taken, and
+// marks the result as taken.
+func uniqueName(name string, taken map[string]bool) string {
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s_%d", name, n)
+		if !taken[candidate] {
+			taken[candidate] = true
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package refdbc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NodeMap holds per-message and per-signal node assignments loaded from a node-map file.
+type NodeMap struct {
+	MessageReceivers     map[uint32][]string            // Receivers for every signal of a message
+	SignalReceivers      map[uint32]map[string][]string // Receivers for individual signals, keyed by message ID and signal name
+	NamedSignalReceivers map[string][]string            // Receivers for signals of a given name in any message
+	MessageTransmitters  map[uint32]string              // Transmitter of a message, replacing the default node
+}
+
+// NewNodeMap creates an empty node map.
+func NewNodeMap() *NodeMap {
+	return &NodeMap{
+		MessageReceivers:     make(map[uint32][]string),
+		SignalReceivers:      make(map[uint32]map[string][]string),
+		NamedSignalReceivers: make(map[string][]string),
+		MessageTransmitters:  make(map[uint32]string),
+	}
+}
+
+// LoadNodeMap reads a node-map file. Each non-blank line that does not start with #
+// has the form `<target> <field> = <value>`, where target is a message ID,
+// `<message ID>.<signal name>`, or a signal name matching that signal in every
+// message, and field is `rx` for the receivers or, for a message, `tx` for
+// its transmitter:
+//
+//	256 rx = Dashboard,Logger
+//	256 tx = GPS_Module
+//	256.Speed rx = ABS
+//	Heading rx = Navigation
+func LoadNodeMap(path string, log *Logger) (*NodeMap, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open node map: %w", err)
+	}
+	defer file.Close()
+
+	nm := NewNodeMap()
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		fields := strings.Fields(key)
+		if !found || len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected '<message ID>[.<signal>] <field> = <value>': %s", lineNum, line)
+		}
+		target, field := fields[0], fields[1]
+		idText, signalName, hasSignal := strings.Cut(target, ".")
+		id, err := strconv.ParseUint(idText, 10, 32)
+		isSignalName := err != nil && !hasSignal && IsValidIdentifier(target)
+		if err != nil && !isSignalName {
+			return nil, fmt.Errorf("line %d: invalid message ID '%s'", lineNum, idText)
+		}
+
+		switch field {
+		case "rx":
+			receivers, err := ParseNodeList(value, log)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			if isSignalName {
+				nm.NamedSignalReceivers[target] = receivers
+			} else if hasSignal {
+				if nm.SignalReceivers[uint32(id)] == nil {
+					nm.SignalReceivers[uint32(id)] = make(map[string][]string)
+				}
+				nm.SignalReceivers[uint32(id)][signalName] = receivers
+			} else {
+				nm.MessageReceivers[uint32(id)] = receivers
+			}
+		case "tx":
+			if isSignalName || hasSignal {
+				return nil, fmt.Errorf("line %d: tx can only be given for a message, not signal '%s'", lineNum, target)
+			}
+			transmitters, err := ParseNodeList(value, log)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			if len(transmitters) != 1 {
+				return nil, fmt.Errorf("line %d: expected one transmitter for message %d but got %d", lineNum, id, len(transmitters))
+			}
+			nm.MessageTransmitters[uint32(id)] = transmitters[0]
+		default:
+			return nil, fmt.Errorf("line %d: unknown field '%s' (expected rx or tx)", lineNum, field)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nm, nil
+}
+
+// GroupNode is the DBC node of a channel group (GPS, IMU, ADC...), from a
+// node-mapping file.
+type GroupNode struct {
+	Node      string   // Transmitter of the messages in the group; empty keeps the default
+	Receivers []string // Receivers of the signals in the group; empty keeps the default
+}
+
+// groupNodeEntry is one group of a node-mapping file, before validation.
+type groupNodeEntry struct {
+	Node      string `json:"node"`
+	Receivers string `json:"receivers"` // Comma-separated node names
+}
+
+// LoadNodeMapping reads a JSON file, or YAML when the name ends in .yaml or
+// .yml, mapping channel groups to the nodes that transmit and receive them.
+// Each value is a node name, or a mapping with a node and comma-separated
+// receivers:
+//
+//	GPS: GPS_Module
+//	IMU:
+//	  node: IMU_Module
+//	  receivers: Logger,Dashboard
+//
+// Group names are matched case-insensitively, with the characters DBC
+// identifiers don't allow replaced by underscores as in signal groups.
+func LoadNodeMapping(path string, log *Logger) (map[string]GroupNode, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open node mapping: %w", err)
+	}
+	if IsYAMLFile(path) {
+		doc, err := ParseYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("node mapping %s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("node mapping %s: %w", path, err)
+		}
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("node mapping %s: %w", path, err)
+	}
+	groups := make(map[string]GroupNode, len(raw))
+	for _, group := range sortedKeys(raw) {
+		var entry groupNodeEntry
+		if err := json.Unmarshal(raw[group], &entry.Node); err != nil {
+			decoder := json.NewDecoder(strings.NewReader(string(raw[group])))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&entry); err != nil {
+				return nil, fmt.Errorf("node mapping %s: group '%s': expected a node name or a mapping of node and receivers: %w", path, group, err)
+			}
+		}
+		var gn GroupNode
+		if entry.Node = strings.TrimSpace(entry.Node); entry.Node != "" {
+			if !IsValidIdentifier(entry.Node) {
+				return nil, fmt.Errorf("node mapping %s: group '%s': node name '%s' is not a valid DBC identifier", path, group, entry.Node)
+			}
+			gn.Node = entry.Node
+		}
+		if gn.Receivers, err = ParseNodeList(entry.Receivers, log); err != nil {
+			return nil, fmt.Errorf("node mapping %s: group '%s': %w", path, group, err)
+		}
+		key := strings.ToLower(sanitizeIdentifier(strings.TrimSpace(group)))
+		if _, ok := groups[key]; ok {
+			return nil, fmt.Errorf("node mapping %s: group '%s' is listed more than once", path, group)
+		}
+		groups[key] = gn
+	}
+	return groups, nil
+}
+
+// messageGroup returns the channel group of msg: that of its first grouped
+// signal, or an empty string if no signal has one.
+func messageGroup(msg *Message) string {
+	for _, sig := range msg.Signals {
+		if sig.Group != "" {
+			return sig.Group
+		}
+	}
+	return ""
+}
+
+// ParseNodeList splits a comma-separated list of node names, validating each one.
+// Duplicate names are dropped with a warning. An empty list yields nil.
+func ParseNodeList(list string, log *Logger) ([]string, error) {
+	var nodes []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !IsValidIdentifier(name) {
+			return nil, fmt.Errorf("node name '%s' is not a valid DBC identifier", name)
+		}
+		if seen[name] {
+			log.Warnf("node %s is listed more than once in '%s'; ignoring the duplicate.", name, list)
+			continue
+		}
+		seen[name] = true
+		nodes = append(nodes, name)
+	}
+	return nodes, nil
+}
+
+// ParseSignalReceivers parses a -signal-receivers specification of the form
+// `signal,node[,node...];signal,node...` into receivers keyed by signal name.
+// A signal listed twice is reported with a warning and the last entry wins.
+func ParseSignalReceivers(spec string, log *Logger) (map[string][]string, error) {
+	receivers := make(map[string][]string)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		signalName, nodeList, found := strings.Cut(entry, ",")
+		signalName = strings.TrimSpace(signalName)
+		if !found || signalName == "" {
+			return nil, fmt.Errorf("expected 'signal,node[,node...]' but got '%s'", entry)
+		}
+		nodes, err := ParseNodeList(nodeList, log)
+		if err != nil {
+			return nil, err
+		}
+		if len(nodes) == 0 {
+			return nil, fmt.Errorf("no receivers given for signal %s", signalName)
+		}
+		if _, exists := receivers[signalName]; exists {
+			log.Warnf("receivers for signal %s are given more than once; using the last entry.", signalName)
+		}
+		receivers[signalName] = nodes
+	}
+	return receivers, nil
+}
+
+// assignTransmitters sets the transmitter of every message that has one in
+// the node map. Other messages get the node of their channel group in
+// opts.GroupNodes or, with opts.GroupTransmitters, a node named after the
+// group. The channel group of a message is that of its first grouped signal.
+// Messages without any of these keep opts.Node. Entries of opts.GroupNodes
+// that match no group in the file are reported with a warning.
+func assignTransmitters(messages map[uint32]*Message, opts Options) {
+	used := make(map[string]bool)
+	for id, msg := range messages {
+		for _, sig := range msg.Signals {
+			used[strings.ToLower(sig.Group)] = true
+		}
+		if opts.NodeMap != nil {
+			if node, ok := opts.NodeMap.MessageTransmitters[id]; ok {
+				msg.Node = node
+				continue
+			}
+		}
+		group := messageGroup(msg)
+		if group == "" {
+			continue
+		}
+		if gn, ok := opts.GroupNodes[strings.ToLower(group)]; ok && gn.Node != "" {
+			msg.Node = gn.Node
+		} else if opts.GroupTransmitters {
+			msg.Node = group
+		}
+	}
+
+	var unused []string
+	for group := range opts.GroupNodes {
+		if !used[group] {
+			unused = append(unused, group)
+		}
+	}
+	sort.Strings(unused)
+	for _, group := range unused {
+		opts.Log.Warnf("node mapping for group %s doesn't match any channel group in the file.", group)
+	}
+}
+
+// assignReceivers sets the receivers of every signal. In the node map, an entry
+// for the signal within its message wins over one for the signal name, which
+// wins over one for the message; all of them win over the receivers of the
+// signal's channel group in opts.GroupNodes, which win over the global
+// -receivers list.
+// Nodes from the global list are dropped when they are the message's own
+// transmitter, and a list left empty becomes Vector__XXX rather than the
+// default node, which may be that transmitter; entries in the node map are
+// used exactly as written.
+func assignReceivers(messages map[uint32]*Message, opts Options) {
+	for id, msg := range messages {
+		for _, sig := range msg.Signals {
+			if opts.NodeMap != nil {
+				if receivers, ok := opts.NodeMap.SignalReceivers[id][sig.Name]; ok {
+					sig.Receivers = receivers
+					continue
+				}
+				if receivers, ok := opts.NodeMap.NamedSignalReceivers[sig.Name]; ok {
+					sig.Receivers = receivers
+					continue
+				}
+				if receivers, ok := opts.NodeMap.MessageReceivers[id]; ok {
+					sig.Receivers = receivers
+					continue
+				}
+			}
+			if gn, ok := opts.GroupNodes[strings.ToLower(sig.Group)]; ok && sig.Group != "" && len(gn.Receivers) > 0 {
+				sig.Receivers = gn.Receivers
+				continue
+			}
+
+			sig.Receivers = nil
+			for _, receiver := range opts.Receivers {
+				if receiver != msg.Node {
+					sig.Receivers = append(sig.Receivers, receiver)
+				}
+			}
+			if len(opts.Receivers) > 0 && len(sig.Receivers) == 0 {
+				sig.Receivers = []string{DefaultNodeName}
+			}
+		}
+	}
+}
+
+// signalReceivers returns the receivers written for a signal, falling back to
+// the given node when the signal has none.
+func signalReceivers(sig *Signal, fallback string) []string {
+	if len(sig.Receivers) == 0 {
+		return []string{fallback}
+	}
+	return sig.Receivers
+}
+
+// collectNodes returns every node referenced by the messages, starting with
+// the default node, in order of first appearance.
+func collectNodes(messages map[uint32]*Message, defaultNode string) []string {
+	nodes := []string{defaultNode}
+	seen := map[string]bool{defaultNode: true}
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			nodes = append(nodes, name)
+		}
+	}
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		add(msg.Node)
+		for _, sig := range msg.Signals {
+			for _, receiver := range sig.Receivers {
+				add(receiver)
+			}
+		}
+	}
+	return nodes
+}
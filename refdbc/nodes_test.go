@@ -0,0 +1,31 @@
+package refdbc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAssignReceiversDropsTransmitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		receivers []string
+		want      []string
+	}{
+		{"no list", nil, nil},
+		{"other nodes", []string{"ECU", "Logger"}, []string{"Logger"}},
+		{"only the transmitter", []string{"ECU"}, []string{DefaultNodeName}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig := &Signal{Name: "Speed"}
+			messages := map[uint32]*Message{0x100: {ID: 0x100, Node: "ECU", Signals: []*Signal{sig}}}
+			opts := DefaultOptions()
+			opts.Node = "ECU"
+			opts.Receivers = tt.receivers
+			assignReceivers(messages, opts)
+			if !reflect.DeepEqual(sig.Receivers, tt.want) {
+				t.Errorf("receivers = %q, want %q", sig.Receivers, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package refdbc
+
+import "strconv"
+
+// FloatFormats lists the accepted values of the -float-format flag, naming how
+// factors, offsets and ranges are written.
+var FloatFormats = []string{"shortest", "fixed", "max-digits"}
+
+// IsValidFloatFormat reports whether format is one of FloatFormats.
+func IsValidFloatFormat(format string) bool {
+	for _, f := range FloatFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultFloatDigits is the number of significant digits kept by the
+// max-digits float format unless opts.FloatDigits says otherwise.
+const DefaultFloatDigits = 15
+
+// formatFloat renders a factor, offset or range value in opts.FloatFormat:
+//
+//   - shortest: the shortest decimal that reads back as the same float64,
+//     with an exponent for very small or large values (3.0517578125e-05).
+//   - fixed: the same digits, always in plain decimal notation
+//     (0.000030517578125), for consumers that reject exponents.
+//   - max-digits: plain decimal notation rounded to opts.FloatDigits
+//     significant digits, dropping binary noise such as 0.30000000000000004.
+//
+// Negative zero, which unit conversions and range derivation can produce, is
+// written as 0 so the output doesn't depend on how a zero was computed.
+func formatFloat(f float64, opts Options) string {
+	if f == 0 {
+		f = 0
+	}
+	switch opts.FloatFormat {
+	case "fixed":
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	case "max-digits":
+		digits := opts.FloatDigits
+		if digits <= 0 {
+			digits = DefaultFloatDigits
+		}
+		rounded, _ := strconv.ParseFloat(strconv.FormatFloat(f, 'g', digits, 64), 64)
+		return strconv.FormatFloat(rounded, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,66 @@
+package refdbc
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// tenth and fifth are variables so that tenth+fifth is computed in float64,
+// not folded exactly as an untyped constant.
+var tenth, fifth = 0.1, 0.2
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		f      float64
+		format string
+		digits int
+		want   string
+	}{
+		{0.01, "shortest", 0, "0.01"},
+		{655.35, "shortest", 0, "655.35"},
+		{-0.5, "shortest", 0, "-0.5"},
+		{3.0517578125e-05, "shortest", 0, "3.0517578125e-05"},
+		{1e21, "shortest", 0, "1e+21"},
+		{math.Copysign(0, -1), "shortest", 0, "0"},
+		{tenth + fifth, "shortest", 0, "0.30000000000000004"},
+
+		{3.0517578125e-05, "fixed", 0, "0.000030517578125"},
+		{1e21, "fixed", 0, "1000000000000000000000"},
+		{-40, "fixed", 0, "-40"},
+		{math.Copysign(0, -1), "fixed", 0, "0"},
+
+		{tenth + fifth, "max-digits", 0, "0.3"},
+		{3.0517578125e-05, "max-digits", 0, "0.000030517578125"},
+		{3.0517578125e-05, "max-digits", 4, "0.00003052"},
+		{655.35, "max-digits", 3, "655"},
+		{math.Copysign(0, -1), "max-digits", 0, "0"},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.FloatFormat = tt.format
+		if tt.digits != 0 {
+			opts.FloatDigits = tt.digits
+		}
+		if got := formatFloat(tt.f, opts); got != tt.want {
+			t.Errorf("formatFloat(%v) with %s %d = %s, want %s", tt.f, tt.format, tt.digits, got, tt.want)
+		}
+	}
+}
+
+// TestFormatFloatRoundTrip checks that the shortest and fixed formats read
+// back as the same float64.
+func TestFormatFloatRoundTrip(t *testing.T) {
+	values := []float64{3.0517578125e-05, 0.00244140625, tenth + fifth, 1.0 / 3, 655.35, -1e-10, 1.8446744073709552e19, math.SmallestNonzeroFloat64}
+	for _, format := range []string{"shortest", "fixed"} {
+		opts := DefaultOptions()
+		opts.FloatFormat = format
+		for _, f := range values {
+			text := formatFloat(f, opts)
+			back, err := strconv.ParseFloat(text, 64)
+			if err != nil || back != f {
+				t.Errorf("%s: %v written as %s reads back as %v (%v)", format, f, text, back, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package refdbc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MessageOverride patches the fields of a parsed message. Nil fields are left unchanged.
+type MessageOverride struct {
+	Name      *string
+	Comment   *string
+	CycleTime *int                       // Transmission period in milliseconds
+	Signals   map[string]*SignalOverride // Keyed by the signal name in the .ref file
+}
+
+// SignalOverride patches the fields of a parsed signal. Nil fields are left unchanged.
+type SignalOverride struct {
+	Name    *string
+	Unit    *string
+	Comment *string
+	Factor  *float64
+	Offset  *float64
+	Min     *float64
+	Max     *float64
+	Type    *string            // signed, unsigned, float or double, as in the type column
+	Values  []ValueDescription // Labels added to the signal's value table, replacing those of the same value
+}
+
+// LoadOverrides reads a JSON file of metadata to patch onto the parsed messages,
+// keyed by message ID and then by signal name:
+//
+//	{
+//	  "256": {
+//	    "name": "VehicleSpeed",
+//	    "cycle_time": 100,
+//	    "signals": {
+//	      "Speed": {"unit": "km/h", "comment": "GPS speed", "min": 0, "max": 300}
+//	    }
+//	  }
+//	}
+//
+// Files ending in .yaml or .yml are read as YAML with the same structure (see
+// ParseYAML for the subset accepted):
+//
+//	256:
+//	  name: VehicleSpeed
+//	  signals:
+//	    Speed:
+//	      unit: km/h
+//
+// Unknown keys are reported with a warning so typos are caught, but don't stop
+// the file from loading.
+func LoadOverrides(path string, log *Logger) (map[uint32]*MessageOverride, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open overrides file: %w", err)
+	}
+	if IsYAMLFile(path) {
+		doc, err := ParseYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("overrides file %s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("overrides file %s: %w", path, err)
+		}
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("overrides file %s: %w", path, err)
+	}
+	overrides := make(map[uint32]*MessageOverride, len(raw))
+	for _, key := range sortedKeys(raw) {
+		id, err := strconv.ParseUint(key, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("overrides file %s: invalid message ID '%s'", path, key)
+		}
+		override := &MessageOverride{}
+		var signals map[string]json.RawMessage
+		where := fmt.Sprintf("message %d", id)
+		err = decodeOverride(raw[key], where, map[string]interface{}{
+			"name":       &override.Name,
+			"comment":    &override.Comment,
+			"cycle_time": &override.CycleTime,
+			"signals":    &signals,
+		}, log)
+		if err != nil {
+			return nil, fmt.Errorf("overrides file %s: %w", path, err)
+		}
+		if override.CycleTime != nil && *override.CycleTime < 0 {
+			return nil, fmt.Errorf("overrides file %s: %s: cycle time %d is negative", path, where, *override.CycleTime)
+		}
+		if override.Name != nil && !IsValidIdentifier(*override.Name) {
+			return nil, fmt.Errorf("overrides file %s: %s: name '%s' is not a valid DBC identifier", path, where, *override.Name)
+		}
+
+		override.Signals = make(map[string]*SignalOverride, len(signals))
+		for _, name := range sortedKeys(signals) {
+			sig := &SignalOverride{}
+			var values map[string]string
+			sigWhere := fmt.Sprintf("signal %s of %s", name, where)
+			err := decodeOverride(signals[name], sigWhere, map[string]interface{}{
+				"name":    &sig.Name,
+				"unit":    &sig.Unit,
+				"comment": &sig.Comment,
+				"factor":  &sig.Factor,
+				"offset":  &sig.Offset,
+				"min":     &sig.Min,
+				"max":     &sig.Max,
+				"type":    &sig.Type,
+				"values":  &values,
+			}, log)
+			if err != nil {
+				return nil, fmt.Errorf("overrides file %s: %w", path, err)
+			}
+			for valueText, label := range values {
+				value, err := strconv.ParseInt(valueText, 0, 64)
+				if err != nil {
+					return nil, fmt.Errorf("overrides file %s: %s: invalid value '%s'", path, sigWhere, valueText)
+				}
+				sig.Values = append(sig.Values, ValueDescription{Value: value, Label: label})
+			}
+			sortValueTable(sig.Values)
+			if sig.Type != nil {
+				if _, _, ok := parseSignalType(*sig.Type); !ok {
+					return nil, fmt.Errorf("overrides file %s: %s: unknown type '%s' (expected signed, unsigned, float or double)", path, sigWhere, *sig.Type)
+				}
+			}
+			if sig.Name != nil && !IsValidIdentifier(*sig.Name) {
+				return nil, fmt.Errorf("overrides file %s: %s: name '%s' is not a valid DBC identifier", path, sigWhere, *sig.Name)
+			}
+			override.Signals[name] = sig
+		}
+		overrides[uint32(id)] = override
+	}
+	return overrides, nil
+}
+
+// IsYAMLFile reports whether path names a YAML file, judging by its extension.
+func IsYAMLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// decodeOverride decodes the JSON object data into the targets of fields, keyed
+// by JSON key. Keys without a target are reported as unknown with a warning.
+func decodeOverride(data json.RawMessage, where string, fields map[string]interface{}, log *Logger) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%s: %w", where, err)
+	}
+	for _, key := range sortedKeys(raw) {
+		target, ok := fields[key]
+		if !ok {
+			log.Warnf("overrides for %s: unknown key '%s'; ignoring it.", where, key)
+			continue
+		}
+		if err := json.Unmarshal(raw[key], target); err != nil {
+			return fmt.Errorf("%s: invalid %s: %w", where, key, err)
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// applyOverrides patches opts.Overrides onto the parsed messages. Overrides
+// for messages or signals that aren't in the file, and signal names already
+// used in the message, are reported with a warning.
+func applyOverrides(messages map[uint32]*Message, opts Options) {
+	ids := make([]uint32, 0, len(opts.Overrides))
+	for id := range opts.Overrides {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		override := opts.Overrides[id]
+		msg, ok := messages[id]
+		if !ok {
+			opts.Log.Warnf("overrides for message %d don't match any message in the file.", id)
+			continue
+		}
+		if override.Name != nil {
+			msg.Name = *override.Name
+		}
+		if override.Comment != nil {
+			msg.Comment = *override.Comment
+		}
+		if override.CycleTime != nil {
+			msg.CycleTime = *override.CycleTime
+		}
+
+		names := make([]string, 0, len(override.Signals))
+		for name := range override.Signals {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			sig := findSignal(msg, name)
+			if sig == nil {
+				opts.Log.Warnf("overrides for signal %s of message %d don't match any signal in the file.", name, id)
+				continue
+			}
+			applySignalOverride(msg, sig, override.Signals[name], opts)
+		}
+	}
+}
+
+// applySignalOverride patches one signal of msg.
+func applySignalOverride(msg *Message, sig *Signal, override *SignalOverride, opts Options) {
+	if override.Name != nil && *override.Name != sig.Name {
+		if findSignal(msg, *override.Name) != nil {
+			opts.Log.Warnf("cannot rename signal %s in message %d to '%s' (name already used in this message).", sig.Name, msg.ID, *override.Name)
+		} else {
+			sig.Name = *override.Name
+		}
+	}
+	if override.Unit != nil {
+		sig.Unit = *override.Unit
+	}
+	if override.Comment != nil {
+		sig.Comment = *override.Comment
+	}
+	if override.Factor != nil {
+		sig.Factor = *override.Factor
+	}
+	if override.Offset != nil {
+		sig.Offset = *override.Offset
+	}
+	if override.Min != nil {
+		sig.Min = *override.Min
+	}
+	if override.Max != nil {
+		sig.Max = *override.Max
+	}
+	if override.Type != nil {
+		valueType, signed, _ := parseSignalType(*override.Type)
+		if expected := ieeeLength(valueType); expected != 0 && sig.Length != expected {
+			opts.Log.Warnf("cannot make signal %s in message %d a %s: it is %d bits long, not %d.", sig.Name, msg.ID, valueTypeNames[valueType], sig.Length, expected)
+		} else {
+			sig.ValueType, sig.IsSigned = valueType, signed
+		}
+	}
+	if len(override.Values) > 0 {
+		sig.ValueTable = mergeValueTable(sig.ValueTable, override.Values)
+	}
+}
@@ -0,0 +1,417 @@
+package refdbc
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// signalParser builds structured Messages from signal lines fed to it one at a
+// time, so the decompressed entries of a file never need to be held in memory together.
+type signalParser struct {
+	opts     Options
+	messages map[uint32]*Message
+
+	delimiter  string              // Field separator; empty until detected when opts.Delimiter is "auto"
+	fields     []string            // Fields of the current line, reused for every line
+	signals    []Signal            // Block the next signals are allocated from, signalBlockSize at a time
+	seen       map[string]position // Where each signal line parsed so far was first found, to report repeats
+	skipped    int                 // Lines skipped because they could not be parsed
+	duplicates int                 // Lines that repeat an earlier line exactly
+}
+
+// signalBlockSize is how many Signals the parser allocates at once, rather
+// than one allocation per line.
+const signalBlockSize = 64
+
+// newSignalParser creates a parser with an empty message map.
+func newSignalParser(opts Options) *signalParser {
+	delimiter := opts.Delimiter
+	if delimiter == "auto" {
+		delimiter = ""
+	}
+	return &signalParser{
+		opts:      opts,
+		delimiter: delimiter,
+		messages:  make(map[uint32]*Message),
+		seen:      make(map[string]position),
+	}
+}
+
+// parseEntry parses the signal lines of one decompressed entry, numbering
+// them from 1 within it. The entry is copied to a string once and each line
+// is a slice of it, so lines don't need a copy of their own.
+func (p *signalParser) parseEntry(data []byte, entry int) error {
+	text := string(data)
+	for line, offset := 1, 0; offset < len(text); line++ {
+		advance, token, _ := scanRecords(data[offset:], true)
+		record := text[offset : offset+len(token)]
+		offset += advance
+		if strings.TrimSpace(record) == "" {
+			continue
+		}
+		if err := p.parseLine(record, position{Entry: entry, Line: line}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseLine converts one raw CSV-like line into a Signal and adds it to its Message.
+// Every message is assigned opts.Node as its transmitter. Signals with an invalid
+// bit layout are skipped with a warning, or rejected with an error when opts.Strict
+// is set. pos is the line's position in the input, used in log events and errors.
+func (p *signalParser) parseLine(line string, pos position) error {
+	log := p.opts.Log
+
+	// Comment lines are not signals.
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "//") {
+		log.debugAt(pos, "skipping comment: %s", line)
+		return nil
+	}
+
+	if p.delimiter == "" {
+		p.delimiter = detectDelimiter(line)
+		log.debugAt(pos, "detected field delimiter %q", p.delimiter)
+	}
+
+	// Clean up trailing delimiters and split
+	p.fields = splitFields(p.fields, strings.Trim(line, " \t"+p.delimiter), p.delimiter)
+	parts := p.fields
+	if isColumnHeader(parts) {
+		log.debugAt(pos, "skipping column header: %s", line)
+		return nil
+	}
+	if len(parts) < 11 {
+		log.warnAt(pos, "skipping malformed line (not enough fields): %s", line)
+		p.skipped++
+		return nil
+	}
+
+	// Exports sometimes repeat a signal line. The copy is parsed like any
+	// other line, so the repeated signal name is resolved by -dup.
+	if first, ok := p.seen[trimmed]; ok {
+		log.warnAt(pos, "line repeats %s exactly; -dup decides which copy is written: %s", first, line)
+		p.duplicates++
+	} else {
+		p.seen[trimmed] = pos
+	}
+
+	// Parse all parts, converting to correct types
+	msgID, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		log.warnAt(pos, "skipping line (invalid message ID): %s", line)
+		p.skipped++
+		return nil
+	}
+	if msgID > maxExtendedID {
+		log.warnAt(pos, "skipping line (message ID %d is larger than the 29-bit maximum 0x%X): %s", msgID, maxExtendedID, line)
+		p.skipped++
+		return nil
+	}
+
+	startBit, startBitErr := strconv.Atoi(parts[3])
+	length, lengthErr := strconv.Atoi(parts[4])
+	offset, _ := strconv.ParseFloat(parts[5], 64)
+	factor, _ := strconv.ParseFloat(parts[6], 64)
+	// Racelogic exports put the maximum before the minimum; -minmax-order
+	// min-first reads hand-edited files that use the conventional order.
+	maxColumn, minColumn := 7, 8
+	if p.opts.MinMaxOrder == "min-first" {
+		maxColumn, minColumn = 8, 7
+	}
+	max, _ := strconv.ParseFloat(parts[maxColumn], 64)
+	min, _ := strconv.ParseFloat(parts[minColumn], 64)
+	// The type column is usually signed/unsigned, but IEEE floating point
+	// channels carry float or double instead. Anything else is unsigned.
+	valueType, isSigned, _ := parseSignalType(parts[9])
+	var byteOrder byte = 0 // Default to Motorola (big-endian)
+	if strings.EqualFold(parts[10], "intel") {
+		byteOrder = 1 // Intel (little-endian)
+	}
+
+	var dlc int
+	if len(parts) >= 12 {
+		dlc, err = strconv.Atoi(parts[11])
+		if err != nil {
+			// If DLC is present but not a valid number, warn and default to 8.
+			log.warnAt(pos, "invalid DLC '%s', assuming 8. Line: %s", parts[11], line)
+			dlc = 8
+		}
+	} else {
+		// DLC is missing, assume default of 8 and notify user.
+		log.warnAt(pos, "missing DLC field, assuming default of 8.")
+		dlc = 8
+	}
+	// CAN FD payloads grow in steps above 8 bytes, so sizes in between are
+	// rounded up to the next one.
+	if dlc < 0 || dlc > maxDLC {
+		log.warnAt(pos, "invalid DLC %d (payloads are 0 to %d bytes), assuming 8. Line: %s", dlc, maxDLC, line)
+		dlc = 8
+	} else if !isValidDLC(dlc) {
+		log.warnAt(pos, "DLC %d is not a CAN FD payload size, using %d. Line: %s", dlc, grownDLC(dlc), line)
+		dlc = grownDLC(dlc)
+	}
+
+	// Validate the bit layout before the signal is added to its message. Only
+	// the largest payload bounds the start bit here: the message's DLC is not
+	// settled until -dlc-policy has seen every line, so checkOverlaps reports
+	// signals reaching past it.
+	var layoutProblem string
+	switch {
+	case startBitErr != nil:
+		layoutProblem = fmt.Sprintf("invalid start bit '%s'", parts[3])
+	case lengthErr != nil:
+		layoutProblem = fmt.Sprintf("invalid length '%s'", parts[4])
+	case length < 1 || length > 64:
+		layoutProblem = fmt.Sprintf("length %d is outside the range 1-64", length)
+	case startBit < 0:
+		layoutProblem = fmt.Sprintf("start bit %d is negative", startBit)
+	case startBit >= maxDLC*8:
+		layoutProblem = fmt.Sprintf("start bit %d is outside the %d bits of a %d-byte payload", startBit, maxDLC*8, maxDLC)
+	}
+	// Motorola start bits may need converting to DBC's numbering.
+	if layoutProblem == "" && byteOrder == 0 {
+		converted := motorolaStartBit(startBit, length, p.opts.BitConvention)
+		if converted < 0 || converted >= maxDLC*8 {
+			layoutProblem = fmt.Sprintf("start bit %d in %s numbering has no DBC equivalent inside a payload", startBit, p.opts.BitConvention)
+		} else {
+			startBit = converted
+		}
+	}
+	if layoutProblem != "" {
+		if p.opts.Strict {
+			return fmt.Errorf("%s: %s: %s", pos, layoutProblem, line)
+		}
+		log.warnAt(pos, "skipping line (%s): %s", layoutProblem, line)
+		p.skipped++
+		return nil
+	}
+
+	// IEEE values are only meaningful at their native width.
+	if expected := ieeeLength(valueType); expected != 0 && length != expected {
+		log.warnAt(pos, "declares a %s signal with length %d (expected %d): %s", valueTypeNames[valueType], length, expected, line)
+	}
+
+	// Newer exports add a free-text description of the signal as a 13th column,
+	// and may carry a description of the message as a 14th, the channel group
+	// (GPS, IMU, ADC...) as a 15th and, for signals split across two messages,
+	// the part flag (MSW or LSW) as a 16th. A 17th column may label the raw
+	// values of an enumerated signal, as in `0=Off|1=On`, an 18th gives
+	// the transmission period of the message in milliseconds and a 19th marks
+	// multiplexing, as M for the multiplexor or m<value> for a signal sent
+	// when the multiplexor has that value.
+	var signalComment, messageComment, groupColumn, part string
+	var valueTable []ValueDescription
+	var cycleTime, muxValue int
+	var muxRole byte
+	if len(parts) >= 13 {
+		signalComment = strings.TrimSpace(parts[12])
+	}
+	if len(parts) >= 14 {
+		messageComment = strings.TrimSpace(parts[13])
+	}
+	if len(parts) >= 15 {
+		groupColumn = parts[14]
+	}
+	if len(parts) >= 16 {
+		switch flag := strings.ToUpper(strings.TrimSpace(parts[15])); flag {
+		case "", partMSW, partLSW:
+			part = flag
+		default:
+			log.warnAt(pos, "unknown part flag '%s', treating the signal as whole: %s", parts[15], line)
+		}
+	}
+	if len(parts) >= 17 {
+		var err error
+		if valueTable, err = parseValueTable(parts[16]); err != nil {
+			log.warnAt(pos, "ignoring the value table (%v): %s", err, line)
+		}
+	}
+	if len(parts) >= 18 && strings.TrimSpace(parts[17]) != "" {
+		var err error
+		if cycleTime, err = strconv.Atoi(strings.TrimSpace(parts[17])); err != nil || cycleTime < 0 {
+			log.warnAt(pos, "ignoring the invalid cycle time '%s': %s", parts[17], line)
+			cycleTime = 0
+		}
+	}
+	if len(parts) >= 19 {
+		var err error
+		if muxRole, muxValue, err = parseMuxMarker(parts[18]); err != nil {
+			log.warnAt(pos, "treating the signal as not multiplexed (%v): %s", err, line)
+		}
+	}
+
+	// If message doesn't exist in our map, create it
+	if _, ok := p.messages[uint32(msgID)]; !ok {
+		p.messages[uint32(msgID)] = &Message{
+			ID:   uint32(msgID),
+			Name: messageName(p.opts.NameTemplate, newMessageNameData(uint32(msgID), parts[0], groupColumn)),
+			DLC:  dlc,
+			Node: p.opts.Node,
+
+			IsExtended: msgID > maxStandardID,
+
+			// Room for the signals of most messages, so the slice rarely grows.
+			Signals: make([]*Signal, 0, 8),
+		}
+	} else if dlc != p.messages[uint32(msgID)].DLC {
+		// If message already exists, the DLC policy decides between conflicting values.
+		if err := p.resolveDLC(p.messages[uint32(msgID)], dlc, parts[0], pos); err != nil {
+			return err
+		}
+	}
+
+	// Create the signal
+	if len(p.signals) == cap(p.signals) {
+		p.signals = make([]Signal, 0, signalBlockSize)
+	}
+	p.signals = append(p.signals, Signal{
+		Name:      parts[0],
+		Unit:      parts[2],
+		StartBit:  startBit,
+		Length:    length,
+		Offset:    offset,
+		Factor:    factor,
+		Max:       max,
+		Min:       min,
+		IsSigned:  isSigned,
+		ValueType: valueType,
+		ByteOrder: byteOrder,
+		Comment:   signalComment,
+		Group:     signalGroupName(groupColumn, parts[0], p.opts),
+		Part:      part,
+		MuxRole:   muxRole,
+		MuxValue:  muxValue,
+		pos:       pos,
+		dlc:       dlc,
+
+		ValueTable: valueTable,
+	})
+	signal := &p.signals[len(p.signals)-1]
+	if p.opts.Comments == "full" {
+		signal.provenance = signalProvenance(p.opts.Source, pos, line)
+	}
+
+	// The first description found for a message is kept.
+	if messageComment != "" && p.messages[uint32(msgID)].Comment == "" {
+		p.messages[uint32(msgID)].Comment = messageComment
+	}
+	// So is the first cycle time; a different one is only reported.
+	if msg := p.messages[uint32(msgID)]; cycleTime > 0 && msg.CycleTime == 0 {
+		msg.CycleTime = cycleTime
+	} else if cycleTime > 0 && cycleTime != msg.CycleTime {
+		log.warnAt(pos, "cycle time %d ms differs from the %d ms given earlier for message %d; keeping %d ms: %s", cycleTime, msg.CycleTime, msgID, msg.CycleTime, line)
+	}
+
+	// Add signal to its parent message
+	p.messages[uint32(msgID)].Signals = append(p.messages[uint32(msgID)].Signals, signal)
+	return nil
+}
+
+// parseSignalLines converts the raw CSV-like lines into a map of structured Messages.
+func parseSignalLines(lines []string, opts Options) (map[uint32]*Message, error) {
+	p := newSignalParser(opts)
+	for i, line := range lines {
+		if err := p.parseLine(line, position{Line: i + 1}); err != nil {
+			return p.messages, err
+		}
+	}
+	return p.messages, nil
+}
+
+// delimiterCandidates are the field separators tried by detectDelimiter, in order of preference.
+var delimiterCandidates = []string{",", ";", "\t"}
+
+// detectDelimiter picks the field separator of a signal line: the first of
+// delimiterCandidates that splits it into enough fields for a signal, or
+// otherwise the one giving the most fields.
+func detectDelimiter(line string) string {
+	best, bestFields := delimiterCandidates[0], 0
+	for _, delimiter := range delimiterCandidates {
+		fields := len(strings.Split(strings.Trim(line, " \t"+delimiter), delimiter))
+		if fields >= 11 {
+			return delimiter
+		}
+		if fields > bestFields {
+			best, bestFields = delimiter, fields
+		}
+	}
+	return best
+}
+
+// ParseDelimiter converts a -delimiter value to a field separator: a single
+// character, "tab" or "\t" for a tab, or "auto" to detect it per file.
+func ParseDelimiter(value string) (string, error) {
+	switch value {
+	case "auto":
+		return value, nil
+	case "tab", `\t`:
+		return "\t", nil
+	}
+	if utf8.RuneCountInString(value) != 1 || value == " " {
+		return "", fmt.Errorf("expected a single character, 'tab' or 'auto', got '%s'", value)
+	}
+	return value, nil
+}
+
+// splitFields splits s around each instance of sep like strings.Split, but
+// appends the fields to dst[:0], so one slice serves every line.
+func splitFields(dst []string, s, sep string) []string {
+	dst = dst[:0]
+	for {
+		i := strings.Index(s, sep)
+		if i < 0 {
+			return append(dst, s)
+		}
+		dst = append(dst, s[:i])
+		s = s[i+len(sep):]
+	}
+}
+
+// isColumnHeader reports whether the fields of a line are a column header row
+// such as "Name,ID,Unit,Start,Length,...". To avoid dropping real data with a
+// single typo, the ID, start bit and length fields must all be non-numeric.
+func isColumnHeader(parts []string) bool {
+	if len(parts) < 5 {
+		return false
+	}
+	for _, field := range []string{parts[1], parts[3], parts[4]} {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(field), 64); err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// utf8BOM is the byte order mark some editors put at the start of UTF-8 text.
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// scanRecords is a bufio.SplitFunc like bufio.ScanLines, except that a lone \r
+// also ends a record, as in files written by old Mac tools. \r\n and \n
+// endings split exactly as with bufio.ScanLines.
+func scanRecords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// A \r may be the first half of \r\n, so the next byte decides.
+		switch {
+		case i+1 < len(data) && data[i+1] == '\n':
+			return i + 2, data[:i], nil
+		case i+1 < len(data) || atEOF:
+			return i + 1, data[:i], nil
+		}
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
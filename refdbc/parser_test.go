@@ -0,0 +1,253 @@
+package refdbc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestIsColumnHeader(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"Name,ID,Unit,Start,Length,Offset,Factor,Max,Min,Type,Order,DLC", true},
+		{"name,id,unit,startbit,length,offset,factor,max,min,sign,endian,dlc,comment", true},
+		{"Signal,Message ID,Unit,Start Bit,Bits", true},
+		{"Speed,256,km/h,0,16,0,0.01,655.35,0,unsigned,Intel,8", false},
+		{"Speed,0x100,km/h,0,16,0,0.01,655.35,0,unsigned,Intel,8", false},
+		{"Speed,256,km/h,start,16,0,0.01,655.35,0,unsigned,Intel,8", false},
+		{"Speed,ID,km/h,Start,Length,0,0.01,655.35,0,unsigned,Intel,8", true},
+		{"Speed,256,km/h,Start,Length,0,0.01,655.35,0,unsigned,Intel,8", false},
+		{"Name,ID,Unit,Start", false},
+	}
+	for _, tt := range tests {
+		if got := isColumnHeader(strings.Split(tt.line, ",")); got != tt.want {
+			t.Errorf("isColumnHeader(%q) = %t, want %t", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestColumnHeaderSkipped(t *testing.T) {
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.Log = NewLogger(&log, "text", LevelWarn)
+	p := newSignalParser(opts)
+	lines := []string{
+		"Name,ID,Unit,Start,Length,Offset,Factor,Max,Min,Type,Order,DLC",
+		"Speed,256,km/h,0,16,0,0.01,655.35,0,unsigned,Intel,8",
+		"Heading,256,deg,16,16,0,0.01,360,0,unsigned,Intel,8",
+	}
+	for i, line := range lines {
+		if err := p.parseLine(line, position{Line: i + 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if log.Len() != 0 {
+		t.Errorf("warnings:\n%s", log.String())
+	}
+	if n := len(p.messages[256].Signals); n != 2 {
+		t.Errorf("%d signals, want 2", n)
+	}
+}
+
+func TestMinMaxOrder(t *testing.T) {
+	tests := []struct {
+		order string
+		line  string
+	}{
+		{"max-first", "Temp,256,degC,0,16,0,0.1,150,-40,signed,Intel,8"},
+		{"min-first", "Temp,256,degC,0,16,0,0.1,-40,150,signed,Intel,8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.MinMaxOrder = tt.order
+			messages, err := parseSignalLines([]string{tt.line}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out strings.Builder
+			if err := WriteDBCWithOptions(&Database{Messages: messages}, &out, opts); err != nil {
+				t.Fatal(err)
+			}
+			if want := ` SG_ Temp : 0|16@1- (0.1,0) [-40|150] "degC" Vector__XXX`; !strings.Contains(out.String(), want) {
+				t.Errorf("no line %q in:\n%s", want, out.String())
+			}
+		})
+	}
+}
+
+func TestScanRecords(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"crlf", "a,1\r\nb,2\r\n", []string{"a,1", "b,2"}},
+		{"lf", "a,1\nb,2\n", []string{"a,1", "b,2"}},
+		{"lone cr", "a,1\rb,2\r", []string{"a,1", "b,2"}},
+		{"mixed", "a,1\r\nb,2\nc,3\rd,4", []string{"a,1", "b,2", "c,3", "d,4"}},
+		{"blank lines", "a,1\r\n\r\n\n\rb,2", []string{"a,1", "", "", "", "b,2"}},
+		{"no final line break", "a,1", []string{"a,1"}},
+		{"bom", "\xEF\xBB\xBFa,1\r\nb,2", []string{"\xEF\xBB\xBFa,1", "b,2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Reading a byte at a time splits \r\n across reads.
+			for _, r := range []io.Reader{strings.NewReader(tt.text), iotest.OneByteReader(strings.NewReader(tt.text))} {
+				scanner := bufio.NewScanner(r)
+				scanner.Split(scanRecords)
+				var got []string
+				for scanner.Scan() {
+					got = append(got, scanner.Text())
+				}
+				if err := scanner.Err(); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("records %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseREFByteOrderMark(t *testing.T) {
+	ref := refBuilder{Serial: "SN 123456", Entries: []string{
+		"\xEF\xBB\xBFSpeed,256,km/h,0,16,0,0.01,655.35,0,unsigned,Intel,8\rHeading,256,deg,16,16,0,0.01,360,0,unsigned,Intel,8\r",
+	}}.build(t)
+	db, err := ParseREF(bytes.NewReader(ref))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, sig := range db.Messages[256].Signals {
+		names = append(names, sig.Name)
+	}
+	if want := []string{"Speed", "Heading"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("signals %q, want %q", names, want)
+	}
+}
+
+func TestDetectDelimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"comma", "Speed,256,km/h,0,16,0,0.01,655.35,0,unsigned,Intel,8", ","},
+		{"semicolon", "Speed;256;km/h;0;16;0;0.01;655.35;0;unsigned;Intel;8", ";"},
+		{"semicolon with decimal commas", "Speed;256;km/h;0;16;0;0,01;655,35;0;unsigned;Intel;8", ";"},
+		{"tab", "Speed\t256\tkm/h\t0\t16\t0\t0.01\t655.35\t0\tunsigned\tIntel\t8", "\t"},
+		{"trailing delimiter", "Speed;256;km/h;0;16;0;0.01;655.35;0;unsigned;Intel;", ";"},
+		{"comma in a comment", "Speed;256;km/h;0;16;0;0.01;655.35;0;unsigned;Intel;8;Speed, filtered", ";"},
+		{"too few fields", "Speed;256;km/h", ";"},
+		{"no delimiter", "Speed", ","},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectDelimiter(tt.line); got != tt.want {
+				t.Errorf("detectDelimiter(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{",", ",", true},
+		{";", ";", true},
+		{"|", "|", true},
+		{"tab", "\t", true},
+		{`\t`, "\t", true},
+		{"\t", "\t", true},
+		{"auto", "auto", true},
+		{"", "", false},
+		{" ", "", false},
+		{",;", "", false},
+		{"comma", "", false},
+	}
+	for _, tt := range tests {
+		got, err := ParseDelimiter(tt.value)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseDelimiter(%q) = %q, %v; want %q, ok %t", tt.value, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAutoDelimiter(t *testing.T) {
+	for _, delimiter := range []string{",", ";", "\t"} {
+		lines := []string{
+			strings.ReplaceAll("Speed,256,km/h,0,16,0,0.01,655.35,0,unsigned,Intel,8", ",", delimiter),
+			strings.ReplaceAll("Heading,256,deg,16,16,0,0.01,360,0,unsigned,Intel,8", ",", delimiter),
+		}
+		for _, setting := range []string{"auto", delimiter} {
+			opts := DefaultOptions()
+			opts.Delimiter = setting
+			messages, err := parseSignalLines(lines, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg := messages[256]; msg == nil || len(msg.Signals) != 2 || msg.Signals[1].Max != 360 {
+				t.Errorf("-delimiter %q on %q-separated lines: messages %v", setting, delimiter, messages)
+			}
+		}
+	}
+}
+
+const speedLine = "Speed,256,km/h,0,16,0,0.01,655.35,0,unsigned,Intel,8"
+
+func TestRepeatedLineUsesDupStrategy(t *testing.T) {
+	tests := []struct {
+		strategy string
+		signals  int
+	}{
+		{"keep", 2},
+		{"first", 1},
+		{"last", 1},
+		{"rename", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.DupStrategy = tt.strategy
+			p := newSignalParser(opts)
+			for i, line := range []string{speedLine, speedLine} {
+				if err := p.parseLine(line, position{Line: i + 1}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if p.duplicates != 1 {
+				t.Errorf("duplicates = %d, want 1", p.duplicates)
+			}
+			if opts.Log.warnings == 0 {
+				t.Error("the repeated line was not reported")
+			}
+			if err := checkUniqueNames(p.messages, opts); err != nil {
+				t.Fatal(err)
+			}
+			if n := len(p.messages[256].Signals); n != tt.signals {
+				t.Errorf("%d signals written, want %d", n, tt.signals)
+			}
+		})
+	}
+
+	opts := DefaultOptions()
+	opts.DupStrategy = "error"
+	messages, err := parseSignalLines([]string{speedLine, speedLine}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkUniqueNames(messages, opts); err == nil {
+		t.Error("-dup error accepted a repeated line")
+	}
+}
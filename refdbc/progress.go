@@ -0,0 +1,94 @@
+package refdbc
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// progressInterval is the number of entries between progress events when the
+// log isn't a terminal.
+const progressInterval = 250
+
+// progressBarWidth is the number of characters inside the progress bar.
+const progressBarWidth = 30
+
+// progressReporter reports the number of entries processed so far. In text
+// form on a terminal it draws a bar, redrawn in place whenever the percentage
+// changes; otherwise every progressInterval entries are a separate info event.
+type progressReporter struct {
+	log     *Logger
+	total   int
+	tty     bool
+	enabled bool
+	percent int // Percentage last drawn on a terminal
+}
+
+// newProgressReporter creates a reporter writing to opts.Log. Progress is only
+// shown when there are enough entries for an update to be useful, info events
+// are enabled and the log isn't Buffered, which would only show it once the
+// file is done.
+func newProgressReporter(total int, opts Options) *progressReporter {
+	f, isFile := opts.Log.w.(*os.File)
+	return &progressReporter{
+		log:     opts.Log,
+		total:   total,
+		tty:     !opts.Log.json && isFile && IsTerminal(f),
+		enabled: opts.Log.enabled(LevelInfo) && total > progressInterval && opts.Log.parent == nil,
+		percent: -1,
+	}
+}
+
+// update reports that done entries have been processed.
+func (p *progressReporter) update(done int) {
+	if !p.enabled || done == 0 || done == p.total {
+		return
+	}
+	if p.tty {
+		if done*100/p.total != p.percent {
+			p.print(done)
+		}
+		return
+	}
+	if done%progressInterval == 0 {
+		p.print(done)
+	}
+}
+
+// finish prints the final count and, on a terminal, ends the in-place line.
+func (p *progressReporter) finish() {
+	if !p.enabled {
+		return
+	}
+	p.print(p.total)
+	if p.tty {
+		fmt.Fprintln(p.log.w)
+	}
+}
+
+func (p *progressReporter) print(done int) {
+	percent := done * 100 / p.total
+	line := fmt.Sprintf("Processed %d/%d entries (%d%%)", done, p.total, percent)
+	if !p.tty {
+		p.log.Infof("%s", line)
+		return
+	}
+	p.percent = percent
+	filled := done * progressBarWidth / p.total
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	fmt.Fprintf(p.log.w, "\r[%s] %s", bar, line)
+}
+
+// IsTerminal reports whether f is connected to a terminal rather than a file,
+// pipe or the null device (which is also a character device), as stdin is not
+// when CI runners or scripts start the tool.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	if null, err := os.Stat(os.DevNull); err == nil && os.SameFile(info, null) {
+		return false
+	}
+	return true
+}
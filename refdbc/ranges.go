@@ -0,0 +1,115 @@
+package refdbc
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// rawRange returns the smallest and largest raw integer values a signal of the
+// given length can hold (two's complement when signed).
+func rawRange(length int, signed bool) (float64, float64) {
+	if signed {
+		half := math.Ldexp(1, length-1)
+		return -half, half - 1
+	}
+	return 0, math.Ldexp(1, length) - 1
+}
+
+// physicalRange returns the physical values a signal can represent once its
+// raw range is scaled by factor and offset.
+func physicalRange(sig *Signal, signed bool) (float64, float64) {
+	rawMin, rawMax := rawRange(sig.Length, signed)
+	lo := rawMin*sig.Factor + sig.Offset
+	hi := rawMax*sig.Factor + sig.Offset
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	return lo, hi
+}
+
+// rangeFits reports whether the declared [Min, Max] range lies within the
+// physical range representable with the given signedness, allowing for
+// floating point rounding of one part in a million of the factor.
+func rangeFits(sig *Signal, signed bool) bool {
+	lo, hi := physicalRange(sig, signed)
+	tolerance := math.Abs(sig.Factor) * 1e-6
+	return sig.Min >= lo-tolerance && sig.Max <= hi+tolerance
+}
+
+// checkSignRanges warns about integer signals whose declared range contradicts
+// their signedness and bit length after factor and offset are applied. With
+// opts.FixSign an unsigned signal is made signed when its range clearly needs
+// it: a negative minimum, a roughly symmetric range, and a range that fits the
+// signed representation. The remaining signals are listed in warnings, or in
+// an error when opts.Strict is set.
+func checkSignRanges(messages map[uint32]*Message, opts Options) error {
+	var violations []string
+	for _, id := range sortedMessageIDs(messages) {
+		for _, sig := range messages[id].Signals {
+			// IEEE values, unscaled signals and unspecified ranges can't be checked.
+			if sig.ValueType != 0 || sig.Factor == 0 || (sig.Min == 0 && sig.Max == 0) {
+				continue
+			}
+			if rangeFits(sig, sig.IsSigned) {
+				continue
+			}
+
+			lo, hi := physicalRange(sig, sig.IsSigned)
+			signedness := "unsigned"
+			if sig.IsSigned {
+				signedness = "signed"
+			}
+
+			symmetric := math.Abs(sig.Min+sig.Max) <= math.Abs(sig.Factor)*(1+1e-6)
+			if opts.FixSign && !sig.IsSigned && sig.Min < 0 && symmetric && rangeFits(sig, true) {
+				opts.Log.Warnf("signal %s in message %d is unsigned but its range [%g|%g] needs a sign; changed to signed.",
+					sig.Name, id, sig.Min, sig.Max)
+				sig.IsSigned = true
+				continue
+			}
+
+			switch {
+			case !sig.IsSigned && sig.Min < 0 && sig.Min < lo:
+				violations = append(violations, fmt.Sprintf("signal %s in message %d is unsigned but declares minimum %g; the lowest representable value is %g",
+					sig.Name, id, sig.Min, lo))
+			case sig.Max > hi:
+				violations = append(violations, fmt.Sprintf("signal %s in message %d declares maximum %g, but with %d bits (%s), factor %g and offset %g it reaches at most %g",
+					sig.Name, id, sig.Max, sig.Length, signedness, sig.Factor, sig.Offset, hi))
+			default:
+				violations = append(violations, fmt.Sprintf("signal %s in message %d declares range [%g|%g], but with %d bits (%s), factor %g and offset %g it covers only [%g|%g]",
+					sig.Name, id, sig.Min, sig.Max, sig.Length, signedness, sig.Factor, sig.Offset, lo, hi))
+			}
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+	if opts.Strict {
+		return fmt.Errorf("ranges not representable: %s", strings.Join(violations, "; "))
+	}
+	for _, violation := range violations {
+		opts.Log.Warnf("%s.", violation)
+	}
+	return nil
+}
+
+// fillAutoRanges gives integer signals that declare the range 0/0 the full
+// physical range their length, signedness, factor and offset can represent,
+// e.g. [-10|117.5] for an unsigned 8-bit signal with factor 0.5 and offset -10.
+// Signals with an explicit range, and IEEE or unscaled signals, are left alone.
+func fillAutoRanges(messages map[uint32]*Message, opts Options) {
+	if !opts.AutoRange {
+		return
+	}
+	for _, id := range sortedMessageIDs(messages) {
+		for _, sig := range messages[id].Signals {
+			if sig.ValueType != 0 || sig.Factor == 0 || sig.Min != 0 || sig.Max != 0 {
+				continue
+			}
+			sig.Min, sig.Max = physicalRange(sig, sig.IsSigned)
+			opts.Log.Debugf("computed range [%g|%g] for signal %s in message %d", sig.Min, sig.Max, sig.Name, id)
+		}
+	}
+}
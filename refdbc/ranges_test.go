@@ -0,0 +1,68 @@
+package refdbc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFillAutoRanges(t *testing.T) {
+	tests := []struct {
+		length   int
+		signed   bool
+		min, max float64
+	}{
+		{1, false, 0, 1},
+		{1, true, -1, 0},
+		{8, false, 0, 255},
+		{8, true, -128, 127},
+		{16, false, 0, 65535},
+		{16, true, -32768, 32767},
+		{32, false, 0, 4294967295},
+		{32, true, -2147483648, 2147483647},
+		{64, false, 0, math.MaxUint64},
+		{64, true, math.MinInt64, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		sig := &Signal{Name: "Raw", Length: tt.length, IsSigned: tt.signed, Factor: 1}
+		messages := map[uint32]*Message{0x100: {ID: 0x100, Signals: []*Signal{sig}}}
+		opts := DefaultOptions()
+		opts.AutoRange = true
+		fillAutoRanges(messages, opts)
+		if sig.Min != tt.min || sig.Max != tt.max {
+			t.Errorf("%d bits, signed %t: range [%g|%g], want [%g|%g]", tt.length, tt.signed, sig.Min, sig.Max, tt.min, tt.max)
+		}
+	}
+}
+
+func TestFillAutoRangesScaled(t *testing.T) {
+	tests := []struct {
+		name     string
+		sig      Signal
+		min, max float64
+	}{
+		{"factor and offset", Signal{Length: 8, Factor: 0.5, Offset: -10}, -10, 117.5},
+		{"signed", Signal{Length: 16, IsSigned: true, Factor: 0.01}, -327.68, 327.67},
+		{"negative factor", Signal{Length: 8, Factor: -1, Offset: 100}, -155, 100},
+		{"explicit range", Signal{Length: 8, Factor: 1, Min: 0, Max: 100}, 0, 100},
+		{"float", Signal{Length: 32, ValueType: 1, Factor: 1}, 0, 0},
+		{"unscaled", Signal{Length: 8}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig := tt.sig
+			messages := map[uint32]*Message{0x100: {ID: 0x100, Signals: []*Signal{&sig}}}
+			opts := DefaultOptions()
+			opts.AutoRange = true
+			fillAutoRanges(messages, opts)
+			if math.Abs(sig.Min-tt.min) > 1e-9 || math.Abs(sig.Max-tt.max) > 1e-9 {
+				t.Errorf("range [%g|%g], want [%g|%g]", sig.Min, sig.Max, tt.min, tt.max)
+			}
+		})
+	}
+
+	sig := &Signal{Length: 8, Factor: 1}
+	fillAutoRanges(map[uint32]*Message{0x100: {ID: 0x100, Signals: []*Signal{sig}}}, DefaultOptions())
+	if sig.Min != 0 || sig.Max != 0 {
+		t.Errorf("range [%g|%g] filled in without AutoRange", sig.Min, sig.Max)
+	}
+}
@@ -0,0 +1,293 @@
+// Package refdbc converts Racelogic .ref files, which describe the CAN signals
+// of VBOX data loggers, into DBC files and back.
+//
+// ParseREF and WriteDBC cover the common case:
+//
+//	db, err := refdbc.ParseREF(file)
+//	if err != nil {
+//		return err
+//	}
+//	return refdbc.WriteDBC(db, out)
+//
+// The Options type exposes the settings of the racelogic-ref-to-dbc command
+// for callers that need more control.
+package refdbc
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"text/template"
+)
+
+// Signal represents a single signal within a CAN message.
+type Signal struct {
+	Name      string
+	StartBit  int
+	Length    int
+	ByteOrder byte // 0 for Motorola (big-endian), 1 for Intel (little-endian)
+	IsSigned  bool
+	ValueType byte // 0 for integer, 1 for IEEE float, 2 for IEEE double (see SIG_VALTYPE_)
+	Factor    float64
+	Offset    float64
+	Min       float64
+	Max       float64
+	Unit      string
+	Receivers []string // Nodes that receive the signal; empty means the default node
+	Comment   string   // Free-text description, written as CM_ SG_
+	Group     string   // Racelogic channel group (e.g. GPS), written as SIG_GROUP_
+	Part      string   // partMSW or partLSW for half of a signal split across two messages
+
+	MuxRole  byte // 0 for a plain signal, 1 for the multiplexor (M), 2 for a multiplexed signal (m<MuxValue>)
+	MuxValue int  // Multiplexor value of the frames that carry a multiplexed signal
+
+	ValueTable []ValueDescription // Labels for raw values, sorted by value, written as VAL_
+
+	pos        position // Where the signal was defined in the .ref file, if it was read from one
+	dlc        int      // DLC declared on the signal's line in the .ref file
+	provenance string   // Source file, position and raw line, for -comments full
+}
+
+// ValueDescription labels one raw value of a signal, such as 0 for "Off".
+type ValueDescription struct {
+	Value int64
+	Label string
+}
+
+// Message represents a CAN message, containing one or more signals.
+type Message struct {
+	ID      uint32
+	Name    string
+	DLC     int
+	Node    string
+	Comment string // Free-text description, written as CM_ BO_
+	Signals []*Signal
+
+	CycleTime int // Transmission period in milliseconds, 0 if unknown; written as GenMsgCycleTime
+
+	IsExtended bool // 29-bit identifier, written to DBC with dbcExtendedFlag set
+
+	provenance string // Source file and serial string, for -comments full
+}
+
+// CAN identifier limits. IDs above maxStandardID need an extended (29-bit) frame.
+const (
+	maxStandardID = 0x7FF
+	maxExtendedID = 0x1FFFFFFF
+
+	// dbcExtendedFlag marks an extended ID in DBC files, which store it as ID | 0x80000000.
+	dbcExtendedFlag = 0x80000000
+)
+
+// dbcID returns the identifier of the message as written in DBC files.
+func (m *Message) dbcID() uint32 {
+	if m.IsExtended {
+		return m.ID | dbcExtendedFlag
+	}
+	return m.ID
+}
+
+// Version identifies the converter in -version output and -annotate comments.
+// Release builds set it with
+// -ldflags "-X github.com/EastArctica/racelogic-ref-to-dbc/refdbc.Version=<version>".
+var Version = "dev"
+
+// DefaultNodeName is the placeholder node DBC tools use when no real node is known.
+const DefaultNodeName = "Vector__XXX"
+
+// Options holds the settings that control how each file is converted.
+type Options struct {
+	Format    string // Output format, one of the keys of FormatExtensions
+	CSVLayout string // Column layout of CSV output: table, or ref for the .ref field order
+
+	Node   string // Node name used as the transmitter of every message and the default receiver
+	Strict bool   // Treat recoverable data problems as fatal errors
+	Verify bool   // Read DBC output back and fail if it differs from the parsed messages
+
+	CANFD bool // Mark every message as a CAN FD frame, with the attributes Vector tools expect
+
+	AllowPartial bool // Write the messages read before an entry that can't be read, instead of failing the file
+
+	Log *Logger // Destination for errors, warnings, progress and debug events
+
+	NoHeader bool // Omit the VERSION/NS_/BS_/BU_ header from DBC output
+
+	SortOrder         string // Order of messages in DBC output: id, name or source; empty means id
+	Indent            string // Indentation of SG_ lines: space or tab; empty means space
+	LineEnding        string // Line endings of DBC output: lf or crlf; empty means lf
+	ReceiverSeparator string // Separator of SG_ receiver lists: comma, comma-space or space; empty means comma
+
+	Compat string // Tool the DBC output is checked against, one of CompatProfiles; empty for none
+
+	InputEncoding string // Character set of .ref text, one of InputEncodings; "auto" or empty detects it per entry
+	DBCEncoding   string // Character set of DBC output, one of DBCEncodings; empty means utf-8
+
+	SigPrefix string       // Prepended to every signal name
+	SigSuffix string       // Appended to every signal name
+	Renames   []RenameRule // Signal rename rules, applied before the prefix and suffix
+
+	Receivers []string // Receivers for every signal not covered by NodeMap
+	NodeMap   *NodeMap // Per-message and per-signal node assignments
+
+	GroupNodes        map[string]GroupNode // Transmitters and receivers per channel group, keyed by lower-case group name
+	GroupTransmitters bool                 // Use the channel group of each message as its transmitter, unless NodeMap or GroupNodes gives one
+
+	AutoPack bool // Move overlapping signals into free bits instead of only warning
+
+	NameTemplate *template.Template // Generates message names from their IDs
+	AutoSuffix   bool               // Resolve duplicate message or signal names by appending _2, _3...
+	DupStrategy  string             // Handling of repeated signal names in a message: keep, error, rename, first or last
+	NamePolicy   string             // Handling of signal names that aren't DBC identifiers: keep, replace or strict
+	NameReport   io.Writer          // Receives a CSV row for every signal renamed by NamePolicy or MaxNameLength, if set
+
+	MaxNameLength int // Signal names longer than this are shortened, keeping them unique with a hash; 0 for no limit
+
+	Report *Report // Collects the messages of every conversion for a review report, if set
+
+	DLCPolicy   string        // How conflicting DLCs within a message are resolved: max, first, strict or ask
+	Prompt      io.Writer     // Receives the questions of DLCPolicy ask; nil means os.Stderr
+	PromptInput *bufio.Reader // Supplies the answers to those questions; nil means Stdin
+	Interactive bool          // Whether a user answers at PromptInput; without one, DLCPolicy ask acts like strict
+
+	MinMaxOrder string // Order of the range columns: max-first (Racelogic) or min-first
+	Delimiter   string // Field separator of signal lines, or "auto" to detect it per file
+
+	FormatVersion string // Layout of .ref files, one of RefVersions; "auto" or empty detects it per file
+
+	BitConvention string // Numbering of Motorola start bits in the source: dbc, lsb or sequential
+
+	FloatFormat string // How factors, offsets and ranges are written: shortest, fixed or max-digits
+	FloatDigits int    // Significant digits kept by the max-digits float format
+
+	NormalizeUnits bool // Rewrite recognized units to canonical ones, rescaling signals
+	FixSign        bool // Make unsigned signals signed when their range clearly requires it
+	AutoRange      bool // Fill in 0/0 ranges with everything the signal can represent
+
+	Units map[string]UnitConversion // Unit mapping table keyed by lower-case unit, applied before the built-in one
+
+	Annotate bool   // Add comments with each message's hex ID and signal count, and the converter version
+	Comments string // DBC comments written: none, basic (from the file and overrides) or full (adding provenance)
+	Source   string // Name of the file being converted, used by Annotate and DumpRaw
+
+	Attributes []AttributeDef // DBC attribute definitions written as BA_DEF_, with their defaults
+
+	Metadata bool // Write the logger metadata of .ref files as a DBC comment and in JSON output
+
+	DumpRaw      io.Writer // Receives every decompressed entry before it is parsed, if set
+	DumpTrailing io.Writer // Receives the unparsed bytes left at the end of a .ref file, if set
+
+	GroupByPrefix bool // Derive signal groups from the name prefix when there is no group column
+	MinGroupSize  int  // Smallest group written as SIG_GROUP_
+
+	CombineSplit bool // Write split signals as one full-width signal instead of _MSW/_LSW halves
+
+	Overrides map[uint32]*MessageOverride // Hand-maintained metadata patched onto the parsed messages
+
+	DiffIgnore []string // Kinds of differences left out of comparisons, from DiffIgnores
+
+	ConflictPolicy string // What MergeIntoDBC does with messages the base DBC already has: error, keep or replace
+}
+
+// Stdin is shared by everything that reads user input, so buffered input is not lost between readers.
+var Stdin = bufio.NewReader(os.Stdin)
+
+// Stdout receives output written to StdioPath.
+var Stdout io.Writer = os.Stdout
+
+// StdioPath, given as an input or output path, reads from Stdin or writes to Stdout.
+const StdioPath = "-"
+
+// Database is the set of CAN messages described by a .ref or .dbc file.
+type Database struct {
+	Messages map[uint32]*Message // Keyed by message ID
+
+	Nodes      []string       // Nodes listed on the BU_ line of a DBC file
+	Attributes []AttributeDef // Attribute definitions of a DBC file, with their defaults and network values
+
+	Metadata       *RefMetadata // Header line and serial string of a .ref file; nil for other sources
+	MissingEntries []int        // Entries of a .ref file read with AllowPartial that are missing from Messages
+	TotalEntries   int          // Entries the .ref file declares, when MissingEntries is set
+}
+
+// DefaultOptions returns the settings the racelogic-ref-to-dbc command uses
+// when no flags are given, except that log events are discarded.
+func DefaultOptions() Options {
+	return Options{
+		Format:        "dbc",
+		CSVLayout:     "table",
+		Comments:      "basic",
+		Node:          DefaultNodeName,
+		Log:           NewLogger(io.Discard, "text", LevelWarn),
+		NameTemplate:  template.Must(ParseNameTemplate(DefaultNameTemplate)),
+		DLCPolicy:     "max",
+		MinMaxOrder:   "max-first",
+		FormatVersion: "auto",
+		Delimiter:     ",",
+		BitConvention: "dbc",
+		FloatFormat:   "shortest",
+		FloatDigits:   DefaultFloatDigits,
+		MinGroupSize:  2,
+
+		SortOrder:         "id",
+		Indent:            "space",
+		LineEnding:        "lf",
+		ReceiverSeparator: "comma",
+
+		InputEncoding: "auto",
+		DBCEncoding:   "utf-8",
+	}
+}
+
+// ParseREF decodes a .ref file using DefaultOptions.
+func ParseREF(r io.Reader) (*Database, error) {
+	return ParseREFWithOptions(r, DefaultOptions())
+}
+
+// ParseREFWithOptions decodes a .ref file. Warnings are reported through
+// opts.Log; the returned error is for fatal issues.
+func ParseREFWithOptions(r io.Reader, opts Options) (*Database, error) {
+	return ParseREFContext(context.Background(), r, opts)
+}
+
+// ParseREFContext is like ParseREFWithOptions, but stops between entries and
+// returns ctx.Err() once ctx is cancelled.
+func ParseREFContext(ctx context.Context, r io.Reader, opts Options) (*Database, error) {
+	messages, stats, err := parseRefContext(ctx, r, opts)
+	if err != nil {
+		return nil, err
+	}
+	return stats.database(messages), nil
+}
+
+// WriteDBC writes db as a DBC file using DefaultOptions.
+func WriteDBC(db *Database, w io.Writer) error {
+	return WriteDBCWithOptions(db, w, DefaultOptions())
+}
+
+// WriteDBCWithOptions writes db as a DBC file, using the node, header, comment
+// and signal group settings of opts.
+func WriteDBCWithOptions(db *Database, w io.Writer, opts Options) error {
+	writer := bufio.NewWriter(w)
+	if err := writeDBC(db, writer, opts); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// WriteREF writes db as a .ref file for the logger described by info, using
+// DefaultOptions.
+func WriteREF(db *Database, w io.Writer, info SerialInfo) error {
+	return WriteREFWithOptions(db, w, info, DefaultOptions())
+}
+
+// WriteREFWithOptions writes db as a .ref file for the logger described by
+// info, using the delimiter, range order, bit numbering and number format
+// settings of opts, so the file reads back with the same options.
+func WriteREFWithOptions(db *Database, w io.Writer, info SerialInfo, opts Options) error {
+	preamble, err := info.preamble()
+	if err != nil {
+		return err
+	}
+	return writeRef(db.Messages, preamble, w, opts)
+}
@@ -0,0 +1,278 @@
+package refdbc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RefPreamble is everything a .ref file holds before its entry count.
+type RefPreamble struct {
+	Header       string
+	Serial       string // Serial string line; unused when Legacy is set
+	SerialBlock  []byte // Compressed serial block, written as it was read
+	Legacy       bool   // No serial string or serial block, as in very old files
+	LittleEndian bool   // Entry count is little-endian, as in legacy-le files
+}
+
+// DefaultRefPreamble is written when no -ref-template is given. VBOX Tools may
+// expect the header and serial of a real file, so -ref-template is preferred.
+func DefaultRefPreamble() (RefPreamble, error) {
+	return SerialInfo{}.preamble()
+}
+
+// SerialInfo describes the logger a generated .ref file is for.
+type SerialInfo struct {
+	Header string // Header line; the name and version of this tool if empty
+	Serial string // Serial string line; ignored when Legacy is set
+	Block  []byte // Contents of the serial block, compressed when written
+	Legacy bool   // Write no serial string or serial block, as in very old files
+
+	LittleEndian bool // With Legacy, write the entry count little-endian for older logger firmware
+}
+
+// preamble checks the header and serial string and returns the preamble they
+// make. Both must be single lines of printable text no longer than the
+// reader accepts.
+func (info SerialInfo) preamble() (RefPreamble, error) {
+	preamble := RefPreamble{
+		Header:       info.Header,
+		Serial:       info.Serial,
+		Legacy:       info.Legacy,
+		LittleEndian: info.Legacy && info.LittleEndian,
+	}
+	if preamble.Header == "" {
+		preamble.Header = "racelogic-ref-to-dbc " + Version
+	}
+	if err := checkRefLine("header", preamble.Header); err != nil {
+		return RefPreamble{}, err
+	}
+	if info.Legacy {
+		return preamble, nil
+	}
+	if err := checkRefLine("serial string", preamble.Serial); err != nil {
+		return RefPreamble{}, err
+	}
+	block, err := compressZlib(info.Block)
+	if err != nil {
+		return RefPreamble{}, fmt.Errorf("serial block: %w", err)
+	}
+	preamble.SerialBlock = block
+	return preamble, nil
+}
+
+// checkRefLine returns an error if line can't be written as the header or
+// serial string line of a .ref file.
+func checkRefLine(what, line string) error {
+	if len(line) > maxHeaderLineLen {
+		return fmt.Errorf("%s is %d bytes long, more than the %d a .ref file allows", what, len(line), maxHeaderLineLen)
+	}
+	for _, b := range []byte(line) {
+		if (b < 0x20 || b > 0x7E) && b != '\t' {
+			return fmt.Errorf("%s %q contains a line break or other non-printable character", what, line)
+		}
+	}
+	return nil
+}
+
+// ReadRefPreamble reads the header line, serial string and serial block of an
+// existing .ref file, so a converted file can carry the same ones.
+func ReadRefPreamble(path string) (RefPreamble, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return RefPreamble{}, fmt.Errorf("failed to open template file: %w", err)
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+
+	variant, err := sniffRefHeader(reader)
+	if err != nil {
+		return RefPreamble{}, fmt.Errorf("template file %s: %w", path, err)
+	}
+	preamble, _, err := readRefPreamble(reader, variant)
+	if err != nil {
+		return RefPreamble{}, fmt.Errorf("template file %s: %w", path, err)
+	}
+	return preamble, nil
+}
+
+// ConvertDBCFile converts a .dbc file back into a .ref file for -reverse mode.
+func ConvertDBCFile(inputPath, outputPath string, preamble RefPreamble, opts Options) (stats FileStats, err error) {
+	start := time.Now()
+	defer func() {
+		stats.Warnings = opts.Log.warnings
+		stats.Elapsed = time.Since(start)
+	}()
+
+	messages, err := readDBCFile(inputPath)
+	if err != nil {
+		return stats, err
+	}
+	outFile, err := createOutput(outputPath)
+	if err != nil {
+		return stats, fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+
+	if err := writeRef(messages, preamble, outFile, opts); err != nil {
+		return stats, fmt.Errorf("failed to write REF file: %w", err)
+	}
+	stats.countWritten(messages)
+	opts.Report.add(inputPath, sourceName(inputPath), messages, opts.Log)
+	return stats, nil
+}
+
+// writeRef writes the messages as a .ref file: the preamble, the entry count,
+// one zlib-compressed entry per message holding a CRLF-terminated signal line
+// for each of its signals, and a CRC-16/XMODEM checksum of everything before it.
+// Signal lines use the columns, delimiter, range order and Motorola bit
+// numbering selected in opts, so the file reads back with the same options.
+func writeRef(messages map[uint32]*Message, preamble RefPreamble, w io.Writer, opts Options) error {
+	ids := sortedMessageIDs(messages)
+	if len(ids) > math.MaxUint16 {
+		return fmt.Errorf("%d messages don't fit the 16-bit entry count of a .ref file", len(ids))
+	}
+	delimiter := opts.Delimiter
+	if delimiter == "auto" {
+		delimiter = ","
+	}
+
+	var out bytes.Buffer
+	out.WriteString(preamble.Header + "\r\n")
+	if !preamble.Legacy {
+		out.WriteString(preamble.Serial + "\r\n")
+		if err := writeZlibStr(&out, preamble.SerialBlock); err != nil {
+			return fmt.Errorf("serial block: %w", err)
+		}
+	}
+	var countOrder binary.ByteOrder = binary.BigEndian
+	if preamble.LittleEndian {
+		countOrder = binary.LittleEndian
+	}
+	binary.Write(&out, countOrder, uint16(len(ids)))
+
+	for _, id := range ids {
+		msg := messages[id]
+		var entry bytes.Buffer
+		for i, sig := range msg.Signals {
+			fields := refSignalFields(msg, sig, i == 0, opts)
+			for j, field := range fields {
+				fields[j] = refField(field, delimiter, msg, sig, opts)
+			}
+			entry.WriteString(strings.Join(fields, delimiter) + "\r\n")
+		}
+		compressed, err := compressZlib(entry.Bytes())
+		if err != nil {
+			return fmt.Errorf("message %d: %w", id, err)
+		}
+		if err := writeZlibStr(&out, compressed); err != nil {
+			return fmt.Errorf("message %d: %w", id, err)
+		}
+	}
+
+	crc := checksumSchemes[0].Init
+	for _, b := range out.Bytes() {
+		crc = crc16CCITTUpdate(crc, b)
+	}
+	binary.Write(&out, binary.BigEndian, crc)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// refSignalFields returns the columns of the signal line for sig, the inverse
+// of signalParser.parseLine. The message comment and cycle time are only
+// written on the first line of a message, and the optional columns only when
+// something needs them.
+func refSignalFields(msg *Message, sig *Signal, firstLine bool, opts Options) []string {
+	signType := "unsigned"
+	switch {
+	case sig.ValueType == 1:
+		signType = "float"
+	case sig.ValueType == 2:
+		signType = "double"
+	case sig.IsSigned:
+		signType = "signed"
+	}
+	startBit := sig.StartBit
+	if sig.ByteOrder == 0 {
+		startBit = refStartBit(startBit, sig.Length, opts.BitConvention)
+	}
+	first, second := sig.Max, sig.Min
+	if opts.MinMaxOrder == "min-first" {
+		first, second = sig.Min, sig.Max
+	}
+
+	fields := []string{
+		sig.Name,
+		strconv.FormatUint(uint64(msg.ID), 10),
+		sig.Unit,
+		strconv.Itoa(startBit),
+		strconv.Itoa(sig.Length),
+		formatFloat(sig.Offset, opts),
+		formatFloat(sig.Factor, opts),
+		formatFloat(first, opts),
+		formatFloat(second, opts),
+		signType,
+		byteOrderName(sig.ByteOrder),
+		strconv.Itoa(msg.DLC),
+	}
+	messageComment, cycleTime := "", ""
+	if firstLine {
+		messageComment = msg.Comment
+		if msg.CycleTime > 0 {
+			cycleTime = strconv.Itoa(msg.CycleTime)
+		}
+	}
+	optional := []string{sig.Comment, messageComment, sig.Group, sig.Part, formatValueTable(sig.ValueTable), cycleTime, muxMarker(sig)}
+	for len(optional) > 0 && optional[len(optional)-1] == "" {
+		optional = optional[:len(optional)-1]
+	}
+	return append(fields, optional...)
+}
+
+// refField makes a column value safe for a signal line, which has no quoting:
+// delimiters and line breaks are replaced by spaces, with a warning.
+func refField(value, delimiter string, msg *Message, sig *Signal, opts Options) string {
+	if !strings.Contains(value, delimiter) && !strings.ContainsAny(value, "\r\n") {
+		return value
+	}
+	cleaned := strings.NewReplacer(delimiter, " ", "\r\n", " ", "\n", " ", "\r", " ").Replace(value)
+	opts.Log.Warnf("signal %s in message %d: '%s' contains the field delimiter or a line break; written as '%s'.",
+		sig.Name, msg.ID, value, cleaned)
+	return cleaned
+}
+
+// compressZlib returns data compressed as a zlib stream.
+func compressZlib(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeZlibStr is the inverse of readZlibStr: it writes data after its
+// big-endian 16-bit length.
+func writeZlibStr(w io.Writer, data []byte) error {
+	if len(data) > math.MaxUint16 {
+		return fmt.Errorf("compressed data of %d bytes is too long for a zlib string", len(data))
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(len(data))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
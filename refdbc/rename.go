@@ -0,0 +1,140 @@
+package refdbc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// RenameRule rewrites signal names. A rule is either an exact mapping
+// (oldName=newName) or a regular expression substitution (s/pattern/replacement/).
+type RenameRule struct {
+	From    string         // Exact signal name to replace (exact rules only)
+	To      string         // Replacement name or regexp replacement template
+	Pattern *regexp.Regexp // Compiled pattern (substitution rules only)
+}
+
+// apply returns the name produced by the rule, and whether the rule matched.
+func (r RenameRule) apply(name string) (string, bool) {
+	if r.Pattern != nil {
+		if !r.Pattern.MatchString(name) {
+			return name, false
+		}
+		return r.Pattern.ReplaceAllString(name, r.To), true
+	}
+	if name != r.From {
+		return name, false
+	}
+	return r.To, true
+}
+
+// LoadRenameRules reads a rename file. Each non-blank line that does not start
+// with # is either `oldName=newName` or `s/pattern/replacement/`.
+func LoadRenameRules(path string) ([]RenameRule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rename file: %w", err)
+	}
+	defer file.Close()
+
+	var rules []RenameRule
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "s/") {
+			parts := splitUnescaped(line[2:], '/')
+			if len(parts) != 3 || parts[2] != "" {
+				return nil, fmt.Errorf("line %d: expected s/pattern/replacement/: %s", lineNum, line)
+			}
+			re, err := regexp.Compile(parts[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid pattern: %w", lineNum, err)
+			}
+			rules = append(rules, RenameRule{To: parts[1], Pattern: re})
+			continue
+		}
+
+		from, to, found := strings.Cut(line, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !found || from == "" || to == "" {
+			return nil, fmt.Errorf("line %d: expected oldName=newName: %s", lineNum, line)
+		}
+		rules = append(rules, RenameRule{From: from, To: to})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// splitUnescaped splits s on every sep that is not preceded by a backslash.
+// Escaped separators are unescaped in the result.
+func splitUnescaped(s string, sep byte) []string {
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == sep:
+			current.WriteByte(sep)
+			i++
+		case s[i] == sep:
+			parts = append(parts, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(s[i])
+		}
+	}
+	return append(parts, current.String())
+}
+
+// renameSignals applies the rename rules followed by the configured prefix and
+// suffix to every signal name. A new name that is not a valid DBC identifier or
+// that collides with another signal in the same message is rejected with a
+// warning and the signal keeps its original name.
+func renameSignals(messages map[uint32]*Message, opts Options) {
+	if len(opts.Renames) == 0 && opts.SigPrefix == "" && opts.SigSuffix == "" {
+		return
+	}
+
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		taken := make(map[string]bool, len(msg.Signals))
+		for _, sig := range msg.Signals {
+			taken[sig.Name] = true
+		}
+
+		for _, sig := range msg.Signals {
+			newName := sig.Name
+			for _, rule := range opts.Renames {
+				if renamed, ok := rule.apply(newName); ok {
+					newName = renamed
+					break
+				}
+			}
+			newName = opts.SigPrefix + newName + opts.SigSuffix
+			if newName == sig.Name {
+				continue
+			}
+
+			if !IsValidIdentifier(newName) {
+				opts.Log.Warnf("cannot rename signal %s in message %d to '%s' (not a valid DBC identifier).", sig.Name, id, newName)
+				continue
+			}
+			if taken[newName] {
+				opts.Log.Warnf("cannot rename signal %s in message %d to '%s' (name already used in this message).", sig.Name, id, newName)
+				continue
+			}
+			delete(taken, sig.Name)
+			taken[newName] = true
+			sig.Name = newName
+		}
+	}
+}
@@ -0,0 +1,477 @@
+package refdbc
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ReportFormats maps the extensions of report files to their format.
+var ReportFormats = map[string]string{
+	".html": "html",
+	".htm":  "html",
+	".md":   "markdown",
+}
+
+// ReportFormat returns the format of a report written to path, from its
+// extension.
+func ReportFormat(path string) (string, error) {
+	format, ok := ReportFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return "", fmt.Errorf("unsupported report type '%s' (expected .html, .htm or .md)", filepath.Ext(path))
+	}
+	return format, nil
+}
+
+// Report collects the messages of every conversion of a run, to describe
+// them in one document once the run is done. Conversions running at the
+// same time may add to it.
+type Report struct {
+	mu       sync.Mutex
+	sections []reportSection
+}
+
+// reportSection holds what one conversion adds to a Report.
+type reportSection struct {
+	path     string // Input path, which orders the sections
+	source   string // Name shown as the heading of the section
+	messages map[uint32]*Message
+	warnings []logEvent
+}
+
+// NewReport returns an empty Report.
+func NewReport() *Report {
+	return &Report{}
+}
+
+// add records the messages converted from path, shown under the name
+// source, and the warnings logged while converting them.
+func (r *Report) add(path, source string, messages map[uint32]*Message, log *Logger) {
+	if r == nil {
+		return
+	}
+	warnings := append([]logEvent(nil), log.fileWarnings...)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sections = append(r.sections, reportSection{path: path, source: source, messages: messages, warnings: warnings})
+}
+
+// Write writes the report to w as format, "html" or "markdown". Each
+// conversion gets a section, in the order of the input paths, with a table of
+// its messages, the warnings logged while converting it, the signals that
+// appear in more than one message with different scaling (usually a
+// copy-paste mistake in the logger setup), and for every message a table of
+// its signals and a diagram of the payload bits they use.
+func (r *Report) Write(w io.Writer, format string) error {
+	var out reportWriter
+	switch format {
+	case "html":
+		out = &htmlReport{w: w}
+	case "markdown":
+		out = &markdownReport{w: w}
+	default:
+		return fmt.Errorf("unknown report format '%s'", format)
+	}
+
+	r.mu.Lock()
+	sections := make([]reportSection, len(r.sections))
+	copy(sections, r.sections)
+	r.mu.Unlock()
+	sort.SliceStable(sections, func(i, j int) bool { return sections[i].path < sections[j].path })
+
+	out.start("CAN Database Report")
+	out.paragraph(fmt.Sprintf("Generated by racelogic-ref-to-dbc %s.", Version))
+	for _, section := range sections {
+		out.heading(2, section.source)
+		writeMessageOverview(out, section.messages)
+		writeReportWarnings(out, section)
+		writeScalingConflicts(out, section.messages)
+		for _, id := range sortedMessageIDs(section.messages) {
+			writeMessageDetails(out, section.messages[id])
+		}
+	}
+	out.end()
+	return out.err()
+}
+
+// scalingFields returns the properties that decide how the raw value of sig
+// is read, which a signal repeated in several messages should share.
+func scalingFields(sig *Signal) []string {
+	return []string{
+		strconv.Itoa(sig.Length),
+		signalTypeName(sig),
+		formatNumber(sig.Factor),
+		formatNumber(sig.Offset),
+		sig.Unit,
+	}
+}
+
+// scalingConflict is a signal name used in several messages with different
+// scaling.
+type scalingConflict struct {
+	name string
+	uses []signalUse // In message ID order
+}
+
+// signalUse is one definition of a signal.
+type signalUse struct {
+	msg *Message
+	sig *Signal
+}
+
+// findScalingConflicts returns the signal names that appear in more than one
+// message with different scaling, sorted by name. Halves of split signals
+// are left out, as their parts are scaled differently on purpose.
+func findScalingConflicts(messages map[uint32]*Message) []scalingConflict {
+	uses := make(map[string][]signalUse)
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		for _, sig := range msg.Signals {
+			if sig.Part != "" {
+				continue
+			}
+			uses[sig.Name] = append(uses[sig.Name], signalUse{msg: msg, sig: sig})
+		}
+	}
+
+	var conflicts []scalingConflict
+	for name, list := range uses {
+		if differentScaling(list) {
+			conflicts = append(conflicts, scalingConflict{name: name, uses: list})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].name < conflicts[j].name })
+	return conflicts
+}
+
+// differentScaling reports whether uses spans several messages and not every
+// use is scaled like the first.
+func differentScaling(uses []signalUse) bool {
+	first := scalingFields(uses[0].sig)
+	for _, use := range uses[1:] {
+		if use.msg == uses[0].msg {
+			continue
+		}
+		for i, field := range scalingFields(use.sig) {
+			if field != first[i] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeScalingConflicts writes the table of the signals repeated in messages
+// with different scaling. Values that differ from the first definition of
+// the signal are marked.
+func writeScalingConflicts(out reportWriter, messages map[uint32]*Message) {
+	out.heading(3, "Signals with differing scaling")
+	conflicts := findScalingConflicts(messages)
+	if len(conflicts) == 0 {
+		out.paragraph("No signal appears in more than one message with different scaling.")
+		return
+	}
+	out.paragraph(fmt.Sprintf("%d %s in several messages with different scaling. Check that each definition is intended before distributing the DBC.",
+		len(conflicts), plural(len(conflicts), "signal name appears", "signal names appear")))
+
+	table := reportTable{header: []string{"Signal", "Message", "ID", "Length", "Type", "Factor", "Offset", "Unit"}}
+	for _, conflict := range conflicts {
+		first := scalingFields(conflict.uses[0].sig)
+		for _, use := range conflict.uses {
+			row := []reportCell{
+				{text: conflict.name},
+				{text: use.msg.Name},
+				{text: fmt.Sprintf("%d (0x%X)", use.msg.ID, use.msg.ID)},
+			}
+			for i, field := range scalingFields(use.sig) {
+				row = append(row, reportCell{text: field, mark: field != first[i]})
+			}
+			table.rows = append(table.rows, row)
+		}
+	}
+	out.table(table)
+}
+
+// reportMessageID formats the ID of msg in decimal and hex.
+func reportMessageID(msg *Message) string {
+	if msg.IsExtended {
+		return fmt.Sprintf("%d (0x%X, extended)", msg.ID, msg.ID)
+	}
+	return fmt.Sprintf("%d (0x%X)", msg.ID, msg.ID)
+}
+
+// writeMessageOverview writes a table with a row for every message.
+func writeMessageOverview(out reportWriter, messages map[uint32]*Message) {
+	out.heading(3, "Messages")
+	if len(messages) == 0 {
+		out.paragraph("No messages.")
+		return
+	}
+	table := reportTable{header: []string{"ID", "Name", "DLC", "Transmitter", "Cycle time", "Signals", "Bits used"}}
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		cycle := ""
+		if msg.CycleTime > 0 {
+			cycle = fmt.Sprintf("%d ms", msg.CycleTime)
+		}
+		used, total := messageBitUsage(msg)
+		table.rows = append(table.rows, []reportCell{
+			{text: reportMessageID(msg)},
+			{text: msg.Name},
+			{text: strconv.Itoa(msg.DLC)},
+			{text: msg.Node},
+			{text: cycle},
+			{text: strconv.Itoa(len(msg.Signals))},
+			{text: fmt.Sprintf("%d of %d", used, total)},
+		})
+	}
+	out.table(table)
+}
+
+// writeReportWarnings writes the warnings logged while converting section.
+// Warnings about another file than the section's, as when merging, name it.
+func writeReportWarnings(out reportWriter, section reportSection) {
+	out.heading(3, "Warnings")
+	if len(section.warnings) == 0 {
+		out.paragraph("No warnings.")
+		return
+	}
+	table := reportTable{header: []string{"Where", "Warning"}}
+	for _, event := range section.warnings {
+		var where []string
+		if event.File != "" && event.File != section.path {
+			where = append(where, sourceName(event.File))
+		}
+		if pos := (position{Entry: event.Entry, Line: event.Line}); pos != (position{}) {
+			where = append(where, pos.String())
+		}
+		table.rows = append(table.rows, []reportCell{{text: strings.Join(where, ", ")}, {text: event.Message}})
+	}
+	out.table(table)
+}
+
+// writeMessageDetails writes the comment of msg, a table of its signals and
+// a diagram of its payload. Signals are numbered in the table, and the
+// diagram shows the number of the signal using each bit.
+func writeMessageDetails(out reportWriter, msg *Message) {
+	out.heading(3, fmt.Sprintf("%s, ID %s", msg.Name, reportMessageID(msg)))
+	if msg.Comment != "" {
+		out.paragraph(msg.Comment)
+	}
+	table := reportTable{header: []string{"#", "Signal", "Start bit", "Length", "Byte order", "Type", "Multiplex", "Factor", "Offset", "Min", "Max", "Unit", "Receivers", "Comment"}}
+	for i, sig := range msg.Signals {
+		table.rows = append(table.rows, []reportCell{
+			{text: strconv.Itoa(i + 1)},
+			{text: sig.Name},
+			{text: strconv.Itoa(sig.StartBit)},
+			{text: strconv.Itoa(sig.Length)},
+			{text: byteOrderName(sig.ByteOrder)},
+			{text: signalTypeName(sig)},
+			{text: muxMarker(sig)},
+			{text: formatNumber(sig.Factor)},
+			{text: formatNumber(sig.Offset)},
+			{text: formatNumber(sig.Min)},
+			{text: formatNumber(sig.Max)},
+			{text: sig.Unit},
+			{text: strings.Join(sig.Receivers, ", ")},
+			{text: sig.Comment},
+		})
+	}
+	if len(table.rows) > 0 {
+		out.table(table)
+	}
+	if msg.DLC == 0 {
+		out.paragraph("The message has no payload.")
+		return
+	}
+	out.layout(messageLayout(msg))
+}
+
+// layoutNote explains the marks of a bitLayout.
+const layoutNote = "Numbers are the signals of the table above; * marks a bit used by multiplexed signals of different frames, and X a bit used by overlapping signals."
+
+// reportTable is a table of a report, with a header row.
+type reportTable struct {
+	header []string
+	rows   [][]reportCell
+}
+
+// reportCell is a cell of a reportTable. Marked cells are highlighted.
+type reportCell struct {
+	text string
+	mark bool
+}
+
+// reportWriter writes the parts of a report in one format. Write errors are
+// kept and returned by err, so the parts need no checks of their own.
+type reportWriter interface {
+	start(title string)
+	heading(level int, text string)
+	paragraph(text string)
+	table(t reportTable)
+	layout(l bitLayout)
+	end()
+	err() error
+}
+
+// markdownReport writes a report as Markdown.
+type markdownReport struct {
+	w        io.Writer
+	writeErr error
+}
+
+func (m *markdownReport) printf(format string, args ...interface{}) {
+	if m.writeErr == nil {
+		_, m.writeErr = fmt.Fprintf(m.w, format, args...)
+	}
+}
+
+func (m *markdownReport) start(title string) { m.printf("# %s\n\n", escapeMarkdown(title)) }
+
+func (m *markdownReport) heading(level int, text string) {
+	m.printf("%s %s\n\n", strings.Repeat("#", level), escapeMarkdown(text))
+}
+
+func (m *markdownReport) paragraph(text string) { m.printf("%s\n\n", escapeMarkdown(text)) }
+
+func (m *markdownReport) table(t reportTable) {
+	header := make([]string, len(t.header))
+	for i, h := range t.header {
+		header[i] = escapeMarkdown(h)
+	}
+	m.printf("| %s |\n|%s\n", strings.Join(header, " | "), strings.Repeat("---|", len(header)))
+	for _, row := range t.rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = escapeMarkdown(cell.text)
+			if cell.mark && cell.text != "" {
+				cells[i] = "**" + cells[i] + "**"
+			}
+		}
+		m.printf("| %s |\n", strings.Join(cells, " | "))
+	}
+	m.printf("\n")
+}
+
+// layout writes the payload diagram as a table with a row per byte and the
+// bits from 7 down to 0, as DBC editors show them.
+func (m *markdownReport) layout(l bitLayout) {
+	table := reportTable{header: []string{"Byte", "7", "6", "5", "4", "3", "2", "1", "0"}}
+	for b := 0; b < len(l.bits)/8; b++ {
+		row := []reportCell{{text: strconv.Itoa(b)}}
+		for bit := 7; bit >= 0; bit-- {
+			n := b*8 + bit
+			row = append(row, reportCell{text: l.label(n), mark: l.bits[n] == overlapBit})
+		}
+		table.rows = append(table.rows, row)
+	}
+	m.table(table)
+	m.paragraph(layoutNote)
+}
+
+func (m *markdownReport) end() {}
+
+func (m *markdownReport) err() error { return m.writeErr }
+
+// markdownEscaper escapes the characters Markdown would read as formatting.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `|`, `\|`, `<`, `&lt;`, `[`, `\[`, `]`, `\]`, `#`, `\#`,
+)
+
+// escapeMarkdown makes text safe to use in Markdown, including table cells.
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+// htmlReport writes a report as a standalone HTML page.
+type htmlReport struct {
+	w        io.Writer
+	writeErr error
+}
+
+// htmlReportStyle is the style sheet of HTML reports.
+const htmlReportStyle = `body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+th { background: #f0f0f0; }
+td.mark { background: #ffe3a0; font-weight: bold; }
+table.layout td { width: 2.5em; text-align: center; }
+table.layout td.shared { background: #ddd; }
+table.layout td.overlap { background: #f4a0a0; font-weight: bold; }`
+
+func (h *htmlReport) printf(format string, args ...interface{}) {
+	if h.writeErr == nil {
+		_, h.writeErr = fmt.Fprintf(h.w, format, args...)
+	}
+}
+
+func (h *htmlReport) start(title string) {
+	title = html.EscapeString(title)
+	h.printf("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n<h1>%s</h1>\n", title, htmlReportStyle, title)
+}
+
+func (h *htmlReport) heading(level int, text string) {
+	h.printf("<h%d>%s</h%d>\n", level, html.EscapeString(text), level)
+}
+
+func (h *htmlReport) paragraph(text string) { h.printf("<p>%s</p>\n", html.EscapeString(text)) }
+
+func (h *htmlReport) table(t reportTable) {
+	h.printf("<table>\n<tr>")
+	for _, header := range t.header {
+		h.printf("<th>%s</th>", html.EscapeString(header))
+	}
+	h.printf("</tr>\n")
+	for _, row := range t.rows {
+		h.printf("<tr>")
+		for _, cell := range row {
+			if cell.mark {
+				h.printf("<td class=\"mark\">%s</td>", html.EscapeString(cell.text))
+			} else {
+				h.printf("<td>%s</td>", html.EscapeString(cell.text))
+			}
+		}
+		h.printf("</tr>\n")
+	}
+	h.printf("</table>\n")
+}
+
+// layout writes the payload diagram as a table with a row per byte and the
+// bits from 7 down to 0, as DBC editors show them. Each signal gets its own
+// colour, and its name shows when hovering over its bits.
+func (h *htmlReport) layout(l bitLayout) {
+	h.printf("<table class=\"layout\">\n<tr><th>Byte</th>")
+	for bit := 7; bit >= 0; bit-- {
+		h.printf("<th>%d</th>", bit)
+	}
+	h.printf("</tr>\n")
+	for b := 0; b < len(l.bits)/8; b++ {
+		h.printf("<tr><th>%d</th>", b)
+		for bit := 7; bit >= 0; bit-- {
+			n := b*8 + bit
+			switch number := l.bits[n]; number {
+			case 0:
+				h.printf("<td></td>")
+			case sharedBit:
+				h.printf("<td class=\"shared\">*</td>")
+			case overlapBit:
+				h.printf("<td class=\"overlap\">X</td>")
+			default:
+				h.printf("<td style=\"background: hsl(%d, 70%%, 85%%)\" title=\"%s\">%d</td>",
+					(number*67)%360, html.EscapeString(l.signals[number-1].Name), number)
+			}
+		}
+		h.printf("</tr>\n")
+	}
+	h.printf("</table>\n")
+	h.paragraph(layoutNote)
+}
+
+func (h *htmlReport) end() { h.printf("</body>\n</html>\n") }
+
+func (h *htmlReport) err() error { return h.writeErr }
@@ -0,0 +1,256 @@
+package refdbc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// errNotRefFile is returned when a file's start does not have the shape of a .ref file.
+var errNotRefFile = errors.New("this does not look like a Racelogic .ref file")
+
+// maxHeaderLineLen is the longest header or serial line accepted by the sniffer.
+const maxHeaderLineLen = 256
+
+// zlibMagic is the first byte of a zlib stream using the deflate method with a 32K window.
+const zlibMagic = 0x78
+
+// refHeaderVariant identifies the layout of a .ref file before its entries:
+// its format version.
+type refHeaderVariant int
+
+const (
+	// headerWithSerial is a serial string line and a zlib serial block before
+	// the big-endian entry count, as written by current VBOX Tools.
+	headerWithSerial refHeaderVariant = iota
+	// headerLegacy has the big-endian entry count straight after the header
+	// line, as written by very old VBOX Tools.
+	headerLegacy
+	// headerLegacyLE is headerLegacy with a little-endian entry count, as
+	// written by older logger firmware.
+	headerLegacyLE
+)
+
+// RefVersions lists the accepted values of Options.FormatVersion and the
+// -ref-version flag: auto detects the format version of each file, and the
+// others force one.
+var RefVersions = []string{"auto", "standard", "legacy", "legacy-le"}
+
+// IsValidRefVersion reports whether version is one of RefVersions.
+func IsValidRefVersion(version string) bool {
+	for _, v := range RefVersions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+func (v refHeaderVariant) String() string {
+	switch v {
+	case headerLegacy:
+		return "legacy (no serial block)"
+	case headerLegacyLE:
+		return "legacy-le (no serial block, little-endian entry count)"
+	}
+	return "standard (serial string and zlib serial block)"
+}
+
+// version returns the name of v in RefVersions.
+func (v refHeaderVariant) version() string {
+	switch v {
+	case headerLegacy:
+		return "legacy"
+	case headerLegacyLE:
+		return "legacy-le"
+	}
+	return "standard"
+}
+
+// countOrder returns the byte order of the entry count in files of layout v.
+func (v refHeaderVariant) countOrder() binary.ByteOrder {
+	if v == headerLegacyLE {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// chooseRefVariant returns the layout named by version, or the one
+// sniffRefHeader finds in r when version is auto or empty.
+func chooseRefVariant(r *bufio.Reader, version string) (refHeaderVariant, error) {
+	switch version {
+	case "", "auto":
+		return sniffRefHeader(r)
+	case "standard":
+		return headerWithSerial, nil
+	case "legacy":
+		return headerLegacy, nil
+	case "legacy-le":
+		return headerLegacyLE, nil
+	}
+	return 0, fmt.Errorf("unknown .ref format version '%s'", version)
+}
+
+// readRefPreamble reads the preamble of a file with layout variant, then its
+// entry count.
+func readRefPreamble(r *bufio.Reader, variant refHeaderVariant) (RefPreamble, uint16, error) {
+	preamble := RefPreamble{
+		Legacy:       variant != headerWithSerial,
+		LittleEndian: variant == headerLegacyLE,
+	}
+	header, err := readUpToCRLF(r)
+	if err != nil {
+		return RefPreamble{}, 0, fmt.Errorf("failed to read header: %w", err)
+	}
+	preamble.Header = string(header)
+	if err := discardCRLF(r, "header"); err != nil {
+		return RefPreamble{}, 0, err
+	}
+	if !preamble.Legacy {
+		serial, err := readUpToCRLF(r)
+		if err != nil {
+			return RefPreamble{}, 0, fmt.Errorf("failed to read serial string: %w", err)
+		}
+		preamble.Serial = string(serial)
+		if err := discardCRLF(r, "serial string"); err != nil {
+			return RefPreamble{}, 0, err
+		}
+		preamble.SerialBlock, err = readZlibStr(r)
+		if err != nil {
+			return RefPreamble{}, 0, fmt.Errorf("failed to read zlib serial block: %w", err)
+		}
+	}
+	var totalEntries uint16
+	if err := binary.Read(r, variant.countOrder(), &totalEntries); err != nil {
+		return RefPreamble{}, 0, fmt.Errorf("failed to read total entries count: %w", err)
+	}
+	return preamble, totalEntries, nil
+}
+
+// sniffRefHeader checks, without consuming any input, that the data starts
+// like a .ref file: a printable header line terminated by CRLF, followed either
+// by a serial string line and a length-prefixed zlib block, or (in legacy
+// files) directly by the entry count and the first length-prefixed zlib entry.
+// It returns which of the layouts was found.
+func sniffRefHeader(r *bufio.Reader) (refHeaderVariant, error) {
+	data, err := r.Peek(2*maxHeaderLineLen + 3)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return 0, fmt.Errorf("failed to read file start: %w", err)
+	}
+	if len(data) == 0 {
+		return 0, fmt.Errorf("%w (the file is empty)", errNotRefFile)
+	}
+
+	// The header line must be short, printable text.
+	headerEnd := bytes.Index(data, []byte("\r\n"))
+	if headerEnd < 0 || headerEnd > maxHeaderLineLen {
+		return 0, fmt.Errorf("%w (no header line found)", errNotRefFile)
+	}
+	for _, b := range data[:headerEnd] {
+		if (b < 0x20 || b > 0x7E) && b != '\t' {
+			return 0, fmt.Errorf("%w (the header contains binary data)", errNotRefFile)
+		}
+	}
+
+	// Normally the serial string line follows, then a length-prefixed zlib block.
+	rest := data[headerEnd+2:]
+	serialEnd := bytes.Index(rest, []byte("\r\n"))
+	if serialEnd >= 0 && serialEnd <= maxHeaderLineLen {
+		block := rest[serialEnd+2:]
+		if len(block) >= 3 && isZlibBlockStart(block) {
+			return headerWithSerial, nil
+		}
+	}
+
+	// Legacy files go straight on with the entry count and the first entry.
+	if len(rest) >= 5 && isZlibBlockStart(rest[2:]) {
+		// Look at as much of the file as the reader holds, to count entries.
+		all, err := r.Peek(r.Size())
+		return legacyVariant(all[headerEnd+2:], err == io.EOF), nil
+	}
+
+	if serialEnd < 0 {
+		if len(rest) <= maxHeaderLineLen {
+			return 0, errTruncated("serial string")
+		}
+		return 0, fmt.Errorf("%w (no serial string line found)", errNotRefFile)
+	}
+	if len(rest[serialEnd+2:]) < 3 {
+		return 0, errTruncated("serial block")
+	}
+	return 0, fmt.Errorf("%w (the serial block is not zlib data)", errNotRefFile)
+}
+
+// legacyVariant tells the two legacy layouts apart by the entry count that
+// starts data, which runs to the end of the file if atEOF is set. The entries
+// that follow are counted as far as data reaches, which rules out a reading of
+// the count that doesn't match them. When both readings still fit, as when
+// data ends before the last entry, the smaller one is taken, since few files
+// have more than a few hundred entries; -ref-version can force the other.
+func legacyVariant(data []byte, atEOF bool) refHeaderVariant {
+	entries, exact := countEntries(data[2:], atEOF)
+	fits := func(count uint16) bool {
+		if exact {
+			return int(count) == entries
+		}
+		return int(count) >= entries
+	}
+	bigEndian, littleEndian := binary.BigEndian.Uint16(data), binary.LittleEndian.Uint16(data)
+	switch {
+	case fits(bigEndian) && !fits(littleEndian):
+		return headerLegacy
+	case fits(littleEndian) && !fits(bigEndian):
+		return headerLegacyLE
+	case littleEndian < bigEndian:
+		return headerLegacyLE
+	}
+	return headerLegacy
+}
+
+// countEntries counts the length-prefixed entries at the start of data, which
+// runs to the end of the file if atEOF is set. exact reports whether data held
+// every entry, followed by at most a checksum; otherwise the file has at least
+// the returned number of entries.
+func countEntries(data []byte, atEOF bool) (n int, exact bool) {
+	for {
+		if atEOF && len(data) <= checksumTrailerLen {
+			return n, true
+		}
+		if len(data) < 3 || !isZlibBlockStart(data) {
+			return n, false
+		}
+		length := 2 + int(binary.BigEndian.Uint16(data))
+		if length > len(data) {
+			// The entry goes on past the data, but it is there.
+			return n + 1, false
+		}
+		n++
+		data = data[length:]
+	}
+}
+
+// isZlibBlockStart reports whether data starts with a plausible length prefix
+// followed by the zlib magic byte.
+func isZlibBlockStart(data []byte) bool {
+	return (data[0] != 0 || data[1] != 0) && data[2] == zlibMagic
+}
+
+// errTruncated describes a file that ends before the named part of the format.
+func errTruncated(part string) error {
+	return fmt.Errorf("the file is truncated: it ends before the %s", part)
+}
+
+// discardCRLF skips the CRLF that terminates a header line, reporting a
+// truncated file if the data ends first.
+func discardCRLF(r *bufio.Reader, part string) error {
+	if _, err := r.Discard(2); err != nil {
+		if err == io.EOF {
+			return errTruncated(part + " line break")
+		}
+		return fmt.Errorf("failed to discard %s delimiter: %w", part, err)
+	}
+	return nil
+}
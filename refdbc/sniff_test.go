@@ -0,0 +1,84 @@
+package refdbc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// numberedEntries returns n entries with one signal each, in messages 1 to n.
+func numberedEntries(n int) []string {
+	entries := make([]string, n)
+	for i := range entries {
+		entries[i] = fmt.Sprintf("Signal_%d,%d,,0,8,0,1,255,0,unsigned,Intel,8\r\n", i+1, i+1)
+	}
+	return entries
+}
+
+func TestSniffRefHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    refBuilder
+		size    int // Size of the reader's buffer; 0 for the one ParseREF uses
+		want    refHeaderVariant
+		entries int // Entries ParseREF finds with the detected layout
+	}{
+		{"standard", refBuilder{Serial: "SN 123456", Entries: numberedEntries(3)}, 0, headerWithSerial, 3},
+		{"standard with checksum", refBuilder{Serial: "SN 123456", Entries: numberedEntries(3), Checksum: true}, 0, headerWithSerial, 3},
+		{"standard 256", refBuilder{Serial: "SN 123456", Entries: numberedEntries(256)}, 0, headerWithSerial, 256},
+		{"legacy", refBuilder{Legacy: true, Entries: numberedEntries(3)}, 0, headerLegacy, 3},
+		{"legacy 255", refBuilder{Legacy: true, Entries: numberedEntries(255)}, 0, headerLegacy, 255},
+		{"legacy 256", refBuilder{Legacy: true, Entries: numberedEntries(256)}, 0, headerLegacy, 256},
+		{"legacy 256 with checksum", refBuilder{Legacy: true, Entries: numberedEntries(256), Checksum: true}, 0, headerLegacy, 256},
+		{"legacy 300 past the buffer", refBuilder{Legacy: true, Entries: numberedEntries(300)}, 4096, headerLegacy, 300},
+		{"legacy-le", refBuilder{Legacy: true, Order: binary.LittleEndian, Entries: numberedEntries(3)}, 0, headerLegacyLE, 3},
+		{"legacy-le 256", refBuilder{Legacy: true, Order: binary.LittleEndian, Entries: numberedEntries(256)}, 0, headerLegacyLE, 256},
+		{"legacy-le 300 past the buffer", refBuilder{Legacy: true, Order: binary.LittleEndian, Entries: numberedEntries(300)}, 4096, headerLegacyLE, 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.file.build(t)
+			size := tt.size
+			if size == 0 {
+				size = maxEntrySize
+			}
+			got, err := sniffRefHeader(bufio.NewReaderSize(bytes.NewReader(data), size))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("detected %s, want %s", got, tt.want)
+			}
+
+			db, err := ParseREF(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(db.Messages) != tt.entries {
+				t.Errorf("%d messages read, want %d", len(db.Messages), tt.entries)
+			}
+		})
+	}
+}
+
+func TestSniffRefHeaderRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"no header line", []byte("BO_ 256 Speed: 8 Vector__XXX\n")},
+		{"binary header", []byte("VBOX\x00REF\r\nSN 1\r\n\x00\x08x\x9c")},
+		{"text serial block", []byte("VBOX REF FILE\r\nSN 123456\r\nnot zlib data\r\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := sniffRefHeader(bufio.NewReader(bytes.NewReader(tt.data))); !errors.Is(err, errNotRefFile) {
+				t.Errorf("err = %v, want %v", err, errNotRefFile)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package refdbc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Part flags marking the halves of a signal too wide for one message, which
+// Racelogic sends across two consecutive messages (e.g. 64-bit latitude).
+const (
+	partMSW = "MSW" // Most significant part, sent first
+	partLSW = "LSW" // Least significant part, the continuation
+)
+
+// splitPart is one half of a split signal together with the message carrying it.
+type splitPart struct {
+	msg *Message
+	sig *Signal
+}
+
+// splitBaseName returns the name shared by both halves of a split signal: the
+// signal name without a trailing _MSW or _LSW.
+func splitBaseName(name string) string {
+	for _, suffix := range []string{"_" + partMSW, "_" + partLSW} {
+		if strings.HasSuffix(strings.ToUpper(name), suffix) {
+			return name[:len(name)-len(suffix)]
+		}
+	}
+	return name
+}
+
+// pairSplitSignals matches the MSW and LSW halves of split signals by base name.
+// By default both halves are kept, named <base>_MSW and <base>_LSW, with a
+// comment pointing at the other half. With opts.CombineSplit the MSW half
+// becomes the full-width signal named <base> and the LSW half is removed; the
+// DBC can then only describe the bits of the first frame. Halves without a
+// partner, or whose lengths don't add up to a valid signal, are left as they
+// are with a warning.
+func pairSplitSignals(messages map[uint32]*Message, opts Options) {
+	var bases []string
+	halves := make(map[string]map[string][]splitPart)
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		for _, sig := range msg.Signals {
+			if sig.Part == "" {
+				continue
+			}
+			base := splitBaseName(sig.Name)
+			if halves[base] == nil {
+				halves[base] = make(map[string][]splitPart)
+				bases = append(bases, base)
+			}
+			halves[base][sig.Part] = append(halves[base][sig.Part], splitPart{msg, sig})
+		}
+	}
+
+	for _, base := range bases {
+		msws, lsws := halves[base][partMSW], halves[base][partLSW]
+		switch {
+		case len(msws) == 0:
+			opts.Log.Warnf("split signal %s has an LSW part in message %d but no MSW part; leaving it unpaired.", base, lsws[0].msg.ID)
+			continue
+		case len(lsws) == 0:
+			opts.Log.Warnf("split signal %s has an MSW part in message %d but no LSW part; leaving it unpaired.", base, msws[0].msg.ID)
+			continue
+		case len(msws) > 1 || len(lsws) > 1:
+			opts.Log.Warnf("split signal %s has %d MSW and %d LSW parts; leaving them unpaired.", base, len(msws), len(lsws))
+			continue
+		}
+
+		msw, lsw := msws[0], lsws[0]
+		total := msw.sig.Length + lsw.sig.Length
+		if expected := ieeeLength(msw.sig.ValueType); (expected != 0 && total != expected) || total > 64 {
+			opts.Log.Warnf("split signal %s has parts of %d and %d bits, which don't form a valid signal; leaving them unpaired.",
+				base, msw.sig.Length, lsw.sig.Length)
+			continue
+		}
+
+		if opts.CombineSplit {
+			msw.sig.Name = base
+			msw.sig.Comment = appendComment(msw.sig.Comment, fmt.Sprintf(
+				"Full %d-bit value: the most significant %d bits are sent in this message and the least significant %d bits in message %d.",
+				total, msw.sig.Length, lsw.sig.Length, lsw.msg.ID))
+			msw.sig.Length = total
+			removeSignal(lsw.msg, lsw.sig)
+		} else {
+			msw.sig.Name = base + "_" + partMSW
+			lsw.sig.Name = base + "_" + partLSW
+			msw.sig.Comment = appendComment(msw.sig.Comment, fmt.Sprintf(
+				"Most significant %d bits of %s; the least significant %d bits are %s in message %d.",
+				msw.sig.Length, base, lsw.sig.Length, lsw.sig.Name, lsw.msg.ID))
+			lsw.sig.Comment = appendComment(lsw.sig.Comment, fmt.Sprintf(
+				"Least significant %d bits of %s; the most significant %d bits are %s in message %d.",
+				lsw.sig.Length, base, msw.sig.Length, msw.sig.Name, msw.msg.ID))
+		}
+	}
+}
+
+// appendComment adds note to the end of an existing comment.
+func appendComment(comment, note string) string {
+	if comment == "" {
+		return note
+	}
+	return comment + " " + note
+}
+
+// removeSignal deletes sig from the signals of msg.
+func removeSignal(msg *Message, sig *Signal) {
+	for i, s := range msg.Signals {
+		if s == sig {
+			msg.Signals = append(msg.Signals[:i], msg.Signals[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package refdbc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SummaryFormats lists the accepted values of the -summary-format flag.
+var SummaryFormats = []string{"text", "json"}
+
+// IsValidSummaryFormat reports whether format is one of SummaryFormats.
+func IsValidSummaryFormat(format string) bool {
+	for _, f := range SummaryFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// FileStats summarizes the conversion of one file.
+type FileStats struct {
+	Messages     int           `json:"messages"`      // Messages written
+	Signals      int           `json:"signals"`       // Signals written
+	SkippedLines int           `json:"skipped_lines"` // Lines dropped because they could not be parsed
+	Duplicates   int           `json:"duplicates"`    // Lines that repeat an earlier line exactly
+	Warnings     int           `json:"warnings"`      // Warnings logged
+	Elapsed      time.Duration `json:"-"`
+
+	metadata RefMetadata // Header line and serial string of the file
+	entries  int         // Entries declared by the file header, for Inspect
+	version  string      // Format version of the file, for Inspect
+	missing  []int       // Entries not read with -allow-partial
+}
+
+// database returns the messages read from a .ref file, with its metadata and
+// the entries missing from a partial read.
+func (s FileStats) database(messages map[uint32]*Message) *Database {
+	metadata := s.metadata
+	db := &Database{Messages: messages, Metadata: &metadata}
+	if len(s.missing) > 0 {
+		db.MissingEntries, db.TotalEntries = s.missing, s.entries
+	}
+	return db
+}
+
+// Add accumulates the counts of other into s.
+func (s *FileStats) Add(other FileStats) {
+	s.Messages += other.Messages
+	s.Signals += other.Signals
+	s.SkippedLines += other.SkippedLines
+	s.Duplicates += other.Duplicates
+	s.Warnings += other.Warnings
+	s.Elapsed += other.Elapsed
+}
+
+// RunSummary holds the totals over every file of a run, written as the final
+// line of output so wrapping scripts don't need to parse anything else.
+type RunSummary struct {
+	Files     int `json:"files"`
+	Converted int `json:"converted"`
+	Failed    int `json:"failed"`
+	FileStats
+	ElapsedMS int64  `json:"elapsed_ms"`
+	Severity  string `json:"severity"` // Worst outcome: ok, warn or error
+}
+
+// Write prints the summary to w as a single line, either as key=value pairs
+// or, when format is "json", as a JSON object.
+func (s RunSummary) Write(w io.Writer, format string) error {
+	if format == "json" {
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "summary files=%d converted=%d failed=%d messages=%d signals=%d skipped_lines=%d duplicates=%d warnings=%d elapsed_ms=%d severity=%s\n",
+		s.Files, s.Converted, s.Failed, s.Messages, s.Signals, s.SkippedLines, s.Duplicates, s.Warnings, s.ElapsedMS, s.Severity)
+	return err
+}
+
+// countWritten sets the number of messages and signals in messages.
+func (s *FileStats) countWritten(messages map[uint32]*Message) {
+	s.Messages = len(messages)
+	s.Signals = 0
+	for _, msg := range messages {
+		s.Signals += len(msg.Signals)
+	}
+}
@@ -0,0 +1,107 @@
+package refdbc
+
+import (
+	"sort"
+	"strings"
+)
+
+// SortOrders lists the accepted values of the -sort flag.
+var SortOrders = []string{"id", "name", "source"}
+
+// IsValidSortOrder reports whether order is one of SortOrders.
+func IsValidSortOrder(order string) bool {
+	for _, o := range SortOrders {
+		if o == order {
+			return true
+		}
+	}
+	return false
+}
+
+// Indents lists the accepted values of the -indent flag.
+var Indents = []string{"space", "tab"}
+
+// IsValidIndent reports whether indent is one of Indents.
+func IsValidIndent(indent string) bool {
+	for _, i := range Indents {
+		if i == indent {
+			return true
+		}
+	}
+	return false
+}
+
+// LineEndings lists the accepted values of the -line-endings flag.
+var LineEndings = []string{"lf", "crlf"}
+
+// IsValidLineEnding reports whether ending is one of LineEndings.
+func IsValidLineEnding(ending string) bool {
+	for _, e := range LineEndings {
+		if e == ending {
+			return true
+		}
+	}
+	return false
+}
+
+// ReceiverSeparators lists the accepted values of the -receiver-separator flag.
+var ReceiverSeparators = []string{"comma", "comma-space", "space"}
+
+// IsValidReceiverSeparator reports whether separator is one of ReceiverSeparators.
+func IsValidReceiverSeparator(separator string) bool {
+	for _, s := range ReceiverSeparators {
+		if s == separator {
+			return true
+		}
+	}
+	return false
+}
+
+// orderedMessageIDs returns the IDs of the messages in the order DBC output
+// lists them with opts.SortOrder: by ID (the default), by name, or in the
+// order the messages first appear in the source file. Messages that weren't
+// read from a .ref file come last in source order, by ID.
+func orderedMessageIDs(messages map[uint32]*Message, opts Options) []uint32 {
+	ids := sortedMessageIDs(messages)
+	switch opts.SortOrder {
+	case "name":
+		sort.SliceStable(ids, func(i, j int) bool { return messages[ids[i]].Name < messages[ids[j]].Name })
+	case "source":
+		first := make(map[uint32]position, len(ids))
+		for _, id := range ids {
+			for _, sig := range messages[id].Signals {
+				if sig.pos.Entry > 0 && (first[id].Entry == 0 || sig.pos.before(first[id])) {
+					first[id] = sig.pos
+				}
+			}
+		}
+		sort.SliceStable(ids, func(i, j int) bool {
+			a, b := first[ids[i]], first[ids[j]]
+			if a.Entry == 0 || b.Entry == 0 {
+				return a.Entry != 0 && b.Entry == 0
+			}
+			return a.before(b)
+		})
+	}
+	return ids
+}
+
+// signalIndent returns the indentation of SG_ lines for opts.Indent.
+func signalIndent(opts Options) string {
+	if opts.Indent == "tab" {
+		return "\t"
+	}
+	return " "
+}
+
+// joinReceivers writes the receiver list of an SG_ line with
+// opts.ReceiverSeparator.
+func joinReceivers(receivers []string, opts Options) string {
+	switch opts.ReceiverSeparator {
+	case "comma-space":
+		return strings.Join(receivers, ", ")
+	case "space":
+		return strings.Join(receivers, " ")
+	}
+	return strings.Join(receivers, ",")
+}
@@ -0,0 +1,126 @@
+package refdbc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// symValueTypes names the SIG_VALTYPE_ values as PCAN Symbol types.
+var symValueTypes = [...]string{"", "float", "double"}
+
+// writeSYM writes the messages as a PCAN Symbol Editor (.sym, format version
+// 6.0) file. The direction of the messages isn't known, so they are all
+// listed under {SENDRECEIVE}. Comments are written after each line.
+//
+// A multiplexed message is written as one section per multiplexor value,
+// each naming the multiplexor and its value in a Mux= line and listing the
+// signals of that value after the signals present in every frame. Messages
+// whose multiplexing has no single multiplexor are an error.
+//
+// Like KCD, the format numbers bits sequentially, so the start of a Motorola
+// signal is its DBC start bit s converted with 8*(s/8) + 7 - s%8, followed by
+// the -m flag.
+func writeSYM(messages map[uint32]*Message, w io.Writer, opts Options) error {
+	title := opts.Source
+	if title == "" {
+		title = "racelogic-ref-to-dbc"
+	}
+	fmt.Fprintf(w, "FormatVersion=6.0 // Do not edit this line!\n")
+	fmt.Fprintf(w, "Title=\"%s\"\n\n", strings.ReplaceAll(title, `"`, `'`))
+	fmt.Fprintf(w, "{SENDRECEIVE}\n")
+
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		multiplexor, err := messageMultiplexor(msg)
+		if err != nil {
+			return err
+		}
+		if multiplexor == nil {
+			writeSYMSection(w, msg)
+			for _, sig := range msg.Signals {
+				writeSYMVar(w, sig, opts)
+			}
+			continue
+		}
+		for _, value := range muxValues(msg) {
+			writeSYMSection(w, msg)
+			start, order := symStartBit(multiplexor)
+			fmt.Fprintf(w, "Mux=%s %d,%d %d%s%s\n", multiplexor.Name, start, multiplexor.Length, value, order, symComment(multiplexor.Comment))
+			for _, sig := range msg.Signals {
+				if sig.MuxRole == muxNone || sig.MuxRole == muxMultiplexed && sig.MuxValue == value {
+					writeSYMVar(w, sig, opts)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeSYMSection writes the header of a section of msg: its name, ID,
+// length and cycle time.
+func writeSYMSection(w io.Writer, msg *Message) {
+	fmt.Fprintf(w, "\n[%s]%s\n", msg.Name, symComment(msg.Comment))
+	if msg.IsExtended {
+		fmt.Fprintf(w, "Type=Extended\n")
+		fmt.Fprintf(w, "ID=%08Xh\n", msg.ID)
+	} else {
+		fmt.Fprintf(w, "ID=%03Xh\n", msg.ID)
+	}
+	fmt.Fprintf(w, "Len=%d\n", msg.DLC)
+	if msg.CycleTime > 0 {
+		fmt.Fprintf(w, "CycleTime=%d\n", msg.CycleTime)
+	}
+}
+
+// writeSYMVar writes the Var= line of sig.
+func writeSYMVar(w io.Writer, sig *Signal, opts Options) {
+	signType := "unsigned"
+	switch {
+	case sig.ValueType != 0:
+		signType = symValueTypes[sig.ValueType]
+	case sig.IsSigned:
+		signType = "signed"
+	}
+	start, order := symStartBit(sig)
+	fmt.Fprintf(w, "Var=%s %s %d,%d%s", sig.Name, signType, start, sig.Length, order)
+	if sig.Unit != "" {
+		fmt.Fprintf(w, " /u:%s", symUnit(sig.Unit))
+	}
+	if sig.Factor != 1 {
+		fmt.Fprintf(w, " /f:%s", formatFloat(sig.Factor, opts))
+	}
+	if sig.Offset != 0 {
+		fmt.Fprintf(w, " /o:%s", formatFloat(sig.Offset, opts))
+	}
+	if sig.Min != 0 || sig.Max != 0 {
+		fmt.Fprintf(w, " /min:%s /max:%s", formatFloat(sig.Min, opts), formatFloat(sig.Max, opts))
+	}
+	fmt.Fprintf(w, "%s\n", symComment(sig.Comment))
+}
+
+// symStartBit returns the start of sig in the format's sequential numbering,
+// and the flag marking a Motorola signal.
+func symStartBit(sig *Signal) (start int, order string) {
+	if sig.ByteOrder == 0 {
+		return sequentialToDBC(sig.StartBit), " -m"
+	}
+	return sig.StartBit, ""
+}
+
+// symUnit quotes a unit containing spaces, which would otherwise end the value.
+func symUnit(unit string) string {
+	if strings.ContainsAny(unit, " \t") {
+		return `"` + strings.ReplaceAll(unit, `"`, `'`) + `"`
+	}
+	return unit
+}
+
+// symComment returns a comment for the end of a line, with any line breaks
+// replaced so it stays on that line, or an empty string when there is none.
+func symComment(comment string) string {
+	if comment == "" {
+		return ""
+	}
+	return " // " + strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(comment)
+}
@@ -0,0 +1,9 @@
+package refdbc
+
+import "syscall"
+
+// The ioctl requests reading and setting the terminal mode.
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
@@ -0,0 +1,19 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package refdbc
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw reports that raw mode isn't supported on this system, so
+// BrowseTerminal falls back to Browse.
+func makeRaw(f *os.File) (restore func(), err error) {
+	return nil, errors.New("raw terminal mode is not supported on this system")
+}
+
+// terminalSize reports that the size of the terminal isn't known.
+func terminalSize(f *os.File) (width, height int, ok bool) {
+	return 0, 0, false
+}
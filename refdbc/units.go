@@ -0,0 +1,186 @@
+package refdbc
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// UnitConversion maps a source unit to its canonical form. A physical value v
+// in the source unit becomes v*Scale + Shift in the canonical unit.
+type UnitConversion struct {
+	To    string
+	Scale float64
+	Shift float64
+}
+
+// unitConversions is keyed by the lower-case source unit. Extend this table to
+// support more units; identity entries only rewrite the spelling.
+var unitConversions = map[string]UnitConversion{
+	// Speed
+	"kmh":   {To: "km/h", Scale: 1},
+	"kph":   {To: "km/h", Scale: 1},
+	"km/hr": {To: "km/h", Scale: 1},
+	"mph":   {To: "km/h", Scale: 1.609344},
+	"knots": {To: "km/h", Scale: 1.852},
+	"kts":   {To: "km/h", Scale: 1.852},
+	"ft/s":  {To: "m/s", Scale: 0.3048},
+	// Acceleration
+	"g":      {To: "m/s^2", Scale: 9.80665},
+	"m/s/s":  {To: "m/s^2", Scale: 1},
+	"m/s2":   {To: "m/s^2", Scale: 1},
+	"m/s²":   {To: "m/s^2", Scale: 1},
+	"ft/s/s": {To: "m/s^2", Scale: 0.3048},
+	// Distance
+	"ft":    {To: "m", Scale: 0.3048},
+	"feet":  {To: "m", Scale: 0.3048},
+	"miles": {To: "km", Scale: 1.609344},
+	"mi":    {To: "km", Scale: 1.609344},
+	// Angles and angular rate
+	"deg":       {To: "deg", Scale: 1},
+	"degrees":   {To: "deg", Scale: 1},
+	"°":         {To: "deg", Scale: 1},
+	"deg/sec":   {To: "deg/s", Scale: 1},
+	"degrees/s": {To: "deg/s", Scale: 1},
+	"°/s":       {To: "deg/s", Scale: 1},
+	// Temperature
+	"degf": {To: "degC", Scale: 5.0 / 9.0, Shift: -32 * 5.0 / 9.0},
+	"°f":   {To: "degC", Scale: 5.0 / 9.0, Shift: -32 * 5.0 / 9.0},
+	"degc": {To: "degC", Scale: 1},
+	"°c":   {To: "degC", Scale: 1},
+	// Pressure
+	"psi":  {To: "kPa", Scale: 6.894757},
+	"bar":  {To: "kPa", Scale: 100},
+	"mbar": {To: "kPa", Scale: 0.1},
+}
+
+// unitEntry is one unit of a units file given as a mapping, before validation.
+type unitEntry struct {
+	To    string   `json:"to"`
+	Scale *float64 `json:"scale"`
+	Shift float64  `json:"shift"`
+}
+
+// LoadUnits reads a JSON file mapping units to the ones to write instead,
+// keyed by the unit as found in .ref files. A string only changes the
+// spelling; a mapping can also convert the values, with the same meaning as
+// the fields of UnitConversion:
+//
+//	{
+//	  "kmh": "km/h",
+//	  "mph": {"to": "km/h", "scale": 1.609344}
+//	}
+//
+// Files ending in .yaml or .yml are read as YAML with the same structure.
+// Units are matched without regard to case, so the returned map is keyed by
+// lower-case unit.
+func LoadUnits(path string) (map[string]UnitConversion, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open units file: %w", err)
+	}
+	if IsYAMLFile(path) {
+		doc, err := ParseYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("units file %s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("units file %s: %w", path, err)
+		}
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("units file %s: %w", path, err)
+	}
+	units := make(map[string]UnitConversion, len(raw))
+	for _, unit := range sortedKeys(raw) {
+		conv, err := decodeUnitConversion(raw[unit])
+		if err != nil {
+			return nil, fmt.Errorf("units file %s: unit '%s': %w", path, unit, err)
+		}
+		key := strings.ToLower(strings.TrimSpace(unit))
+		if _, ok := units[key]; ok {
+			return nil, fmt.Errorf("units file %s: unit '%s' is listed more than once", path, unit)
+		}
+		units[key] = conv
+	}
+	return units, nil
+}
+
+// decodeUnitConversion validates the value of a units file entry.
+func decodeUnitConversion(data json.RawMessage) (UnitConversion, error) {
+	var to string
+	if err := json.Unmarshal(data, &to); err == nil {
+		return UnitConversion{To: to, Scale: 1}, nil
+	}
+	var entry unitEntry
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&entry); err != nil {
+		return UnitConversion{}, fmt.Errorf("expected a unit or a mapping of to, scale and shift: %w", err)
+	}
+	conv := UnitConversion{To: entry.To, Scale: 1, Shift: entry.Shift}
+	if entry.Scale != nil {
+		conv.Scale = *entry.Scale
+	}
+	if conv.Scale == 0 {
+		return conv, fmt.Errorf("scale must not be 0")
+	}
+	return conv, nil
+}
+
+// lookupUnit returns the conversion of unit from opts.Units, or from the
+// built-in table with opts.NormalizeUnits.
+func lookupUnit(unit string, opts Options) (UnitConversion, bool) {
+	key := strings.ToLower(unit)
+	if conv, ok := opts.Units[key]; ok {
+		return conv, true
+	}
+	if opts.NormalizeUnits {
+		conv, ok := unitConversions[key]
+		return conv, ok
+	}
+	return UnitConversion{}, false
+}
+
+// normalizeUnits rewrites recognized units to their canonical form and rescales
+// the signal's factor, offset and range so decoded values stay correct.
+// Units in opts.Units take precedence over the built-in table, which is only
+// used with opts.NormalizeUnits. Unrecognized units are left untouched, and
+// so is a 0/0 range, which means the signal has none.
+func normalizeUnits(messages map[uint32]*Message, opts Options) {
+	if !opts.NormalizeUnits && len(opts.Units) == 0 {
+		return
+	}
+	for _, id := range sortedMessageIDs(messages) {
+		for _, sig := range messages[id].Signals {
+			if sig.Unit == "" {
+				continue
+			}
+			conv, ok := lookupUnit(sig.Unit, opts)
+			if !ok {
+				opts.Log.Debugf("unit '%s' of signal %s in message %d is not recognized; leaving it unchanged", sig.Unit, sig.Name, id)
+				continue
+			}
+			if conv.To == sig.Unit && conv.Scale == 1 && conv.Shift == 0 {
+				continue
+			}
+
+			opts.Log.Debugf("normalizing unit of signal %s in message %d: %s -> %s", sig.Name, id, sig.Unit, conv.To)
+			sig.Unit = conv.To
+			sig.Factor *= conv.Scale
+			sig.Offset = sig.Offset*conv.Scale + conv.Shift
+			if sig.Min == 0 && sig.Max == 0 {
+				continue
+			}
+			sig.Min = sig.Min*conv.Scale + conv.Shift
+			sig.Max = sig.Max*conv.Scale + conv.Shift
+			if sig.Min > sig.Max {
+				// A negative scale reverses the range.
+				sig.Min, sig.Max = sig.Max, sig.Min
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package refdbc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalizeUnitsRange(t *testing.T) {
+	tests := []struct {
+		name             string
+		min, max         float64
+		wantMin, wantMax float64
+	}{
+		{"no range", 0, 0, 0, 0},
+		{"range", 32, 212, 0, 100},
+		{"range from zero", 0, 212, -160.0 / 9, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig := &Signal{Name: "Oil_Temp", Unit: "degF", Factor: 1, Min: tt.min, Max: tt.max}
+			messages := map[uint32]*Message{0x100: {ID: 0x100, Signals: []*Signal{sig}}}
+			opts := DefaultOptions()
+			opts.NormalizeUnits = true
+			normalizeUnits(messages, opts)
+			if sig.Unit != "degC" {
+				t.Errorf("unit = %q, want degC", sig.Unit)
+			}
+			if math.Abs(sig.Min-tt.wantMin) > 1e-9 || math.Abs(sig.Max-tt.wantMax) > 1e-9 {
+				t.Errorf("range = [%g|%g], want [%g|%g]", sig.Min, sig.Max, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
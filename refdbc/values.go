@@ -0,0 +1,127 @@
+package refdbc
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// valueTableSeparator separates the entries of a value table column, as the
+// field delimiter is already taken.
+const valueTableSeparator = "|"
+
+// parseValueTable parses a value table column of the form `0=Off|1=On|2=Error`.
+// Values may be decimal or 0x-prefixed hex. The result is sorted by value.
+func parseValueTable(text string) ([]ValueDescription, error) {
+	var table []ValueDescription
+	seen := make(map[int64]bool)
+	for _, entry := range strings.Split(text, valueTableSeparator) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		valueText, label, found := strings.Cut(entry, "=")
+		label = strings.TrimSpace(label)
+		if !found || label == "" {
+			return nil, fmt.Errorf("expected 'value=label' but got '%s'", entry)
+		}
+		value, err := strconv.ParseInt(strings.TrimSpace(valueText), 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value '%s' in '%s'", strings.TrimSpace(valueText), entry)
+		}
+		if seen[value] {
+			return nil, fmt.Errorf("value %d is labelled more than once", value)
+		}
+		seen[value] = true
+		table = append(table, ValueDescription{Value: value, Label: label})
+	}
+	sortValueTable(table)
+	return table, nil
+}
+
+// formatValueTable is the inverse of parseValueTable.
+func formatValueTable(table []ValueDescription) string {
+	entries := make([]string, len(table))
+	for i, vd := range table {
+		entries[i] = fmt.Sprintf("%d=%s", vd.Value, vd.Label)
+	}
+	return strings.Join(entries, valueTableSeparator)
+}
+
+// mergeValueTable returns table with the entries of additions added, replacing
+// the label of any value already present.
+func mergeValueTable(table, additions []ValueDescription) []ValueDescription {
+	merged := make(map[int64]string, len(table)+len(additions))
+	for _, vd := range table {
+		merged[vd.Value] = vd.Label
+	}
+	for _, vd := range additions {
+		merged[vd.Value] = vd.Label
+	}
+	result := make([]ValueDescription, 0, len(merged))
+	for value, label := range merged {
+		result = append(result, ValueDescription{Value: value, Label: label})
+	}
+	sortValueTable(result)
+	return result
+}
+
+// sortValueTable sorts a value table by value.
+func sortValueTable(table []ValueDescription) {
+	sort.Slice(table, func(i, j int) bool { return table[i].Value < table[j].Value })
+}
+
+// equalValueTables reports whether two value tables hold the same entries.
+func equalValueTables(a, b []ValueDescription) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeValueTables writes a VAL_ line for every signal with a value table,
+// taking the messages in the order of ids.
+func writeValueTables(messages map[uint32]*Message, ids []uint32, w *bufio.Writer) {
+	for _, id := range ids {
+		msg := messages[id]
+		for _, sig := range msg.Signals {
+			if len(sig.ValueTable) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "VAL_ %d %s", msg.dbcID(), sig.Name)
+			for _, vd := range sig.ValueTable {
+				fmt.Fprintf(w, " %d \"%s\"", vd.Value, escapeDBCString(vd.Label))
+			}
+			w.WriteString(" ;\n")
+		}
+	}
+}
+
+// valLineRe matches a VAL_ line of a signal: message ID, signal name and the
+// value/label pairs. valEntryRe matches one of the pairs.
+var (
+	valLineRe  = regexp.MustCompile(`^VAL_\s+(\d+)\s+(\S+)\s+(.*?)\s*;$`)
+	valEntryRe = regexp.MustCompile(`(-?\d+)\s+"((?:[^"\\]|\\.)*)"`)
+)
+
+// parseValueDescriptions parses the value/label pairs of a VAL_ line.
+func parseValueDescriptions(text string) ([]ValueDescription, error) {
+	var table []ValueDescription
+	for _, m := range valEntryRe.FindAllStringSubmatch(text, -1) {
+		value, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value '%s'", m[1])
+		}
+		table = append(table, ValueDescription{Value: value, Label: unescapeDBCString(m[2])})
+	}
+	sortValueTable(table)
+	return table, nil
+}
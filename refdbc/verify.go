@@ -0,0 +1,70 @@
+package refdbc
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// verifyDBC reads back DBC output with the internal DBC reader and compares it
+// with the messages it was written from, so nothing is silently lost in
+// formatting: message IDs, names, DLCs, frame formats and cycle times, and each
+// signal's bit layout, signedness, value type, scaling, range and unit.
+// Comments are not compared, since -annotate and -comments full extend them.
+func verifyDBC(messages map[uint32]*Message, data []byte) error {
+	readBack, err := readDBC(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("verification failed: the DBC output can't be read back: %w", err)
+	}
+
+	var problems []string
+	for _, id := range sortedMessageIDs(messages) {
+		msg := messages[id]
+		got, ok := readBack[id]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("message %d is missing", id))
+			continue
+		}
+		if got.Name != msg.Name {
+			problems = append(problems, fmt.Sprintf("message %d is named %s instead of %s", id, got.Name, msg.Name))
+		}
+		if got.DLC != msg.DLC {
+			problems = append(problems, fmt.Sprintf("message %d has DLC %d instead of %d", id, got.DLC, msg.DLC))
+		}
+		if got.IsExtended != msg.IsExtended {
+			problems = append(problems, fmt.Sprintf("message %d is a %s frame instead of %s", id, frameName(got.IsExtended), frameName(msg.IsExtended)))
+		}
+		if got.CycleTime != msg.CycleTime {
+			problems = append(problems, fmt.Sprintf("message %d has cycle time %d ms instead of %d ms", id, got.CycleTime, msg.CycleTime))
+		}
+		if len(got.Signals) != len(msg.Signals) {
+			problems = append(problems, fmt.Sprintf("message %d has %d signals instead of %d", id, len(got.Signals), len(msg.Signals)))
+		}
+		// Signals are matched by position, as a name may be used twice.
+		for i, sig := range msg.Signals {
+			if i >= len(got.Signals) {
+				break
+			}
+			back := got.Signals[i]
+			if back.Name != sig.Name {
+				problems = append(problems, fmt.Sprintf("signal %s of message %d is named %s", sig.Name, id, back.Name))
+				continue
+			}
+			expected := *sig
+			expected.Comment = back.Comment
+			if changes := diffSignal(&expected, back, nil); len(changes) > 0 {
+				problems = append(problems, fmt.Sprintf("signal %s of message %d changed: %s", sig.Name, id, strings.Join(changes, ", ")))
+			}
+		}
+	}
+	for _, id := range sortedMessageIDs(readBack) {
+		if _, ok := messages[id]; !ok {
+			problems = append(problems, fmt.Sprintf("unexpected message %d", id))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("verification failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
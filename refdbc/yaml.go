@@ -0,0 +1,191 @@
+package refdbc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is one non-blank, non-comment line of a YAML file.
+type yamlLine struct {
+	num    int    // 1-based line number
+	indent int    // Number of leading spaces
+	text   string // Line content without indentation or trailing comment
+}
+
+// ParseYAML decodes the subset of YAML used by mapping and configuration
+// files: nested block mappings of `key: value` pairs, indented with spaces,
+// whose values are plain, single-quoted or double-quoted scalars. Sequences,
+// flow collections, anchors and multi-line strings are rejected. Plain scalars
+// that are valid JSON numbers become float64, true and false become bool, and
+// null, ~ and empty values become nil; everything else is a string.
+func ParseYAML(data []byte) (map[string]interface{}, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		content := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(content, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		content = strings.TrimSpace(stripYAMLComment(content))
+		if content == "" || content == "---" {
+			continue
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(raw) - len(strings.TrimLeft(raw, " ")), text: content})
+	}
+	if len(lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	pos := 0
+	result, err := parseYAMLMapping(lines, &pos, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if pos < len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[pos].num)
+	}
+	return result, nil
+}
+
+// parseYAMLMapping reads the block mapping whose keys start at the given
+// indentation, beginning at lines[*pos], and advances *pos past it.
+func parseYAMLMapping(lines []yamlLine, pos *int, indent int) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	for *pos < len(lines) {
+		line := lines[*pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+		}
+		if strings.HasPrefix(line.text, "- ") || line.text == "-" {
+			return nil, fmt.Errorf("line %d: lists are not supported", line.num)
+		}
+
+		key, rest, err := splitYAMLKey(line.text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line.num, err)
+		}
+		if _, exists := result[key]; exists {
+			return nil, fmt.Errorf("line %d: duplicate key '%s'", line.num, key)
+		}
+		*pos++
+
+		if rest == "" && *pos < len(lines) && lines[*pos].indent > indent {
+			value, err := parseYAMLMapping(lines, pos, lines[*pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = value
+			continue
+		}
+		value, err := parseYAMLScalar(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line.num, err)
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+// splitYAMLKey splits `key: value` into its unquoted key and the raw value.
+func splitYAMLKey(text string) (string, string, error) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end := quotedYAMLEnd(text)
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string: %s", text)
+		}
+		key, err := parseYAMLScalar(text[:end+1])
+		if err != nil {
+			return "", "", err
+		}
+		rest := strings.TrimSpace(text[end+1:])
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", fmt.Errorf("expected 'key: value': %s", text)
+		}
+		return key.(string), strings.TrimSpace(rest[1:]), nil
+	}
+
+	if strings.HasSuffix(text, ":") {
+		return strings.TrimSpace(text[:len(text)-1]), "", nil
+	}
+	key, rest, found := strings.Cut(text, ": ")
+	if !found || strings.TrimSpace(key) == "" {
+		return "", "", fmt.Errorf("expected 'key: value': %s", text)
+	}
+	return strings.TrimSpace(key), strings.TrimSpace(rest), nil
+}
+
+// parseYAMLScalar converts a single YAML scalar to a Go value.
+func parseYAMLScalar(raw string) (interface{}, error) {
+	switch {
+	case raw == "" || raw == "~" || raw == "null":
+		return nil, nil
+	case raw == "true" || raw == "false":
+		return raw == "true", nil
+	case strings.HasPrefix(raw, `"`) || strings.HasPrefix(raw, "'"):
+		end := quotedYAMLEnd(raw)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string: %s", raw)
+		}
+		if end != len(raw)-1 {
+			return nil, fmt.Errorf("unexpected text after string: %s", raw[end+1:])
+		}
+		if raw[0] == '\'' {
+			return strings.ReplaceAll(raw[1:end], "''", "'"), nil
+		}
+		return strconv.Unquote(raw)
+	case strings.ContainsAny(raw[:1], "[{&*|>!%@`"):
+		return nil, fmt.Errorf("unsupported value: %s", raw)
+	}
+
+	var number float64
+	if json.Unmarshal([]byte(raw), &number) == nil {
+		return number, nil
+	}
+	return raw, nil
+}
+
+// quotedYAMLEnd returns the index of the quote that closes the string at the
+// start of s, or -1 if it is unterminated. Double-quoted strings honour
+// backslash escapes; in single-quoted strings a doubled quote is a literal one.
+func quotedYAMLEnd(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote && quote == '\'' && i+1 < len(s) && s[i+1] == '\'':
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// stripYAMLComment removes a comment, which starts with a # at the beginning
+// of the line or after whitespace, outside of quoted strings.
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if (quote == '"' && c == '\\') || (quote == '\'' && c == '\'' && i+1 < len(s) && s[i+1] == '\'') {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || s[i-1] == ' ' || s[i-1] == ':' {
+				quote = c
+			}
+		case c == '#' && (i == 0 || s[i-1] == ' '):
+			return s[:i]
+		}
+	}
+	return s
+}